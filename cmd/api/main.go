@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -8,9 +9,12 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // Market calendar time zones, for images without a zoneinfo database
 
 	"github.com/gorilla/mux"
 	_ "github.com/dgrijalva/jwt-go"     // Used indirectly
@@ -21,6 +25,7 @@ import (
 	"officestonks/internal/repository"
 	"officestonks/internal/services"
 	"officestonks/internal/websocket"
+	"officestonks/pkg/market"
 )
 
 func main() {
@@ -73,16 +78,84 @@ func main() {
 	stockRepo := repository.NewStockRepo(db)
 	portfolioRepo := repository.NewPortfolioRepo(db)
 	transactionRepo := repository.NewTransactionRepo(db)
+	orderRepo := repository.NewOrderRepo(db)
+	lotRepo := repository.NewTaxLotRepo(db)
+	shortRepo := repository.NewShortPositionRepo(db)
+	feeRepo := repository.NewFeeScheduleRepo(db)
+	txRunner := repository.NewTxRunner(db)
 	chatRepo := repository.NewChatRepo(db)
+	historyRepo := repository.NewPriceHistoryRepo(db)
+	modelRepo := repository.NewPriceModelRepo(db)
+	stateRepo := repository.NewSimulatorStateRepo(db)
+	eventRepo := repository.NewMarketEventRepo(db)
+	actionRepo := repository.NewCorporateActionRepo(db)
+	ipoRepo := repository.NewIPORepo(db)
+	fundamentalsRepo := repository.NewFundamentalsRepo(db)
+	indexRepo := repository.NewIndexRepo(db)
+	etfRepo := repository.NewETFRepo(db)
+	optionRepo := repository.NewOptionRepo(db)
+	ledgerRepo := repository.NewLedgerRepo(db)
 
 	// Create services
 	authService := services.NewAuthService(userRepo)
-	marketService := services.NewMarketService(stockRepo, userRepo, portfolioRepo, transactionRepo)
+	marketService := services.NewMarketService(services.MarketDeps{
+		StockRepo:        stockRepo,
+		UserRepo:         userRepo,
+		PortfolioRepo:    portfolioRepo,
+		TransactionRepo:  transactionRepo,
+		OrderRepo:        orderRepo,
+		LotRepo:          lotRepo,
+		ShortRepo:        shortRepo,
+		FeeRepo:          feeRepo,
+		ModelRepo:        modelRepo,
+		StateRepo:        stateRepo,
+		ActionRepo:       actionRepo,
+		HistoryRepo:      historyRepo,
+		IPORepo:          ipoRepo,
+		FundamentalsRepo: fundamentalsRepo,
+		IndexRepo:        indexRepo,
+		ETFRepo:          etfRepo,
+		OptionRepo:       optionRepo,
+		LedgerRepo:       ledgerRepo,
+		TxRunner:         txRunner,
+	})
+	marketService.SetShortConfig(getShortConfig())
+	marketService.SetMarginConfig(getMarginConfig())
+	if seed, err := strconv.ParseInt(os.Getenv("SIMULATOR_SEED"), 10, 64); err == nil {
+		log.Printf("Using simulator seed %d", seed)
+		marketService.SetSimulatorSeed(seed)
+	}
+	marketService.SetFactorConfig(getFactorConfig())
+	marketService.SetCalendar(getCalendar())
+	marketService.SetHaltConfig(getHaltConfig())
+	if err := marketService.SetFlowConfig(getFlowConfig()); err != nil {
+		log.Printf("Invalid volume settings, using the defaults: %v", err)
+	}
+	marketService.SetCorporateActionConfig(getCorporateActionConfig())
+	marketService.SetIPOConfig(getIPOConfig())
+	marketService.SetFundamentalsConfig(getFundamentalsConfig())
+	if err := marketService.SetOptionsConfig(getOptionsConfig()); err != nil {
+		log.Printf("Invalid options settings, using the defaults: %v", err)
+	}
+	if err := marketService.SetFractionalConfig(getFractionalConfig()); err != nil {
+		log.Printf("Invalid fractional share settings, using the defaults: %v", err)
+	}
+	if err := marketService.SetEarningsConfig(getEarningsConfig()); err != nil {
+		log.Printf("Invalid earnings settings, using the defaults: %v", err)
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SIMULATOR_SNAPSHOT_INTERVAL")); err == nil && interval > 0 {
+		marketService.SetSnapshotInterval(interval)
+	}
 	userService := services.NewUserService(userRepo, portfolioRepo)
+	historyService := services.NewPriceHistoryService(historyRepo, stockRepo, getPriceHistoryConfig())
 
 	// Create websocket hub and initiate market simulator
 	wsHub := websocket.NewHub(marketService.GetSimulatorUpdates())
 	go wsHub.Run()
+	marketService.SetHub(wsHub)
+
+	// Record every price update for the candle history
+	historyService.Start(marketService.SubscribeUpdates())
 
 	// Initialize the market simulator after setting up the hub
 	if err := marketService.InitializeSimulator(); err != nil {
@@ -92,15 +165,21 @@ func main() {
 	// Create chat service with the websocket hub
 	chatService := services.NewChatService(chatRepo, userRepo, wsHub)
 
+	// Create the news service, which makes up news that moves the simulated prices
+	newsService := services.NewNewsService(eventRepo, stockRepo, marketService, wsHub, getNewsConfig())
+	newsService.Start()
+
 	// Create websocket handler
 	wsHandler := websocket.NewWebSocketHandler(wsHub)
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	marketHandler := handlers.NewMarketHandler(marketService)
+	historyHandler := handlers.NewHistoryHandler(historyService)
 	userHandler := handlers.NewUserHandler(userService)
 	chatHandler := handlers.NewChatHandler(chatService)
-	adminHandler := handlers.NewAdminHandler(userRepo, stockRepo, chatRepo)
+	newsHandler := handlers.NewNewsHandler(newsService)
+	adminHandler := handlers.NewAdminHandler(userRepo, stockRepo, chatRepo, feeRepo, marketService)
 
 	// Create middleware
 	authMiddleware := middleware.NewAuthMiddleware(authService)
@@ -133,6 +212,21 @@ func main() {
 	// Public market routes
 	apiRouter.HandleFunc("/stocks", marketHandler.GetAllStocks).Methods("GET", "OPTIONS")
 	apiRouter.HandleFunc("/stocks/{id}", marketHandler.GetStockByID).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/stocks/{id:[0-9]+}/candles", historyHandler.GetCandles).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/stocks/{id:[0-9]+}/fundamentals", marketHandler.GetFundamentals).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/stocks/{id:[0-9]+}/earnings", marketHandler.GetEarnings).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/stocks/{id:[0-9]+}/options", marketHandler.GetOptionChain).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/fees", marketHandler.GetFeeSchedule).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/news", newsHandler.GetNews).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/market/status", marketHandler.GetMarketStatus).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/halts", marketHandler.GetHalts).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/indices", marketHandler.GetIndices).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/indices/{code}/history", marketHandler.GetIndexHistory).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/corporate-actions", marketHandler.GetCorporateActions).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/ipos", marketHandler.GetIPOs).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/etfs", marketHandler.GetETFs).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/etfs/{id:[0-9]+}", marketHandler.GetETF).Methods("GET", "OPTIONS")
+	apiRouter.HandleFunc("/ipos/{id:[0-9]+}", marketHandler.GetIPO).Methods("GET", "OPTIONS")
 
 	// Public user routes
 	apiRouter.HandleFunc("/users/leaderboard", userHandler.GetLeaderboard).Methods("GET", "OPTIONS")
@@ -143,8 +237,18 @@ func main() {
 
 	// Protected market routes
 	protectedRouter.HandleFunc("/portfolio", marketHandler.GetUserPortfolio).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/portfolio/benchmark", marketHandler.GetBenchmark).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/portfolio/lots", marketHandler.GetTaxLots).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/portfolio/cost-basis", marketHandler.SetCostBasisMethod).Methods("PUT", "OPTIONS")
 	protectedRouter.HandleFunc("/trading", marketHandler.TradeStock).Methods("POST", "OPTIONS")
 	protectedRouter.HandleFunc("/transactions", marketHandler.GetTransactionHistory).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/orders", marketHandler.GetOrders).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/orders/{id:[0-9]+}", marketHandler.CancelOrder).Methods("DELETE", "OPTIONS")
+	protectedRouter.HandleFunc("/margin", marketHandler.SetMarginAccount).Methods("POST", "OPTIONS")
+	protectedRouter.HandleFunc("/margin/repay", marketHandler.RepayLoan).Methods("POST", "OPTIONS")
+	protectedRouter.HandleFunc("/ipos/subscriptions", marketHandler.GetIPOSubscriptions).Methods("GET", "OPTIONS")
+	protectedRouter.HandleFunc("/ipos/{id:[0-9]+}/subscription", marketHandler.SubscribeToIPO).Methods("POST", "OPTIONS")
+	protectedRouter.HandleFunc("/ipos/{id:[0-9]+}/subscription", marketHandler.CancelIPOSubscription).Methods("DELETE", "OPTIONS")
 
 	// Protected user routes
 	protectedRouter.HandleFunc("/users/me", userHandler.GetUserProfile).Methods("GET", "OPTIONS")
@@ -164,13 +268,43 @@ func main() {
 	adminRouter.HandleFunc("/users", adminHandler.GetAllUsers).Methods("GET", "OPTIONS")
 	adminRouter.HandleFunc("/users/{id:[0-9]+}", adminHandler.UpdateUser).Methods("PUT", "OPTIONS")
 	adminRouter.HandleFunc("/users/{id:[0-9]+}", adminHandler.DeleteUser).Methods("DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/users/{id:[0-9]+}/ledger", adminHandler.GetUserLedger).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/reconciliation", adminHandler.GetReconciliation).Methods("GET", "OPTIONS")
 
 	// Admin stock management
 	adminRouter.HandleFunc("/stocks/reset", adminHandler.ResetStockPrices).Methods("GET", "POST", "OPTIONS")
+	adminRouter.HandleFunc("/stocks", adminHandler.GetStocks).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/stocks", adminHandler.CreateStock).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/stocks/{id:[0-9]+}", adminHandler.UpdateStock).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/stocks/{id:[0-9]+}", adminHandler.DelistStock).Methods("DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/ipos", adminHandler.CreateIPO).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/etfs", adminHandler.CreateETF).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/ipos/{id:[0-9]+}", adminHandler.CancelIPO).Methods("DELETE", "OPTIONS")
+
+	// Admin fee schedule management
+	adminRouter.HandleFunc("/fees", adminHandler.GetFeeSchedule).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/fees", adminHandler.UpdateFeeSchedule).Methods("PUT", "OPTIONS")
+
+	// Admin price model routes
+	adminRouter.HandleFunc("/price-models", adminHandler.GetPriceModels).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/stocks/{id:[0-9]+}/price-model", adminHandler.SetStockPriceModel).Methods("PUT", "DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/sectors/{sector}/price-model", adminHandler.SetSectorPriceModel).Methods("PUT", "DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/stocks/{id:[0-9]+}/betas", adminHandler.SetStockBetas).Methods("PUT", "OPTIONS")
+
+	// Admin trading halt routes
+	adminRouter.HandleFunc("/halts/{symbol}", adminHandler.HaltStock).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/halts/{symbol}", adminHandler.ResumeStock).Methods("DELETE", "OPTIONS")
+
+	// Admin corporate action routes
+	adminRouter.HandleFunc("/corporate-actions", adminHandler.DeclareCorporateAction).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/corporate-actions/{id:[0-9]+}", adminHandler.CancelCorporateAction).Methods("DELETE", "OPTIONS")
 
 	// Admin chat management
 	adminRouter.HandleFunc("/chat/clear", adminHandler.ClearAllChats).Methods("GET", "POST", "OPTIONS")
 
+	// Admin news authoring
+	adminRouter.HandleFunc("/news", newsHandler.CreateNews).Methods("POST", "OPTIONS")
+
 	// WebSocket route
 	r.HandleFunc("/ws", wsHandler.HandleConnection)
 
@@ -219,8 +353,28 @@ func main() {
 
 	// Get port from environment variable or use default
 	port := getPort()
-	fmt.Printf("Server starting on port %d...\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), r))
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: r}
+	go func() {
+		fmt.Printf("Server starting on port %d...\n", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Wait for a shutdown signal, then stop taking requests and save the simulator's state
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	if err := marketService.SaveSnapshot(); err != nil {
+		log.Printf("Error saving simulator state: %v", err)
+	}
 }
 
 // Get port from environment or use default 8080
@@ -238,6 +392,300 @@ func getPort() int {
 	return port
 }
 
+// getShortConfig reads the short selling settings from the environment, falling back to the defaults
+func getShortConfig() services.ShortConfig {
+	cfg := services.DefaultShortConfig()
+
+	if rate, err := strconv.ParseFloat(os.Getenv("SHORT_BORROW_FEE_RATE"), 64); err == nil && rate >= 0 {
+		cfg.BorrowFeeRate = rate
+	}
+	if interval, err := time.ParseDuration(os.Getenv("SHORT_FEE_INTERVAL")); err == nil && interval > 0 {
+		cfg.FeeInterval = interval
+	}
+
+	return cfg
+}
+
+// getMarginConfig reads the margin account settings from the environment, falling back to the defaults
+func getMarginConfig() services.MarginConfig {
+	cfg := services.DefaultMarginConfig()
+
+	if leverage, err := strconv.ParseFloat(os.Getenv("MARGIN_MAX_LEVERAGE"), 64); err == nil && leverage >= 1 {
+		cfg.MaxLeverage = leverage
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("MARGIN_INTEREST_RATE"), 64); err == nil && rate >= 0 {
+		cfg.InterestRate = rate
+	}
+	if interval, err := time.ParseDuration(os.Getenv("MARGIN_INTEREST_INTERVAL")); err == nil && interval > 0 {
+		cfg.InterestInterval = interval
+	}
+
+	return cfg
+}
+
+// getFactorConfig reads how much stocks move together from the environment, falling back to the defaults
+func getFactorConfig() market.FactorConfig {
+	cfg := market.DefaultFactorConfig()
+
+	if sigma, err := strconv.ParseFloat(os.Getenv("SIMULATOR_MARKET_SIGMA"), 64); err == nil && sigma >= 0 {
+		cfg.MarketSigma = sigma
+	}
+	if sigma, err := strconv.ParseFloat(os.Getenv("SIMULATOR_SECTOR_SIGMA"), 64); err == nil && sigma >= 0 {
+		cfg.SectorSigma = sigma
+	}
+
+	return cfg
+}
+
+// getCalendar reads the market's trading hours and holidays from the environment, falling back to
+// weekdays 9:30-16:00 New York time. It also returns how many ticks apart prices move while the market is closed.
+func getCalendar() (*market.Calendar, int) {
+	closedEvery := 0
+	if every, err := strconv.Atoi(os.Getenv("MARKET_CLOSED_TICK_EVERY")); err == nil && every >= 0 {
+		closedEvery = every
+	}
+
+	if os.Getenv("MARKET_ALWAYS_OPEN") == "true" {
+		return nil, closedEvery
+	}
+
+	cfg := market.DefaultCalendarConfig()
+	if timezone := os.Getenv("MARKET_TIMEZONE"); timezone != "" {
+		cfg.Timezone = timezone
+	}
+	if open := os.Getenv("MARKET_OPEN"); open != "" {
+		cfg.Open = open
+	}
+	if close := os.Getenv("MARKET_CLOSE"); close != "" {
+		cfg.Close = close
+	}
+	cfg.OpenWeekend = os.Getenv("MARKET_OPEN_WEEKENDS") == "true"
+
+	// Holidays are comma-separated, each a date with an optional early close and name: 2024-12-24@13:00=Christmas Eve
+	for _, entry := range strings.Split(os.Getenv("MARKET_HOLIDAYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var holiday market.Holiday
+		if i := strings.Index(entry, "="); i >= 0 {
+			holiday.Name = strings.TrimSpace(entry[i+1:])
+			entry = entry[:i]
+		}
+		if i := strings.Index(entry, "@"); i >= 0 {
+			holiday.EarlyClose = entry[i+1:]
+			entry = entry[:i]
+		}
+		holiday.Date = entry
+		cfg.Holidays = append(cfg.Holidays, holiday)
+	}
+
+	calendar, err := market.NewCalendar(cfg)
+	if err != nil {
+		log.Printf("Invalid market calendar, using the default: %v", err)
+		calendar, err = market.NewCalendar(market.DefaultCalendarConfig())
+		if err != nil {
+			log.Printf("Default market calendar unavailable, the market will always be open: %v", err)
+			return nil, closedEvery
+		}
+	}
+
+	return calendar, closedEvery
+}
+
+// getHaltConfig reads the price bands and circuit breakers from the environment, falling back to the defaults
+func getHaltConfig() market.HaltConfig {
+	cfg := market.DefaultHaltConfig()
+
+	if percent, err := strconv.ParseFloat(os.Getenv("HALT_BAND_PERCENT"), 64); err == nil && percent >= 0 {
+		cfg.BandPercent = percent
+	}
+	if window, err := time.ParseDuration(os.Getenv("HALT_BAND_WINDOW")); err == nil && window > 0 {
+		cfg.BandWindow = window
+	}
+	if duration, err := time.ParseDuration(os.Getenv("HALT_DURATION")); err == nil && duration > 0 {
+		cfg.HaltDuration = duration
+	}
+	if percent, err := strconv.ParseFloat(os.Getenv("CIRCUIT_BREAKER_DROP_PERCENT"), 64); err == nil && percent >= 0 {
+		cfg.MarketDropPercent = percent
+	}
+	if window, err := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_WINDOW")); err == nil && window > 0 {
+		cfg.MarketWindow = window
+	}
+	if duration, err := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_HALT_DURATION")); err == nil && duration > 0 {
+		cfg.MarketHaltDuration = duration
+	}
+
+	return cfg
+}
+
+// getFlowConfig reads how volume is tracked and how order flow moves prices from the environment,
+// falling back to the defaults
+func getFlowConfig() market.FlowConfig {
+	cfg := market.DefaultFlowConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("VOLUME_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if window, err := time.ParseDuration(os.Getenv("ORDER_FLOW_WINDOW")); err == nil && window > 0 {
+		cfg.FlowWindow = window
+	}
+	if weight, err := strconv.ParseFloat(os.Getenv("ORDER_FLOW_WEIGHT"), 64); err == nil && weight >= 0 {
+		cfg.FlowWeight = weight
+	}
+
+	return cfg
+}
+
+// getCorporateActionConfig reads when corporate actions take effect and which ones the simulator declares
+// from the environment, falling back to the defaults
+func getCorporateActionConfig() services.CorporateActionConfig {
+	cfg := services.DefaultCorporateActionConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("CORPORATE_ACTION_CHECK_INTERVAL")); err == nil && interval > 0 {
+		cfg.CheckInterval = interval
+	}
+	if delay, err := time.ParseDuration(os.Getenv("CORPORATE_ACTION_EX_DELAY")); err == nil && delay >= 0 {
+		cfg.ExDelay = delay
+	}
+	if delay, err := time.ParseDuration(os.Getenv("DIVIDEND_PAY_DELAY")); err == nil && delay >= 0 {
+		cfg.PayDelay = delay
+	}
+	if chance, err := strconv.ParseFloat(os.Getenv("DIVIDEND_CHANCE"), 64); err == nil && chance >= 0 && chance <= 1 {
+		cfg.DividendChance = chance
+	}
+	if yield, err := strconv.ParseFloat(os.Getenv("DIVIDEND_YIELD"), 64); err == nil && yield > 0 {
+		cfg.DividendYield = yield
+	}
+	if price, err := strconv.ParseFloat(os.Getenv("SPLIT_ABOVE_PRICE"), 64); err == nil && price >= 0 {
+		cfg.SplitAbove = price
+	}
+	if price, err := strconv.ParseFloat(os.Getenv("REVERSE_SPLIT_BELOW_PRICE"), 64); err == nil && price >= 0 {
+		cfg.ReverseSplitBelow = price
+	}
+
+	return cfg
+}
+
+// getIPOConfig reads how long IPOs take subscriptions from the environment, falling back to the defaults
+func getIPOConfig() services.IPOConfig {
+	cfg := services.DefaultIPOConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("IPO_CHECK_INTERVAL")); err == nil && interval > 0 {
+		cfg.CheckInterval = interval
+	}
+	if window, err := time.ParseDuration(os.Getenv("IPO_SUBSCRIPTION_WINDOW")); err == nil && window > 0 {
+		cfg.SubscriptionWindow = window
+	}
+
+	return cfg
+}
+
+// getOptionsConfig reads which option contracts are listed and how they are priced from the environment,
+// falling back to the defaults
+func getOptionsConfig() services.OptionsConfig {
+	cfg := services.DefaultOptionsConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("OPTIONS_CHECK_INTERVAL")); err == nil && interval > 0 {
+		cfg.CheckInterval = interval
+	}
+	if interval, err := time.ParseDuration(os.Getenv("OPTIONS_EXPIRY_INTERVAL")); err == nil && interval > 0 {
+		cfg.ExpiryInterval = interval
+	}
+	if expiries, err := strconv.Atoi(os.Getenv("OPTIONS_EXPIRIES")); err == nil {
+		cfg.Expiries = expiries
+	}
+	if strikes, err := strconv.Atoi(os.Getenv("OPTIONS_STRIKES")); err == nil {
+		cfg.Strikes = strikes
+	}
+	if step, err := strconv.ParseFloat(os.Getenv("OPTIONS_STRIKE_STEP"), 64); err == nil {
+		cfg.StrikeStep = step
+	}
+	if size, err := strconv.Atoi(os.Getenv("OPTIONS_CONTRACT_SIZE")); err == nil {
+		cfg.ContractSize = size
+	}
+	if rate, err := strconv.ParseFloat(os.Getenv("OPTIONS_RISK_FREE_RATE"), 64); err == nil {
+		cfg.RiskFreeRate = rate
+	}
+
+	return cfg
+}
+
+// getFractionalConfig reads the smallest fraction of a share that can be traded from the environment,
+// falling back to the default
+func getFractionalConfig() services.FractionalConfig {
+	cfg := services.DefaultFractionalConfig()
+
+	if fraction, err := strconv.ParseFloat(os.Getenv("MIN_SHARE_FRACTION"), 64); err == nil {
+		cfg.MinFraction = fraction
+	}
+
+	return cfg
+}
+
+// getFundamentalsConfig reads how often companies report earnings from the environment, falling back to the defaults
+func getFundamentalsConfig() services.FundamentalsConfig {
+	cfg := services.DefaultFundamentalsConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("EARNINGS_CHECK_INTERVAL")); err == nil && interval > 0 {
+		cfg.CheckInterval = interval
+	}
+	if length, err := time.ParseDuration(os.Getenv("EARNINGS_QUARTER_LENGTH")); err == nil && length > 0 {
+		cfg.QuarterLength = length
+	}
+	if sigma, err := strconv.ParseFloat(os.Getenv("EARNINGS_SURPRISE_SIGMA"), 64); err == nil && sigma >= 0 {
+		cfg.SurpriseSigma = sigma
+	}
+
+	return cfg
+}
+
+// getEarningsConfig reads how prices react to earnings surprises from the environment, falling back to the defaults
+func getEarningsConfig() market.EarningsConfig {
+	cfg := market.DefaultEarningsConfig()
+
+	if sensitivity, err := strconv.ParseFloat(os.Getenv("EARNINGS_SENSITIVITY"), 64); err == nil {
+		cfg.Sensitivity = sensitivity
+	}
+	if reaction, err := strconv.ParseFloat(os.Getenv("EARNINGS_MAX_REACTION"), 64); err == nil {
+		cfg.MaxReaction = reaction
+	}
+	if share, err := strconv.ParseFloat(os.Getenv("EARNINGS_DRIFT_SHARE"), 64); err == nil {
+		cfg.DriftShare = share
+	}
+
+	return cfg
+}
+
+// getNewsConfig reads how often news is made up from the environment, falling back to the defaults
+func getNewsConfig() services.NewsConfig {
+	cfg := services.DefaultNewsConfig()
+
+	if interval, err := time.ParseDuration(os.Getenv("NEWS_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if chance, err := strconv.ParseFloat(os.Getenv("NEWS_CHANCE"), 64); err == nil && chance >= 0 && chance <= 1 {
+		cfg.Chance = chance
+	}
+
+	return cfg
+}
+
+// getPriceHistoryConfig reads the price history settings from the environment, falling back to the defaults
+func getPriceHistoryConfig() services.PriceHistoryConfig {
+	cfg := services.DefaultPriceHistoryConfig()
+
+	if size, err := strconv.Atoi(os.Getenv("PRICE_HISTORY_BATCH_SIZE")); err == nil && size > 0 {
+		cfg.BatchSize = size
+	}
+	if interval, err := time.ParseDuration(os.Getenv("PRICE_HISTORY_FLUSH_INTERVAL")); err == nil && interval > 0 {
+		cfg.FlushInterval = interval
+	}
+
+	return cfg
+}
+
 // Helper function to run commands and return output
 func getMustString(command string) string {
 	cmd := exec.Command("sh", "-c", command)
@@ -7,22 +7,30 @@ import (
 	"strconv"
 	"strings"
 	
+	"github.com/gorilla/mux"
 	"officestonks/internal/models"
+	"officestonks/internal/services"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
 )
 
 // AdminHandler handles admin-specific endpoints
 type AdminHandler struct {
-	userRepo    models.UserRepository
-	stockRepo   models.StockRepository
-	chatRepo    models.ChatRepository
+	userRepo      models.UserRepository
+	stockRepo     models.StockRepository
+	chatRepo      models.ChatRepository
+	feeRepo       models.FeeScheduleRepository
+	marketService *services.MarketService
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(userRepo models.UserRepository, stockRepo models.StockRepository, chatRepo models.ChatRepository) *AdminHandler {
+func NewAdminHandler(userRepo models.UserRepository, stockRepo models.StockRepository, chatRepo models.ChatRepository, feeRepo models.FeeScheduleRepository, marketService *services.MarketService) *AdminHandler {
 	return &AdminHandler{
-		userRepo:  userRepo,
-		stockRepo: stockRepo,
-		chatRepo:  chatRepo,
+		userRepo:      userRepo,
+		stockRepo:     stockRepo,
+		chatRepo:      chatRepo,
+		feeRepo:       feeRepo,
+		marketService: marketService,
 	}
 }
 
@@ -222,9 +230,10 @@ func (h *AdminHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	
 	// Parse request body
 	var updateRequest struct {
-		Username    string  `json:"username"`
-		CashBalance float64 `json:"cash_balance"`
-		IsAdmin     bool    `json:"is_admin"`
+		Username    string      `json:"username"`
+		CashBalance money.Money `json:"cash_balance"`
+		IsAdmin     bool        `json:"is_admin"`
+		Reason      string      `json:"reason"` // Recorded in the ledger with any change to the cash balance
 	}
 	
 	err = json.NewDecoder(r.Body).Decode(&updateRequest)
@@ -240,8 +249,20 @@ func (h *AdminHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Post any change to the cash balance to the ledger as an adjustment by this admin
+	if updateRequest.CashBalance != user.CashBalance {
+		adminID, _ := r.Context().Value("userID").(int)
+		user, err = h.marketService.AdjustCashBalance(userID, updateRequest.CashBalance, adminID, updateRequest.Reason)
+		if err != nil {
+			log.Printf("Error adjusting cash balance: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("UpdateUser: Admin %d set user %d's cash balance to %s", adminID, userID, user.CashBalance)
+	}
+	
 	// Update user
-	err = h.userRepo.UpdateUser(userID, updateRequest.CashBalance, updateRequest.IsAdmin)
+	err = h.userRepo.UpdateUser(userID, updateRequest.IsAdmin)
 	if err != nil {
 		log.Printf("Error updating user: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -249,13 +270,60 @@ func (h *AdminHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Return updated user
-	user.CashBalance = updateRequest.CashBalance
 	user.IsAdmin = updateRequest.IsAdmin
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
 
+// GetUserLedger returns a user's ledger entries, newest first (admin only)
+func (h *AdminHandler) GetUserLedger(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse pagination parameters
+	limit := 50
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	entries, err := h.marketService.GetUserLedger(userID, limit, offset)
+	if err != nil {
+		log.Printf("Error getting ledger for user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetReconciliation checks every user's balances against their ledger and lists the users
+// whose cash, margin loan or IPO escrow disagrees with it (admin only)
+func (h *AdminHandler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	reconciliation, err := h.marketService.ReconcileLedger()
+	if err != nil {
+		log.Printf("Error reconciling the ledger: %v", err)
+		http.Error(w, "Failed to reconcile the ledger", http.StatusInternalServerError)
+		return
+	}
+
+	if len(reconciliation.Flagged) > 0 {
+		log.Printf("GetReconciliation: %d of %d users disagree with their ledger", len(reconciliation.Flagged), reconciliation.Checked)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reconciliation)
+}
+
 // DeleteUser deletes a user from the system (admin only)
 func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from URL
@@ -318,7 +386,7 @@ func (h *AdminHandler) ResetStockPrices(w http.ResponseWriter, r *http.Request)
 	// Log the existing stocks
 	log.Printf("Found %d stocks before resetting prices", len(stocks))
 	for _, s := range stocks {
-		log.Printf("Stock before reset: %s (ID: %d) - Price: %.2f", s.Symbol, s.ID, s.CurrentPrice)
+		log.Printf("Stock before reset: %s (ID: %d) - Price: %s", s.Symbol, s.ID, s.CurrentPrice)
 	}
 
 	// Reset stock prices
@@ -338,7 +406,7 @@ func (h *AdminHandler) ResetStockPrices(w http.ResponseWriter, r *http.Request)
 	} else {
 		log.Printf("Found %d stocks after resetting prices", len(updatedStocks))
 		for _, s := range updatedStocks {
-			log.Printf("Stock after reset: %s (ID: %d) - Price: %.2f", s.Symbol, s.ID, s.CurrentPrice)
+			log.Printf("Stock after reset: %s (ID: %d) - Price: %s", s.Symbol, s.ID, s.CurrentPrice)
 		}
 	}
 
@@ -398,4 +466,412 @@ func (h *AdminHandler) ClearAllChats(w http.ResponseWriter, r *http.Request) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-}
\ No newline at end of file
+}
+
+// GetFeeSchedule returns the commission schedule currently charged on trades (admin only)
+func (h *AdminHandler) GetFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.feeRepo.GetCurrentFeeSchedule()
+	if err != nil {
+		log.Printf("Error getting fee schedule: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// UpdateFeeSchedule replaces the commission schedule charged on trades (admin only)
+func (h *AdminHandler) UpdateFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.FeeSchedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := schedule.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.feeRepo.SaveFeeSchedule(&schedule); err != nil {
+		log.Printf("Error saving fee schedule: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("UpdateFeeSchedule: Fee schedule %d (%s) is now active", schedule.ID, schedule.Type)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// GetPriceModels returns the price models the simulator uses for each sector and stock (admin only)
+func (h *AdminHandler) GetPriceModels(w http.ResponseWriter, r *http.Request) {
+	priceModels, err := h.marketService.GetPriceModels()
+	if err != nil {
+		log.Printf("Error getting price models: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(priceModels)
+}
+
+// SetStockPriceModel gives a stock its own price model (admin only)
+func (h *AdminHandler) SetStockPriceModel(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	// DELETE goes back to the sector's model
+	var params *market.ModelParams
+	if r.Method != http.MethodDelete {
+		params = &market.ModelParams{}
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.marketService.SetStockPriceModel(stockID, params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("SetStockPriceModel: Stock %d now uses %+v", stockID, params)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stock_id": stockID,
+		"params":   params,
+	})
+}
+
+// SetSectorPriceModel sets the price model for stocks in a sector that don't have their own (admin only)
+func (h *AdminHandler) SetSectorPriceModel(w http.ResponseWriter, r *http.Request) {
+	sector := mux.Vars(r)["sector"]
+	if sector == "" {
+		http.Error(w, "Invalid sector", http.StatusBadRequest)
+		return
+	}
+
+	// DELETE goes back to the default model
+	var params *market.ModelParams
+	if r.Method != http.MethodDelete {
+		params = &market.ModelParams{}
+		if err := json.NewDecoder(r.Body).Decode(params); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.marketService.SetSectorPriceModel(sector, params); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("SetSectorPriceModel: Sector %q now uses %+v", sector, params)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sector": sector,
+		"params": params,
+	})
+}
+
+// SetStockBetas sets how strongly a stock follows the market and its sector (admin only)
+func (h *AdminHandler) SetStockBetas(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	var betas market.Betas
+	if err := json.NewDecoder(r.Body).Decode(&betas); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.marketService.SetStockBetas(stockID, betas); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("SetStockBetas: Stock %d now has market beta %.3f and sector beta %.3f", stockID, betas.Market, betas.Sector)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"stock_id": stockID,
+		"betas":    betas,
+	})
+}
+
+// HaltStock stops trading in a stock, for a number of minutes or until it is resumed (admin only)
+func (h *AdminHandler) HaltStock(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+
+	var req struct {
+		Minutes int `json:"minutes"` // 0 halts until the stock is resumed
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.marketService.HaltStock(symbol, time.Duration(req.Minutes)*time.Minute); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("HaltStock: Trading in %s halted for %d minutes", symbol, req.Minutes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"symbol":  symbol,
+		"halted":  true,
+		"minutes": req.Minutes,
+	})
+}
+
+// ResumeStock restarts trading in a halted stock (admin only)
+func (h *AdminHandler) ResumeStock(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+
+	if err := h.marketService.ResumeStock(symbol); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("ResumeStock: Trading in %s resumed", symbol)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"symbol": symbol,
+		"halted": false,
+	})
+}
+
+// DeclareCorporateAction announces a dividend or split on a stock (admin only)
+func (h *AdminHandler) DeclareCorporateAction(w http.ResponseWriter, r *http.Request) {
+	var action models.CorporateAction
+	if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// The admin declaring the action is recorded, whatever the request says
+	action.Source = models.ActionSourceAdmin
+	action.CreatedBy = nil
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		action.CreatedBy = &userID
+	}
+
+	if err := h.marketService.DeclareCorporateAction(&action); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("DeclareCorporateAction: Declared %s %d on %s, ex date %s", action.Type, action.ID, action.Symbol, action.ExDate.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(action)
+}
+
+// CancelCorporateAction withdraws a corporate action before its ex date (admin only)
+func (h *AdminHandler) CancelCorporateAction(w http.ResponseWriter, r *http.Request) {
+	actionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid corporate action ID", http.StatusBadRequest)
+		return
+	}
+
+	action, err := h.marketService.CancelCorporateAction(actionID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CancelCorporateAction: Cancelled %s %d on %s", action.Type, action.ID, action.Symbol)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(action)
+}
+
+// GetStocks returns every stock, or the stocks at one stage of their listing (admin only)
+func (h *AdminHandler) GetStocks(w http.ResponseWriter, r *http.Request) {
+	status := models.StockStatus(r.URL.Query().Get("status"))
+
+	stocks, err := h.marketService.GetStocksByStatus(status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stocks)
+}
+
+// CreateStock lists a new stock at a price straight away (admin only)
+func (h *AdminHandler) CreateStock(w http.ResponseWriter, r *http.Request) {
+	var stock models.Stock
+	if err := json.NewDecoder(r.Body).Decode(&stock); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.marketService.CreateListing(&stock); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CreateStock: Listed %s at %s", stock.Symbol, stock.CurrentPrice)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stock)
+}
+
+// UpdateStock changes a stock's name and sector (admin only)
+func (h *AdminHandler) UpdateStock(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name   string `json:"name"`
+		Sector string `json:"sector"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	stock, err := h.marketService.UpdateListing(&models.Stock{ID: stockID, Name: req.Name, Sector: req.Sector})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("UpdateStock: Updated %s", stock.Symbol)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stock)
+}
+
+// DelistStock stops trading in a stock and cashes out its holders at the last price (admin only)
+func (h *AdminHandler) DelistStock(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	stock, err := h.marketService.DelistStock(stockID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stock)
+}
+
+// CreateIPO adds a new stock that takes subscriptions before it starts trading (admin only)
+func (h *AdminHandler) CreateIPO(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Symbol   string      `json:"symbol"`
+		Name     string      `json:"name"`
+		Sector   string      `json:"sector"`
+		Float    int         `json:"float"`
+		Price    money.Money `json:"ipo_price"`
+		OpensAt  time.Time   `json:"opens_at"`  // Defaults to now
+		ClosesAt time.Time   `json:"closes_at"` // Defaults to the configured subscription window after it opens
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	stock := &models.Stock{Symbol: req.Symbol, Name: req.Name, Sector: req.Sector}
+	ipo := &models.IPO{Float: req.Float, Price: req.Price, OpensAt: req.OpensAt, ClosesAt: req.ClosesAt}
+
+	// The admin creating the IPO is recorded
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		ipo.CreatedBy = &userID
+	}
+
+	if err := h.marketService.CreateIPO(stock, ipo); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CreateIPO: %s offers %d shares at %s until %s", ipo.Symbol, ipo.Float, ipo.Price, ipo.ClosesAt.Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ipo)
+}
+
+// CreateETF lists an ETF holding a weighted basket of listed stocks (admin only)
+func (h *AdminHandler) CreateETF(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Symbol       string      `json:"symbol"`
+		Name         string      `json:"name"`
+		Sector       string      `json:"sector"` // Defaults to "ETF"
+		Price        money.Money `json:"price"`  // Starting price; defaults to 100.00
+		Constituents []struct {
+			StockID int     `json:"stock_id"`
+			Weight  float64 `json:"weight"` // Relative to the other weights; they needn't add up to 1
+		} `json:"constituents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	stock := &models.Stock{Symbol: req.Symbol, Name: req.Name, Sector: req.Sector, CurrentPrice: req.Price}
+	constituents := make([]*models.Constituent, 0, len(req.Constituents))
+	for _, c := range req.Constituents {
+		constituents = append(constituents, &models.Constituent{StockID: c.StockID, Weight: c.Weight})
+	}
+
+	etf, err := h.marketService.CreateETF(stock, constituents)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CreateETF: Listed %s holding %d stocks at %s", etf.Symbol, len(etf.Constituents), etf.Price)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(etf)
+}
+
+// CancelIPO withdraws an IPO before it is allocated and refunds its subscribers (admin only)
+func (h *AdminHandler) CancelIPO(w http.ResponseWriter, r *http.Request) {
+	ipoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid IPO ID", http.StatusBadRequest)
+		return
+	}
+
+	ipo, err := h.marketService.CancelIPO(ipoID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ipo)
+}
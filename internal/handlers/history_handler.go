@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"officestonks/internal/models"
+	"officestonks/internal/services"
+)
+
+// HistoryHandler handles price history requests
+type HistoryHandler struct {
+	historyService *services.PriceHistoryService
+}
+
+// NewHistoryHandler creates a new history handler
+func NewHistoryHandler(historyService *services.PriceHistoryService) *HistoryHandler {
+	return &HistoryHandler{
+		historyService: historyService,
+	}
+}
+
+// GetCandles returns OHLC candles for a stock. The interval defaults to 1m, and from and to
+// may be RFC 3339 times or Unix timestamps.
+func (h *HistoryHandler) GetCandles(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	stockID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	interval := models.CandleInterval(query.Get("interval"))
+	if interval == "" {
+		interval = models.OneMinute
+	}
+
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to time", http.StatusBadRequest)
+		return
+	}
+
+	candles, err := h.historyService.GetCandles(stockID, interval, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return an empty list rather than null when there is no history yet
+	if candles == nil {
+		candles = []*models.Candle{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(candles)
+}
+
+// parseTimeParam parses an RFC 3339 time or a Unix timestamp in seconds. An empty value gives the zero time.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
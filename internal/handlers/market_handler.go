@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -9,6 +10,7 @@ import (
 	"officestonks/internal/middleware"
 	"officestonks/internal/models"
 	"officestonks/internal/services"
+	"officestonks/pkg/money"
 )
 
 // MarketHandler handles market-related requests
@@ -54,6 +56,208 @@ func (h *MarketHandler) GetStockByID(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stock)
 }
 
+// GetFeeSchedule returns the commission schedule charged on trades
+func (h *MarketHandler) GetFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := h.marketService.GetFeeSchedule()
+	if err != nil {
+		http.Error(w, "Failed to retrieve fee schedule", http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// GetMarketStatus returns whether the market is open and when it next opens and closes
+func (h *MarketHandler) GetMarketStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.marketService.GetMarketStatus())
+}
+
+// GetHalts returns every stock whose trading is halted
+func (h *MarketHandler) GetHalts(w http.ResponseWriter, r *http.Request) {
+	halts, err := h.marketService.GetHalts()
+	if err != nil {
+		http.Error(w, "Failed to retrieve trading halts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(halts)
+}
+
+// GetCorporateActions returns declared, upcoming and past dividends and splits, optionally for one stock
+func (h *MarketHandler) GetCorporateActions(w http.ResponseWriter, r *http.Request) {
+	// Parse filter and pagination parameters
+	stockID := 0
+	limit := 50
+	offset := 0
+
+	if id, err := strconv.Atoi(r.URL.Query().Get("stock_id")); err == nil && id > 0 {
+		stockID = id
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	actions, err := h.marketService.GetCorporateActions(stockID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve corporate actions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
+
+// GetFundamentals returns a stock's company figures at its current price
+func (h *MarketHandler) GetFundamentals(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	fundamentals, err := h.marketService.GetFundamentals(stockID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fundamentals)
+}
+
+// GetEarnings returns a stock's earnings reports, latest first
+func (h *MarketHandler) GetEarnings(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse pagination parameters
+	limit := 20
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	reports, err := h.marketService.GetEarningsReports(stockID, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// GetIndices returns the composite and sector indices with how they have done today
+func (h *MarketHandler) GetIndices(w http.ResponseWriter, r *http.Request) {
+	indices, err := h.marketService.GetIndices()
+	if err != nil {
+		http.Error(w, "Failed to retrieve indices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(indices)
+}
+
+// GetIndexHistory returns an index's levels between the from and to times
+func (h *MarketHandler) GetIndexHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from time", http.StatusBadRequest)
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to time", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	points, err := h.marketService.GetIndexHistory(mux.Vars(r)["code"], from, to, limit)
+	if err == services.ErrUnknownIndex {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Return an empty list rather than null when there is no history yet
+	if points == nil {
+		points = []*models.IndexPoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
+
+// GetOptionChain returns every active option contract on a stock with its premium and Greeks
+func (h *MarketHandler) GetOptionChain(w http.ResponseWriter, r *http.Request) {
+	stockID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock ID", http.StatusBadRequest)
+		return
+	}
+
+	chain, err := h.marketService.GetOptionChain(stockID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chain)
+}
+
+// GetETFs returns every listed ETF with its basket
+func (h *MarketHandler) GetETFs(w http.ResponseWriter, r *http.Request) {
+	etfs, err := h.marketService.GetETFs()
+	if err != nil {
+		http.Error(w, "Failed to retrieve ETFs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(etfs)
+}
+
+// GetETF returns an ETF with its basket and each constituent's weight
+func (h *MarketHandler) GetETF(w http.ResponseWriter, r *http.Request) {
+	etfID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ETF ID", http.StatusBadRequest)
+		return
+	}
+
+	etf, err := h.marketService.GetETF(etfID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(etf)
+}
+
 // GetUserPortfolio returns the user's portfolio
 func (h *MarketHandler) GetUserPortfolio(w http.ResponseWriter, r *http.Request) {
 	// Get the user ID from the request context
@@ -89,12 +293,37 @@ func (h *MarketHandler) TradeStock(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	// Options are traded by contract rather than by stock
+	if req.Action == "buy_to_open" || req.Action == "sell_to_close" {
+		h.tradeOption(w, userID, req)
+		return
+	}
+	
+	// Dollar-amount orders work out their quantity from the current price
+	if req.Amount > 0 {
+		h.tradeAmount(w, userID, req)
+		return
+	}
+	
 	// Validate input
 	if req.StockID <= 0 || req.Quantity <= 0 {
 		http.Error(w, "Invalid stock ID or quantity", http.StatusBadRequest)
 		return
 	}
 	
+	// Limit and conditional orders rest in the order book instead of executing immediately
+	orderType := models.OrderType(req.OrderType)
+	if orderType == models.LimitOrder {
+		h.placeLimitOrder(w, userID, req)
+		return
+	} else if orderType.IsConditional() {
+		h.placeConditionalOrder(w, userID, req)
+		return
+	} else if orderType != "" && orderType != models.MarketOrder {
+		http.Error(w, "Invalid order type, must be 'market', 'limit', 'stop_loss', 'take_profit' or 'trailing_stop'", http.StatusBadRequest)
+		return
+	}
+	
 	var err error
 	
 	// Execute the trade
@@ -102,8 +331,12 @@ func (h *MarketHandler) TradeStock(w http.ResponseWriter, r *http.Request) {
 		err = h.marketService.BuyStock(userID, req.StockID, req.Quantity)
 	} else if req.Action == "sell" {
 		err = h.marketService.SellStock(userID, req.StockID, req.Quantity)
+	} else if req.Action == "short" {
+		err = h.marketService.ShortStock(userID, req.StockID, req.Quantity)
+	} else if req.Action == "cover" {
+		err = h.marketService.CoverShort(userID, req.StockID, req.Quantity)
 	} else {
-		http.Error(w, "Invalid action, must be 'buy' or 'sell'", http.StatusBadRequest)
+		http.Error(w, "Invalid action, must be 'buy', 'sell', 'short', 'cover', 'buy_to_open' or 'sell_to_close'", http.StatusBadRequest)
 		return
 	}
 	
@@ -120,6 +353,299 @@ func (h *MarketHandler) TradeStock(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// tradeAmount buys or sells a dollar amount of a stock at market, as many shares or fractions of a share
+// as the amount pays for
+func (h *MarketHandler) tradeAmount(w http.ResponseWriter, userID int, req models.TradeRequest) {
+	if req.StockID <= 0 || req.Quantity != 0 {
+		http.Error(w, "Invalid stock ID, or both a quantity and an amount given", http.StatusBadRequest)
+		return
+	}
+	if req.OrderType != "" && models.OrderType(req.OrderType) != models.MarketOrder {
+		http.Error(w, "Dollar amounts can only be traded with market orders", http.StatusBadRequest)
+		return
+	}
+
+	var quantity float64
+	var err error
+	if req.Action == "buy" {
+		quantity, err = h.marketService.BuyStockAmount(userID, req.StockID, req.Amount)
+	} else if req.Action == "sell" {
+		quantity, err = h.marketService.SellStockAmount(userID, req.StockID, req.Amount)
+	} else {
+		http.Error(w, "Invalid action, dollar amounts can only be bought or sold", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Trade executed successfully",
+		"quantity": quantity,
+	})
+}
+
+// tradeOption buys option contracts to open a position or sells them to close it, at the current premium
+func (h *MarketHandler) tradeOption(w http.ResponseWriter, userID int, req models.TradeRequest) {
+	if req.OptionID <= 0 || req.Quantity <= 0 {
+		http.Error(w, "Invalid option ID or quantity", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity != math.Trunc(req.Quantity) {
+		http.Error(w, "Option contracts can only be traded whole", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if req.Action == "buy_to_open" {
+		err = h.marketService.BuyOption(userID, req.OptionID, int(req.Quantity))
+	} else {
+		err = h.marketService.SellOption(userID, req.OptionID, int(req.Quantity))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Trade executed successfully",
+	})
+}
+
+// GetBenchmark compares the user's return with an index's, the composite unless one is given
+func (h *MarketHandler) GetBenchmark(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	benchmark, err := h.marketService.GetBenchmark(userID, r.URL.Query().Get("index"))
+	if err == services.ErrUnknownIndex {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to benchmark portfolio", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(benchmark)
+}
+
+// GetTaxLots returns the open tax lots behind the user's holdings
+func (h *MarketHandler) GetTaxLots(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	lots, err := h.marketService.GetUserLots(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve tax lots", http.StatusInternalServerError)
+		return
+	}
+	
+	// Return an empty array rather than null
+	if lots == nil {
+		lots = []*models.TaxLot{}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lots)
+}
+
+// SetCostBasisMethod sets whether the user's sales use FIFO, LIFO or average cost
+func (h *MarketHandler) SetCostBasisMethod(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	var methodRequest struct {
+		Method models.CostBasisMethod `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&methodRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	
+	if err := h.marketService.SetCostBasisMethod(userID, methodRequest.Method); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":           "Cost basis method updated successfully",
+		"cost_basis_method": string(methodRequest.Method),
+	})
+}
+
+// placeLimitOrder creates a resting limit order from a trade request
+func (h *MarketHandler) placeLimitOrder(w http.ResponseWriter, userID int, req models.TradeRequest) {
+	if req.LimitPrice <= 0 {
+		http.Error(w, "Limit price is required for limit orders", http.StatusBadRequest)
+		return
+	}
+	
+	side := models.TransactionType(req.Action)
+	if side != models.Buy && side != models.Sell {
+		http.Error(w, "Invalid action, must be 'buy' or 'sell'", http.StatusBadRequest)
+		return
+	}
+	
+	order, err := h.marketService.PlaceLimitOrder(userID, req.StockID, req.Quantity, req.LimitPrice, side)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// placeConditionalOrder creates a stop-loss, take-profit or trailing-stop sell order
+func (h *MarketHandler) placeConditionalOrder(w http.ResponseWriter, userID int, req models.TradeRequest) {
+	if req.Action != "" && req.Action != string(models.Sell) {
+		http.Error(w, "Conditional orders can only sell", http.StatusBadRequest)
+		return
+	}
+	
+	order, err := h.marketService.PlaceConditionalOrder(userID, req.StockID, req.Quantity,
+		models.OrderType(req.OrderType), req.StopPrice, req.TrailAmount, req.TrailPercent)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// GetOrders returns the user's orders, optionally filtered by ?status=
+func (h *MarketHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	status := models.OrderStatus(r.URL.Query().Get("status"))
+	
+	orders, err := h.marketService.GetUserOrders(userID, status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve orders", http.StatusInternalServerError)
+		return
+	}
+	
+	// Return an empty array rather than null
+	if orders == nil {
+		orders = []*models.Order{}
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// CancelOrder cancels one of the user's open orders
+func (h *MarketHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	
+	vars := mux.Vars(r)
+	orderID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	
+	if err := h.marketService.CancelOrder(userID, orderID); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Order cancelled successfully",
+	})
+}
+
+// SetMarginAccount opens or closes the user's margin account
+func (h *MarketHandler) SetMarginAccount(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var marginRequest struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&marginRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.marketService.SetMarginAccount(userID, marginRequest.Enabled); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Margin account updated successfully",
+		"margin_enabled": marginRequest.Enabled,
+	})
+}
+
+// RepayLoan pays down the user's margin loan from their cash
+func (h *MarketHandler) RepayLoan(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var repayRequest struct {
+		Amount money.Money `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&repayRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.marketService.RepayLoan(userID, repayRequest.Amount); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Loan repaid successfully",
+	})
+}
+
 // GetTransactionHistory returns the user's transaction history
 func (h *MarketHandler) GetTransactionHistory(w http.ResponseWriter, r *http.Request) {
 	// Get the user ID from the request context
@@ -157,4 +683,124 @@ func (h *MarketHandler) GetTransactionHistory(w http.ResponseWriter, r *http.Req
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(transactions)
-}
\ No newline at end of file
+}
+
+// GetIPOs returns IPOs, latest first, optionally only those with a status
+func (h *MarketHandler) GetIPOs(w http.ResponseWriter, r *http.Request) {
+	// Parse filter and pagination parameters
+	status := models.IPOStatus(r.URL.Query().Get("status"))
+	limit := 50
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	ipos, err := h.marketService.GetIPOs(status, limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ipos)
+}
+
+// GetIPO returns one IPO, including how many shares have been requested so far
+func (h *MarketHandler) GetIPO(w http.ResponseWriter, r *http.Request) {
+	ipoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid IPO ID", http.StatusBadRequest)
+		return
+	}
+
+	ipo, err := h.marketService.GetIPO(ipoID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ipo)
+}
+
+// GetIPOSubscriptions returns the user's IPO subscriptions and what they were allocated
+func (h *MarketHandler) GetIPOSubscriptions(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subscriptions, err := h.marketService.GetUserIPOSubscriptions(userID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve IPO subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// SubscribeToIPO requests shares in an open IPO, replacing the user's earlier request
+func (h *MarketHandler) SubscribeToIPO(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ipoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid IPO ID", http.StatusBadRequest)
+		return
+	}
+
+	var subscribeRequest struct {
+		Quantity int `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&subscribeRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := h.marketService.SubscribeToIPO(userID, ipoID, subscribeRequest.Quantity)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// CancelIPOSubscription withdraws the user's request for shares in an open IPO
+func (h *MarketHandler) CancelIPOSubscription(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request context
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ipoID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid IPO ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.marketService.CancelIPOSubscription(userID, ipoID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "IPO subscription cancelled successfully",
+	})
+}
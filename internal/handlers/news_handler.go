@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"officestonks/internal/middleware"
+	"officestonks/internal/models"
+	"officestonks/internal/services"
+	"officestonks/pkg/market"
+)
+
+// NewsHandler handles market news requests
+type NewsHandler struct {
+	newsService *services.NewsService
+}
+
+// NewNewsHandler creates a new news handler
+func NewNewsHandler(newsService *services.NewsService) *NewsHandler {
+	return &NewsHandler{
+		newsService: newsService,
+	}
+}
+
+// GetNews returns published market news, newest first
+func (h *NewsHandler) GetNews(w http.ResponseWriter, r *http.Request) {
+	// Parse pagination parameters
+	limit := 50
+	offset := 0
+
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	news, err := h.newsService.GetNews(limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to retrieve news", http.StatusInternalServerError)
+		return
+	}
+
+	// Return an empty list rather than null when there is no news yet
+	if news == nil {
+		news = []*models.MarketEvent{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(news)
+}
+
+// CreateNews publishes a piece of news written by an admin, which moves prices straight away (admin only)
+func (h *NewsHandler) CreateNews(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var newsRequest struct {
+		Scope       market.EventScope `json:"scope"`
+		StockID     *int              `json:"stock_id"`
+		Sector      string            `json:"sector"`
+		Headline    string            `json:"headline"`
+		PriceImpact float64           `json:"price_impact"`
+		TrendImpact float64           `json:"trend_impact"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&newsRequest); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(newsRequest.Headline) > 255 {
+		http.Error(w, "Headline must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	event := &models.MarketEvent{
+		Scope:       newsRequest.Scope,
+		StockID:     newsRequest.StockID,
+		Sector:      newsRequest.Sector,
+		Headline:    newsRequest.Headline,
+		PriceImpact: newsRequest.PriceImpact,
+		TrendImpact: newsRequest.TrendImpact,
+		Source:      models.EventSourceAdmin,
+		CreatedBy:   &userID,
+	}
+
+	if err := h.newsService.PublishEvent(event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("CreateNews: Admin %d published %q", userID, event.Headline)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(event)
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// CandleInterval is the length of time one candle covers
+type CandleInterval string
+
+const (
+	OneMinute   CandleInterval = "1m"
+	FiveMinutes CandleInterval = "5m"
+	OneHour     CandleInterval = "1h"
+	OneDay      CandleInterval = "1d"
+)
+
+// CandleIntervals lists every interval price history is rolled up into
+var CandleIntervals = []CandleInterval{OneMinute, FiveMinutes, OneHour, OneDay}
+
+// Duration returns how long the interval is, or 0 if it isn't supported
+func (i CandleInterval) Duration() time.Duration {
+	switch i {
+	case OneMinute:
+		return time.Minute
+	case FiveMinutes:
+		return 5 * time.Minute
+	case OneHour:
+		return time.Hour
+	case OneDay:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// IsValid reports whether i is a supported candle interval
+func (i CandleInterval) IsValid() bool {
+	return i.Duration() > 0
+}
+
+// BucketStart returns the start of the candle that t falls in. Buckets are aligned to UTC.
+func (i CandleInterval) BucketStart(t time.Time) time.Time {
+	return t.UTC().Truncate(i.Duration())
+}
+
+// PriceTick is a single simulated price for a stock
+type PriceTick struct {
+	ID        int64       `json:"id"`
+	StockID   int         `json:"stock_id"`
+	Price     money.Money `json:"price"`
+	Volume    float64     `json:"volume"` // Shares traded since the previous tick
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Candle is the open, high, low and close price and the volume traded for a stock over one interval
+type Candle struct {
+	StockID     int            `json:"stock_id"`
+	Interval    CandleInterval `json:"interval"`
+	BucketStart time.Time      `json:"time"`
+	Open        money.Money    `json:"open"`
+	High        money.Money    `json:"high"`
+	Low         money.Money    `json:"low"`
+	Close       money.Money    `json:"close"`
+	Volume      float64        `json:"volume"`
+}
+
+// BuildCandles rolls ticks up into candles for an interval. The ticks must be in time order;
+// candles come back in the order their buckets were first seen.
+func BuildCandles(ticks []*PriceTick, interval CandleInterval) []*Candle {
+	type bucketKey struct {
+		stockID int
+		start   time.Time
+	}
+
+	var candles []*Candle
+	byBucket := make(map[bucketKey]*Candle)
+
+	for _, tick := range ticks {
+		key := bucketKey{tick.StockID, interval.BucketStart(tick.CreatedAt)}
+
+		candle, ok := byBucket[key]
+		if !ok {
+			candle = &Candle{
+				StockID:     tick.StockID,
+				Interval:    interval,
+				BucketStart: key.start,
+				Open:        tick.Price,
+				High:        tick.Price,
+				Low:         tick.Price,
+			}
+			byBucket[key] = candle
+			candles = append(candles, candle)
+		}
+
+		if tick.Price > candle.High {
+			candle.High = tick.Price
+		}
+		if tick.Price < candle.Low {
+			candle.Low = tick.Price
+		}
+		candle.Close = tick.Price
+		candle.Volume += tick.Volume
+	}
+
+	return candles
+}
+
+// PriceHistoryRepository interface defines methods for price history data access
+type PriceHistoryRepository interface {
+	SaveTicks(ticks []*PriceTick) error
+	SaveCandles(candles []*Candle) error
+	GetCandles(stockID int, interval CandleInterval, from, to time.Time) ([]*Candle, error)
+	SplitHistoryTx(tx *sql.Tx, stockID int, ratio float64) error
+}
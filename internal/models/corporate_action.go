@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// CorporateActionType defines what a corporate action does to a stock
+type CorporateActionType string
+
+const (
+	DividendAction CorporateActionType = "dividend" // Pays holders cash per share
+	SplitAction    CorporateActionType = "split"    // Turns every SplitFrom shares into SplitTo shares; a reverse split has SplitTo < SplitFrom
+)
+
+// CorporateActionStatus defines where a corporate action is in its lifecycle
+type CorporateActionStatus string
+
+const (
+	ActionDeclared  CorporateActionStatus = "declared"  // Announced, waiting for its ex date
+	ActionEx        CorporateActionStatus = "ex"        // Dividend holders are fixed, waiting for the pay date
+	ActionPaid      CorporateActionStatus = "paid"      // Dividend paid
+	ActionApplied   CorporateActionStatus = "applied"   // Split applied
+	ActionCancelled CorporateActionStatus = "cancelled" // Withdrawn before its ex date
+)
+
+// Sources of corporate actions
+const (
+	ActionSourceSimulator = "simulator" // Declared by the simulator's schedule
+	ActionSourceAdmin     = "admin"     // Declared by an admin
+)
+
+// CorporateAction is a dividend or split declared on a stock
+type CorporateAction struct {
+	ID        int                   `json:"id"`
+	StockID   int                   `json:"stock_id"`
+	Symbol    string                `json:"symbol,omitempty"`
+	Type      CorporateActionType   `json:"type"`
+	Amount    money.Money           `json:"amount,omitempty"`     // Dividend per share
+	SplitTo   int                   `json:"split_to,omitempty"`   // Shares after a split for every SplitFrom before it
+	SplitFrom int                   `json:"split_from,omitempty"` // Shares before a split
+	ExDate    time.Time             `json:"ex_date"`              // Dividends go to holders at this time; splits take effect
+	PayDate   *time.Time            `json:"pay_date,omitempty"`   // When a dividend is paid
+	Status    CorporateActionStatus `json:"status"`
+	Source    string                `json:"source"`
+	CreatedBy *int                  `json:"created_by,omitempty"` // Admin who declared the action
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// Ratio is how many shares a split leaves for every share held before it
+func (a *CorporateAction) Ratio() float64 {
+	return float64(a.SplitTo) / float64(a.SplitFrom)
+}
+
+// DividendEntitlement is a dividend owed to or by one user, fixed on the ex date
+type DividendEntitlement struct {
+	ID       int         `json:"id"`
+	ActionID int         `json:"action_id"`
+	UserID   int         `json:"user_id"`
+	Quantity float64     `json:"quantity"` // Shares held on the ex date; negative for short positions, which pay the dividend
+	Amount   money.Money `json:"amount"`   // Cash credited, or debited when negative
+	PaidAt   *time.Time  `json:"paid_at,omitempty"`
+}
+
+// CorporateActionRepository interface defines methods for corporate action data access
+type CorporateActionRepository interface {
+	CreateAction(action *CorporateAction) error
+	GetActionByID(id int) (*CorporateAction, error)
+	GetActions(stockID int, limit, offset int) ([]*CorporateAction, error)
+	GetDueActions(now time.Time) ([]*CorporateAction, error)
+	HasPendingAction(stockID int, actionType CorporateActionType) (bool, error)
+	CancelAction(id int) error
+	UpdateActionStatusTx(tx *sql.Tx, id int, from, to CorporateActionStatus) error
+	RecordEntitlementsTx(tx *sql.Tx, action *CorporateAction) error
+	GetUnpaidEntitlementsTx(tx *sql.Tx, actionID int) ([]*DividendEntitlement, error)
+	MarkEntitlementPaidTx(tx *sql.Tx, entitlementID int) error
+}
+
+// SplitShares works out how many shares each block of shares becomes after a split by ratio,
+// in whole multiples of step, the smallest fraction of a share that can be held.
+// Every share that splits into a whole step is kept, so the blocks add up to the whole number
+// of steps the total splits into; whole steps made from fractions go to the largest fractions.
+func SplitShares(quantities []float64, ratio, step float64) []float64 {
+	units := make([]int, len(quantities))
+	fractions := make([]float64, len(quantities))
+
+	total, kept := 0.0, 0
+	for i, quantity := range quantities {
+		exact := math.Round(quantity/step) * ratio
+		units[i] = int(math.Floor(exact + 1e-9))
+		fractions[i] = exact - float64(units[i])
+		total += exact
+		kept += units[i]
+	}
+
+	// Hand out the whole steps the fractions add up to
+	order := make([]int, len(quantities))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return fractions[order[a]] > fractions[order[b]] })
+	for _, i := range order[:int(math.Floor(total+1e-9))-kept] {
+		units[i]++
+	}
+
+	result := make([]float64, len(quantities))
+	for i, n := range units {
+		result[i] = RoundShares(float64(n) * step)
+	}
+	return result
+}
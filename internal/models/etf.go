@@ -0,0 +1,62 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// ETF is an instrument whose price is the value of a basket of other stocks plus the cash it holds.
+// It trades like any other stock under its own stock ID.
+type ETF struct {
+	ID           int            `json:"id"` // The ETF's stock ID
+	Symbol       string         `json:"symbol"`
+	Name         string         `json:"name"`
+	Sector       string         `json:"sector"`
+	Price        money.Money    `json:"price"` // Net asset value per share
+	Cash         money.Money    `json:"cash"`  // Cash per share, from dividends and delisted constituents
+	Constituents []*Constituent `json:"constituents"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// Constituent is one stock in an ETF's basket
+type Constituent struct {
+	StockID int         `json:"stock_id"`
+	Symbol  string      `json:"symbol"`
+	Sector  string      `json:"sector"`
+	Units   float64     `json:"units"` // Shares of the stock behind one share of the ETF
+	Price   money.Money `json:"price"`
+	Weight  float64     `json:"weight"` // Share of the ETF's value, as a fraction
+}
+
+// Reprice works out the ETF's value per share and each constituent's weight from the
+// constituents' prices, taking new prices from prices where it has them
+func (e *ETF) Reprice(prices map[int]money.Money) {
+	nav := e.Cash
+	for _, c := range e.Constituents {
+		if price, ok := prices[c.StockID]; ok {
+			c.Price = price
+		}
+		nav += c.Price.Mul(c.Units)
+	}
+
+	for _, c := range e.Constituents {
+		c.Weight = 0
+		if nav > 0 {
+			c.Weight = math.Round(c.Price.Mul(c.Units).Float()/nav.Float()*10000) / 10000
+		}
+	}
+	e.Price = money.Max(money.Cent, nav)
+}
+
+// ETFRepository interface defines methods for ETF data access
+type ETFRepository interface {
+	CreateETFTx(tx *sql.Tx, etf *ETF) error
+	GetETFs() ([]*ETF, error)
+	GetETFByID(id int) (*ETF, error)
+	SplitConstituentTx(tx *sql.Tx, stockID int, ratio float64) error
+	AccrueDividendTx(tx *sql.Tx, stockID int, amount money.Money) error
+	RemoveConstituentTx(tx *sql.Tx, stockID int, price money.Money) error
+}
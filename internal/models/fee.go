@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// FeeType selects how a fee schedule charges commission
+type FeeType string
+
+const (
+	FlatFee       FeeType = "flat"       // The same fee for every trade
+	PerShareFee   FeeType = "per_share"  // A fee for each share traded
+	PercentageFee FeeType = "percentage" // A percentage of the trade value
+	TieredFee     FeeType = "tiered"     // A percentage that drops as the user's monthly volume grows
+)
+
+// FeeModel calculates the commission for a trade
+type FeeModel interface {
+	Fee(quantity float64, price, monthlyVolume money.Money) money.Money
+}
+
+// FeeTier is the percentage charged once a user's monthly volume reaches MinVolume
+type FeeTier struct {
+	MinVolume money.Money `json:"min_volume"`
+	Percent   float64     `json:"percent"`
+}
+
+// FeeSchedule is an admin-configured commission schedule. Only the fields for its type are used.
+type FeeSchedule struct {
+	ID        int         `json:"id"`
+	Type      FeeType     `json:"type"`
+	FlatFee   money.Money `json:"flat_fee,omitempty"`
+	PerShare  money.Money `json:"per_share,omitempty"` // Charged in whole cents per share
+	Percent   float64     `json:"percent,omitempty"`
+	Tiers     []FeeTier   `json:"tiers,omitempty"`
+	MinFee    money.Money `json:"min_fee"`
+	MaxFee    money.Money `json:"max_fee"` // 0 means no cap
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// FeeSchedule is the FeeModel configured by admins
+var _ FeeModel = (*FeeSchedule)(nil)
+
+// DefaultFeeSchedule is used until an admin configures one. Trades are free until then,
+// so commission is only charged once an admin has chosen to charge it.
+func DefaultFeeSchedule() *FeeSchedule {
+	return &FeeSchedule{Type: FlatFee}
+}
+
+// Validate checks that the schedule has the settings its type needs
+func (f *FeeSchedule) Validate() error {
+	if f.FlatFee < 0 || f.PerShare < 0 || f.Percent < 0 || f.MinFee < 0 || f.MaxFee < 0 {
+		return errors.New("fees cannot be negative")
+	}
+	if f.MaxFee > 0 && f.MaxFee < f.MinFee {
+		return errors.New("max fee must be at least the min fee")
+	}
+
+	switch f.Type {
+	case FlatFee, PerShareFee, PercentageFee:
+		return nil
+	case TieredFee:
+		if len(f.Tiers) == 0 {
+			return errors.New("tiered fee schedules need at least one tier")
+		}
+		for i, tier := range f.Tiers {
+			if tier.MinVolume < 0 || tier.Percent < 0 {
+				return errors.New("fee tiers cannot be negative")
+			}
+			if i > 0 && tier.MinVolume <= f.Tiers[i-1].MinVolume {
+				return errors.New("fee tiers must be in increasing order of volume")
+			}
+		}
+		return nil
+	default:
+		return errors.New("fee type must be 'flat', 'per_share', 'percentage' or 'tiered'")
+	}
+}
+
+// Fee calculates the commission for a trade, rounded to the cent and clamped to the min and max fee
+func (f *FeeSchedule) Fee(quantity float64, price, monthlyVolume money.Money) money.Money {
+	value := price.Mul(quantity)
+
+	var fee money.Money
+	switch f.Type {
+	case FlatFee:
+		fee = f.FlatFee
+	case PerShareFee:
+		fee = f.PerShare.Mul(quantity)
+	case PercentageFee:
+		fee = value.MulRate(f.Percent / 100)
+	case TieredFee:
+		// Use the highest tier the user's volume has reached
+		percent := 0.0
+		for _, tier := range f.Tiers {
+			if monthlyVolume >= tier.MinVolume {
+				percent = tier.Percent
+			}
+		}
+		fee = value.MulRate(percent / 100)
+	}
+
+	fee = money.Max(fee, f.MinFee)
+	if f.MaxFee > 0 {
+		fee = money.Min(fee, f.MaxFee)
+	}
+	return fee
+}
+
+// FeeScheduleRepository interface defines methods for fee schedule data access
+type FeeScheduleRepository interface {
+	GetCurrentFeeSchedule() (*FeeSchedule, error)
+	SaveFeeSchedule(schedule *FeeSchedule) error
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Fundamentals are the simulated company figures behind a stock. EPS and revenue cover the
+// last four quarters and change with each earnings report.
+type Fundamentals struct {
+	StockID           int       `json:"stock_id"`
+	Symbol            string    `json:"symbol"`
+	Price             float64   `json:"price"`
+	SharesOutstanding int64     `json:"shares_outstanding"`
+	EPS               float64   `json:"eps"`                // Earnings per share over the last four quarters
+	Revenue           float64   `json:"revenue"`            // Revenue over the last four quarters
+	PERatio           *float64  `json:"pe_ratio,omitempty"` // Price over EPS; missing while the company makes a loss
+	MarketCap         float64   `json:"market_cap"`         // Price times shares outstanding
+	FiscalYear        int       `json:"fiscal_year"`        // Year of the last quarter reported
+	FiscalQuarter     int       `json:"fiscal_quarter"`     // Last quarter reported, 1 to 4
+	NextEarningsAt    time.Time `json:"next_earnings_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// SetPrice works out the figures that depend on the share price
+func (f *Fundamentals) SetPrice(price float64) {
+	f.Price = price
+	f.MarketCap = math.Round(price * float64(f.SharesOutstanding))
+	f.PERatio = nil
+	if f.EPS > 0 {
+		pe := math.Round(price/f.EPS*100) / 100
+		f.PERatio = &pe
+	}
+}
+
+// NextQuarter returns the fiscal quarter after the last one reported
+func (f *Fundamentals) NextQuarter() (year, quarter int) {
+	if f.FiscalQuarter >= 4 {
+		return f.FiscalYear + 1, 1
+	}
+	return f.FiscalYear, f.FiscalQuarter + 1
+}
+
+// EarningsReport is a company's results for one quarter, against what was expected
+type EarningsReport struct {
+	ID              int       `json:"id"`
+	StockID         int       `json:"stock_id"`
+	Symbol          string    `json:"symbol,omitempty"`
+	FiscalYear      int       `json:"fiscal_year"`
+	FiscalQuarter   int       `json:"fiscal_quarter"`
+	EPS             float64   `json:"eps"`
+	ExpectedEPS     float64   `json:"expected_eps"`
+	Revenue         float64   `json:"revenue"`
+	ExpectedRevenue float64   `json:"expected_revenue"`
+	Surprise        float64   `json:"surprise"`     // Fraction EPS beat expectations by; negative for a miss
+	PriceImpact     float64   `json:"price_impact"` // Price move the report caused, as a fraction
+	ReportedAt      time.Time `json:"reported_at"`
+}
+
+// FundamentalsRepository interface defines methods for fundamentals and earnings data access
+type FundamentalsRepository interface {
+	GetFundamentals(stockID int) (*Fundamentals, error)
+	CreateFundamentals(f *Fundamentals) error
+	GetStockIDsWithoutFundamentals() ([]int, error)
+	GetDueFundamentals(now time.Time) ([]*Fundamentals, error)
+	UpdateFundamentalsTx(tx *sql.Tx, f *Fundamentals) error
+	CreateEarningsReportTx(tx *sql.Tx, report *EarningsReport) error
+	SetReportPriceImpact(reportID int, impact float64) error
+	GetEarningsReports(stockID int, limit, offset int) ([]*EarningsReport, error)
+	SplitFundamentalsTx(tx *sql.Tx, stockID int, ratio float64) error
+}
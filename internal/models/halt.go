@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// TradingHalt is a stock whose trading is stopped
+type TradingHalt struct {
+	StockID int        `json:"stock_id"`
+	Symbol  string     `json:"symbol"`
+	Reason  string     `json:"reason"` // limit_up, limit_down, circuit_breaker or admin
+	Since   time.Time  `json:"since"`
+	Until   *time.Time `json:"until,omitempty"` // Not set when the halt lasts until an admin resumes the stock
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// MarketIndex is a market index's current level and how it has done today
+type MarketIndex struct {
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Sector        string    `json:"sector,omitempty"` // Empty for the composite
+	Value         float64   `json:"value"`
+	PreviousClose float64   `json:"previous_close"` // Last level before today, or today's first if the index is new
+	Change        float64   `json:"change"`
+	ChangePercent float64   `json:"change_percent"`
+	Members       int       `json:"members"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// IndexPoint is a market index's level at one time
+type IndexPoint struct {
+	Code       string    `json:"code,omitempty"`
+	Value      float64   `json:"value"`
+	RecordedAt time.Time `json:"time"`
+}
+
+// Benchmark compares a user's return since they joined with a market index's over the same time
+type Benchmark struct {
+	IndexCode       string      `json:"index_code"`
+	Since           time.Time   `json:"since"`          // When the user joined, or the index's first level if later
+	StartingValue   money.Money `json:"starting_value"` // Cash the user started with
+	PortfolioValue  money.Money `json:"portfolio_value"`
+	PortfolioReturn float64     `json:"portfolio_return"` // As a fraction
+	IndexStart      float64     `json:"index_start"`
+	IndexValue      float64     `json:"index_value"`
+	IndexReturn     float64     `json:"index_return"`  // As a fraction
+	ExcessReturn    float64     `json:"excess_return"` // Portfolio return less the index's
+}
+
+// IndexRepository interface defines methods for index history data access
+type IndexRepository interface {
+	SaveIndexPoints(points []*IndexPoint) error
+	GetLatestIndexLevels() (map[string]float64, error)
+	GetIndexLevelAt(code string, at time.Time) (*IndexPoint, error)
+	GetIndexHistory(code string, from, to time.Time, limit int) ([]*IndexPoint, error)
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// IPOStatus defines where an IPO is in its lifecycle
+type IPOStatus string
+
+const (
+	IPOOpen      IPOStatus = "open"      // Taking subscriptions until it closes
+	IPOAllocated IPOStatus = "allocated" // Shares allocated and the stock listed
+	IPOCancelled IPOStatus = "cancelled" // Withdrawn before allocation; subscriptions refunded
+)
+
+// IPO is a new listing that users subscribe to before it starts trading
+type IPO struct {
+	ID         int         `json:"id"`
+	StockID    int         `json:"stock_id"`
+	Symbol     string      `json:"symbol,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Sector     string      `json:"sector,omitempty"`
+	Float      int         `json:"float"`     // Shares offered
+	Price      money.Money `json:"ipo_price"` // Price every allocated share is bought at
+	OpensAt    time.Time   `json:"opens_at"`  // Subscriptions are taken from this time
+	ClosesAt   time.Time   `json:"closes_at"` // Shares are allocated and the stock listed at this time
+	Status     IPOStatus   `json:"status"`
+	Subscribed int         `json:"subscribed"` // Shares requested so far
+	CreatedBy  *int        `json:"created_by,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// IPOSubscription is one user's request for shares in an IPO. The cost of the shares
+// requested is held back from the user's cash until the IPO is allocated or cancelled.
+type IPOSubscription struct {
+	ID        int       `json:"id"`
+	IPOID     int       `json:"ipo_id"`
+	UserID    int       `json:"user_id"`
+	Quantity  int       `json:"quantity"`            // Shares requested
+	Allocated *int      `json:"allocated,omitempty"` // Shares received, once allocated
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IPORepository interface defines methods for IPO data access
+type IPORepository interface {
+	CreateIPOTx(tx *sql.Tx, ipo *IPO) error
+	GetIPOByID(id int) (*IPO, error)
+	GetIPOs(status IPOStatus, limit, offset int) ([]*IPO, error)
+	GetDueIPOs(now time.Time) ([]*IPO, error)
+	GetIPOForUpdate(tx *sql.Tx, id int) (*IPO, error)
+	UpdateIPOStatusTx(tx *sql.Tx, id int, from, to IPOStatus) error
+	GetUserSubscriptions(userID int) ([]*IPOSubscription, error)
+	GetSubscriptionForUpdate(tx *sql.Tx, ipoID, userID int) (*IPOSubscription, error)
+	GetSubscriptionsForUpdate(tx *sql.Tx, ipoID int) ([]*IPOSubscription, error)
+	SaveSubscriptionTx(tx *sql.Tx, ipoID, userID, quantity int) error
+	DeleteSubscriptionTx(tx *sql.Tx, subscriptionID int) error
+	SetAllocatedTx(tx *sql.Tx, subscriptionID, allocated int) error
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// LedgerAccount is one side of a ledger posting. A user's own accounts hold their money;
+// the others are where it comes from and goes to outside the user.
+type LedgerAccount string
+
+const (
+	CashAccount   LedgerAccount = "cash"   // The user's cash balance
+	LoanAccount   LedgerAccount = "loan"   // The user's margin loan; its balance is what they owe, negated
+	EscrowAccount LedgerAccount = "escrow" // Cash held back for the user's IPO subscriptions
+
+	MarketAccount          LedgerAccount = "market"            // Other side of trades, option premiums and settlements
+	FeeAccount             LedgerAccount = "fees"              // Commissions and borrow fees
+	InterestAccount        LedgerAccount = "interest"          // Margin interest
+	CorporateActionAccount LedgerAccount = "corporate_actions" // Dividends, dividend charges and cash in lieu
+	AdjustmentAccount      LedgerAccount = "adjustments"       // Balances changed by an admin
+	BonusAccount           LedgerAccount = "bonuses"           // Cash given to new users
+	OpeningBalanceAccount  LedgerAccount = "opening_balances"  // Balances users had before the ledger was kept
+)
+
+// LedgerEntry is one double-entry posting: Amount moves out of CreditAccount and into DebitAccount.
+// An account's balance is what has been debited to it less what has been credited from it.
+type LedgerEntry struct {
+	ID            int           `json:"id"`
+	UserID        int           `json:"user_id"`
+	DebitAccount  LedgerAccount `json:"debit_account"`  // Where the money went
+	CreditAccount LedgerAccount `json:"credit_account"` // Where the money came from
+	Amount        money.Money   `json:"amount"`         // Always positive
+	TransactionID *int          `json:"transaction_id,omitempty"`
+	Memo          string        `json:"memo,omitempty"`
+	CreatedBy     *int          `json:"created_by,omitempty"` // The admin who made an adjustment
+	CreatedAt     time.Time     `json:"created_at"`
+}
+
+// Transfer moves amount from one account to another. A negative amount moves it the other way.
+func Transfer(from, to LedgerAccount, amount money.Money) *LedgerEntry {
+	if amount < 0 {
+		from, to, amount = to, from, -amount
+	}
+	return &LedgerEntry{DebitAccount: to, CreditAccount: from, Amount: amount}
+}
+
+// Change is how much the entry changes an account's balance by
+func (e *LedgerEntry) Change(account LedgerAccount) money.Money {
+	var change money.Money
+	if e.DebitAccount == account {
+		change += e.Amount
+	}
+	if e.CreditAccount == account {
+		change -= e.Amount
+	}
+	return change
+}
+
+// LedgerBalance compares the balances stored for a user with the balances their ledger adds up to,
+// and the cash their transactions moved with the cash the ledger entries for them moved
+type LedgerBalance struct {
+	UserID       int         `json:"user_id"`
+	Username     string      `json:"username"`
+	CashBalance  money.Money `json:"cash_balance"`
+	LedgerCash   money.Money `json:"ledger_cash"`
+	LoanBalance  money.Money `json:"loan_balance"`
+	LedgerLoan   money.Money `json:"ledger_loan"` // What the ledger says is owed
+	Escrow       money.Money `json:"escrow"`      // Held back for IPO subscriptions that haven't been allocated
+	LedgerEscrow money.Money `json:"ledger_escrow"`
+
+	// Transactions from before the ledger was kept have no entries, so only those from the
+	// first to the last transaction the ledger records are compared
+	FirstTransactionID    int         `json:"-"`
+	LastTransactionID     int         `json:"-"`
+	TransactionCash       money.Money `json:"transaction_cash"`        // Net cash the transactions say they moved
+	LedgerTransactionCash money.Money `json:"ledger_transaction_cash"` // Net cash the ledger entries for them moved
+}
+
+// Balanced reports whether every stored balance and the transactions agree with the ledger
+func (b *LedgerBalance) Balanced() bool {
+	return b.CashBalance == b.LedgerCash && b.LoanBalance == b.LedgerLoan && b.Escrow == b.LedgerEscrow &&
+		b.TransactionCash == b.LedgerTransactionCash
+}
+
+// LedgerReconciliation is the result of checking every user's balances against the ledger
+type LedgerReconciliation struct {
+	Checked   int              `json:"checked"`
+	Flagged   []*LedgerBalance `json:"flagged"` // Users with a balance that disagrees with their ledger
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+// LedgerRepository interface defines methods for ledger data access
+type LedgerRepository interface {
+	PostTx(tx *sql.Tx, userID int, entries []*LedgerEntry) (cash, loan money.Money, err error)
+	GetUserEntries(userID, limit, offset int) ([]*LedgerEntry, error)
+	GetBalances() ([]*LedgerBalance, error)
+}
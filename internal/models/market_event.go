@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"officestonks/pkg/market"
+)
+
+// Sources of market events
+const (
+	EventSourceGenerated = "generated" // Made up by the simulator
+	EventSourceAdmin     = "admin"     // Written by an admin
+)
+
+// MarketEvent is a piece of news that moved the market
+type MarketEvent struct {
+	ID          int               `json:"id"`
+	Scope       market.EventScope `json:"scope"`
+	StockID     *int              `json:"stock_id,omitempty"`
+	Symbol      string            `json:"symbol,omitempty"`
+	Sector      string            `json:"sector,omitempty"`
+	Headline    string            `json:"headline"`
+	PriceImpact float64           `json:"price_impact"` // Immediate price change, as a fraction
+	TrendImpact float64           `json:"trend_impact"` // Extra return per tick that follows the news
+	Source      string            `json:"source"`
+	CreatedBy   *int              `json:"created_by,omitempty"` // Admin who wrote the event
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// MarketEventRepository interface defines methods for market event data access
+type MarketEventRepository interface {
+	CreateEvent(event *MarketEvent) error
+	GetRecentEvents(limit, offset int) ([]*MarketEvent, error)
+}
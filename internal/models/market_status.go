@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// MarketStatus says whether the market is open and when that next changes
+type MarketStatus struct {
+	IsOpen     bool       `json:"is_open"`
+	Timezone   string     `json:"timezone"`
+	ServerTime time.Time  `json:"server_time"`
+	NextOpen   *time.Time `json:"next_open,omitempty"`  // Not set when the market is always open
+	NextClose  *time.Time `json:"next_close,omitempty"` // Not set when the market is always open
+	Holiday    string     `json:"holiday,omitempty"`    // Today's holiday or early close, if any
+}
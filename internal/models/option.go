@@ -0,0 +1,110 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// OptionType defines whether an option is the right to buy or to sell
+type OptionType string
+
+const (
+	CallOption OptionType = "call" // The right to buy the shares at the strike
+	PutOption  OptionType = "put"  // The right to sell the shares at the strike
+)
+
+// OptionStatus defines where an option contract is in its lifecycle
+type OptionStatus string
+
+const (
+	OptionActive  OptionStatus = "active"  // Trading until it expires
+	OptionExpired OptionStatus = "expired" // Settled at expiry or when its stock was delisted
+)
+
+// OptionContract is a listed call or put on a stock. Each contract covers Shares shares.
+type OptionContract struct {
+	ID              int          `json:"id"`
+	StockID         int          `json:"stock_id"`
+	Symbol          string       `json:"symbol"` // The underlying stock's symbol
+	Type            OptionType   `json:"type"`
+	Strike          money.Money  `json:"strike"`
+	Shares          int          `json:"shares"` // Shares delivered by one contract; changes with splits
+	ExpiresAt       time.Time    `json:"expires_at"`
+	Status          OptionStatus `json:"status"`
+	SettlementPrice *money.Money `json:"settlement_price,omitempty"` // Underlying price it was settled at
+	CreatedAt       time.Time    `json:"created_at"`
+
+	// Filled in when the contract is priced
+	UnderlyingPrice money.Money `json:"underlying_price,omitempty"`
+	Premium         money.Money `json:"premium,omitempty"` // Price per share; a contract costs Premium * Shares
+	Greeks          *Greeks     `json:"greeks,omitempty"`
+}
+
+// IsCall reports whether the contract is a call
+func (c *OptionContract) IsCall() bool {
+	return c.Type == CallOption
+}
+
+// IntrinsicValue is what the contract pays per share if exercised at price
+func (c *OptionContract) IntrinsicValue(price money.Money) money.Money {
+	if c.IsCall() && price > c.Strike {
+		return price - c.Strike
+	}
+	if !c.IsCall() && price < c.Strike {
+		return c.Strike - price
+	}
+	return 0
+}
+
+// Greeks are an option's sensitivities, per share of the underlying
+type Greeks struct {
+	Delta float64 `json:"delta"`
+	Gamma float64 `json:"gamma"`
+	Theta float64 `json:"theta"` // Per day
+	Vega  float64 `json:"vega"`  // Per volatility point
+	Rho   float64 `json:"rho"`   // Per interest rate point
+}
+
+// OptionChain is every active contract on a stock, priced at its current price
+type OptionChain struct {
+	StockID         int               `json:"stock_id"`
+	Symbol          string            `json:"symbol"`
+	UnderlyingPrice money.Money       `json:"underlying_price"`
+	Volatility      float64           `json:"volatility"`     // Annualised volatility the contracts are priced with
+	RiskFreeRate    float64           `json:"risk_free_rate"` // Annual
+	Contracts       []*OptionContract `json:"contracts"`      // By expiry, then type, then strike
+}
+
+// OptionPosition is a number of contracts a user has bought and not yet sold or had settled
+type OptionPosition struct {
+	ID          int         `json:"id"`
+	UserID      int         `json:"user_id"`
+	ContractID  int         `json:"contract_id"`
+	Quantity    int         `json:"quantity"`     // Contracts held
+	AverageCost money.Money `json:"average_cost"` // Average premium paid per contract, including commission
+	OpenedAt    time.Time   `json:"opened_at"`
+
+	// For joined queries
+	Contract OptionContract `json:"contract"`
+
+	// Filled in by GetUserPortfolio
+	MarketValue money.Money `json:"market_value"`
+}
+
+// OptionRepository interface defines methods for option contract and position data access
+type OptionRepository interface {
+	CreateContracts(contracts []*OptionContract) (int, error)
+	GetContractByID(id int) (*OptionContract, error)
+	GetActiveContracts(stockID int) ([]*OptionContract, error)
+	GetExpiredContracts(now time.Time) ([]*OptionContract, error)
+	GetContractForUpdate(tx *sql.Tx, id int) (*OptionContract, error)
+	SettleContractTx(tx *sql.Tx, id int, price money.Money) error
+	SplitContractsTx(tx *sql.Tx, stockID int, ratio float64) error
+	GetUserOptionPositions(userID int) ([]*OptionPosition, error)
+	GetOptionPositionForUpdate(tx *sql.Tx, userID, contractID int) (*OptionPosition, error)
+	GetContractPositionsForUpdate(tx *sql.Tx, contractID int) ([]*OptionPosition, error)
+	AddOptionPositionTx(tx *sql.Tx, userID, contractID, quantity int, costPerContract money.Money) error
+	UpdateOptionQuantityTx(tx *sql.Tx, positionID, newQuantity int) error
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// OrderType defines how an order is executed
+type OrderType string
+
+const (
+	MarketOrder       OrderType = "market"
+	LimitOrder        OrderType = "limit"
+	StopLossOrder     OrderType = "stop_loss"
+	TakeProfitOrder   OrderType = "take_profit"
+	TrailingStopOrder OrderType = "trailing_stop"
+)
+
+// IsConditional reports whether the order type is a sell that waits for a trigger price
+func (t OrderType) IsConditional() bool {
+	return t == StopLossOrder || t == TakeProfitOrder || t == TrailingStopOrder
+}
+
+// OrderStatus defines the lifecycle state of an order
+type OrderStatus string
+
+const (
+	OrderOpen      OrderStatus = "open"
+	OrderFilled    OrderStatus = "filled"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// Order represents a resting order waiting for the market to reach its price
+type Order struct {
+	ID          int             `json:"id"`
+	UserID      int             `json:"user_id"`
+	StockID     int             `json:"stock_id"`
+	Side        TransactionType `json:"side"` // "buy" or "sell"
+	OrderType   OrderType       `json:"order_type"`
+	Quantity    float64         `json:"quantity"`
+	LimitPrice  money.Money     `json:"limit_price"`
+	ReservedFee money.Money     `json:"reserved_fee,omitempty"` // Commission held back with a limit buy, on top of its cost
+	Status      OrderStatus     `json:"status"`
+	FilledPrice *money.Money    `json:"filled_price,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+
+	// Conditional orders: the order triggers a market sell once the price crosses StopPrice.
+	// Trailing stops move StopPrice up behind HighWaterMark by TrailAmount or TrailPercent.
+	StopPrice     money.Money `json:"stop_price,omitempty"`
+	TrailAmount   money.Money `json:"trail_amount,omitempty"`
+	TrailPercent  float64     `json:"trail_percent,omitempty"`
+	HighWaterMark money.Money `json:"high_water_mark,omitempty"`
+
+	// For joined queries
+	Stock Stock `json:"stock,omitempty"`
+}
+
+// LimitCrossed reports whether price lets a limit order fill: buys fill at or below
+// their limit, sells at or above it
+func (o *Order) LimitCrossed(price money.Money) bool {
+	if o.Side == Buy {
+		return price <= o.LimitPrice
+	}
+	return price >= o.LimitPrice
+}
+
+// TrailingStopPrice returns the trigger price trailing below the order's high-water mark
+func (o *Order) TrailingStopPrice() money.Money {
+	if o.TrailPercent > 0 {
+		return o.HighWaterMark.MulRate(1 - o.TrailPercent/100)
+	}
+	return o.HighWaterMark - o.TrailAmount
+}
+
+// RaiseTrail moves a trailing stop up behind a new high and reports whether it moved
+func (o *Order) RaiseTrail(price money.Money) bool {
+	if o.OrderType != TrailingStopOrder || price <= o.HighWaterMark {
+		return false
+	}
+	o.HighWaterMark = price
+	o.StopPrice = o.TrailingStopPrice()
+	return true
+}
+
+// Triggered reports whether price has crossed a conditional order's trigger.
+// Take-profits fire at or above their target, stop-losses and trailing stops at or below their stop.
+func (o *Order) Triggered(price money.Money) bool {
+	switch o.OrderType {
+	case TakeProfitOrder:
+		return price >= o.StopPrice
+	case StopLossOrder, TrailingStopOrder:
+		return price <= o.StopPrice
+	default:
+		return false
+	}
+}
+
+// OrderRepository interface defines methods for order data access
+type OrderRepository interface {
+	CreateOrderTx(tx *sql.Tx, order *Order) (*Order, error)
+	GetOrderByID(id int) (*Order, error)
+	GetUserOrders(userID int, status OrderStatus) ([]*Order, error)
+	GetOpenOrdersForStock(stockID int) ([]*Order, error)
+	MarkOrderFilledTx(tx *sql.Tx, orderID int, quantity float64, price money.Money) error
+	UpdateTrailingStop(orderID int, highWaterMark, stopPrice money.Money) error
+	CancelOrder(orderID, userID int) error
+	GetReservedCash(userID int) (money.Money, error)
+	GetReservedCashTx(tx *sql.Tx, userID int) (money.Money, error)
+	GetReservedSharesTx(tx *sql.Tx, userID, stockID int) (float64, error)
+	SplitOpenOrdersTx(tx *sql.Tx, stockID int, ratio, step float64) error
+	CancelOpenOrdersForStockTx(tx *sql.Tx, stockID int) error
+}
@@ -1,28 +1,97 @@
 package models
 
+import (
+	"database/sql"
+	"math"
+
+	"officestonks/pkg/money"
+)
+
+// ShareScale is how finely share quantities are stored: the schema keeps them to millionths of a share
+const ShareScale = 1e6
+
+// RoundShares rounds a share quantity to what the schema stores, dropping floating point drift
+func RoundShares(quantity float64) float64 {
+	return math.Round(quantity*ShareScale) / ShareScale
+}
+
 // Portfolio represents a user's stock holding
 type Portfolio struct {
-	ID       int   `json:"id"`
-	UserID   int   `json:"user_id"`
-	StockID  int   `json:"stock_id"`
-	Quantity int   `json:"quantity"`
-	Stock    Stock `json:"stock,omitempty"` // For joined queries
+	ID       int     `json:"id"`
+	UserID   int     `json:"user_id"`
+	StockID  int     `json:"stock_id"`
+	Quantity float64 `json:"quantity"` // Shares held, possibly a fraction of a share
+	Stock    Stock   `json:"stock,omitempty"` // For joined queries
+
+	// Filled in from tax lots by GetUserPortfolio
+	CostBasis     money.Money `json:"cost_basis"`     // What the shares cost, including commission
+	AverageCost   float64     `json:"average_cost"`   // Cost basis per share
+	MarketValue   money.Money `json:"market_value"`   // What the shares are worth at the current price
+	UnrealizedPnL money.Money `json:"unrealized_pnl"` // Market value minus cost basis
 }
 
 // PortfolioRepository interface defines methods for portfolio data access
 type PortfolioRepository interface {
 	GetUserPortfolio(userID int) ([]*Portfolio, error)
 	GetUserStockHolding(userID, stockID int) (*Portfolio, error)
-	AddStockToPortfolio(userID, stockID, quantity int) error
-	UpdateStockQuantity(portfolioID, newQuantity int) error
+	AddStockToPortfolio(userID, stockID int, quantity float64) error
+	UpdateStockQuantity(portfolioID int, newQuantity float64) error
 	RemoveStockFromPortfolio(portfolioID int) error
-	CalculatePortfolioValue(userID int) (float64, error)
+	GetUserStockHoldingForUpdate(tx *sql.Tx, userID, stockID int) (*Portfolio, error)
+	AddStockToPortfolioTx(tx *sql.Tx, userID, stockID int, quantity float64) error
+	UpdateStockQuantityTx(tx *sql.Tx, portfolioID int, newQuantity float64) error
+	CalculateStockValue(userID int) (money.Money, error)
+	CalculatePortfolioValue(userID int) (money.Money, error)
+	GetUserIDsHoldingStock(stockID int) ([]int, error)
 }
 
 // PortfolioSummary provides an overview of a user's entire portfolio
 type PortfolioSummary struct {
-	CashBalance     float64      `json:"cash_balance"`
-	StockValue      float64      `json:"stock_value"`
-	TotalValue      float64      `json:"total_value"`
+	CashBalance     money.Money  `json:"cash_balance"`
+	StockValue      money.Money  `json:"stock_value"`
+	TotalValue      money.Money  `json:"total_value"` // Net worth: cash + stock value - liabilities
 	PortfolioItems  []*Portfolio `json:"portfolio_items"`
+	
+	// Short selling
+	ShortPositions  []*ShortPosition `json:"short_positions"`
+	ShortExposure   money.Money      `json:"short_exposure"` // Market value of all borrowed shares
+	Liabilities     money.Money      `json:"liabilities"`    // What the user owes: covering all shorts plus the margin loan
+	
+	// Options
+	OptionPositions []*OptionPosition `json:"option_positions"`
+	OptionValue     money.Money       `json:"option_value"` // Market value of all option positions, included in TotalValue
+	
+	// Margin account
+	MarginEnabled   bool             `json:"margin_enabled"`
+	LoanBalance     money.Money      `json:"loan_balance"`
+	BuyingPower     money.Money      `json:"buying_power"` // Cash available for buying stock, including what can still be borrowed
+	
+	// Trading costs and P&L
+	TotalFees       money.Money      `json:"total_fees"`     // Commission paid on all trades to date
+	CostBasis       money.Money      `json:"cost_basis"`     // What the current holdings cost
+	UnrealizedPnL   money.Money      `json:"unrealized_pnl"` // Gain or loss on current holdings
+	RealizedPnL     money.Money      `json:"realized_pnl"`   // Gain or loss locked in by sales, covers and fees
+	
+	// Look-through exposure, counting the stocks inside ETFs rather than the ETFs themselves
+	Exposures       []*Exposure       `json:"exposures"`
+	SectorExposures []*SectorExposure `json:"sector_exposures"`
+}
+
+// Exposure is how much of a user's money rides on one stock, held directly or through ETFs.
+// Short positions count against it.
+type Exposure struct {
+	StockID int         `json:"stock_id"`
+	Symbol  string      `json:"symbol"`
+	Sector  string      `json:"sector"`
+	Direct  money.Money `json:"direct"`   // Market value held directly, less any short position
+	ViaETFs money.Money `json:"via_etfs"` // Market value held through ETFs, less ETFs shorted
+	Total   money.Money `json:"total"`
+}
+
+// SectorExposure is how much of a user's money rides on one sector, with ETFs looked through.
+// Cash held inside ETFs is counted under the "Cash" sector.
+type SectorExposure struct {
+	Sector string      `json:"sector"`
+	Value  money.Money `json:"value"`
+	Weight float64     `json:"weight"` // Share of the user's gross exposure, as a fraction
 }
\ No newline at end of file
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"officestonks/pkg/market"
+)
+
+// PriceModels lists which price model the simulator uses for each sector and stock,
+// and how strongly each stock follows the market and its sector
+type PriceModels struct {
+	Default market.ModelParams             `json:"default"`
+	Sectors map[string]*market.ModelParams `json:"sectors"`
+	Stocks  map[int]*market.ModelParams    `json:"stocks"`
+	Factors market.FactorConfig            `json:"factors"`
+	Betas   map[int]market.Betas           `json:"betas"`
+}
+
+// PriceModelRepository interface defines methods for price model data access
+type PriceModelRepository interface {
+	GetStockModels() (map[int]*market.ModelParams, error)
+	SetStockModel(stockID int, params *market.ModelParams) error
+	GetSectorModels() (map[string]*market.ModelParams, error)
+	SetSectorModel(sector string, params *market.ModelParams) error
+	GetStockBetas() (map[int]market.Betas, error)
+	SetStockBetas(stockID int, betas market.Betas) error
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// ShortPosition represents shares a user has borrowed and sold, and must buy back
+type ShortPosition struct {
+	ID         int         `json:"id"`
+	UserID     int         `json:"user_id"`
+	StockID    int         `json:"stock_id"`
+	Quantity   float64     `json:"quantity"`
+	EntryPrice money.Money `json:"entry_price"` // Average price the shares were sold short at
+	OpenedAt   time.Time   `json:"opened_at"`
+
+	// For joined queries
+	Stock Stock `json:"stock,omitempty"`
+}
+
+// MarketValue is what it would cost to buy the shares back at the stock's current price
+func (p *ShortPosition) MarketValue() money.Money {
+	return p.Stock.CurrentPrice.Mul(p.Quantity)
+}
+
+// ShortPositionRepository interface defines methods for short position data access
+type ShortPositionRepository interface {
+	GetUserShortPositions(userID int) ([]*ShortPosition, error)
+	GetAllShortPositions() ([]*ShortPosition, error)
+	GetUserIDsWithShortsInStock(stockID int) ([]int, error)
+	GetShortMarketValue(userID int) (money.Money, error)
+	GetShortPositionForUpdate(tx *sql.Tx, userID, stockID int) (*ShortPosition, error)
+	AddShortTx(tx *sql.Tx, userID, stockID int, quantity float64, price money.Money) error
+	UpdateShortQuantityTx(tx *sql.Tx, positionID int, newQuantity float64) error
+	SplitShortTx(tx *sql.Tx, positionID int, newQuantity float64, entryPrice money.Money) error
+}
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"officestonks/pkg/market"
+)
+
+// SimulatorStateRepository interface defines methods for saving and loading the market simulator's state
+type SimulatorStateRepository interface {
+	SaveSnapshot(snapshot *market.Snapshot) error
+	GetSnapshot() (*market.Snapshot, error)
+}
@@ -1,37 +1,67 @@
 package models
 
 import (
+	"database/sql"
 	"time"
+
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// StockStatus defines where a stock is in its listing lifecycle
+type StockStatus string
+
+const (
+	StockIPO      StockStatus = "ipo"      // Taking IPO subscriptions; not traded yet
+	StockListed   StockStatus = "listed"   // Traded and simulated
+	StockDelisted StockStatus = "delisted" // No longer traded; kept for history
+)
+
+// InstrumentType defines what sort of instrument a stock is
+type InstrumentType string
+
+const (
+	InstrumentStock InstrumentType = "stock" // A company, priced by the simulator
+	InstrumentETF   InstrumentType = "etf"   // A basket of stocks, priced at the basket's value
 )
 
 // Stock represents a company stock in the market
 type Stock struct {
-	ID           int       `json:"id"`
-	Symbol       string    `json:"symbol"`
-	Name         string    `json:"name"`
-	Sector       string    `json:"sector"`
-	CurrentPrice float64   `json:"current_price"`
-	LastUpdated  time.Time `json:"last_updated"`
+	ID           int                 `json:"id"`
+	Symbol       string              `json:"symbol"`
+	Name         string              `json:"name"`
+	Sector       string              `json:"sector"`
+	CurrentPrice money.Money         `json:"current_price"`
+	Status       StockStatus         `json:"status"`
+	Type         InstrumentType      `json:"type"`
+	LastUpdated  time.Time           `json:"last_updated"`
+	VolumeStats  *market.VolumeStats `json:"volume_stats,omitempty"` // Trading over the simulator's volume interval
 }
 
 // StockRepository interface defines methods for stock data access
 type StockRepository interface {
 	GetAllStocks() ([]*Stock, error)
+	GetStocksByStatus(status StockStatus) ([]*Stock, error)
 	GetStockByID(id int) (*Stock, error)
 	GetStockBySymbol(symbol string) (*Stock, error)
-	UpdateStockPrice(stockID int, newPrice float64) error
+	CreateStock(stock *Stock) error
+	CreateStockTx(tx *sql.Tx, stock *Stock) error
+	UpdateStock(stock *Stock) error
+	SetStockStatusTx(tx *sql.Tx, stockID int, from, to StockStatus) error
+	UpdateStockPrice(stockID int, newPrice money.Money) error
+	UpdateStockPriceTx(tx *sql.Tx, stockID int, newPrice money.Money) error
 	LoadStocksForSimulation() (map[int]struct {
 		ID       int
 		Symbol   string
 		Sector   string
-		Price    float64
+		Price    money.Money
 	}, error)
 	ResetAllStockPrices() error
 }
 
 // StockPrice represents a simple price update
 type StockPrice struct {
-	StockID int     `json:"stock_id"`
-	Symbol  string  `json:"symbol"`
-	Price   float64 `json:"price"`
+	StockID int         `json:"stock_id"`
+	Symbol  string      `json:"symbol"`
+	Price   money.Money `json:"price"`
 }
\ No newline at end of file
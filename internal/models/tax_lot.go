@@ -0,0 +1,44 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// CostBasisMethod decides which tax lots a sale uses up
+type CostBasisMethod string
+
+const (
+	FIFO        CostBasisMethod = "fifo"    // Sell the oldest shares first
+	LIFO        CostBasisMethod = "lifo"    // Sell the newest shares first
+	AverageCost CostBasisMethod = "average" // Every share costs the average price of the holding
+)
+
+// IsValid reports whether m is a supported cost basis method
+func (m CostBasisMethod) IsValid() bool {
+	return m == FIFO || m == LIFO || m == AverageCost
+}
+
+// TaxLot is a block of shares bought in one trade that hasn't been sold yet
+type TaxLot struct {
+	ID               int         `json:"id"`
+	UserID           int         `json:"user_id"`
+	StockID          int         `json:"stock_id"`
+	Quantity         float64     `json:"quantity"`          // Shares left in the lot
+	OriginalQuantity float64     `json:"original_quantity"` // Shares bought
+	CostPerShare     money.Money `json:"cost_per_share"`    // Purchase price plus commission, per share
+	TransactionID    *int        `json:"transaction_id,omitempty"`
+	AcquiredAt       time.Time   `json:"acquired_at"`
+}
+
+// TaxLotRepository interface defines methods for tax lot data access
+type TaxLotRepository interface {
+	GetUserLots(userID int) ([]*TaxLot, error)
+	AddLotTx(tx *sql.Tx, userID, stockID int, quantity float64, costPerShare money.Money, transactionID int) error
+	GetOpenLotsForUpdate(tx *sql.Tx, userID, stockID int, method CostBasisMethod) ([]*TaxLot, error)
+	UpdateLotQuantityTx(tx *sql.Tx, lotID int, newQuantity float64) error
+	SetLotCostTx(tx *sql.Tx, userID, stockID int, costPerShare money.Money) error
+	SplitLotTx(tx *sql.Tx, lotID int, quantity, originalQuantity float64, costPerShare money.Money) error
+}
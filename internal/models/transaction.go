@@ -1,15 +1,42 @@
 package models
 
 import (
+	"database/sql"
 	"time"
+
+	"officestonks/pkg/money"
 )
 
 // TransactionType defines the type of transaction
 type TransactionType string
 
 const (
-	Buy  TransactionType = "buy"
-	Sell TransactionType = "sell"
+	Buy       TransactionType = "buy"
+	Sell      TransactionType = "sell"
+	Short     TransactionType = "short"      // Sell borrowed shares
+	Cover     TransactionType = "cover"      // Buy back borrowed shares
+	BorrowFee TransactionType = "borrow_fee" // Fee for borrowing shares; Price is the fee per share
+
+	// Corporate actions
+	Dividend       TransactionType = "dividend"        // Dividend paid on shares held; Price is the dividend per share
+	DividendCharge TransactionType = "dividend_charge" // Dividend owed on shares sold short; Price is the dividend per share
+	StockSplit     TransactionType = "split"           // Shares held after a split, or owed as a negative Quantity; Price is the new share price
+	CashInLieu     TransactionType = "cash_in_lieu"    // Part of a share left over by a split, settled in cash; Quantity is 0 and Price is the cash received, negative when paid
+
+	// Listings
+	IPOAllocation TransactionType = "ipo"          // Shares allocated in an IPO at the IPO price
+	DelistSale    TransactionType = "delist_sale"  // Shares held in a delisted stock, cashed out at its last price
+	DelistCover   TransactionType = "delist_cover" // Shares owed in a delisted stock, settled at its last price
+
+	// Options; StockID is the underlying stock and OptionID the contract
+	OptionBuy    TransactionType = "option_buy"    // Contracts bought to open; Quantity is contracts and Price the premium per contract
+	OptionSell   TransactionType = "option_sell"   // Contracts sold to close; Quantity is contracts and Price the premium per contract
+	CallExercise TransactionType = "call_exercise" // Shares bought at the strike when a call is exercised at expiry
+	PutExercise  TransactionType = "put_exercise"  // Shares sold at the strike when a put is exercised at expiry
+	OptionSettle TransactionType = "option_settle" // Contracts settled in cash at expiry; Quantity is contracts and Price what each paid, 0 if worthless
+
+	// Margin accounts; StockID is 0
+	MarginInterest TransactionType = "margin_interest" // Interest added to a margin loan; Quantity is 0 and Price the interest charged
 )
 
 // Transaction represents a stock purchase or sale
@@ -17,24 +44,69 @@ type Transaction struct {
 	ID              int             `json:"id"`
 	UserID          int             `json:"user_id"`
 	StockID         int             `json:"stock_id"`
-	Quantity        int             `json:"quantity"`
-	Price           float64         `json:"price"`
+	Quantity        float64         `json:"quantity"`
+	Price           money.Money     `json:"price"`
 	TransactionType TransactionType `json:"transaction_type"`
+	Fee             money.Money     `json:"fee"` // Commission charged on top of the trade
+	RealizedPnL     *money.Money    `json:"realized_pnl,omitempty"` // Profit or loss locked in by a sale, cover or fee
+	OrderID         *int            `json:"order_id,omitempty"` // Set when the trade filled an order
+	OptionID        *int            `json:"option_id,omitempty"` // Set for option trades and settlements
 	CreatedAt       time.Time       `json:"created_at"`
 	
 	// For joined queries
 	Stock           Stock           `json:"stock,omitempty"`
 }
 
+// CashFlow is how much the transaction added to the user's cash, less any margin loan.
+// It is negative for money spent, and 0 for transactions that only move shares.
+func (t *Transaction) CashFlow() money.Money {
+	value := t.Price.Mul(t.Quantity)
+	switch t.TransactionType {
+	case Buy, Cover, IPOAllocation, CallExercise, DelistCover, OptionBuy:
+		return -value - t.Fee
+	case Sell, Short, PutExercise, DelistSale, OptionSell, OptionSettle:
+		return value - t.Fee
+	case BorrowFee:
+		return -value
+	case Dividend, DividendCharge:
+		// The entitlement is rounded to the cent as a whole, not per share
+		if t.RealizedPnL != nil {
+			return *t.RealizedPnL
+		}
+		return 0
+	case CashInLieu:
+		return t.Price
+	case MarginInterest:
+		return -t.Price
+	}
+	return 0
+}
+
 // TransactionRepository interface defines methods for transaction data access
 type TransactionRepository interface {
-	CreateTransaction(userID, stockID, quantity int, price float64, transType TransactionType) (*Transaction, error)
+	CreateTransaction(userID, stockID int, quantity float64, price money.Money, transType TransactionType) (*Transaction, error)
+	CreateTransactionTx(tx *sql.Tx, userID, stockID int, quantity float64, price money.Money, transType TransactionType, fee money.Money, orderID int) (*Transaction, error)
 	GetUserTransactions(userID int, limit, offset int) ([]*Transaction, error)
+	GetUserTransactionsBetween(userID, firstID, lastID int) ([]*Transaction, error)
+	GetMonthlyVolumeTx(tx *sql.Tx, userID int) (money.Money, error)
+	SetRealizedPnLTx(tx *sql.Tx, transactionID int, pnl money.Money) error
+	SetOptionTx(tx *sql.Tx, transactionID, optionID int) error
+	GetRealizedPnL(userID int) (money.Money, error)
+	GetTotalFees(userID int) (money.Money, error)
 }
 
 // TradeRequest represents a buy or sell request
 type TradeRequest struct {
-	StockID  int    `json:"stock_id"`
-	Quantity int    `json:"quantity"`
-	Action   string `json:"action"` // "buy" or "sell"
+	StockID    int         `json:"stock_id"`
+	Quantity   float64     `json:"quantity"`    // Shares, which may be a fraction of a share, or option contracts
+	Amount     money.Money `json:"amount"`      // Dollars of stock to buy or sell at market, instead of a quantity
+	Action     string      `json:"action"`      // "buy", "sell", "short", "cover", "buy_to_open" or "sell_to_close"
+	OptionID   int         `json:"option_id"`   // Option contract, for "buy_to_open" and "sell_to_close"
+	OrderType  string      `json:"order_type"`  // "market" (default), "limit", "stop_loss", "take_profit" or "trailing_stop"
+	LimitPrice money.Money `json:"limit_price"` // Required for limit orders
+
+	// Conditional sell orders
+	StopPrice    money.Money `json:"stop_price"`    // Trigger price for stop-loss and take-profit orders
+	TrailAmount  money.Money `json:"trail_amount"`  // Trailing stop distance in dollars
+	TrailPercent float64     `json:"trail_percent"` // Trailing stop distance as a percentage
 }
\ No newline at end of file
@@ -0,0 +1,11 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// TxRunner runs a unit of work inside a single database transaction.
+// Repository methods ending in Tx take the transaction so their changes commit or roll back together.
+type TxRunner interface {
+	RunInTx(fn func(tx *sql.Tx) error) error
+}
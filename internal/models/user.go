@@ -1,30 +1,43 @@
 package models
 
 import (
+	"database/sql"
 	"time"
+
+	"officestonks/pkg/money"
 )
 
 // User represents a user in the system
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // Never expose this in JSON
-	CashBalance  float64   `json:"cash_balance"`
-	IsAdmin      bool      `json:"is_admin"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID              int             `json:"id"`
+	Username        string          `json:"username"`
+	PasswordHash    string          `json:"-"` // Never expose this in JSON
+	CashBalance     money.Money     `json:"cash_balance"`
+	IsAdmin         bool            `json:"is_admin"`
+	MarginEnabled   bool            `json:"margin_enabled"`    // Whether the user may borrow to buy stock
+	LoanBalance     money.Money     `json:"loan_balance"`      // Outstanding margin loan, including accrued interest
+	CostBasisMethod CostBasisMethod `json:"cost_basis_method"` // Which shares a sale uses up
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
 }
 
+// StartingCash is the cash balance every new user starts with
+const StartingCash = 10000 * money.Dollar
+
 // UserRepository interface defines methods for user data access
 type UserRepository interface {
 	CreateUser(username, password string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	GetUserByUsername(username string) (*User, error)
-	UpdateUserBalance(userID int, newBalance float64) error
+	GetUserForUpdate(tx *sql.Tx, id int) (*User, error)
 	GetTopUsers(limit int) ([]*User, error)
+	SetMarginEnabled(userID int, enabled bool) error
+	SetCostBasisMethod(userID int, method CostBasisMethod) error
+	GetUserIDsWithLoans() ([]int, error)
+	GetUserIDsWithLoansHoldingStock(stockID int) ([]int, error)
 	IsUserAdmin(userID int) (bool, error)
 	GetAllUsers() ([]*User, error)
-	UpdateUser(userID int, cashBalance float64, isAdmin bool) error
+	UpdateUser(userID int, isAdmin bool) error
 	DeleteUser(userID int) error
 }
 
@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// CorporateActionRepo implements the CorporateActionRepository interface
+type CorporateActionRepo struct {
+	db *sql.DB
+}
+
+// NewCorporateActionRepo creates a new corporate action repository
+func NewCorporateActionRepo(db *sql.DB) *CorporateActionRepo {
+	return &CorporateActionRepo{db: db}
+}
+
+// corporateActionColumns are the columns scanCorporateAction reads, joined with the stock's symbol
+const corporateActionColumns = `
+	a.id, a.stock_id, s.symbol, a.action_type, a.amount, a.split_to, a.split_from,
+	a.ex_date, a.pay_date, a.status, a.source, a.created_by, a.created_at
+`
+
+// CreateAction stores a corporate action and fills in its ID, status and creation time
+func (r *CorporateActionRepo) CreateAction(action *models.CorporateAction) error {
+	query := `
+		INSERT INTO corporate_actions (stock_id, action_type, amount, split_to, split_from, ex_date, pay_date, status, source, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query, action.StockID, action.Type, action.Amount, action.SplitTo, action.SplitFrom,
+		action.ExDate, action.PayDate, models.ActionDeclared, action.Source, action.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	action.ID = int(id)
+	action.Status = models.ActionDeclared
+
+	return r.db.QueryRow("SELECT created_at FROM corporate_actions WHERE id = ?", action.ID).Scan(&action.CreatedAt)
+}
+
+// GetActionByID gets a corporate action by ID
+func (r *CorporateActionRepo) GetActionByID(id int) (*models.CorporateAction, error) {
+	query := `
+		SELECT ` + corporateActionColumns + `
+		FROM corporate_actions a
+		JOIN stocks s ON a.stock_id = s.id
+		WHERE a.id = ?
+	`
+
+	action, err := scanCorporateAction(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("corporate action not found")
+		}
+		return nil, err
+	}
+
+	return action, nil
+}
+
+// GetActions gets the corporate actions on a stock, or on every stock if stockID is 0, latest ex date first
+func (r *CorporateActionRepo) GetActions(stockID int, limit, offset int) ([]*models.CorporateAction, error) {
+	query := `
+		SELECT ` + corporateActionColumns + `
+		FROM corporate_actions a
+		JOIN stocks s ON a.stock_id = s.id
+		WHERE ? = 0 OR a.stock_id = ?
+		ORDER BY a.ex_date DESC, a.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	return queryCorporateActions(r.db, query, stockID, stockID, limit, offset)
+}
+
+// GetDueActions gets the declared actions whose ex date has passed and the dividends
+// whose pay date has passed, in the order they fell due
+func (r *CorporateActionRepo) GetDueActions(now time.Time) ([]*models.CorporateAction, error) {
+	query := `
+		SELECT ` + corporateActionColumns + `
+		FROM corporate_actions a
+		JOIN stocks s ON a.stock_id = s.id
+		WHERE (a.status = ? AND a.ex_date <= ?) OR (a.status = ? AND a.pay_date <= ?)
+		ORDER BY a.ex_date, a.id
+	`
+
+	return queryCorporateActions(r.db, query, models.ActionDeclared, now, models.ActionEx, now)
+}
+
+// HasPendingAction reports whether a stock has an action of a type that hasn't been paid or applied yet
+func (r *CorporateActionRepo) HasPendingAction(stockID int, actionType models.CorporateActionType) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM corporate_actions
+		WHERE stock_id = ? AND action_type = ? AND status IN (?, ?)
+	`
+
+	var count int
+	err := r.db.QueryRow(query, stockID, actionType, models.ActionDeclared, models.ActionEx).Scan(&count)
+	return count > 0, err
+}
+
+// CancelAction withdraws a corporate action that hasn't reached its ex date
+func (r *CorporateActionRepo) CancelAction(id int) error {
+	result, err := r.db.Exec("UPDATE corporate_actions SET status = ? WHERE id = ? AND status = ?",
+		models.ActionCancelled, id, models.ActionDeclared)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("corporate action not found or already in effect")
+	}
+
+	return nil
+}
+
+// UpdateActionStatusTx moves a corporate action from one status to the next inside a transaction.
+// This fails if the action has already moved on, so an action is never processed twice.
+func (r *CorporateActionRepo) UpdateActionStatusTx(tx *sql.Tx, id int, from, to models.CorporateActionStatus) error {
+	result, err := tx.Exec("UPDATE corporate_actions SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("corporate action is no longer " + string(from))
+	}
+
+	return nil
+}
+
+// RecordEntitlementsTx fixes who is owed a dividend, and who owes it on shares sold short,
+// from the holdings at the ex date inside a transaction
+func (r *CorporateActionRepo) RecordEntitlementsTx(tx *sql.Tx, action *models.CorporateAction) error {
+	holdersQuery := `
+		INSERT INTO dividend_entitlements (action_id, user_id, quantity, amount)
+		SELECT ?, user_id, quantity, ROUND(quantity * ?, 2)
+		FROM portfolios
+		WHERE stock_id = ? AND quantity > 0
+	`
+	if _, err := tx.Exec(holdersQuery, action.ID, action.Amount, action.StockID); err != nil {
+		return err
+	}
+
+	shortsQuery := `
+		INSERT INTO dividend_entitlements (action_id, user_id, quantity, amount)
+		SELECT ?, user_id, -quantity, -ROUND(quantity * ?, 2)
+		FROM short_positions
+		WHERE stock_id = ? AND quantity > 0
+	`
+	_, err := tx.Exec(shortsQuery, action.ID, action.Amount, action.StockID)
+	return err
+}
+
+// GetUnpaidEntitlementsTx gets a dividend's unpaid entitlements, by user, and locks them until the transaction ends
+func (r *CorporateActionRepo) GetUnpaidEntitlementsTx(tx *sql.Tx, actionID int) ([]*models.DividendEntitlement, error) {
+	query := `
+		SELECT id, action_id, user_id, quantity, amount
+		FROM dividend_entitlements
+		WHERE action_id = ? AND paid_at IS NULL
+		ORDER BY user_id, id
+		FOR UPDATE
+	`
+
+	rows, err := tx.Query(query, actionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entitlements []*models.DividendEntitlement
+	for rows.Next() {
+		var e models.DividendEntitlement
+		if err := rows.Scan(&e.ID, &e.ActionID, &e.UserID, &e.Quantity, &e.Amount); err != nil {
+			return nil, err
+		}
+		entitlements = append(entitlements, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entitlements, nil
+}
+
+// MarkEntitlementPaidTx records that a dividend entitlement has been paid inside a transaction
+func (r *CorporateActionRepo) MarkEntitlementPaidTx(tx *sql.Tx, entitlementID int) error {
+	_, err := tx.Exec("UPDATE dividend_entitlements SET paid_at = ? WHERE id = ?", time.Now(), entitlementID)
+	return err
+}
+
+// queryCorporateActions runs a corporate action query and scans the results
+func queryCorporateActions(q queryer, query string, args ...interface{}) ([]*models.CorporateAction, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []*models.CorporateAction
+	for rows.Next() {
+		action, err := scanCorporateAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, action)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return actions, nil
+}
+
+// scanCorporateAction reads a corporate action joined with its stock's symbol from a result row
+func scanCorporateAction(row rowScanner) (*models.CorporateAction, error) {
+	var a models.CorporateAction
+	var payDate sql.NullTime
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&a.ID,
+		&a.StockID,
+		&a.Symbol,
+		&a.Type,
+		&a.Amount,
+		&a.SplitTo,
+		&a.SplitFrom,
+		&a.ExDate,
+		&payDate,
+		&a.Status,
+		&a.Source,
+		&createdBy,
+		&a.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if payDate.Valid {
+		a.PayDate = &payDate.Time
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		a.CreatedBy = &id
+	}
+
+	return &a, nil
+}
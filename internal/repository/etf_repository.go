@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// ETFRepo implements the ETFRepository interface
+type ETFRepo struct {
+	db *sql.DB
+}
+
+// NewETFRepo creates a new ETF repository
+func NewETFRepo(db *sql.DB) *ETFRepo {
+	return &ETFRepo{db: db}
+}
+
+// CreateETFTx stores an ETF's basket for its stock inside a transaction and fills in its creation time
+func (r *ETFRepo) CreateETFTx(tx *sql.Tx, etf *models.ETF) error {
+	if len(etf.Constituents) == 0 {
+		return errors.New("an ETF needs at least one constituent")
+	}
+
+	if _, err := tx.Exec("INSERT INTO etfs (stock_id, cash) VALUES (?, ?)", etf.ID, etf.Cash); err != nil {
+		return err
+	}
+
+	placeholders := make([]string, 0, len(etf.Constituents))
+	args := make([]interface{}, 0, len(etf.Constituents)*3)
+	for _, c := range etf.Constituents {
+		placeholders = append(placeholders, "(?, ?, ?)")
+		args = append(args, etf.ID, c.StockID, c.Units)
+	}
+
+	query := "INSERT INTO etf_constituents (etf_id, stock_id, units) VALUES " +
+		strings.Join(placeholders, ", ")
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+
+	return tx.QueryRow("SELECT created_at FROM etfs WHERE stock_id = ?", etf.ID).Scan(&etf.CreatedAt)
+}
+
+// GetETFs gets every listed ETF with its basket, by symbol
+func (r *ETFRepo) GetETFs() ([]*models.ETF, error) {
+	query := `
+		SELECT s.id, s.symbol, s.name, s.sector, s.current_price, e.cash, e.created_at
+		FROM etfs e
+		JOIN stocks s ON e.stock_id = s.id
+		WHERE s.status = ?
+		ORDER BY s.symbol
+	`
+
+	rows, err := r.db.Query(query, models.StockListed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var etfs []*models.ETF
+	byID := make(map[int]*models.ETF)
+	for rows.Next() {
+		etf, err := scanETF(rows)
+		if err != nil {
+			return nil, err
+		}
+		etfs = append(etfs, etf)
+		byID[etf.ID] = etf
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	constituentsQuery := `
+		SELECT c.etf_id, c.stock_id, s.symbol, s.sector, c.units, s.current_price
+		FROM etf_constituents c
+		JOIN stocks s ON c.stock_id = s.id
+		JOIN stocks e ON c.etf_id = e.id
+		WHERE e.status = ?
+		ORDER BY c.etf_id, s.symbol
+	`
+
+	constituentRows, err := r.db.Query(constituentsQuery, models.StockListed)
+	if err != nil {
+		return nil, err
+	}
+	defer constituentRows.Close()
+
+	for constituentRows.Next() {
+		var etfID int
+		var c models.Constituent
+		if err := constituentRows.Scan(&etfID, &c.StockID, &c.Symbol, &c.Sector, &c.Units, &c.Price); err != nil {
+			return nil, err
+		}
+		if etf, ok := byID[etfID]; ok {
+			etf.Constituents = append(etf.Constituents, &c)
+		}
+	}
+	if err := constituentRows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, etf := range etfs {
+		etf.Reprice(nil)
+	}
+	return etfs, nil
+}
+
+// GetETFByID gets an ETF, listed or not, with its basket
+func (r *ETFRepo) GetETFByID(id int) (*models.ETF, error) {
+	query := `
+		SELECT s.id, s.symbol, s.name, s.sector, s.current_price, e.cash, e.created_at
+		FROM etfs e
+		JOIN stocks s ON e.stock_id = s.id
+		WHERE e.stock_id = ?
+	`
+
+	etf, err := scanETF(r.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.New("ETF not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	constituentsQuery := `
+		SELECT c.stock_id, s.symbol, s.sector, c.units, s.current_price
+		FROM etf_constituents c
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE c.etf_id = ?
+		ORDER BY s.symbol
+	`
+
+	rows, err := r.db.Query(constituentsQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.Constituent
+		if err := rows.Scan(&c.StockID, &c.Symbol, &c.Sector, &c.Units, &c.Price); err != nil {
+			return nil, err
+		}
+		etf.Constituents = append(etf.Constituents, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	etf.Reprice(nil)
+	return etf, nil
+}
+
+// SplitConstituentTx scales the units of a stock in every basket by a split's ratio inside a transaction,
+// so the baskets keep their value
+func (r *ETFRepo) SplitConstituentTx(tx *sql.Tx, stockID int, ratio float64) error {
+	_, err := tx.Exec("UPDATE etf_constituents SET units = units * ? WHERE stock_id = ?", ratio, stockID)
+	return err
+}
+
+// AccrueDividendTx adds a stock's dividend per share to the cash of every ETF holding it inside a transaction
+func (r *ETFRepo) AccrueDividendTx(tx *sql.Tx, stockID int, amount money.Money) error {
+	query := `
+		UPDATE etfs e
+		JOIN etf_constituents c ON c.etf_id = e.stock_id
+		SET e.cash = e.cash + ROUND(c.units * ?, 2)
+		WHERE c.stock_id = ?
+	`
+
+	_, err := tx.Exec(query, amount, stockID)
+	return err
+}
+
+// RemoveConstituentTx takes a stock out of every basket inside a transaction, turning its units into cash at price
+func (r *ETFRepo) RemoveConstituentTx(tx *sql.Tx, stockID int, price money.Money) error {
+	if err := r.AccrueDividendTx(tx, stockID, price); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("DELETE FROM etf_constituents WHERE stock_id = ?", stockID)
+	return err
+}
+
+// scanETF reads an ETF's stock details and cash from a result row
+func scanETF(row rowScanner) (*models.ETF, error) {
+	var etf models.ETF
+	err := row.Scan(&etf.ID, &etf.Symbol, &etf.Name, &etf.Sector, &etf.Price, &etf.Cash, &etf.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &etf, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"officestonks/internal/models"
+)
+
+// FeeScheduleRepo implements the FeeScheduleRepository interface
+type FeeScheduleRepo struct {
+	db *sql.DB
+}
+
+// NewFeeScheduleRepo creates a new fee schedule repository
+func NewFeeScheduleRepo(db *sql.DB) *FeeScheduleRepo {
+	return &FeeScheduleRepo{db: db}
+}
+
+// GetCurrentFeeSchedule gets the most recently saved fee schedule, or the default if none has been saved
+func (r *FeeScheduleRepo) GetCurrentFeeSchedule() (*models.FeeSchedule, error) {
+	var f models.FeeSchedule
+	var tiers sql.NullString
+
+	query := `
+		SELECT id, fee_type, flat_fee, per_share, percent, tiers, min_fee, max_fee, created_at
+		FROM fee_schedules
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	err := r.db.QueryRow(query).Scan(
+		&f.ID,
+		&f.Type,
+		&f.FlatFee,
+		&f.PerShare,
+		&f.Percent,
+		&tiers,
+		&f.MinFee,
+		&f.MaxFee,
+		&f.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.DefaultFeeSchedule(), nil
+		}
+		return nil, err
+	}
+
+	if tiers.Valid && tiers.String != "" {
+		if err := json.Unmarshal([]byte(tiers.String), &f.Tiers); err != nil {
+			return nil, err
+		}
+	}
+
+	return &f, nil
+}
+
+// SaveFeeSchedule stores a new fee schedule, which replaces the current one.
+// Old schedules are kept as a history of fee changes.
+func (r *FeeScheduleRepo) SaveFeeSchedule(schedule *models.FeeSchedule) error {
+	var tiers interface{}
+	if len(schedule.Tiers) > 0 {
+		encoded, err := json.Marshal(schedule.Tiers)
+		if err != nil {
+			return err
+		}
+		tiers = string(encoded)
+	}
+
+	query := `
+		INSERT INTO fee_schedules (fee_type, flat_fee, per_share, percent, tiers, min_fee, max_fee)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query, schedule.Type, schedule.FlatFee, schedule.PerShare, schedule.Percent,
+		tiers, schedule.MinFee, schedule.MaxFee)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	schedule.ID = int(id)
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// FundamentalsRepo implements the FundamentalsRepository interface
+type FundamentalsRepo struct {
+	db *sql.DB
+}
+
+// NewFundamentalsRepo creates a new fundamentals repository
+func NewFundamentalsRepo(db *sql.DB) *FundamentalsRepo {
+	return &FundamentalsRepo{db: db}
+}
+
+// fundamentalsColumns are the columns scanFundamentals reads, joined with the stock's symbol and price
+const fundamentalsColumns = `
+	f.stock_id, s.symbol, s.current_price, f.shares_outstanding, f.eps, f.revenue,
+	f.fiscal_year, f.fiscal_quarter, f.next_earnings_at, f.updated_at
+`
+
+// GetFundamentals gets a stock's fundamentals, or nil if it doesn't have any yet
+func (r *FundamentalsRepo) GetFundamentals(stockID int) (*models.Fundamentals, error) {
+	query := `
+		SELECT ` + fundamentalsColumns + `
+		FROM stock_fundamentals f
+		JOIN stocks s ON f.stock_id = s.id
+		WHERE f.stock_id = ?
+	`
+
+	f, err := scanFundamentals(r.db.QueryRow(query, stockID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return f, err
+}
+
+// CreateFundamentals stores a stock's first fundamentals. A stock that already has some keeps them.
+func (r *FundamentalsRepo) CreateFundamentals(f *models.Fundamentals) error {
+	query := `
+		INSERT INTO stock_fundamentals (stock_id, shares_outstanding, eps, revenue, fiscal_year, fiscal_quarter, next_earnings_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE stock_id = stock_id
+	`
+
+	_, err := r.db.Exec(query, f.StockID, f.SharesOutstanding, f.EPS, f.Revenue, f.FiscalYear, f.FiscalQuarter, f.NextEarningsAt)
+	return err
+}
+
+// GetStockIDsWithoutFundamentals gets the listed stocks, other than ETFs, that don't have fundamentals yet
+func (r *FundamentalsRepo) GetStockIDsWithoutFundamentals() ([]int, error) {
+	query := `
+		SELECT s.id
+		FROM stocks s
+		LEFT JOIN stock_fundamentals f ON f.stock_id = s.id
+		WHERE s.status = ? AND s.instrument_type = ? AND f.stock_id IS NULL
+		ORDER BY s.id
+	`
+
+	rows, err := r.db.Query(query, models.StockListed, models.InstrumentStock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// GetDueFundamentals gets the fundamentals of the listed stocks whose next earnings report is due
+func (r *FundamentalsRepo) GetDueFundamentals(now time.Time) ([]*models.Fundamentals, error) {
+	query := `
+		SELECT ` + fundamentalsColumns + `
+		FROM stock_fundamentals f
+		JOIN stocks s ON f.stock_id = s.id
+		WHERE s.status = ? AND f.next_earnings_at <= ?
+		ORDER BY f.next_earnings_at, f.stock_id
+	`
+
+	rows, err := r.db.Query(query, models.StockListed, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []*models.Fundamentals
+	for rows.Next() {
+		f, err := scanFundamentals(rows)
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, f)
+	}
+
+	return due, rows.Err()
+}
+
+// UpdateFundamentalsTx saves a stock's fundamentals after an earnings report inside a transaction
+func (r *FundamentalsRepo) UpdateFundamentalsTx(tx *sql.Tx, f *models.Fundamentals) error {
+	query := `
+		UPDATE stock_fundamentals
+		SET shares_outstanding = ?, eps = ?, revenue = ?, fiscal_year = ?, fiscal_quarter = ?, next_earnings_at = ?
+		WHERE stock_id = ?
+	`
+
+	_, err := tx.Exec(query, f.SharesOutstanding, f.EPS, f.Revenue, f.FiscalYear, f.FiscalQuarter, f.NextEarningsAt, f.StockID)
+	return err
+}
+
+// CreateEarningsReportTx stores an earnings report inside a transaction and fills in its ID and time.
+// Each quarter can only be reported once.
+func (r *FundamentalsRepo) CreateEarningsReportTx(tx *sql.Tx, report *models.EarningsReport) error {
+	query := `
+		INSERT INTO earnings_reports (stock_id, fiscal_year, fiscal_quarter, eps, expected_eps, revenue, expected_revenue, surprise, price_impact)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, report.StockID, report.FiscalYear, report.FiscalQuarter, report.EPS, report.ExpectedEPS,
+		report.Revenue, report.ExpectedRevenue, report.Surprise, report.PriceImpact)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	report.ID = int(id)
+
+	return tx.QueryRow("SELECT reported_at FROM earnings_reports WHERE id = ?", report.ID).Scan(&report.ReportedAt)
+}
+
+// SetReportPriceImpact records the price move an earnings report caused
+func (r *FundamentalsRepo) SetReportPriceImpact(reportID int, impact float64) error {
+	_, err := r.db.Exec("UPDATE earnings_reports SET price_impact = ? WHERE id = ?", impact, reportID)
+	return err
+}
+
+// GetEarningsReports gets a stock's earnings reports, latest first
+func (r *FundamentalsRepo) GetEarningsReports(stockID int, limit, offset int) ([]*models.EarningsReport, error) {
+	query := `
+		SELECT e.id, e.stock_id, s.symbol, e.fiscal_year, e.fiscal_quarter, e.eps, e.expected_eps,
+			e.revenue, e.expected_revenue, e.surprise, e.price_impact, e.reported_at
+		FROM earnings_reports e
+		JOIN stocks s ON e.stock_id = s.id
+		WHERE e.stock_id = ?
+		ORDER BY e.fiscal_year DESC, e.fiscal_quarter DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, stockID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*models.EarningsReport
+	for rows.Next() {
+		var e models.EarningsReport
+		err := rows.Scan(
+			&e.ID,
+			&e.StockID,
+			&e.Symbol,
+			&e.FiscalYear,
+			&e.FiscalQuarter,
+			&e.EPS,
+			&e.ExpectedEPS,
+			&e.Revenue,
+			&e.ExpectedRevenue,
+			&e.Surprise,
+			&e.PriceImpact,
+			&e.ReportedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, &e)
+	}
+
+	return reports, rows.Err()
+}
+
+// SplitFundamentalsTx restates a stock's share count and per-share earnings, past and present,
+// for a split by ratio inside a transaction
+func (r *FundamentalsRepo) SplitFundamentalsTx(tx *sql.Tx, stockID int, ratio float64) error {
+	query := `
+		UPDATE stock_fundamentals
+		SET shares_outstanding = ROUND(shares_outstanding * ?), eps = ROUND(eps / ?, 4)
+		WHERE stock_id = ?
+	`
+	if _, err := tx.Exec(query, ratio, ratio, stockID); err != nil {
+		return err
+	}
+
+	reportsQuery := `
+		UPDATE earnings_reports
+		SET eps = ROUND(eps / ?, 4), expected_eps = ROUND(expected_eps / ?, 4)
+		WHERE stock_id = ?
+	`
+	_, err := tx.Exec(reportsQuery, ratio, ratio, stockID)
+	return err
+}
+
+// scanFundamentals reads a stock's fundamentals joined with its symbol and price from a result row
+func scanFundamentals(row rowScanner) (*models.Fundamentals, error) {
+	var f models.Fundamentals
+	var price float64
+
+	err := row.Scan(
+		&f.StockID,
+		&f.Symbol,
+		&price,
+		&f.SharesOutstanding,
+		&f.EPS,
+		&f.Revenue,
+		&f.FiscalYear,
+		&f.FiscalQuarter,
+		&f.NextEarningsAt,
+		&f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	f.SetPrice(price)
+	return &f, nil
+}
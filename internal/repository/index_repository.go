@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// IndexRepo implements the IndexRepository interface
+type IndexRepo struct {
+	db *sql.DB
+}
+
+// NewIndexRepo creates a new index repository
+func NewIndexRepo(db *sql.DB) *IndexRepo {
+	return &IndexRepo{db: db}
+}
+
+// SaveIndexPoints writes a batch of index levels
+func (r *IndexRepo) SaveIndexPoints(points []*models.IndexPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(points))
+	args := make([]interface{}, 0, len(points)*3)
+	for _, point := range points {
+		placeholders = append(placeholders, "(?, ?, ?)")
+		args = append(args, point.Code, point.Value, point.RecordedAt.UTC())
+	}
+
+	query := "INSERT INTO index_history (code, value, recorded_at) VALUES " +
+		strings.Join(placeholders, ", ")
+
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+// GetLatestIndexLevels gets the level each index was last recorded at, by code
+func (r *IndexRepo) GetLatestIndexLevels() (map[string]float64, error) {
+	query := `
+		SELECT h.code, h.value
+		FROM index_history h
+		JOIN (
+			SELECT code, MAX(recorded_at) AS recorded_at
+			FROM index_history
+			GROUP BY code
+		) latest ON h.code = latest.code AND h.recorded_at = latest.recorded_at
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := make(map[string]float64)
+	for rows.Next() {
+		var code string
+		var value float64
+		if err := rows.Scan(&code, &value); err != nil {
+			return nil, err
+		}
+		levels[code] = value
+	}
+
+	return levels, rows.Err()
+}
+
+// GetIndexLevelAt gets the last level an index was recorded at, at or before a time. If the index
+// has no history that far back, it gets the first level recorded after. It returns nil if the
+// index has no history at all.
+func (r *IndexRepo) GetIndexLevelAt(code string, at time.Time) (*models.IndexPoint, error) {
+	queries := []string{`
+		SELECT code, value, recorded_at
+		FROM index_history
+		WHERE code = ? AND recorded_at <= ?
+		ORDER BY recorded_at DESC
+		LIMIT 1
+	`, `
+		SELECT code, value, recorded_at
+		FROM index_history
+		WHERE code = ? AND recorded_at > ?
+		ORDER BY recorded_at
+		LIMIT 1
+	`}
+
+	for _, query := range queries {
+		var point models.IndexPoint
+		err := r.db.QueryRow(query, code, at.UTC()).Scan(&point.Code, &point.Value, &point.RecordedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &point, nil
+	}
+
+	return nil, nil
+}
+
+// GetIndexHistory gets the latest levels of an index between from and to, up to limit, oldest first
+func (r *IndexRepo) GetIndexHistory(code string, from, to time.Time, limit int) ([]*models.IndexPoint, error) {
+	query := `
+		SELECT value, recorded_at
+		FROM index_history
+		WHERE code = ? AND recorded_at >= ? AND recorded_at <= ?
+		ORDER BY recorded_at DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, code, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*models.IndexPoint
+	for rows.Next() {
+		var point models.IndexPoint
+		if err := rows.Scan(&point.Value, &point.RecordedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, &point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Put the points in time order
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
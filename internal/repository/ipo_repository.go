@@ -0,0 +1,287 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// IPORepo implements the IPORepository interface
+type IPORepo struct {
+	db *sql.DB
+}
+
+// NewIPORepo creates a new IPO repository
+func NewIPORepo(db *sql.DB) *IPORepo {
+	return &IPORepo{db: db}
+}
+
+// ipoColumns are the columns scanIPO reads, joined with the stock and the shares subscribed
+const ipoColumns = `
+	i.id, i.stock_id, s.symbol, s.name, s.sector, i.float_shares, i.ipo_price, i.opens_at, i.closes_at,
+	i.status, COALESCE((SELECT SUM(quantity) FROM ipo_subscriptions WHERE ipo_id = i.id), 0),
+	i.created_by, i.created_at
+`
+
+// CreateIPOTx stores an IPO inside a transaction and fills in its ID, status and creation time
+func (r *IPORepo) CreateIPOTx(tx *sql.Tx, ipo *models.IPO) error {
+	query := `
+		INSERT INTO ipos (stock_id, float_shares, ipo_price, opens_at, closes_at, status, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, ipo.StockID, ipo.Float, ipo.Price, ipo.OpensAt, ipo.ClosesAt, models.IPOOpen, ipo.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ipo.ID = int(id)
+	ipo.Status = models.IPOOpen
+
+	return tx.QueryRow("SELECT created_at FROM ipos WHERE id = ?", ipo.ID).Scan(&ipo.CreatedAt)
+}
+
+// GetIPOByID gets an IPO by ID
+func (r *IPORepo) GetIPOByID(id int) (*models.IPO, error) {
+	return getIPO(r.db, id, "")
+}
+
+// GetIPOForUpdate gets an IPO by ID and locks it until the transaction ends
+func (r *IPORepo) GetIPOForUpdate(tx *sql.Tx, id int) (*models.IPO, error) {
+	return getIPO(tx, id, "FOR UPDATE")
+}
+
+// GetIPOs gets the IPOs with a status, or every IPO if status is empty, latest first
+func (r *IPORepo) GetIPOs(status models.IPOStatus, limit, offset int) ([]*models.IPO, error) {
+	query := `
+		SELECT ` + ipoColumns + `
+		FROM ipos i
+		JOIN stocks s ON i.stock_id = s.id
+		WHERE ? = '' OR i.status = ?
+		ORDER BY i.closes_at DESC, i.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	return queryIPOs(r.db, query, status, status, limit, offset)
+}
+
+// GetDueIPOs gets the open IPOs whose subscription window has closed, in the order they closed
+func (r *IPORepo) GetDueIPOs(now time.Time) ([]*models.IPO, error) {
+	query := `
+		SELECT ` + ipoColumns + `
+		FROM ipos i
+		JOIN stocks s ON i.stock_id = s.id
+		WHERE i.status = ? AND i.closes_at <= ?
+		ORDER BY i.closes_at, i.id
+	`
+
+	return queryIPOs(r.db, query, models.IPOOpen, now)
+}
+
+// UpdateIPOStatusTx moves an IPO from one status to the next inside a transaction.
+// This fails if the IPO has already moved on, so it is never allocated twice.
+func (r *IPORepo) UpdateIPOStatusTx(tx *sql.Tx, id int, from, to models.IPOStatus) error {
+	result, err := tx.Exec("UPDATE ipos SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("IPO is no longer " + string(from))
+	}
+
+	return nil
+}
+
+// GetUserSubscriptions gets every IPO subscription a user has made, latest first
+func (r *IPORepo) GetUserSubscriptions(userID int) ([]*models.IPOSubscription, error) {
+	query := `
+		SELECT id, ipo_id, user_id, quantity, allocated, created_at
+		FROM ipo_subscriptions
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`
+
+	return querySubscriptions(r.db, query, userID)
+}
+
+// GetSubscriptionForUpdate gets a user's subscription to an IPO, or nil if there isn't one,
+// and locks it until the transaction ends
+func (r *IPORepo) GetSubscriptionForUpdate(tx *sql.Tx, ipoID, userID int) (*models.IPOSubscription, error) {
+	query := `
+		SELECT id, ipo_id, user_id, quantity, allocated, created_at
+		FROM ipo_subscriptions
+		WHERE ipo_id = ? AND user_id = ?
+		FOR UPDATE
+	`
+
+	subscription, err := scanSubscription(tx.QueryRow(query, ipoID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return subscription, err
+}
+
+// GetSubscriptionsForUpdate gets every subscription to an IPO, earliest first, and locks them until the transaction ends
+func (r *IPORepo) GetSubscriptionsForUpdate(tx *sql.Tx, ipoID int) ([]*models.IPOSubscription, error) {
+	query := `
+		SELECT id, ipo_id, user_id, quantity, allocated, created_at
+		FROM ipo_subscriptions
+		WHERE ipo_id = ?
+		ORDER BY id
+		FOR UPDATE
+	`
+
+	return querySubscriptions(tx, query, ipoID)
+}
+
+// SaveSubscriptionTx records how many shares a user has requested in an IPO, replacing any earlier request
+func (r *IPORepo) SaveSubscriptionTx(tx *sql.Tx, ipoID, userID, quantity int) error {
+	query := `
+		INSERT INTO ipo_subscriptions (ipo_id, user_id, quantity)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity)
+	`
+
+	_, err := tx.Exec(query, ipoID, userID, quantity)
+	return err
+}
+
+// DeleteSubscriptionTx withdraws a subscription inside a transaction
+func (r *IPORepo) DeleteSubscriptionTx(tx *sql.Tx, subscriptionID int) error {
+	_, err := tx.Exec("DELETE FROM ipo_subscriptions WHERE id = ?", subscriptionID)
+	return err
+}
+
+// SetAllocatedTx records how many shares a subscription received inside a transaction
+func (r *IPORepo) SetAllocatedTx(tx *sql.Tx, subscriptionID, allocated int) error {
+	_, err := tx.Exec("UPDATE ipo_subscriptions SET allocated = ? WHERE id = ?", allocated, subscriptionID)
+	return err
+}
+
+// getIPO gets one IPO, with an optional locking clause
+func getIPO(q queryer, id int, lock string) (*models.IPO, error) {
+	query := `
+		SELECT ` + ipoColumns + `
+		FROM ipos i
+		JOIN stocks s ON i.stock_id = s.id
+		WHERE i.id = ?
+	` + lock
+
+	ipo, err := scanIPO(q.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("IPO not found")
+		}
+		return nil, err
+	}
+
+	return ipo, nil
+}
+
+// queryIPOs runs an IPO query and scans the results
+func queryIPOs(q queryer, query string, args ...interface{}) ([]*models.IPO, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ipos []*models.IPO
+	for rows.Next() {
+		ipo, err := scanIPO(rows)
+		if err != nil {
+			return nil, err
+		}
+		ipos = append(ipos, ipo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ipos, nil
+}
+
+// scanIPO reads an IPO joined with its stock from a result row
+func scanIPO(row rowScanner) (*models.IPO, error) {
+	var i models.IPO
+	var createdBy sql.NullInt64
+
+	err := row.Scan(
+		&i.ID,
+		&i.StockID,
+		&i.Symbol,
+		&i.Name,
+		&i.Sector,
+		&i.Float,
+		&i.Price,
+		&i.OpensAt,
+		&i.ClosesAt,
+		&i.Status,
+		&i.Subscribed,
+		&createdBy,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		i.CreatedBy = &id
+	}
+
+	return &i, nil
+}
+
+// querySubscriptions runs an IPO subscription query and scans the results
+func querySubscriptions(q queryer, query string, args ...interface{}) ([]*models.IPOSubscription, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.IPOSubscription
+	for rows.Next() {
+		subscription, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+// scanSubscription reads an IPO subscription from a result row
+func scanSubscription(row rowScanner) (*models.IPOSubscription, error) {
+	var s models.IPOSubscription
+	var allocated sql.NullInt64
+
+	if err := row.Scan(&s.ID, &s.IPOID, &s.UserID, &s.Quantity, &allocated, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if allocated.Valid {
+		shares := int(allocated.Int64)
+		s.Allocated = &shares
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// LedgerRepo implements the LedgerRepository interface
+type LedgerRepo struct {
+	db *sql.DB
+}
+
+// NewLedgerRepo creates a new ledger repository
+func NewLedgerRepo(db *sql.DB) *LedgerRepo {
+	return &LedgerRepo{db: db}
+}
+
+// PostTx records a user's ledger entries inside a database transaction and applies them to the
+// cash and margin loan stored with the user, returning how much each changed by. The stored
+// balances are kept separately from the ledger so the reconciliation can check one against the other.
+func (r *LedgerRepo) PostTx(tx *sql.Tx, userID int, entries []*models.LedgerEntry) (cash, loan money.Money, err error) {
+	for _, e := range entries {
+		cash += e.Change(models.CashAccount)
+		loan -= e.Change(models.LoanAccount)
+	}
+	if err := insertLedgerEntries(tx, entries); err != nil {
+		return 0, 0, err
+	}
+	if cash == 0 && loan == 0 {
+		return 0, 0, nil
+	}
+
+	query := `
+		UPDATE users
+		SET cash_balance = cash_balance + ?, loan_balance = COALESCE(loan_balance, 0) + ?
+		WHERE id = ?
+	`
+	if _, err := tx.Exec(query, cash, loan, userID); err != nil {
+		return 0, 0, err
+	}
+	return cash, loan, nil
+}
+
+// insertLedgerEntries inserts ledger entries using either the database or a transaction,
+// filling in their IDs. Entries that don't move any money are skipped.
+func insertLedgerEntries(q queryer, entries []*models.LedgerEntry) error {
+	query := `
+		INSERT INTO ledger_entries (user_id, debit_account, credit_account, amount, transaction_id, memo, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	for _, e := range entries {
+		if e.Amount == 0 {
+			continue
+		}
+
+		var memo *string
+		if e.Memo != "" {
+			memo = &e.Memo
+		}
+
+		result, err := q.Exec(query, e.UserID, e.DebitAccount, e.CreditAccount, e.Amount, e.TransactionID, memo, e.CreatedBy)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		e.ID = int(id)
+		e.CreatedAt = time.Now()
+	}
+
+	return nil
+}
+
+// GetUserEntries gets a user's ledger entries, newest first
+func (r *LedgerRepo) GetUserEntries(userID, limit, offset int) ([]*models.LedgerEntry, error) {
+	query := `
+		SELECT id, user_id, debit_account, credit_account, amount, transaction_id, memo, created_by, created_at
+		FROM ledger_entries
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*models.LedgerEntry{}
+	for rows.Next() {
+		var e models.LedgerEntry
+		var transactionID, createdBy sql.NullInt64
+		var memo sql.NullString
+
+		err := rows.Scan(&e.ID, &e.UserID, &e.DebitAccount, &e.CreditAccount, &e.Amount, &transactionID, &memo, &createdBy, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if transactionID.Valid {
+			id := int(transactionID.Int64)
+			e.TransactionID = &id
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			e.CreatedBy = &id
+		}
+		e.Memo = memo.String
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetBalances gets every user's stored balances alongside the balances their ledger adds up to.
+// Escrow is stored as the cost of the user's IPO subscriptions that haven't been allocated.
+// The cash the ledger moved for transactions is what left or reached the user's own accounts.
+func (r *LedgerRepo) GetBalances() ([]*models.LedgerBalance, error) {
+	query := `
+		SELECT u.id, u.username, u.cash_balance, COALESCE(l.cash, 0), COALESCE(u.loan_balance, 0), COALESCE(l.loan, 0),
+			   COALESCE(e.escrow, 0), COALESCE(l.escrow, 0),
+			   COALESCE(l.first_transaction, 0), COALESCE(l.last_transaction, 0), COALESCE(l.transaction_cash, 0)
+		FROM users u
+		LEFT JOIN (
+			SELECT user_id,
+				   SUM(IF(debit_account = 'cash', amount, 0)) - SUM(IF(credit_account = 'cash', amount, 0)) AS cash,
+				   SUM(IF(credit_account = 'loan', amount, 0)) - SUM(IF(debit_account = 'loan', amount, 0)) AS loan,
+				   SUM(IF(debit_account = 'escrow', amount, 0)) - SUM(IF(credit_account = 'escrow', amount, 0)) AS escrow,
+				   MIN(transaction_id) AS first_transaction,
+				   MAX(transaction_id) AS last_transaction,
+				   SUM(IF(transaction_id IS NOT NULL AND debit_account IN ('cash', 'loan', 'escrow'), amount, 0)) -
+				   SUM(IF(transaction_id IS NOT NULL AND credit_account IN ('cash', 'loan', 'escrow'), amount, 0)) AS transaction_cash
+			FROM ledger_entries
+			GROUP BY user_id
+		) l ON l.user_id = u.id
+		LEFT JOIN (
+			SELECT s.user_id, SUM(s.quantity * i.ipo_price) AS escrow
+			FROM ipo_subscriptions s
+			JOIN ipos i ON s.ipo_id = i.id
+			WHERE s.allocated IS NULL
+			GROUP BY s.user_id
+		) e ON e.user_id = u.id
+		ORDER BY u.id
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []*models.LedgerBalance
+	for rows.Next() {
+		var b models.LedgerBalance
+		err := rows.Scan(&b.UserID, &b.Username, &b.CashBalance, &b.LedgerCash, &b.LoanBalance, &b.LedgerLoan, &b.Escrow, &b.LedgerEscrow,
+			&b.FirstTransactionID, &b.LastTransactionID, &b.LedgerTransactionCash)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, &b)
+	}
+
+	return balances, rows.Err()
+}
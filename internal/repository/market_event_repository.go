@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"database/sql"
+
+	"officestonks/internal/models"
+)
+
+// MarketEventRepo implements the MarketEventRepository interface
+type MarketEventRepo struct {
+	db *sql.DB
+}
+
+// NewMarketEventRepo creates a new market event repository
+func NewMarketEventRepo(db *sql.DB) *MarketEventRepo {
+	return &MarketEventRepo{db: db}
+}
+
+// CreateEvent stores a market event and fills in its ID and creation time
+func (r *MarketEventRepo) CreateEvent(event *models.MarketEvent) error {
+	var sector interface{}
+	if event.Sector != "" {
+		sector = event.Sector
+	}
+
+	query := `
+		INSERT INTO market_events (scope, stock_id, sector, headline, price_impact, trend_impact, source, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := r.db.Exec(query, event.Scope, event.StockID, sector, event.Headline,
+		event.PriceImpact, event.TrendImpact, event.Source, event.CreatedBy)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = int(id)
+
+	return r.db.QueryRow("SELECT created_at FROM market_events WHERE id = ?", event.ID).Scan(&event.CreatedAt)
+}
+
+// GetRecentEvents gets market events, newest first
+func (r *MarketEventRepo) GetRecentEvents(limit, offset int) ([]*models.MarketEvent, error) {
+	query := `
+		SELECT e.id, e.scope, e.stock_id, COALESCE(s.symbol, ''), COALESCE(e.sector, ''), e.headline,
+			e.price_impact, e.trend_impact, e.source, e.created_by, e.created_at
+		FROM market_events e
+		LEFT JOIN stocks s ON e.stock_id = s.id
+		ORDER BY e.created_at DESC, e.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.Query(query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.MarketEvent
+	for rows.Next() {
+		var e models.MarketEvent
+		var stockID, createdBy sql.NullInt64
+		err := rows.Scan(
+			&e.ID,
+			&e.Scope,
+			&stockID,
+			&e.Symbol,
+			&e.Sector,
+			&e.Headline,
+			&e.PriceImpact,
+			&e.TrendImpact,
+			&e.Source,
+			&createdBy,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if stockID.Valid {
+			id := int(stockID.Int64)
+			e.StockID = &id
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			e.CreatedBy = &id
+		}
+
+		events = append(events, &e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
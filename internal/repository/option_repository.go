@@ -0,0 +1,318 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// OptionRepo implements the OptionRepository interface
+type OptionRepo struct {
+	db *sql.DB
+}
+
+// NewOptionRepo creates a new option repository
+func NewOptionRepo(db *sql.DB) *OptionRepo {
+	return &OptionRepo{db: db}
+}
+
+// contractColumns are the columns scanContract reads, joined with the underlying stock
+const contractColumns = `
+	c.id, c.stock_id, s.symbol, c.option_type, c.strike, c.shares, c.expires_at, c.status,
+	c.settlement_price, c.created_at
+`
+
+// CreateContracts lists option contracts, skipping any already listed with the same stock,
+// type, strike and expiry, and returns how many were new
+func (r *OptionRepo) CreateContracts(contracts []*models.OptionContract) (int, error) {
+	if len(contracts) == 0 {
+		return 0, nil
+	}
+
+	placeholders := make([]string, 0, len(contracts))
+	args := make([]interface{}, 0, len(contracts)*6)
+	for _, c := range contracts {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+		args = append(args, c.StockID, c.Type, c.Strike, c.Shares, c.ExpiresAt, models.OptionActive)
+	}
+
+	query := "INSERT IGNORE INTO option_contracts (stock_id, option_type, strike, shares, expires_at, status) VALUES " +
+		strings.Join(placeholders, ", ")
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	created, err := result.RowsAffected()
+	return int(created), err
+}
+
+// GetContractByID gets an option contract by ID
+func (r *OptionRepo) GetContractByID(id int) (*models.OptionContract, error) {
+	return getContract(r.db, id, "")
+}
+
+// GetContractForUpdate gets an option contract by ID and locks it until the transaction ends
+func (r *OptionRepo) GetContractForUpdate(tx *sql.Tx, id int) (*models.OptionContract, error) {
+	return getContract(tx, id, "FOR UPDATE")
+}
+
+// GetActiveContracts gets the active contracts on a stock, or on every stock if stockID is 0,
+// by expiry, then type, then strike
+func (r *OptionRepo) GetActiveContracts(stockID int) ([]*models.OptionContract, error) {
+	query := `
+		SELECT ` + contractColumns + `
+		FROM option_contracts c
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE c.status = ? AND (? = 0 OR c.stock_id = ?)
+		ORDER BY c.expires_at, c.stock_id, c.option_type, c.strike
+	`
+
+	return queryContracts(r.db, query, models.OptionActive, stockID, stockID)
+}
+
+// GetExpiredContracts gets the active contracts that have reached expiry, in the order they expired
+func (r *OptionRepo) GetExpiredContracts(now time.Time) ([]*models.OptionContract, error) {
+	query := `
+		SELECT ` + contractColumns + `
+		FROM option_contracts c
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE c.status = ? AND c.expires_at <= ?
+		ORDER BY c.expires_at, c.id
+	`
+
+	return queryContracts(r.db, query, models.OptionActive, now)
+}
+
+// SettleContractTx marks an active contract expired at the underlying's settlement price inside a transaction.
+// This fails if the contract has already been settled, so it is never settled twice.
+func (r *OptionRepo) SettleContractTx(tx *sql.Tx, id int, price money.Money) error {
+	query := "UPDATE option_contracts SET status = ?, settlement_price = ? WHERE id = ? AND status = ?"
+	result, err := tx.Exec(query, models.OptionExpired, price, id, models.OptionActive)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("option contract has already been settled")
+	}
+
+	return nil
+}
+
+// SplitContractsTx adjusts a stock's active contracts for a split inside a transaction: each contract
+// delivers ratio times as many shares at the strike divided by ratio, so its value doesn't change
+func (r *OptionRepo) SplitContractsTx(tx *sql.Tx, stockID int, ratio float64) error {
+	query := `
+		UPDATE option_contracts
+		SET strike = ROUND(strike / ?, 2), shares = ROUND(shares * ?)
+		WHERE stock_id = ? AND status = ?
+	`
+
+	_, err := tx.Exec(query, ratio, ratio, stockID, models.OptionActive)
+	return err
+}
+
+// GetUserOptionPositions gets a user's option positions with their contracts, soonest expiry first
+func (r *OptionRepo) GetUserOptionPositions(userID int) ([]*models.OptionPosition, error) {
+	query := `
+		SELECT p.id, p.user_id, p.contract_id, p.quantity, p.average_cost, p.opened_at, ` + contractColumns + `
+		FROM option_positions p
+		JOIN option_contracts c ON p.contract_id = c.id
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE p.user_id = ?
+		ORDER BY c.expires_at, s.symbol, c.option_type, c.strike
+	`
+
+	return queryOptionPositions(r.db, query, userID)
+}
+
+// GetOptionPositionForUpdate gets a user's position in a contract, or nil if they have none,
+// and locks it until the transaction ends
+func (r *OptionRepo) GetOptionPositionForUpdate(tx *sql.Tx, userID, contractID int) (*models.OptionPosition, error) {
+	query := `
+		SELECT p.id, p.user_id, p.contract_id, p.quantity, p.average_cost, p.opened_at, ` + contractColumns + `
+		FROM option_positions p
+		JOIN option_contracts c ON p.contract_id = c.id
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE p.user_id = ? AND p.contract_id = ?
+		FOR UPDATE
+	`
+
+	positions, err := queryOptionPositions(tx, query, userID, contractID)
+	if err != nil || len(positions) == 0 {
+		return nil, err
+	}
+	return positions[0], nil
+}
+
+// GetContractPositionsForUpdate gets every position in a contract in user ID order, and locks them
+// until the transaction ends
+func (r *OptionRepo) GetContractPositionsForUpdate(tx *sql.Tx, contractID int) ([]*models.OptionPosition, error) {
+	query := `
+		SELECT p.id, p.user_id, p.contract_id, p.quantity, p.average_cost, p.opened_at, ` + contractColumns + `
+		FROM option_positions p
+		JOIN option_contracts c ON p.contract_id = c.id
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE p.contract_id = ?
+		ORDER BY p.user_id
+		FOR UPDATE
+	`
+
+	return queryOptionPositions(tx, query, contractID)
+}
+
+// AddOptionPositionTx adds contracts to a user's position inside a transaction, averaging in what they cost
+func (r *OptionRepo) AddOptionPositionTx(tx *sql.Tx, userID, contractID, quantity int, costPerContract money.Money) error {
+	query := `
+		INSERT INTO option_positions (user_id, contract_id, quantity, average_cost)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			average_cost = ROUND((average_cost * quantity + VALUES(average_cost) * VALUES(quantity)) / (quantity + VALUES(quantity)), 2),
+			quantity = quantity + VALUES(quantity)
+	`
+
+	_, err := tx.Exec(query, userID, contractID, quantity, costPerContract)
+	return err
+}
+
+// UpdateOptionQuantityTx changes how many contracts a position holds inside a transaction,
+// closing the position if none are left
+func (r *OptionRepo) UpdateOptionQuantityTx(tx *sql.Tx, positionID, newQuantity int) error {
+	if newQuantity <= 0 {
+		_, err := tx.Exec("DELETE FROM option_positions WHERE id = ?", positionID)
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE option_positions SET quantity = ? WHERE id = ?", newQuantity, positionID)
+	return err
+}
+
+// getContract gets one option contract, with an optional locking clause
+func getContract(q queryer, id int, lock string) (*models.OptionContract, error) {
+	query := `
+		SELECT ` + contractColumns + `
+		FROM option_contracts c
+		JOIN stocks s ON c.stock_id = s.id
+		WHERE c.id = ?
+	` + lock
+
+	contract, err := scanContract(q.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("option contract not found")
+		}
+		return nil, err
+	}
+
+	return contract, nil
+}
+
+// queryContracts runs an option contract query and scans the results
+func queryContracts(q queryer, query string, args ...interface{}) ([]*models.OptionContract, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contracts []*models.OptionContract
+	for rows.Next() {
+		contract, err := scanContract(rows)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, contract)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contracts, nil
+}
+
+// queryOptionPositions runs an option position query and scans the results
+func queryOptionPositions(q queryer, query string, args ...interface{}) ([]*models.OptionPosition, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []*models.OptionPosition
+	for rows.Next() {
+		var p models.OptionPosition
+		var settlementPrice money.NullMoney
+		c := &p.Contract
+
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.ContractID,
+			&p.Quantity,
+			&p.AverageCost,
+			&p.OpenedAt,
+			&c.ID,
+			&c.StockID,
+			&c.Symbol,
+			&c.Type,
+			&c.Strike,
+			&c.Shares,
+			&c.ExpiresAt,
+			&c.Status,
+			&settlementPrice,
+			&c.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if settlementPrice.Valid {
+			c.SettlementPrice = &settlementPrice.Money
+		}
+		positions = append(positions, &p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+// scanContract reads an option contract joined with its stock from a result row
+func scanContract(row rowScanner) (*models.OptionContract, error) {
+	var c models.OptionContract
+	var settlementPrice money.NullMoney
+
+	err := row.Scan(
+		&c.ID,
+		&c.StockID,
+		&c.Symbol,
+		&c.Type,
+		&c.Strike,
+		&c.Shares,
+		&c.ExpiresAt,
+		&c.Status,
+		&settlementPrice,
+		&c.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if settlementPrice.Valid {
+		c.SettlementPrice = &settlementPrice.Money
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// OrderRepo implements the OrderRepository interface
+type OrderRepo struct {
+	db *sql.DB
+}
+
+// NewOrderRepo creates a new order repository
+func NewOrderRepo(db *sql.DB) *OrderRepo {
+	return &OrderRepo{db: db}
+}
+
+// CreateOrderTx stores a new open order inside a transaction
+func (r *OrderRepo) CreateOrderTx(tx *sql.Tx, order *models.Order) (*models.Order, error) {
+	query := `
+		INSERT INTO orders (user_id, stock_id, side, order_type, quantity, limit_price, reserved_fee, status,
+			stop_price, trail_amount, trail_percent, high_water_mark)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.Exec(query, order.UserID, order.StockID, order.Side, order.OrderType,
+		order.Quantity, order.LimitPrice, order.ReservedFee, models.OrderOpen,
+		nullIfZero(order.StopPrice), nullIfZero(order.TrailAmount),
+		nullIfZeroRate(order.TrailPercent), nullIfZero(order.HighWaterMark))
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	created := *order
+	created.ID = int(id)
+	created.Status = models.OrderOpen
+	created.CreatedAt = time.Now()
+	created.UpdatedAt = created.CreatedAt
+
+	return &created, nil
+}
+
+// GetOrderByID retrieves an order by ID
+func (r *OrderRepo) GetOrderByID(id int) (*models.Order, error) {
+	query := `
+		SELECT o.id, o.user_id, o.stock_id, o.side, o.order_type, o.quantity, o.limit_price, o.reserved_fee,
+			   o.status, o.filled_price, o.created_at, o.updated_at,
+			   o.stop_price, o.trail_amount, o.trail_percent, o.high_water_mark,
+			   s.symbol, s.name
+		FROM orders o
+		JOIN stocks s ON o.stock_id = s.id
+		WHERE o.id = ?
+	`
+
+	order, err := scanOrder(r.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("order not found")
+		}
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// GetUserOrders gets a user's orders, optionally filtered by status
+func (r *OrderRepo) GetUserOrders(userID int, status models.OrderStatus) ([]*models.Order, error) {
+	query := `
+		SELECT o.id, o.user_id, o.stock_id, o.side, o.order_type, o.quantity, o.limit_price, o.reserved_fee,
+			   o.status, o.filled_price, o.created_at, o.updated_at,
+			   o.stop_price, o.trail_amount, o.trail_percent, o.high_water_mark,
+			   s.symbol, s.name
+		FROM orders o
+		JOIN stocks s ON o.stock_id = s.id
+		WHERE o.user_id = ? AND (? = '' OR o.status = ?)
+		ORDER BY o.created_at DESC
+	`
+
+	rows, err := r.db.Query(query, userID, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// GetOpenOrdersForStock gets all open orders for a stock, oldest first
+func (r *OrderRepo) GetOpenOrdersForStock(stockID int) ([]*models.Order, error) {
+	query := `
+		SELECT o.id, o.user_id, o.stock_id, o.side, o.order_type, o.quantity, o.limit_price, o.reserved_fee,
+			   o.status, o.filled_price, o.created_at, o.updated_at,
+			   o.stop_price, o.trail_amount, o.trail_percent, o.high_water_mark,
+			   s.symbol, s.name
+		FROM orders o
+		JOIN stocks s ON o.stock_id = s.id
+		WHERE o.stock_id = ? AND o.status = ?
+		ORDER BY o.created_at ASC, o.id ASC
+	`
+
+	rows, err := r.db.Query(query, stockID, models.OrderOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*models.Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// MarkOrderFilledTx marks an open order as filled for the executed quantity at the given price.
+// It fails if the order is no longer open, e.g. because it was cancelled in the meantime.
+func (r *OrderRepo) MarkOrderFilledTx(tx *sql.Tx, orderID int, quantity float64, price money.Money) error {
+	query := `
+		UPDATE orders
+		SET status = ?, quantity = ?, filled_price = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	result, err := tx.Exec(query, models.OrderFilled, quantity, price, time.Now(), orderID, models.OrderOpen)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("order is no longer open")
+	}
+
+	return nil
+}
+
+// UpdateTrailingStop moves a trailing stop's high-water mark and trigger price
+func (r *OrderRepo) UpdateTrailingStop(orderID int, highWaterMark, stopPrice money.Money) error {
+	query := `
+		UPDATE orders
+		SET high_water_mark = ?, stop_price = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`
+
+	_, err := r.db.Exec(query, highWaterMark, stopPrice, time.Now(), orderID, models.OrderOpen)
+	return err
+}
+
+// CancelOrder cancels one of the user's open orders
+func (r *OrderRepo) CancelOrder(orderID, userID int) error {
+	query := `
+		UPDATE orders
+		SET status = ?, updated_at = ?
+		WHERE id = ? AND user_id = ? AND status = ?
+	`
+
+	result, err := r.db.Exec(query, models.OrderCancelled, time.Now(), orderID, userID, models.OrderOpen)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("order not found or not open")
+	}
+
+	return nil
+}
+
+// GetReservedCash returns the cash held back by a user's open buy orders
+func (r *OrderRepo) GetReservedCash(userID int) (money.Money, error) {
+	return reservedCash(r.db, userID)
+}
+
+// GetReservedCashTx returns the cash held back by a user's open buy orders inside a transaction
+func (r *OrderRepo) GetReservedCashTx(tx *sql.Tx, userID int) (money.Money, error) {
+	return reservedCash(tx, userID)
+}
+
+// reservedCash sums the cost of a user's open limit buy orders, each rounded to the cent,
+// and the commission held back with them
+func reservedCash(q queryer, userID int) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(ROUND(quantity * limit_price, 2) + reserved_fee), 0)
+		FROM orders
+		WHERE user_id = ? AND side = ? AND order_type = ? AND status = ?
+	`
+
+	var reserved money.Money
+	err := q.QueryRow(query, userID, models.Buy, models.LimitOrder, models.OrderOpen).Scan(&reserved)
+	return reserved, err
+}
+
+// GetReservedSharesTx returns the shares held back by a user's open limit sell orders for a stock.
+// Conditional orders only protect a position, so they don't reserve shares.
+func (r *OrderRepo) GetReservedSharesTx(tx *sql.Tx, userID, stockID int) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM orders
+		WHERE user_id = ? AND stock_id = ? AND side = ? AND order_type = ? AND status = ?
+	`
+
+	var reserved float64
+	err := tx.QueryRow(query, userID, stockID, models.Sell, models.LimitOrder, models.OrderOpen).Scan(&reserved)
+	return reserved, err
+}
+
+// SplitOpenOrdersTx adjusts a stock's open orders for a split by ratio inside a transaction.
+// Quantities are rounded down to a whole multiple of step, and orders left with no shares are cancelled.
+func (r *OrderRepo) SplitOpenOrdersTx(tx *sql.Tx, stockID int, ratio, step float64) error {
+	query := `
+		UPDATE orders
+		SET quantity = FLOOR(quantity * ? / ? + 0.000001) * ?,
+			limit_price = ROUND(limit_price / ?, 2),
+			stop_price = ROUND(stop_price / ?, 2),
+			trail_amount = ROUND(trail_amount / ?, 2),
+			high_water_mark = ROUND(high_water_mark / ?, 2)
+		WHERE stock_id = ? AND status = ?
+	`
+
+	if _, err := tx.Exec(query, ratio, step, step, ratio, ratio, ratio, ratio, stockID, models.OrderOpen); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE orders SET status = ? WHERE stock_id = ? AND status = ? AND quantity = 0",
+		models.OrderCancelled, stockID, models.OrderOpen)
+	return err
+}
+
+// CancelOpenOrdersForStockTx cancels every open order for a stock inside a transaction,
+// releasing the cash and shares they held back
+func (r *OrderRepo) CancelOpenOrdersForStockTx(tx *sql.Tx, stockID int) error {
+	_, err := tx.Exec("UPDATE orders SET status = ?, updated_at = ? WHERE stock_id = ? AND status = ?",
+		models.OrderCancelled, time.Now(), stockID, models.OrderOpen)
+	return err
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder reads an order joined with its stock from a result row
+func scanOrder(row rowScanner) (*models.Order, error) {
+	var o models.Order
+	var filledPrice, stopPrice, trailAmount, highWaterMark money.NullMoney
+	var trailPercent sql.NullFloat64
+
+	err := row.Scan(
+		&o.ID,
+		&o.UserID,
+		&o.StockID,
+		&o.Side,
+		&o.OrderType,
+		&o.Quantity,
+		&o.LimitPrice,
+		&o.ReservedFee,
+		&o.Status,
+		&filledPrice,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+		&stopPrice,
+		&trailAmount,
+		&trailPercent,
+		&highWaterMark,
+		&o.Stock.Symbol,
+		&o.Stock.Name,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if filledPrice.Valid {
+		o.FilledPrice = &filledPrice.Money
+	}
+	o.StopPrice = stopPrice.Money
+	o.TrailAmount = trailAmount.Money
+	o.TrailPercent = trailPercent.Float64
+	o.HighWaterMark = highWaterMark.Money
+	o.Stock.ID = o.StockID
+
+	return &o, nil
+}
+
+// nullIfZero stores unset optional prices as NULL
+func nullIfZero(value money.Money) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
+
+// nullIfZeroRate stores unset optional percentages as NULL
+func nullIfZeroRate(value float64) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return value
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 
 	"officestonks/internal/models"
+	"officestonks/pkg/money"
 )
 
 // PortfolioRepo implements the PortfolioRepository interface
@@ -97,7 +98,7 @@ func (r *PortfolioRepo) GetUserStockHolding(userID, stockID int) (*models.Portfo
 }
 
 // AddStockToPortfolio adds a stock to a user's portfolio
-func (r *PortfolioRepo) AddStockToPortfolio(userID, stockID, quantity int) error {
+func (r *PortfolioRepo) AddStockToPortfolio(userID, stockID int, quantity float64) error {
 	// Check if the user already has this stock
 	existing, err := r.GetUserStockHolding(userID, stockID)
 	if err != nil {
@@ -125,7 +126,7 @@ func (r *PortfolioRepo) AddStockToPortfolio(userID, stockID, quantity int) error
 }
 
 // UpdateStockQuantity updates the quantity of a stock in a portfolio
-func (r *PortfolioRepo) UpdateStockQuantity(portfolioID, newQuantity int) error {
+func (r *PortfolioRepo) UpdateStockQuantity(portfolioID int, newQuantity float64) error {
 	if newQuantity <= 0 {
 		return r.RemoveStockFromPortfolio(portfolioID)
 	}
@@ -151,33 +152,132 @@ func (r *PortfolioRepo) RemoveStockFromPortfolio(portfolioID int) error {
 	return err
 }
 
-// CalculatePortfolioValue calculates the total value of a user's portfolio
-func (r *PortfolioRepo) CalculatePortfolioValue(userID int) (float64, error) {
-	// First, get the user's cash balance
-	var cashBalance float64
+// GetUserStockHoldingForUpdate gets a stock holding inside a transaction and locks the row
+// until the transaction ends. It returns nil if the user doesn't hold the stock.
+func (r *PortfolioRepo) GetUserStockHoldingForUpdate(tx *sql.Tx, userID, stockID int) (*models.Portfolio, error) {
+	var p models.Portfolio
+	
+	query := `
+		SELECT id, user_id, stock_id, quantity
+		FROM portfolios
+		WHERE user_id = ? AND stock_id = ?
+		FOR UPDATE
+	`
+	
+	err := tx.QueryRow(query, userID, stockID).Scan(
+		&p.ID,
+		&p.UserID,
+		&p.StockID,
+		&p.Quantity,
+	)
+	
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No holding for this stock
+		}
+		return nil, err
+	}
+	
+	return &p, nil
+}
+
+// AddStockToPortfolioTx adds shares to a user's portfolio inside a transaction,
+// creating the holding if it doesn't exist yet
+func (r *PortfolioRepo) AddStockToPortfolioTx(tx *sql.Tx, userID, stockID int, quantity float64) error {
+	query := `
+		INSERT INTO portfolios (user_id, stock_id, quantity)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = quantity + VALUES(quantity)
+	`
+	
+	_, err := tx.Exec(query, userID, stockID, quantity)
+	return err
+}
+
+// UpdateStockQuantityTx updates the quantity of a holding inside a transaction,
+// removing the holding once it reaches zero
+func (r *PortfolioRepo) UpdateStockQuantityTx(tx *sql.Tx, portfolioID int, newQuantity float64) error {
+	if newQuantity <= 0 {
+		_, err := tx.Exec("DELETE FROM portfolios WHERE id = ?", portfolioID)
+		return err
+	}
+	
+	query := `
+		UPDATE portfolios
+		SET quantity = ?
+		WHERE id = ?
+	`
+	
+	_, err := tx.Exec(query, newQuantity, portfolioID)
+	return err
+}
+
+// GetUserIDsHoldingStock returns the users who hold shares in a stock
+func (r *PortfolioRepo) GetUserIDsHoldingStock(stockID int) ([]int, error) {
+	rows, err := r.db.Query("SELECT user_id FROM portfolios WHERE stock_id = ? AND quantity > 0", stockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
+// CalculateStockValue calculates the market value of all stocks a user holds
+func (r *PortfolioRepo) CalculateStockValue(userID int) (money.Money, error) {
+	stockValueQuery := `
+		SELECT COALESCE(SUM(ROUND(p.quantity * s.current_price, 2)), 0) as stock_value
+		FROM portfolios p
+		JOIN stocks s ON p.stock_id = s.id
+		WHERE p.user_id = ?
+	`
+	var stockValue money.Money
+	err := r.db.QueryRow(stockValueQuery, userID).Scan(&stockValue)
+	return stockValue, err
+}
+
+// CalculatePortfolioValue calculates the net equity of a user's portfolio (cash + stocks - shorts - margin loan)
+func (r *PortfolioRepo) CalculatePortfolioValue(userID int) (money.Money, error) {
+	// First, get the user's cash balance and margin loan
+	var cashBalance, loanBalance money.Money
 	cashQuery := `
-		SELECT cash_balance
+		SELECT cash_balance, loan_balance
 		FROM users
 		WHERE id = ?
 	`
-	err := r.db.QueryRow(cashQuery, userID).Scan(&cashBalance)
+	err := r.db.QueryRow(cashQuery, userID).Scan(&cashBalance, &loanBalance)
 	if err != nil {
 		return 0, err
 	}
 	
 	// Then, calculate the value of all stocks
-	stockValueQuery := `
-		SELECT COALESCE(SUM(p.quantity * s.current_price), 0) as stock_value
-		FROM portfolios p
-		JOIN stocks s ON p.stock_id = s.id
-		WHERE p.user_id = ?
+	stockValue, err := r.CalculateStockValue(userID)
+	if err != nil {
+		return 0, err
+	}
+	
+	// Short positions are a liability: the shares have to be bought back
+	shortValueQuery := `
+		SELECT COALESCE(SUM(ROUND(sp.quantity * s.current_price, 2)), 0) as short_value
+		FROM short_positions sp
+		JOIN stocks s ON sp.stock_id = s.id
+		WHERE sp.user_id = ?
 	`
-	var stockValue float64
-	err = r.db.QueryRow(stockValueQuery, userID).Scan(&stockValue)
+	var shortValue money.Money
+	err = r.db.QueryRow(shortValueQuery, userID).Scan(&shortValue)
 	if err != nil {
 		return 0, err
 	}
 	
-	// Return total portfolio value
-	return cashBalance + stockValue, nil
+	// Return net portfolio value
+	return cashBalance + stockValue - shortValue - loanBalance, nil
 }
\ No newline at end of file
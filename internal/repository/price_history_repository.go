@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// PriceHistoryRepo implements the PriceHistoryRepository interface
+type PriceHistoryRepo struct {
+	db *sql.DB
+}
+
+// NewPriceHistoryRepo creates a new price history repository
+func NewPriceHistoryRepo(db *sql.DB) *PriceHistoryRepo {
+	return &PriceHistoryRepo{db: db}
+}
+
+// SaveTicks stores a batch of price ticks with a single insert
+func (r *PriceHistoryRepo) SaveTicks(ticks []*models.PriceTick) error {
+	if len(ticks) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(ticks))
+	args := make([]interface{}, 0, len(ticks)*4)
+	for _, tick := range ticks {
+		placeholders = append(placeholders, "(?, ?, ?, ?)")
+		args = append(args, tick.StockID, tick.Price, tick.Volume, tick.CreatedAt.UTC())
+	}
+
+	query := "INSERT INTO price_ticks (stock_id, price, volume, created_at) VALUES " +
+		strings.Join(placeholders, ", ")
+
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+// SaveCandles merges a batch of candles into the stored ones. A candle for a bucket that
+// already exists keeps its open, widens its high and low, takes the new close and adds the volume.
+func (r *PriceHistoryRepo) SaveCandles(candles []*models.Candle) error {
+	if len(candles) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, 0, len(candles))
+	args := make([]interface{}, 0, len(candles)*8)
+	for _, c := range candles {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, c.StockID, c.Interval, c.BucketStart.UTC(), c.Open, c.High, c.Low, c.Close, c.Volume)
+	}
+
+	query := "INSERT INTO price_candles (stock_id, candle_interval, bucket_start, open, high, low, close, volume) VALUES " +
+		strings.Join(placeholders, ", ") + `
+		ON DUPLICATE KEY UPDATE
+			high = GREATEST(high, VALUES(high)),
+			low = LEAST(low, VALUES(low)),
+			close = VALUES(close),
+			volume = volume + VALUES(volume)
+	`
+
+	_, err := r.db.Exec(query, args...)
+	return err
+}
+
+// GetCandles gets a stock's candles for an interval whose buckets start between from and to, oldest first
+func (r *PriceHistoryRepo) GetCandles(stockID int, interval models.CandleInterval, from, to time.Time) ([]*models.Candle, error) {
+	query := `
+		SELECT stock_id, candle_interval, bucket_start, open, high, low, close, volume
+		FROM price_candles
+		WHERE stock_id = ? AND candle_interval = ? AND bucket_start >= ? AND bucket_start <= ?
+		ORDER BY bucket_start
+	`
+
+	rows, err := r.db.Query(query, stockID, interval, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candles []*models.Candle
+	for rows.Next() {
+		var c models.Candle
+		err := rows.Scan(
+			&c.StockID,
+			&c.Interval,
+			&c.BucketStart,
+			&c.Open,
+			&c.High,
+			&c.Low,
+			&c.Close,
+			&c.Volume,
+		)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, &c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return candles, nil
+}
+
+// SplitHistoryTx adjusts a stock's stored prices and volumes for a split by ratio inside a transaction,
+// so charts stay continuous across the split
+func (r *PriceHistoryRepo) SplitHistoryTx(tx *sql.Tx, stockID int, ratio float64) error {
+	ticksQuery := `
+		UPDATE price_ticks
+		SET price = ROUND(price / ?, 2), volume = ROUND(volume * ?, 6)
+		WHERE stock_id = ?
+	`
+	if _, err := tx.Exec(ticksQuery, ratio, ratio, stockID); err != nil {
+		return err
+	}
+
+	candlesQuery := `
+		UPDATE price_candles
+		SET open = ROUND(open / ?, 2), high = ROUND(high / ?, 2), low = ROUND(low / ?, 2),
+			close = ROUND(close / ?, 2), volume = ROUND(volume * ?, 6)
+		WHERE stock_id = ?
+	`
+	_, err := tx.Exec(candlesQuery, ratio, ratio, ratio, ratio, ratio, stockID)
+	return err
+}
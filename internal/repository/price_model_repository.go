@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"officestonks/pkg/market"
+)
+
+// PriceModelRepo implements the PriceModelRepository interface
+type PriceModelRepo struct {
+	db *sql.DB
+}
+
+// NewPriceModelRepo creates a new price model repository
+func NewPriceModelRepo(db *sql.DB) *PriceModelRepo {
+	return &PriceModelRepo{db: db}
+}
+
+// GetStockModels gets the price model of every stock that has its own
+func (r *PriceModelRepo) GetStockModels() (map[int]*market.ModelParams, error) {
+	rows, err := r.db.Query("SELECT id, model_params FROM stocks WHERE model_params IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	models := make(map[int]*market.ModelParams)
+	for rows.Next() {
+		var stockID int
+		var encoded string
+		if err := rows.Scan(&stockID, &encoded); err != nil {
+			return nil, err
+		}
+
+		var params market.ModelParams
+		if err := json.Unmarshal([]byte(encoded), &params); err != nil {
+			return nil, err
+		}
+		models[stockID] = &params
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// SetStockModel stores a stock's own price model, or clears it when params is nil
+func (r *PriceModelRepo) SetStockModel(stockID int, params *market.ModelParams) error {
+	var encoded interface{}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		encoded = string(data)
+	}
+
+	_, err := r.db.Exec("UPDATE stocks SET model_params = ? WHERE id = ?", encoded, stockID)
+	return err
+}
+
+// GetSectorModels gets the price model of every sector that has one
+func (r *PriceModelRepo) GetSectorModels() (map[string]*market.ModelParams, error) {
+	rows, err := r.db.Query("SELECT sector, model_params FROM sector_models")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	models := make(map[string]*market.ModelParams)
+	for rows.Next() {
+		var sector, encoded string
+		if err := rows.Scan(&sector, &encoded); err != nil {
+			return nil, err
+		}
+
+		var params market.ModelParams
+		if err := json.Unmarshal([]byte(encoded), &params); err != nil {
+			return nil, err
+		}
+		models[sector] = &params
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// SetSectorModel stores a sector's price model, or removes it when params is nil
+func (r *PriceModelRepo) SetSectorModel(sector string, params *market.ModelParams) error {
+	if params == nil {
+		_, err := r.db.Exec("DELETE FROM sector_models WHERE sector = ?", sector)
+		return err
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO sector_models (sector, model_params) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE model_params = VALUES(model_params)
+	`
+	_, err = r.db.Exec(query, sector, string(data))
+	return err
+}
+
+// GetStockBetas gets how strongly every stock follows the market and its sector
+func (r *PriceModelRepo) GetStockBetas() (map[int]market.Betas, error) {
+	rows, err := r.db.Query("SELECT id, market_beta, sector_beta FROM stocks")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	betas := make(map[int]market.Betas)
+	for rows.Next() {
+		var stockID int
+		var b market.Betas
+		if err := rows.Scan(&stockID, &b.Market, &b.Sector); err != nil {
+			return nil, err
+		}
+		betas[stockID] = b
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return betas, nil
+}
+
+// SetStockBetas stores how strongly a stock follows the market and its sector
+func (r *PriceModelRepo) SetStockBetas(stockID int, betas market.Betas) error {
+	_, err := r.db.Exec("UPDATE stocks SET market_beta = ?, sector_beta = ? WHERE id = ?",
+		betas.Market, betas.Sector, stockID)
+	return err
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"database/sql"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// ShortPositionRepo implements the ShortPositionRepository interface
+type ShortPositionRepo struct {
+	db *sql.DB
+}
+
+// NewShortPositionRepo creates a new short position repository
+func NewShortPositionRepo(db *sql.DB) *ShortPositionRepo {
+	return &ShortPositionRepo{db: db}
+}
+
+// GetUserShortPositions gets all of a user's open short positions
+func (r *ShortPositionRepo) GetUserShortPositions(userID int) ([]*models.ShortPosition, error) {
+	query := `
+		SELECT sp.id, sp.user_id, sp.stock_id, sp.quantity, sp.entry_price, sp.opened_at,
+			   s.symbol, s.name, s.sector, s.current_price
+		FROM short_positions sp
+		JOIN stocks s ON sp.stock_id = s.id
+		WHERE sp.user_id = ?
+		ORDER BY s.symbol ASC
+	`
+
+	return r.queryShortPositions(query, userID)
+}
+
+// GetAllShortPositions gets every open short position, e.g. for charging borrow fees
+func (r *ShortPositionRepo) GetAllShortPositions() ([]*models.ShortPosition, error) {
+	query := `
+		SELECT sp.id, sp.user_id, sp.stock_id, sp.quantity, sp.entry_price, sp.opened_at,
+			   s.symbol, s.name, s.sector, s.current_price
+		FROM short_positions sp
+		JOIN stocks s ON sp.stock_id = s.id
+		ORDER BY sp.user_id ASC, s.symbol ASC
+	`
+
+	return r.queryShortPositions(query)
+}
+
+// queryShortPositions runs a short position query and scans the results
+func (r *ShortPositionRepo) queryShortPositions(query string, args ...interface{}) ([]*models.ShortPosition, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var positions []*models.ShortPosition
+	for rows.Next() {
+		var p models.ShortPosition
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.StockID,
+			&p.Quantity,
+			&p.EntryPrice,
+			&p.OpenedAt,
+			&p.Stock.Symbol,
+			&p.Stock.Name,
+			&p.Stock.Sector,
+			&p.Stock.CurrentPrice,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Stock.ID = p.StockID
+		positions = append(positions, &p)
+	}
+
+	return positions, nil
+}
+
+// GetUserIDsWithShortsInStock gets the users who are short a stock
+func (r *ShortPositionRepo) GetUserIDsWithShortsInStock(stockID int) ([]int, error) {
+	rows, err := r.db.Query("SELECT user_id FROM short_positions WHERE stock_id = ?", stockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
+// GetShortMarketValue returns what it would cost a user to cover all their short positions
+func (r *ShortPositionRepo) GetShortMarketValue(userID int) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(ROUND(sp.quantity * s.current_price, 2)), 0)
+		FROM short_positions sp
+		JOIN stocks s ON sp.stock_id = s.id
+		WHERE sp.user_id = ?
+	`
+
+	var value money.Money
+	err := r.db.QueryRow(query, userID).Scan(&value)
+	return value, err
+}
+
+// GetShortPositionForUpdate gets a short position inside a transaction and locks the row
+// until the transaction ends. It returns nil if the user isn't short the stock.
+func (r *ShortPositionRepo) GetShortPositionForUpdate(tx *sql.Tx, userID, stockID int) (*models.ShortPosition, error) {
+	var p models.ShortPosition
+
+	query := `
+		SELECT id, user_id, stock_id, quantity, entry_price, opened_at
+		FROM short_positions
+		WHERE user_id = ? AND stock_id = ?
+		FOR UPDATE
+	`
+
+	err := tx.QueryRow(query, userID, stockID).Scan(
+		&p.ID,
+		&p.UserID,
+		&p.StockID,
+		&p.Quantity,
+		&p.EntryPrice,
+		&p.OpenedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // Not short this stock
+		}
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// AddShortTx opens or adds to a short position inside a transaction,
+// keeping the entry price as the average of all short sales
+func (r *ShortPositionRepo) AddShortTx(tx *sql.Tx, userID, stockID int, quantity float64, price money.Money) error {
+	query := `
+		INSERT INTO short_positions (user_id, stock_id, quantity, entry_price)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			entry_price = (entry_price * quantity + VALUES(entry_price) * VALUES(quantity)) / (quantity + VALUES(quantity)),
+			quantity = quantity + VALUES(quantity)
+	`
+
+	_, err := tx.Exec(query, userID, stockID, quantity, price)
+	return err
+}
+
+// UpdateShortQuantityTx updates the size of a short position inside a transaction,
+// closing the position once it reaches zero
+func (r *ShortPositionRepo) UpdateShortQuantityTx(tx *sql.Tx, positionID int, newQuantity float64) error {
+	if newQuantity <= 0 {
+		_, err := tx.Exec("DELETE FROM short_positions WHERE id = ?", positionID)
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE short_positions SET quantity = ? WHERE id = ?", newQuantity, positionID)
+	return err
+}
+
+// SplitShortTx sets a short position's shares and entry price after a split inside a transaction.
+// A position left with no shares is closed.
+func (r *ShortPositionRepo) SplitShortTx(tx *sql.Tx, positionID int, newQuantity float64, entryPrice money.Money) error {
+	if newQuantity <= 0 {
+		_, err := tx.Exec("DELETE FROM short_positions WHERE id = ?", positionID)
+		return err
+	}
+
+	_, err := tx.Exec("UPDATE short_positions SET quantity = ?, entry_price = ? WHERE id = ?", newQuantity, entryPrice, positionID)
+	return err
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"officestonks/pkg/market"
+)
+
+// SimulatorStateRepo implements the SimulatorStateRepository interface
+type SimulatorStateRepo struct {
+	db *sql.DB
+}
+
+// NewSimulatorStateRepo creates a new simulator state repository
+func NewSimulatorStateRepo(db *sql.DB) *SimulatorStateRepo {
+	return &SimulatorStateRepo{db: db}
+}
+
+// SaveSnapshot stores the simulator's state, replacing the previous snapshot
+func (r *SimulatorStateRepo) SaveSnapshot(snapshot *market.Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO simulator_snapshots (id, state) VALUES (1, ?)
+		ON DUPLICATE KEY UPDATE state = VALUES(state)
+	`
+	_, err = r.db.Exec(query, string(data))
+	return err
+}
+
+// GetSnapshot gets the last saved snapshot, or nil if none has been saved
+func (r *SimulatorStateRepo) GetSnapshot() (*market.Snapshot, error) {
+	var data string
+	err := r.db.QueryRow("SELECT state FROM simulator_snapshots WHERE id = 1").Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snapshot market.Snapshot
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"officestonks/internal/models"
+	"officestonks/pkg/money"
 )
 
 // StockRepo implements the StockRepository interface
@@ -20,20 +21,26 @@ func NewStockRepo(db *sql.DB) *StockRepo {
 	return &StockRepo{db: db}
 }
 
-// GetAllStocks retrieves all stocks from the database
+// GetAllStocks retrieves all listed stocks from the database
 func (r *StockRepo) GetAllStocks() ([]*models.Stock, error) {
+	return r.GetStocksByStatus(models.StockListed)
+}
+
+// GetStocksByStatus retrieves the stocks at one stage of their listing, or every stock if status is empty
+func (r *StockRepo) GetStocksByStatus(status models.StockStatus) ([]*models.Stock, error) {
 	query := `
-		SELECT id, symbol, name, sector, current_price, last_updated
+		SELECT id, symbol, name, sector, current_price, status, instrument_type, last_updated
 		FROM stocks
+		WHERE ? = '' OR status = ?
 		ORDER BY symbol ASC
 	`
-	
-	rows, err := r.db.Query(query)
+
+	rows, err := r.db.Query(query, status, status)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var stocks []*models.Stock
 	for rows.Next() {
 		var stock models.Stock
@@ -43,6 +50,8 @@ func (r *StockRepo) GetAllStocks() ([]*models.Stock, error) {
 			&stock.Name,
 			&stock.Sector,
 			&stock.CurrentPrice,
+			&stock.Status,
+			&stock.Type,
 			&stock.LastUpdated,
 		)
 		if err != nil {
@@ -50,8 +59,8 @@ func (r *StockRepo) GetAllStocks() ([]*models.Stock, error) {
 		}
 		stocks = append(stocks, &stock)
 	}
-	
-	return stocks, nil
+
+	return stocks, rows.Err()
 }
 
 // GetStockByID retrieves a stock by ID
@@ -59,7 +68,7 @@ func (r *StockRepo) GetStockByID(id int) (*models.Stock, error) {
 	var stock models.Stock
 	
 	query := `
-		SELECT id, symbol, name, sector, current_price, last_updated
+		SELECT id, symbol, name, sector, current_price, status, instrument_type, last_updated
 		FROM stocks
 		WHERE id = ?
 	`
@@ -70,6 +79,8 @@ func (r *StockRepo) GetStockByID(id int) (*models.Stock, error) {
 		&stock.Name,
 		&stock.Sector,
 		&stock.CurrentPrice,
+		&stock.Status,
+		&stock.Type,
 		&stock.LastUpdated,
 	)
 	
@@ -88,7 +99,7 @@ func (r *StockRepo) GetStockBySymbol(symbol string) (*models.Stock, error) {
 	var stock models.Stock
 	
 	query := `
-		SELECT id, symbol, name, sector, current_price, last_updated
+		SELECT id, symbol, name, sector, current_price, status, instrument_type, last_updated
 		FROM stocks
 		WHERE symbol = ?
 	`
@@ -99,6 +110,8 @@ func (r *StockRepo) GetStockBySymbol(symbol string) (*models.Stock, error) {
 		&stock.Name,
 		&stock.Sector,
 		&stock.CurrentPrice,
+		&stock.Status,
+		&stock.Type,
 		&stock.LastUpdated,
 	)
 	
@@ -112,8 +125,82 @@ func (r *StockRepo) GetStockBySymbol(symbol string) (*models.Stock, error) {
 	return &stock, nil
 }
 
+// CreateStock adds a stock and fills in its ID and update time
+func (r *StockRepo) CreateStock(stock *models.Stock) error {
+	return r.createStock(r.db, stock)
+}
+
+// CreateStockTx adds a stock inside a transaction and fills in its ID and update time
+func (r *StockRepo) CreateStockTx(tx *sql.Tx, stock *models.Stock) error {
+	return r.createStock(tx, stock)
+}
+
+// createStock adds a stock using either the database or a transaction
+func (r *StockRepo) createStock(q queryer, stock *models.Stock) error {
+	if stock.Type == "" {
+		stock.Type = models.InstrumentStock
+	}
+
+	query := `
+		INSERT INTO stocks (symbol, name, sector, current_price, status, instrument_type)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := q.Exec(query, stock.Symbol, stock.Name, stock.Sector, stock.CurrentPrice, stock.Status, stock.Type)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	stock.ID = int(id)
+
+	return q.QueryRow("SELECT last_updated FROM stocks WHERE id = ?", stock.ID).Scan(&stock.LastUpdated)
+}
+
+// UpdateStock changes a stock's name and sector
+func (r *StockRepo) UpdateStock(stock *models.Stock) error {
+	result, err := r.db.Exec("UPDATE stocks SET name = ?, sector = ? WHERE id = ?", stock.Name, stock.Sector, stock.ID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// MySQL doesn't count rows that were already up to date, so check the stock exists
+		_, err := r.GetStockByID(stock.ID)
+		return err
+	}
+
+	return nil
+}
+
+// SetStockStatusTx moves a stock from one listing status to the next inside a transaction.
+// This fails if the stock has already moved on, so a listing is never changed twice.
+func (r *StockRepo) SetStockStatusTx(tx *sql.Tx, stockID int, from, to models.StockStatus) error {
+	result, err := tx.Exec("UPDATE stocks SET status = ? WHERE id = ? AND status = ?", to, stockID, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("stock is not " + string(from))
+	}
+
+	return nil
+}
+
 // UpdateStockPrice updates a stock's price
-func (r *StockRepo) UpdateStockPrice(stockID int, newPrice float64) error {
+func (r *StockRepo) UpdateStockPrice(stockID int, newPrice money.Money) error {
 	query := `
 		UPDATE stocks
 		SET current_price = ?, last_updated = ?
@@ -124,19 +211,33 @@ func (r *StockRepo) UpdateStockPrice(stockID int, newPrice float64) error {
 	return err
 }
 
-// LoadStocksForSimulation loads all stocks for the market simulator
+// UpdateStockPriceTx updates the current price of a stock inside a transaction
+func (r *StockRepo) UpdateStockPriceTx(tx *sql.Tx, stockID int, newPrice money.Money) error {
+	query := `
+		UPDATE stocks
+		SET current_price = ?, last_updated = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query, newPrice, time.Now(), stockID)
+	return err
+}
+
+// LoadStocksForSimulation loads all listed stocks for the market simulator. ETFs aren't simulated;
+// their prices follow their baskets.
 func (r *StockRepo) LoadStocksForSimulation() (map[int]struct {
 	ID       int
 	Symbol   string
 	Sector   string
-	Price    float64
+	Price    money.Money
 }, error) {
 	query := `
 		SELECT id, symbol, name, sector, current_price
 		FROM stocks
+		WHERE status = ? AND instrument_type = ?
 	`
 	
-	rows, err := r.db.Query(query)
+	rows, err := r.db.Query(query, models.StockListed, models.InstrumentStock)
 	if err != nil {
 		return nil, err
 	}
@@ -146,13 +247,13 @@ func (r *StockRepo) LoadStocksForSimulation() (map[int]struct {
 		ID       int
 		Symbol   string
 		Sector   string
-		Price    float64
+		Price    money.Money
 	})
 	
 	for rows.Next() {
 		var id int
 		var symbol, name, sector string
-		var price float64
+		var price money.Money
 		
 		err := rows.Scan(&id, &symbol, &name, &sector, &price)
 		if err != nil {
@@ -163,7 +264,7 @@ func (r *StockRepo) LoadStocksForSimulation() (map[int]struct {
 			ID       int
 			Symbol   string
 			Sector   string
-			Price    float64
+			Price    money.Money
 		}{
 			ID:     id,
 			Symbol: symbol,
@@ -193,13 +294,15 @@ func (r *StockRepo) ResetAllStockPrices() error {
 	
 	// Update each stock individually with a random price
 	for _, stock := range stocks {
-		// Generate a random price between 50 and 1000
-		newPrice := 50.0 + rand.Float64()*950.0
-		
-		// Round to 2 decimal places
-		newPrice = float64(int(newPrice*100)) / 100
+		// ETFs are priced from their baskets
+		if stock.Type == models.InstrumentETF {
+			continue
+		}
+
+		// Generate a random price between 50 and 1000, in whole cents
+		newPrice := 50*money.Dollar + money.Money(rand.Int63n(int64(950*money.Dollar)))
 		
-		log.Printf("ResetAllStockPrices: Updating %s price from %.2f to %.2f", 
+		log.Printf("ResetAllStockPrices: Updating %s price from %s to %s", 
 			stock.Symbol, stock.CurrentPrice, newPrice)
 		
 		// Update the stock price
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// TaxLotRepo implements the TaxLotRepository interface
+type TaxLotRepo struct {
+	db *sql.DB
+}
+
+// NewTaxLotRepo creates a new tax lot repository
+func NewTaxLotRepo(db *sql.DB) *TaxLotRepo {
+	return &TaxLotRepo{db: db}
+}
+
+// GetUserLots gets all of a user's open tax lots, oldest first
+func (r *TaxLotRepo) GetUserLots(userID int) ([]*models.TaxLot, error) {
+	query := `
+		SELECT id, user_id, stock_id, quantity, original_quantity, cost_per_share, transaction_id, acquired_at
+		FROM tax_lots
+		WHERE user_id = ? AND quantity > 0
+		ORDER BY stock_id ASC, id ASC
+	`
+
+	return queryLots(r.db, query, userID)
+}
+
+// AddLotTx records a new tax lot for a purchase inside a transaction
+func (r *TaxLotRepo) AddLotTx(tx *sql.Tx, userID, stockID int, quantity float64, costPerShare money.Money, transactionID int) error {
+	query := `
+		INSERT INTO tax_lots (user_id, stock_id, quantity, original_quantity, cost_per_share, transaction_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	var transactionRef *int
+	if transactionID != 0 {
+		transactionRef = &transactionID
+	}
+
+	_, err := tx.Exec(query, userID, stockID, quantity, quantity, costPerShare, transactionRef)
+	return err
+}
+
+// GetOpenLotsForUpdate gets a user's open lots for a stock in the order a sale should use
+// them up, and locks them until the transaction ends. Average cost sales use them oldest first.
+func (r *TaxLotRepo) GetOpenLotsForUpdate(tx *sql.Tx, userID, stockID int, method models.CostBasisMethod) ([]*models.TaxLot, error) {
+	order := "ASC"
+	if method == models.LIFO {
+		order = "DESC"
+	}
+
+	query := `
+		SELECT id, user_id, stock_id, quantity, original_quantity, cost_per_share, transaction_id, acquired_at
+		FROM tax_lots
+		WHERE user_id = ? AND stock_id = ? AND quantity > 0
+		ORDER BY id ` + order + `
+		FOR UPDATE
+	`
+
+	return queryLots(tx, query, userID, stockID)
+}
+
+// UpdateLotQuantityTx updates the shares left in a lot inside a transaction.
+// Sold-out lots are kept with a quantity of zero as a record of the purchase.
+func (r *TaxLotRepo) UpdateLotQuantityTx(tx *sql.Tx, lotID int, newQuantity float64) error {
+	_, err := tx.Exec("UPDATE tax_lots SET quantity = ? WHERE id = ?", newQuantity, lotID)
+	return err
+}
+
+// SetLotCostTx sets the cost per share of all of a user's open lots for a stock inside a transaction,
+// which keeps every share at the average cost for the average cost method
+func (r *TaxLotRepo) SetLotCostTx(tx *sql.Tx, userID, stockID int, costPerShare money.Money) error {
+	query := `
+		UPDATE tax_lots
+		SET cost_per_share = ?
+		WHERE user_id = ? AND stock_id = ? AND quantity > 0
+	`
+
+	_, err := tx.Exec(query, costPerShare, userID, stockID)
+	return err
+}
+
+// SplitLotTx sets a lot's shares and cost after a split inside a transaction
+func (r *TaxLotRepo) SplitLotTx(tx *sql.Tx, lotID int, quantity, originalQuantity float64, costPerShare money.Money) error {
+	query := `
+		UPDATE tax_lots
+		SET quantity = ?, original_quantity = ?, cost_per_share = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query, quantity, originalQuantity, costPerShare, lotID)
+	return err
+}
+
+// queryLots runs a tax lot query and scans the results
+func queryLots(q queryer, query string, args ...interface{}) ([]*models.TaxLot, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*models.TaxLot
+	for rows.Next() {
+		var lot models.TaxLot
+		var transactionID sql.NullInt64
+
+		err := rows.Scan(
+			&lot.ID,
+			&lot.UserID,
+			&lot.StockID,
+			&lot.Quantity,
+			&lot.OriginalQuantity,
+			&lot.CostPerShare,
+			&transactionID,
+			&lot.AcquiredAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if transactionID.Valid {
+			id := int(transactionID.Int64)
+			lot.TransactionID = &id
+		}
+		lots = append(lots, &lot)
+	}
+
+	return lots, nil
+}
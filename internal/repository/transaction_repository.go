@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"officestonks/internal/models"
+	"officestonks/pkg/money"
 )
 
 // TransactionRepo implements the TransactionRepository interface
@@ -18,13 +19,34 @@ func NewTransactionRepo(db *sql.DB) *TransactionRepo {
 }
 
 // CreateTransaction records a new transaction
-func (r *TransactionRepo) CreateTransaction(userID, stockID, quantity int, price float64, transType models.TransactionType) (*models.Transaction, error) {
+func (r *TransactionRepo) CreateTransaction(userID, stockID int, quantity float64, price money.Money, transType models.TransactionType) (*models.Transaction, error) {
+	return insertTransaction(r.db, userID, stockID, quantity, price, transType, 0, 0)
+}
+
+// CreateTransactionTx records a new transaction inside a database transaction.
+// fee is the commission charged on top of the trade; a non-zero orderID links
+// the transaction to the order it filled. A stockID of 0 is for cash movements
+// that aren't about any one stock, such as margin interest.
+func (r *TransactionRepo) CreateTransactionTx(tx *sql.Tx, userID, stockID int, quantity float64, price money.Money, transType models.TransactionType, fee money.Money, orderID int) (*models.Transaction, error) {
+	return insertTransaction(tx, userID, stockID, quantity, price, transType, fee, orderID)
+}
+
+// insertTransaction inserts a transaction row using either the database or a transaction
+func insertTransaction(q queryer, userID, stockID int, quantity float64, price money.Money, transType models.TransactionType, fee money.Money, orderID int) (*models.Transaction, error) {
 	query := `
-		INSERT INTO transactions (user_id, stock_id, quantity, price, transaction_type)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO transactions (user_id, stock_id, quantity, price, transaction_type, fee, order_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 	
-	result, err := r.db.Exec(query, userID, stockID, quantity, price, transType)
+	var orderRef, stockRef *int
+	if orderID != 0 {
+		orderRef = &orderID
+	}
+	if stockID != 0 {
+		stockRef = &stockID
+	}
+	
+	result, err := q.Exec(query, userID, stockRef, quantity, price, transType, fee, orderRef)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +63,8 @@ func (r *TransactionRepo) CreateTransaction(userID, stockID, quantity int, price
 		Quantity:        quantity,
 		Price:           price,
 		TransactionType: transType,
+		Fee:             fee,
+		OrderID:         orderRef,
 		CreatedAt:       time.Now(),
 	}
 	
@@ -50,26 +74,47 @@ func (r *TransactionRepo) CreateTransaction(userID, stockID, quantity int, price
 // GetUserTransactions gets a user's transaction history
 func (r *TransactionRepo) GetUserTransactions(userID int, limit, offset int) ([]*models.Transaction, error) {
 	query := `
-		SELECT t.id, t.user_id, t.stock_id, t.quantity, t.price, t.transaction_type, t.created_at,
-			   s.symbol, s.name
+		SELECT t.id, t.user_id, COALESCE(t.stock_id, 0), t.quantity, t.price, t.transaction_type, t.fee, t.realized_pnl, t.order_id, t.option_id, t.created_at,
+			   COALESCE(s.symbol, ''), COALESCE(s.name, '')
 		FROM transactions t
-		JOIN stocks s ON t.stock_id = s.id
+		LEFT JOIN stocks s ON t.stock_id = s.id
 		WHERE t.user_id = ?
 		ORDER BY t.created_at DESC
 		LIMIT ? OFFSET ?
 	`
-	
-	rows, err := r.db.Query(query, userID, limit, offset)
+
+	return queryTransactions(r.db, query, userID, limit, offset)
+}
+
+// GetUserTransactionsBetween gets a user's transactions with IDs from firstID to lastID, in the order they were made
+func (r *TransactionRepo) GetUserTransactionsBetween(userID, firstID, lastID int) ([]*models.Transaction, error) {
+	query := `
+		SELECT t.id, t.user_id, COALESCE(t.stock_id, 0), t.quantity, t.price, t.transaction_type, t.fee, t.realized_pnl, t.order_id, t.option_id, t.created_at,
+			   COALESCE(s.symbol, ''), COALESCE(s.name, '')
+		FROM transactions t
+		LEFT JOIN stocks s ON t.stock_id = s.id
+		WHERE t.user_id = ? AND t.id BETWEEN ? AND ?
+		ORDER BY t.id
+	`
+
+	return queryTransactions(r.db, query, userID, firstID, lastID)
+}
+
+// queryTransactions runs a query for transactions joined with their stock and reads every row
+func queryTransactions(q queryer, query string, args ...interface{}) ([]*models.Transaction, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var transactions []*models.Transaction
 	for rows.Next() {
 		var t models.Transaction
 		var stock models.Stock
-		
+		var orderID, optionID sql.NullInt64
+		var realizedPnL money.NullMoney
+
 		err := rows.Scan(
 			&t.ID,
 			&t.UserID,
@@ -77,6 +122,10 @@ func (r *TransactionRepo) GetUserTransactions(userID int, limit, offset int) ([]
 			&t.Quantity,
 			&t.Price,
 			&t.TransactionType,
+			&t.Fee,
+			&realizedPnL,
+			&orderID,
+			&optionID,
 			&t.CreatedAt,
 			&stock.Symbol,
 			&stock.Name,
@@ -84,23 +133,38 @@ func (r *TransactionRepo) GetUserTransactions(userID int, limit, offset int) ([]
 		if err != nil {
 			return nil, err
 		}
-		
+
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			t.OrderID = &id
+		}
+		if optionID.Valid {
+			id := int(optionID.Int64)
+			t.OptionID = &id
+		}
+		if realizedPnL.Valid {
+			t.RealizedPnL = &realizedPnL.Money
+		}
 		stock.ID = t.StockID
 		t.Stock = stock
 		transactions = append(transactions, &t)
 	}
-	
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return transactions, nil
 }
 
 // GetRecentTransactions gets the most recent transactions across all users
 func (r *TransactionRepo) GetRecentTransactions(limit int) ([]*models.Transaction, error) {
 	query := `
-		SELECT t.id, t.user_id, t.stock_id, t.quantity, t.price, t.transaction_type, t.created_at,
-			   s.symbol, s.name,
+		SELECT t.id, t.user_id, COALESCE(t.stock_id, 0), t.quantity, t.price, t.transaction_type, t.fee, t.realized_pnl, t.order_id, t.option_id, t.created_at,
+			   COALESCE(s.symbol, ''), COALESCE(s.name, ''),
 			   u.username
 		FROM transactions t
-		JOIN stocks s ON t.stock_id = s.id
+		LEFT JOIN stocks s ON t.stock_id = s.id
 		JOIN users u ON t.user_id = u.id
 		ORDER BY t.created_at DESC
 		LIMIT ?
@@ -116,6 +180,8 @@ func (r *TransactionRepo) GetRecentTransactions(limit int) ([]*models.Transactio
 	for rows.Next() {
 		var t models.Transaction
 		var stock models.Stock
+		var orderID, optionID sql.NullInt64
+		var realizedPnL money.NullMoney
 		var username string
 		
 		err := rows.Scan(
@@ -125,6 +191,10 @@ func (r *TransactionRepo) GetRecentTransactions(limit int) ([]*models.Transactio
 			&t.Quantity,
 			&t.Price,
 			&t.TransactionType,
+			&t.Fee,
+			&realizedPnL,
+			&orderID,
+			&optionID,
 			&t.CreatedAt,
 			&stock.Symbol,
 			&stock.Name,
@@ -134,10 +204,64 @@ func (r *TransactionRepo) GetRecentTransactions(limit int) ([]*models.Transactio
 			return nil, err
 		}
 		
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			t.OrderID = &id
+		}
+		if optionID.Valid {
+			id := int(optionID.Int64)
+			t.OptionID = &id
+		}
+		if realizedPnL.Valid {
+			t.RealizedPnL = &realizedPnL.Money
+		}
 		stock.ID = t.StockID
 		t.Stock = stock
 		transactions = append(transactions, &t)
 	}
 	
 	return transactions, nil
+}
+
+// GetMonthlyVolumeTx returns the value a user has traded since the start of the current month,
+// which decides their tier on a tiered fee schedule
+func (r *TransactionRepo) GetMonthlyVolumeTx(tx *sql.Tx, userID int) (money.Money, error) {
+	now := time.Now()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	query := `
+		SELECT COALESCE(SUM(ROUND(quantity * price, 2)), 0)
+		FROM transactions
+		WHERE user_id = ? AND transaction_type IN (?, ?, ?, ?) AND created_at >= ?
+	`
+
+	var volume money.Money
+	err := tx.QueryRow(query, userID, models.Buy, models.Sell, models.Short, models.Cover, monthStart).Scan(&volume)
+	return volume, err
+}
+
+// SetRealizedPnLTx records the profit or loss a transaction locked in, inside a database transaction
+func (r *TransactionRepo) SetRealizedPnLTx(tx *sql.Tx, transactionID int, pnl money.Money) error {
+	_, err := tx.Exec("UPDATE transactions SET realized_pnl = ? WHERE id = ?", pnl, transactionID)
+	return err
+}
+
+// SetOptionTx records which option contract a transaction was for, inside a database transaction
+func (r *TransactionRepo) SetOptionTx(tx *sql.Tx, transactionID, optionID int) error {
+	_, err := tx.Exec("UPDATE transactions SET option_id = ? WHERE id = ?", optionID, transactionID)
+	return err
+}
+
+// GetRealizedPnL returns the total profit or loss a user has locked in
+func (r *TransactionRepo) GetRealizedPnL(userID int) (money.Money, error) {
+	var total money.Money
+	err := r.db.QueryRow("SELECT COALESCE(SUM(realized_pnl), 0) FROM transactions WHERE user_id = ?", userID).Scan(&total)
+	return total, err
+}
+
+// GetTotalFees returns the total commission a user has paid
+func (r *TransactionRepo) GetTotalFees(userID int) (money.Money, error) {
+	var total money.Money
+	err := r.db.QueryRow("SELECT COALESCE(SUM(fee), 0) FROM transactions WHERE user_id = ?", userID).Scan(&total)
+	return total, err
 }
\ No newline at end of file
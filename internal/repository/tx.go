@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+)
+
+// queryer is the subset of *sql.DB and *sql.Tx that repository queries need,
+// so the same query code can run inside or outside a transaction
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// TxRunner implements the TxRunner interface
+type TxRunner struct {
+	db *sql.DB
+}
+
+// NewTxRunner creates a new transaction runner
+func NewTxRunner(db *sql.DB) *TxRunner {
+	return &TxRunner{db: db}
+}
+
+// RunInTx runs fn inside a database transaction. The transaction is committed if fn
+// returns nil and rolled back if it returns an error or panics.
+func (r *TxRunner) RunInTx(fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("RunInTx: Error rolling back transaction: %v", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -20,10 +20,16 @@ func NewUserRepo(db *sql.DB) *UserRepo {
 	return &UserRepo{db: db}
 }
 
-// CreateUser adds a new user to the database
+// CreateUser adds a new user to the database, along with the ledger entry for their starting cash
 func (r *UserRepo) CreateUser(username, passwordHash string) (*models.User, error) {
 	// Initial cash balance
-	initialBalance := 10000.00
+	initialBalance := models.StartingCash
+	
+	// Start a transaction, so the user never exists without their starting cash in the ledger
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
 	
 	// SQL statement to insert a new user
 	query := `
@@ -32,14 +38,29 @@ func (r *UserRepo) CreateUser(username, passwordHash string) (*models.User, erro
 	`
 	
 	// Execute the query
-	result, err := r.db.Exec(query, username, passwordHash, initialBalance)
+	result, err := tx.Exec(query, username, passwordHash, initialBalance)
 	if err != nil {
+		tx.Rollback()
 		return nil, err
 	}
 	
 	// Get the ID of the new user
 	id, err := result.LastInsertId()
 	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	
+	// Record where the starting cash came from
+	bonus := models.Transfer(models.BonusAccount, models.CashAccount, initialBalance)
+	bonus.UserID = int(id)
+	bonus.Memo = "Starting cash"
+	if err := insertLedgerEntries(tx, []*models.LedgerEntry{bonus}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 	
@@ -49,6 +70,7 @@ func (r *UserRepo) CreateUser(username, passwordHash string) (*models.User, erro
 		Username:     username,
 		PasswordHash: passwordHash,
 		CashBalance:  initialBalance,
+		CostBasisMethod: models.FIFO,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}, nil
@@ -59,7 +81,7 @@ func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
 	var user models.User
 
 	query := `
-		SELECT id, username, password_hash, cash_balance, is_admin, created_at, updated_at
+		SELECT id, username, password_hash, cash_balance, is_admin, margin_enabled, loan_balance, cost_basis_method, created_at, updated_at
 		FROM users
 		WHERE id = ?
 	`
@@ -70,6 +92,9 @@ func (r *UserRepo) GetUserByID(id int) (*models.User, error) {
 		&user.PasswordHash,
 		&user.CashBalance,
 		&user.IsAdmin,
+		&user.MarginEnabled,
+		&user.LoanBalance,
+		&user.CostBasisMethod,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -89,7 +114,7 @@ func (r *UserRepo) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
 
 	query := `
-		SELECT id, username, password_hash, cash_balance, is_admin, created_at, updated_at
+		SELECT id, username, password_hash, cash_balance, is_admin, margin_enabled, loan_balance, cost_basis_method, created_at, updated_at
 		FROM users
 		WHERE username = ?
 	`
@@ -100,6 +125,9 @@ func (r *UserRepo) GetUserByUsername(username string) (*models.User, error) {
 		&user.PasswordHash,
 		&user.CashBalance,
 		&user.IsAdmin,
+		&user.MarginEnabled,
+		&user.LoanBalance,
+		&user.CostBasisMethod,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -114,25 +142,58 @@ func (r *UserRepo) GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
-// UpdateUserBalance updates a user's cash balance
-func (r *UserRepo) UpdateUserBalance(userID int, newBalance float64) error {
+// GetUserForUpdate retrieves a user inside a transaction and locks the row until the transaction ends
+func (r *UserRepo) GetUserForUpdate(tx *sql.Tx, id int) (*models.User, error) {
+	var user models.User
+
 	query := `
-		UPDATE users
-		SET cash_balance = ?
+		SELECT id, username, password_hash, cash_balance, is_admin, margin_enabled, loan_balance, cost_basis_method, created_at, updated_at
+		FROM users
 		WHERE id = ?
+		FOR UPDATE
 	`
-	
-	_, err := r.db.Exec(query, newBalance, userID)
-	return err
+
+	err := tx.QueryRow(query, id).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.CashBalance,
+		&user.IsAdmin,
+		&user.MarginEnabled,
+		&user.LoanBalance,
+		&user.CostBasisMethod,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return &user, nil
 }
 
-// GetTopUsers gets the top users by portfolio value
+// GetTopUsers gets the top users by net equity: cash plus stock value, minus shorts and margin loans
 func (r *UserRepo) GetTopUsers(limit int) ([]*models.User, error) {
-	// This is simplified - in a real app, you'd calculate portfolio value
 	query := `
-		SELECT id, username, cash_balance, created_at, updated_at
-		FROM users
-		ORDER BY cash_balance DESC
+		SELECT u.id, u.username, u.cash_balance, u.margin_enabled, u.loan_balance, u.created_at, u.updated_at
+		FROM users u
+		LEFT JOIN (
+			SELECT p.user_id, SUM(p.quantity * s.current_price) AS value
+			FROM portfolios p
+			JOIN stocks s ON p.stock_id = s.id
+			GROUP BY p.user_id
+		) longs ON longs.user_id = u.id
+		LEFT JOIN (
+			SELECT sp.user_id, SUM(sp.quantity * s.current_price) AS value
+			FROM short_positions sp
+			JOIN stocks s ON sp.stock_id = s.id
+			GROUP BY sp.user_id
+		) shorts ON shorts.user_id = u.id
+		ORDER BY u.cash_balance + COALESCE(longs.value, 0) - COALESCE(shorts.value, 0) - u.loan_balance DESC
 		LIMIT ?
 	`
 
@@ -149,6 +210,8 @@ func (r *UserRepo) GetTopUsers(limit int) ([]*models.User, error) {
 			&user.ID,
 			&user.Username,
 			&user.CashBalance,
+			&user.MarginEnabled,
+			&user.LoanBalance,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -161,6 +224,56 @@ func (r *UserRepo) GetTopUsers(limit int) ([]*models.User, error) {
 	return users, nil
 }
 
+// SetMarginEnabled turns a user's margin account on or off
+func (r *UserRepo) SetMarginEnabled(userID int, enabled bool) error {
+	_, err := r.db.Exec("UPDATE users SET margin_enabled = ? WHERE id = ?", enabled, userID)
+	return err
+}
+
+// SetCostBasisMethod sets how a user's sales pick which shares are sold
+func (r *UserRepo) SetCostBasisMethod(userID int, method models.CostBasisMethod) error {
+	_, err := r.db.Exec("UPDATE users SET cost_basis_method = ? WHERE id = ?", method, userID)
+	return err
+}
+
+// GetUserIDsWithLoans gets the users who have an outstanding margin loan
+func (r *UserRepo) GetUserIDsWithLoans() ([]int, error) {
+	return r.queryUserIDs("SELECT id FROM users WHERE loan_balance > 0")
+}
+
+// GetUserIDsWithLoansHoldingStock gets the users with a margin loan who hold a stock,
+// i.e. whose equity moves with the stock's price
+func (r *UserRepo) GetUserIDsWithLoansHoldingStock(stockID int) ([]int, error) {
+	query := `
+		SELECT u.id
+		FROM users u
+		JOIN portfolios p ON p.user_id = u.id
+		WHERE u.loan_balance > 0 AND p.stock_id = ?
+	`
+
+	return r.queryUserIDs(query, stockID)
+}
+
+// queryUserIDs runs a query that selects a single user ID column
+func (r *UserRepo) queryUserIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, nil
+}
+
 // IsUserAdmin checks if a user is an admin
 func (r *UserRepo) IsUserAdmin(userID int) (bool, error) {
 	query := `
@@ -186,7 +299,7 @@ func (r *UserRepo) GetAllUsers() ([]*models.User, error) {
 	log.Println("GetAllUsers: Fetching all users from database")
 
 	query := `
-		SELECT id, username, password_hash, cash_balance, is_admin, created_at, updated_at
+		SELECT id, username, password_hash, cash_balance, is_admin, margin_enabled, loan_balance, cost_basis_method, created_at, updated_at
 		FROM users
 		ORDER BY id ASC
 	`
@@ -212,6 +325,9 @@ func (r *UserRepo) GetAllUsers() ([]*models.User, error) {
 			&user.PasswordHash,
 			&user.CashBalance,
 			&isAdmin,
+			&user.MarginEnabled,
+			&user.LoanBalance,
+			&user.CostBasisMethod,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -233,17 +349,17 @@ func (r *UserRepo) GetAllUsers() ([]*models.User, error) {
 	return users, nil
 }
 
-// UpdateUser updates a user's information
-func (r *UserRepo) UpdateUser(userID int, cashBalance float64, isAdmin bool) error {
+// UpdateUser updates a user's information. Cash balances aren't changed here, as
+// every change to them has to be posted to the ledger.
+func (r *UserRepo) UpdateUser(userID int, isAdmin bool) error {
 	query := `
 		UPDATE users
-		SET cash_balance = ?,
-			is_admin = ?,
+		SET is_admin = ?,
 			updated_at = ?
 		WHERE id = ?
 	`
 
-	_, err := r.db.Exec(query, cashBalance, isAdmin, time.Now(), userID)
+	_, err := r.db.Exec(query, isAdmin, time.Now(), userID)
 	return err
 }
 
@@ -262,8 +378,57 @@ func (r *UserRepo) DeleteUser(userID int) error {
 		return err
 	}
 
+	// Delete user's tax lots
+	_, err = tx.Exec("DELETE FROM tax_lots WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's short positions
+	_, err = tx.Exec("DELETE FROM short_positions WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's orders
+	_, err = tx.Exec("DELETE FROM orders WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's dividend entitlements
+	_, err = tx.Exec("DELETE FROM dividend_entitlements WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's IPO subscriptions
+	_, err = tx.Exec("DELETE FROM ipo_subscriptions WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's option positions
+	_, err = tx.Exec("DELETE FROM option_positions WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Delete user's ledger entries, so the accounts on the other side of them don't keep money from nobody
+	_, err = tx.Exec("DELETE FROM ledger_entries WHERE user_id = ?", userID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Delete user's portfolio
-	_, err = tx.Exec("DELETE FROM portfolio WHERE user_id = ?", userID)
+	_, err = tx.Exec("DELETE FROM portfolios WHERE user_id = ?", userID)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// ErrMarketClosed is returned for market orders placed outside trading sessions
+var ErrMarketClosed = errors.New("the market is closed; place a limit order or try again when it opens")
+
+// SetCalendar sets when the market is open. Outside sessions the simulator moves prices
+// every closedEvery ticks, or not at all if closedEvery is 0.
+func (s *MarketService) SetCalendar(calendar *market.Calendar, closedEvery int) {
+	s.calendar = calendar
+	s.simulator.SetCalendar(calendar, closedEvery)
+}
+
+// SetClock sets the clock the market reads the time from, so tests and replays can
+// control when it opens and closes
+func (s *MarketService) SetClock(clock market.Clock) {
+	s.simulator.SetClock(clock)
+}
+
+// IsMarketOpen reports whether the market is open now
+func (s *MarketService) IsMarketOpen() bool {
+	return s.calendar.IsOpen(s.simulator.Now())
+}
+
+// checkMarketOpen rejects market orders while the market is closed
+func (s *MarketService) checkMarketOpen() error {
+	if !s.IsMarketOpen() {
+		return ErrMarketClosed
+	}
+	return nil
+}
+
+// GetMarketStatus returns whether the market is open and when it next opens and closes
+func (s *MarketService) GetMarketStatus() *models.MarketStatus {
+	now := s.simulator.Now()
+	status := &models.MarketStatus{
+		IsOpen:     s.calendar.IsOpen(now),
+		Timezone:   s.calendar.Location().String(),
+		ServerTime: now,
+	}
+
+	if nextOpen := s.calendar.NextOpen(now); !nextOpen.IsZero() {
+		status.NextOpen = &nextOpen
+	}
+	if nextClose := s.calendar.NextClose(now); !nextClose.IsZero() {
+		status.NextClose = &nextClose
+	}
+	if holiday, ok := s.calendar.HolidayOn(now); ok {
+		status.Holiday = holiday.Name
+	}
+
+	return status
+}
+
+// runCalendarJobs broadcasts "market_open" and "market_close" messages as sessions start and end
+func (s *MarketService) runCalendarJobs() {
+	wasOpen := s.IsMarketOpen()
+	for {
+		status := s.GetMarketStatus()
+
+		// Sleep until the next open or close, whichever comes first
+		next := status.NextClose
+		if !status.IsOpen || next == nil {
+			next = status.NextOpen
+		}
+		if next == nil {
+			return
+		}
+		wait := next.Sub(s.simulator.Now())
+		if wait < time.Second {
+			wait = time.Second
+		}
+		time.Sleep(wait)
+
+		isOpen := s.IsMarketOpen()
+		if isOpen == wasOpen {
+			continue
+		}
+		wasOpen = isOpen
+
+		if s.wsHub != nil {
+			messageType := "market_close"
+			if isOpen {
+				messageType = "market_open"
+			}
+			s.wsHub.BroadcastMessage(messageType, s.GetMarketStatus())
+		}
+	}
+}
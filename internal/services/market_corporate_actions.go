@@ -0,0 +1,492 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// CorporateActionConfig controls when corporate actions take effect and which ones the simulator declares itself
+type CorporateActionConfig struct {
+	CheckInterval     time.Duration // How often due actions are processed and new ones considered
+	ExDelay           time.Duration // Time from declaring an action to its ex date, unless one is given
+	PayDelay          time.Duration // Time from a dividend's ex date to its pay date, unless one is given
+	DividendChance    float64       // Chance each check that a random stock declares a dividend; 0 leaves dividends to admins
+	DividendYield     float64       // Dividend the simulator declares, as a fraction of the price
+	SplitAbove        float64       // Price above which the simulator declares a 2-for-1 split; 0 turns it off
+	ReverseSplitBelow float64       // Price below which the simulator declares a 1-for-10 reverse split; 0 turns it off
+}
+
+// DefaultCorporateActionConfig returns the corporate action settings used unless overridden
+func DefaultCorporateActionConfig() CorporateActionConfig {
+	return CorporateActionConfig{
+		CheckInterval:     time.Minute,
+		ExDelay:           time.Hour,
+		PayDelay:          time.Hour,
+		DividendChance:    0.01,
+		DividendYield:     0.005,
+		SplitAbove:        5000,
+		ReverseSplitBelow: 1,
+	}
+}
+
+// SetCorporateActionConfig replaces the corporate action settings
+func (s *MarketService) SetCorporateActionConfig(cfg CorporateActionConfig) {
+	s.actionConfig = cfg
+}
+
+// DeclareCorporateAction announces a dividend or split. Missing ex and pay dates are filled in from the config.
+func (s *MarketService) DeclareCorporateAction(action *models.CorporateAction) error {
+	switch action.Type {
+	case models.DividendAction:
+		if action.Amount <= 0 {
+			return errors.New("dividend amount must be positive")
+		}
+		action.SplitTo, action.SplitFrom = 0, 0
+	case models.SplitAction:
+		if action.SplitTo <= 0 || action.SplitFrom <= 0 || action.SplitTo == action.SplitFrom {
+			return errors.New("a split must turn split_from shares into a different number of split_to shares")
+		}
+		if action.SplitTo > 100 || action.SplitFrom > 100 {
+			return errors.New("split_to and split_from cannot be more than 100")
+		}
+		action.Amount = 0
+		action.PayDate = nil
+	default:
+		return errors.New("type must be 'dividend' or 'split'")
+	}
+
+	stock, err := s.stockRepo.GetStockByID(action.StockID)
+	if err != nil {
+		return err
+	}
+	if stock.Type == models.InstrumentETF {
+		return errors.New("ETFs pass on their constituents' corporate actions and can't have their own")
+	}
+	action.Symbol = stock.Symbol
+
+	if action.ExDate.IsZero() {
+		action.ExDate = time.Now().Add(s.actionConfig.ExDelay)
+	}
+	if action.Type == models.DividendAction {
+		if action.PayDate == nil {
+			payDate := action.ExDate.Add(s.actionConfig.PayDelay)
+			action.PayDate = &payDate
+		} else if action.PayDate.Before(action.ExDate) {
+			return errors.New("pay date cannot be before the ex date")
+		}
+	}
+	if action.Source == "" {
+		action.Source = models.ActionSourceAdmin
+	}
+
+	if err := s.actionRepo.CreateAction(action); err != nil {
+		return err
+	}
+
+	s.announceCorporateAction(action)
+	return nil
+}
+
+// CancelCorporateAction withdraws a corporate action before its ex date
+func (s *MarketService) CancelCorporateAction(id int) (*models.CorporateAction, error) {
+	if err := s.actionRepo.CancelAction(id); err != nil {
+		return nil, err
+	}
+
+	action, err := s.actionRepo.GetActionByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.announceCorporateAction(action)
+	return action, nil
+}
+
+// GetCorporateActions returns the corporate actions on a stock, or on every stock if stockID is 0
+func (s *MarketService) GetCorporateActions(stockID, limit, offset int) ([]*models.CorporateAction, error) {
+	actions, err := s.actionRepo.GetActions(stockID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if actions == nil {
+		actions = []*models.CorporateAction{}
+	}
+	return actions, nil
+}
+
+// announceCorporateAction tells every client about a corporate action's new status
+func (s *MarketService) announceCorporateAction(action *models.CorporateAction) {
+	if s.wsHub != nil {
+		s.wsHub.BroadcastMessage("corporate_action", action)
+	}
+}
+
+// runCorporateActionJobs puts corporate actions into effect as they fall due, and declares new ones
+func (s *MarketService) runCorporateActionJobs() {
+	ticker := time.NewTicker(s.actionConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ProcessCorporateActions()
+		s.declareScheduledActions()
+	}
+}
+
+// ProcessCorporateActions moves every due corporate action on to its next stage
+func (s *MarketService) ProcessCorporateActions() {
+	actions, err := s.actionRepo.GetDueActions(time.Now())
+	if err != nil {
+		log.Printf("ProcessCorporateActions: Error loading due actions: %v", err)
+		return
+	}
+
+	for _, action := range actions {
+		switch {
+		case action.Type == models.DividendAction && action.Status == models.ActionDeclared:
+			err = s.goExDividend(action)
+		case action.Type == models.DividendAction && action.Status == models.ActionEx:
+			err = s.payDividend(action)
+		case action.Type == models.SplitAction:
+			err = s.applySplit(action)
+		}
+		if err != nil {
+			log.Printf("ProcessCorporateActions: Error processing %s %d on %s: %v", action.Type, action.ID, action.Symbol, err)
+		}
+	}
+}
+
+// goExDividend fixes who is owed a dividend and drops the stock's price by the dividend
+func (s *MarketService) goExDividend(action *models.CorporateAction) error {
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.actionRepo.UpdateActionStatusTx(tx, action.ID, models.ActionDeclared, models.ActionEx); err != nil {
+			return err
+		}
+		if err := s.actionRepo.RecordEntitlementsTx(tx, action); err != nil {
+			return err
+		}
+		// ETFs holding the stock keep the dividend as cash
+		return s.etfRepo.AccrueDividendTx(tx, action.StockID, action.Amount)
+	})
+	if err != nil {
+		return err
+	}
+	action.Status = models.ActionEx
+	s.reloadETFs()
+
+	// New buyers don't get the dividend, so the shares are worth that much less
+	s.simulator.ApplyDividend(action.StockID, action.Amount)
+
+	s.announceCorporateAction(action)
+	return nil
+}
+
+// payDividend credits holders with the dividend they are owed and charges short sellers what they owe
+func (s *MarketService) payDividend(action *models.CorporateAction) error {
+	var paid []*models.DividendEntitlement
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		paid = nil
+
+		if err := s.actionRepo.UpdateActionStatusTx(tx, action.ID, models.ActionEx, models.ActionPaid); err != nil {
+			return err
+		}
+
+		entitlements, err := s.actionRepo.GetUnpaidEntitlementsTx(tx, action.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, entitlement := range entitlements {
+			user, err := s.userRepo.GetUserForUpdate(tx, entitlement.UserID)
+			if err != nil {
+				return err
+			}
+			transType, quantity := models.Dividend, entitlement.Quantity
+			if quantity < 0 {
+				transType, quantity = models.DividendCharge, -quantity
+			}
+			transaction, err := s.transactionRepo.CreateTransactionTx(tx, entitlement.UserID, action.StockID, quantity, action.Amount, transType, 0, 0)
+			if err != nil {
+				return err
+			}
+			if err := s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, entitlement.Amount); err != nil {
+				return err
+			}
+			if err := s.postTx(tx, user, transaction, models.Transfer(models.CorporateActionAccount, models.CashAccount, entitlement.Amount)); err != nil {
+				return err
+			}
+
+			if err := s.actionRepo.MarkEntitlementPaidTx(tx, entitlement.ID); err != nil {
+				return err
+			}
+			paid = append(paid, entitlement)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	action.Status = models.ActionPaid
+
+	for _, entitlement := range paid {
+		s.notifyUser(entitlement.UserID, "dividend", entitlement)
+	}
+	s.announceCorporateAction(action)
+	return nil
+}
+
+// applySplit rewrites every holding, short position, tax lot, open order and stored price
+// of a stock for a split, as one database transaction. Trading in the stock is halted meanwhile.
+func (s *MarketService) applySplit(action *models.CorporateAction) error {
+	// Wait for any other halt to end, so resuming afterwards doesn't cut it short
+	if halt := s.simulator.GetHalt(action.StockID); halt != nil {
+		return errors.New("waiting for the " + halt.Reason + " halt to end")
+	}
+	// Stocks the simulator doesn't know about can't be traded anyway
+	if err := s.simulator.HaltStock(action.StockID, market.HaltCorporateAction, 0); err == nil {
+		defer s.simulator.ResumeStock(action.StockID)
+	}
+
+	stock, err := s.stockRepo.GetStockByID(action.StockID)
+	if err != nil {
+		return err
+	}
+	ratio := action.Ratio()
+	newPrice := money.Max(money.Cent, stock.CurrentPrice.MulRate(1/ratio))
+
+	// Everyone who holds or owes shares, in ID order so users are always locked in the same order
+	holderIDs, err := s.portfolioRepo.GetUserIDsHoldingStock(action.StockID)
+	if err != nil {
+		return err
+	}
+	shortIDs, err := s.shortRepo.GetUserIDsWithShortsInStock(action.StockID)
+	if err != nil {
+		return err
+	}
+	userIDs := uniqueSortedIDs(append(holderIDs, shortIDs...))
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.actionRepo.UpdateActionStatusTx(tx, action.ID, models.ActionDeclared, models.ActionApplied); err != nil {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			if err := s.splitUserPositionsTx(tx, userID, action.StockID, ratio, newPrice); err != nil {
+				return err
+			}
+		}
+
+		if err := s.orderRepo.SplitOpenOrdersTx(tx, action.StockID, ratio, s.fractionalConfig.MinFraction); err != nil {
+			return err
+		}
+		if err := s.historyRepo.SplitHistoryTx(tx, action.StockID, ratio); err != nil {
+			return err
+		}
+		if err := s.fundamentalsRepo.SplitFundamentalsTx(tx, action.StockID, ratio); err != nil {
+			return err
+		}
+		if err := s.etfRepo.SplitConstituentTx(tx, action.StockID, ratio); err != nil {
+			return err
+		}
+		if err := s.optionRepo.SplitContractsTx(tx, action.StockID, ratio); err != nil {
+			return err
+		}
+		return s.stockRepo.UpdateStockPriceTx(tx, action.StockID, newPrice)
+	})
+	if err != nil {
+		return err
+	}
+	action.Status = models.ActionApplied
+	s.reloadETFs()
+
+	s.simulator.ApplySplit(action.StockID, ratio)
+
+	log.Printf("applySplit: Split %s %d-for-%d for %d users", action.Symbol, action.SplitTo, action.SplitFrom, len(userIDs))
+	s.announceCorporateAction(action)
+	return nil
+}
+
+// splitUserPositionsTx splits a user's holding and tax lots, or short position, in a stock by ratio.
+// Parts of the minimum fraction of a share the split leaves over are settled in cash at the new price.
+func (s *MarketService) splitUserPositionsTx(tx *sql.Tx, userID, stockID int, ratio float64, newPrice money.Money) error {
+	user, err := s.userRepo.GetUserForUpdate(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stockID)
+	if err != nil {
+		return err
+	}
+	if holding != nil {
+		lots, err := s.lotRepo.GetOpenLotsForUpdate(tx, userID, stockID, models.FIFO)
+		if err != nil {
+			return err
+		}
+
+		// Each lot keeps what it cost in total, spread over its new shares
+		quantities := make([]float64, len(lots))
+		for i, lot := range lots {
+			quantities[i] = lot.Quantity
+		}
+		var costBefore, costAfter money.Money
+		step := s.fractionalConfig.MinFraction
+		for i, newQuantity := range models.SplitShares(quantities, ratio, step) {
+			lot := lots[i]
+			costPerShare := lot.CostPerShare.MulRate(1 / ratio)
+			originalQuantity := math.Max(models.RoundShares(lot.OriginalQuantity*ratio), newQuantity)
+			if err := s.lotRepo.SplitLotTx(tx, lot.ID, newQuantity, originalQuantity, costPerShare); err != nil {
+				return err
+			}
+			costBefore += lot.CostPerShare.Mul(lot.Quantity)
+			costAfter += costPerShare.Mul(newQuantity)
+		}
+
+		newQuantity, fraction := splitQuantity(holding.Quantity, ratio, step)
+		if err := s.portfolioRepo.UpdateStockQuantityTx(tx, holding.ID, newQuantity); err != nil {
+			return err
+		}
+		if _, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, newQuantity, newPrice, models.StockSplit, 0, 0); err != nil {
+			return err
+		}
+
+		// The part of a share left over is sold, realizing its share of the cost
+		if fraction > 0 {
+			cashInLieu := newPrice.Mul(fraction)
+			if err := s.recordCashInLieuTx(tx, user, stockID, cashInLieu, cashInLieu-(costBefore-costAfter)); err != nil {
+				return err
+			}
+		}
+	}
+
+	position, err := s.shortRepo.GetShortPositionForUpdate(tx, userID, stockID)
+	if err != nil {
+		return err
+	}
+	if position != nil {
+		newQuantity, fraction := splitQuantity(position.Quantity, ratio, s.fractionalConfig.MinFraction)
+		entryPrice := position.EntryPrice.MulRate(1 / ratio)
+		if err := s.shortRepo.SplitShortTx(tx, position.ID, newQuantity, entryPrice); err != nil {
+			return err
+		}
+		// Shares owed are recorded as negative, so they can't be mistaken for shares held
+		if _, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, -newQuantity, newPrice, models.StockSplit, 0, 0); err != nil {
+			return err
+		}
+
+		// The part of a share left over is bought back
+		if fraction > 0 {
+			cashInLieu := newPrice.Mul(fraction)
+			if err := s.recordCashInLieuTx(tx, user, stockID, -cashInLieu, entryPrice.Mul(fraction)-cashInLieu); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordCashInLieuTx records cash paid for part of a share left over by a split; amount is negative when the user pays
+func (s *MarketService) recordCashInLieuTx(tx *sql.Tx, user *models.User, stockID int, amount, realizedPnL money.Money) error {
+	transaction, err := s.transactionRepo.CreateTransactionTx(tx, user.ID, stockID, 0, amount, models.CashInLieu, 0, 0)
+	if err != nil {
+		return err
+	}
+	if err := s.postTx(tx, user, transaction, models.Transfer(models.CorporateActionAccount, models.CashAccount, amount)); err != nil {
+		return err
+	}
+	return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, realizedPnL)
+}
+
+// declareScheduledActions declares the corporate actions the simulator makes on its own: splits that bring
+// prices back into a sensible range, and now and then a dividend on a random stock
+func (s *MarketService) declareScheduledActions() {
+	cfg := s.actionConfig
+
+	listed, err := s.stockRepo.GetAllStocks()
+	if err != nil {
+		log.Printf("declareScheduledActions: Error loading stocks: %v", err)
+		return
+	}
+
+	// ETFs don't have corporate actions of their own
+	var stocks []*models.Stock
+	for _, stock := range listed {
+		if stock.Type == models.InstrumentStock {
+			stocks = append(stocks, stock)
+		}
+	}
+
+	for _, stock := range stocks {
+		action := &models.CorporateAction{StockID: stock.ID, Type: models.SplitAction, Source: models.ActionSourceSimulator}
+		switch {
+		case cfg.SplitAbove > 0 && stock.CurrentPrice.Float() > cfg.SplitAbove:
+			action.SplitTo, action.SplitFrom = 2, 1
+		case cfg.ReverseSplitBelow > 0 && stock.CurrentPrice.Float() < cfg.ReverseSplitBelow:
+			action.SplitTo, action.SplitFrom = 1, 10
+		default:
+			continue
+		}
+		s.declareIfNonePending(action)
+	}
+
+	// Use the global random numbers so a seeded simulator still replays the same prices
+	if cfg.DividendChance <= 0 || len(stocks) == 0 || rand.Float64() >= cfg.DividendChance {
+		return
+	}
+	stock := stocks[rand.Intn(len(stocks))]
+	amount := stock.CurrentPrice.MulRate(cfg.DividendYield)
+	if amount >= money.Cent {
+		s.declareIfNonePending(&models.CorporateAction{StockID: stock.ID, Type: models.DividendAction, Amount: amount, Source: models.ActionSourceSimulator})
+	}
+}
+
+// declareIfNonePending declares a corporate action unless the stock already has one of the same type on the way
+func (s *MarketService) declareIfNonePending(action *models.CorporateAction) {
+	pending, err := s.actionRepo.HasPendingAction(action.StockID, action.Type)
+	if err != nil {
+		log.Printf("declareIfNonePending: Error checking stock %d for pending actions: %v", action.StockID, err)
+		return
+	}
+	if pending {
+		return
+	}
+
+	if err := s.DeclareCorporateAction(action); err != nil {
+		log.Printf("declareIfNonePending: Error declaring %s on stock %d: %v", action.Type, action.StockID, err)
+	}
+}
+
+// splitQuantity returns the shares quantity splits into by ratio, rounded down to a whole multiple of step,
+// and the part of a share left over
+func splitQuantity(quantity, ratio, step float64) (float64, float64) {
+	exact := quantity * ratio
+	kept := models.RoundShares(math.Floor(exact/step+1e-9) * step)
+	fraction := exact - kept
+	if fraction < 1e-9 {
+		fraction = 0
+	}
+	return kept, fraction
+}
+
+// uniqueSortedIDs returns the distinct IDs in ascending order
+func uniqueSortedIDs(ids []int) []int {
+	sort.Ints(ids)
+
+	unique := ids[:0]
+	for _, id := range ids {
+		if len(unique) == 0 || id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// SetCostBasisMethod sets which shares a user's future sales use up
+func (s *MarketService) SetCostBasisMethod(userID int, method models.CostBasisMethod) error {
+	if !method.IsValid() {
+		return errors.New("cost basis method must be 'fifo', 'lifo' or 'average'")
+	}
+
+	return s.userRepo.SetCostBasisMethod(userID, method)
+}
+
+// GetUserLots returns a user's open tax lots
+func (s *MarketService) GetUserLots(userID int) ([]*models.TaxLot, error) {
+	return s.lotRepo.GetUserLots(userID)
+}
+
+// addLotTx records the shares from a purchase as a tax lot. The commission is
+// part of what the shares cost.
+func (s *MarketService) addLotTx(tx *sql.Tx, userID, stockID int, quantity float64, price, fee money.Money, transactionID int) error {
+	costPerShare := (price.Mul(quantity) + fee).MulRate(1 / quantity)
+	return s.lotRepo.AddLotTx(tx, userID, stockID, quantity, costPerShare, transactionID)
+}
+
+// consumeLotsTx uses up the tax lots for a sale according to the user's cost basis
+// method and returns what the sold shares cost. Shares bought before lots were
+// tracked have no lot and are treated as costing the sale price.
+func (s *MarketService) consumeLotsTx(tx *sql.Tx, user *models.User, stockID int, quantity float64, price money.Money) (money.Money, error) {
+	method := user.CostBasisMethod
+	if !method.IsValid() {
+		method = models.FIFO
+	}
+
+	lots, err := s.lotRepo.GetOpenLotsForUpdate(tx, user.ID, stockID, method)
+	if err != nil {
+		return 0, err
+	}
+
+	// With average cost every share costs the same, whichever lot it comes from
+	var averageCost money.Money
+	if method == models.AverageCost {
+		var totalCost money.Money
+		var totalQuantity float64
+		for _, lot := range lots {
+			totalCost += lot.CostPerShare.Mul(lot.Quantity)
+			totalQuantity += lot.Quantity
+		}
+		if totalQuantity > 0 {
+			averageCost = totalCost.MulRate(1 / totalQuantity)
+		}
+	}
+
+	var costBasis money.Money
+	remaining := quantity
+	for _, lot := range lots {
+		if remaining <= 0 {
+			break
+		}
+
+		sold := math.Min(lot.Quantity, remaining)
+
+		lotCost := lot.CostPerShare
+		if method == models.AverageCost {
+			lotCost = averageCost
+		}
+		costBasis += lotCost.Mul(sold)
+
+		if err := s.lotRepo.UpdateLotQuantityTx(tx, lot.ID, models.RoundShares(lot.Quantity-sold)); err != nil {
+			return 0, err
+		}
+		remaining = models.RoundShares(remaining - sold)
+	}
+	costBasis += price.Mul(remaining)
+
+	// Keep the shares that are left at the average so the next sale sees the same cost
+	if method == models.AverageCost && len(lots) > 0 {
+		if err := s.lotRepo.SetLotCostTx(tx, user.ID, stockID, averageCost); err != nil {
+			return 0, err
+		}
+	}
+
+	return costBasis, nil
+}
+
+// fillCostBasis works out the cost basis and unrealized P&L of every holding in a portfolio summary
+func (s *MarketService) fillCostBasis(summary *models.PortfolioSummary) error {
+	if len(summary.PortfolioItems) == 0 {
+		return nil
+	}
+
+	lots, err := s.lotRepo.GetUserLots(summary.PortfolioItems[0].UserID)
+	if err != nil {
+		return err
+	}
+
+	lotCost := make(map[int]money.Money)
+	lotQuantity := make(map[int]float64)
+	for _, lot := range lots {
+		lotCost[lot.StockID] += lot.CostPerShare.Mul(lot.Quantity)
+		lotQuantity[lot.StockID] += lot.Quantity
+	}
+
+	for _, item := range summary.PortfolioItems {
+		item.MarketValue = item.Stock.CurrentPrice.Mul(item.Quantity)
+		item.CostBasis = lotCost[item.StockID]
+
+		// Shares without a lot were bought before lots were tracked, so count them at the current price
+		if untracked := models.RoundShares(item.Quantity - lotQuantity[item.StockID]); untracked > 0 {
+			item.CostBasis += item.Stock.CurrentPrice.Mul(untracked)
+		}
+
+		item.AverageCost = item.CostBasis.Float() / item.Quantity
+		item.UnrealizedPnL = item.MarketValue - item.CostBasis
+
+		summary.CostBasis += item.CostBasis
+		summary.UnrealizedPnL += item.UnrealizedPnL
+	}
+
+	return nil
+}
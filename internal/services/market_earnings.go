@@ -0,0 +1,199 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// FundamentalsConfig controls how often companies report earnings and how far results stray from expectations
+type FundamentalsConfig struct {
+	CheckInterval time.Duration // How often due earnings reports are published
+	QuarterLength time.Duration // Time between a company's earnings reports
+	SurpriseSigma float64       // Standard deviation of the fraction earnings beat or miss expectations by
+}
+
+// DefaultFundamentalsConfig returns the fundamentals settings used unless overridden
+func DefaultFundamentalsConfig() FundamentalsConfig {
+	return FundamentalsConfig{
+		CheckInterval: time.Minute,
+		QuarterLength: 24 * time.Hour,
+		SurpriseSigma: 0.1,
+	}
+}
+
+// SetFundamentalsConfig replaces the fundamentals settings
+func (s *MarketService) SetFundamentalsConfig(cfg FundamentalsConfig) {
+	s.fundamentalsConfig = cfg
+}
+
+// SetEarningsConfig sets how prices react to earnings surprises
+func (s *MarketService) SetEarningsConfig(cfg market.EarningsConfig) error {
+	return s.simulator.SetEarningsConfig(cfg)
+}
+
+// GetFundamentals returns a stock's fundamentals at its current price, making them up
+// if the stock doesn't have any yet
+func (s *MarketService) GetFundamentals(stockID int) (*models.Fundamentals, error) {
+	f, err := s.fundamentalsRepo.GetFundamentals(stockID)
+	if err != nil || f != nil {
+		return f, err
+	}
+
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Type == models.InstrumentETF {
+		return nil, errors.New("ETFs don't have company fundamentals")
+	}
+	if err := s.fundamentalsRepo.CreateFundamentals(s.newFundamentals(stock, time.Now())); err != nil {
+		return nil, err
+	}
+	return s.fundamentalsRepo.GetFundamentals(stockID)
+}
+
+// GetEarningsReports returns a stock's earnings reports, latest first
+func (s *MarketService) GetEarningsReports(stockID int, limit, offset int) ([]*models.EarningsReport, error) {
+	if _, err := s.stockRepo.GetStockByID(stockID); err != nil {
+		return nil, err
+	}
+	return s.fundamentalsRepo.GetEarningsReports(stockID, limit, offset)
+}
+
+// newFundamentals makes up plausible company figures for a stock at its current price.
+// The company's last reported quarter is the end of last year, and its next report falls
+// somewhere in the coming quarter so reports are spread out between stocks.
+func (s *MarketService) newFundamentals(stock *models.Stock, now time.Time) *models.Fundamentals {
+	price := math.Max(stock.CurrentPrice.Float(), 0.01)
+
+	// Market caps from $1bn to $1tn, P/E ratios from 8 to 40 and price to sales from 1 to 8
+	marketCap := math.Pow(10, 9+3*rand.Float64())
+	eps := price / (8 + 32*rand.Float64())
+	if rand.Float64() < 0.1 {
+		// Some companies are losing money
+		eps = -eps / 4
+	}
+
+	return &models.Fundamentals{
+		StockID:           stock.ID,
+		SharesOutstanding: int64(math.Max(1, math.Round(marketCap/price))),
+		EPS:               math.Round(eps*10000) / 10000,
+		Revenue:           math.Round(marketCap/(1+7*rand.Float64())*100) / 100,
+		FiscalYear:        now.Year() - 1,
+		FiscalQuarter:     4,
+		NextEarningsAt:    now.Add(time.Duration(rand.Int63n(int64(s.fundamentalsConfig.QuarterLength)))),
+	}
+}
+
+// runEarningsJobs publishes earnings reports as they fall due
+func (s *MarketService) runEarningsJobs() {
+	ticker := time.NewTicker(s.fundamentalsConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ProcessEarnings()
+	}
+}
+
+// ProcessEarnings makes up fundamentals for listed stocks that don't have any and publishes
+// every earnings report that is due
+func (s *MarketService) ProcessEarnings() {
+	now := time.Now()
+
+	ids, err := s.fundamentalsRepo.GetStockIDsWithoutFundamentals()
+	if err != nil {
+		log.Printf("ProcessEarnings: Error loading stocks without fundamentals: %v", err)
+		return
+	}
+	for _, id := range ids {
+		stock, err := s.stockRepo.GetStockByID(id)
+		if err == nil {
+			err = s.fundamentalsRepo.CreateFundamentals(s.newFundamentals(stock, now))
+		}
+		if err != nil {
+			log.Printf("ProcessEarnings: Error creating fundamentals for stock %d: %v", id, err)
+		}
+	}
+
+	due, err := s.fundamentalsRepo.GetDueFundamentals(now)
+	if err != nil {
+		log.Printf("ProcessEarnings: Error loading due earnings: %v", err)
+		return
+	}
+	for _, f := range due {
+		if _, err := s.reportEarnings(f, now); err != nil {
+			log.Printf("ProcessEarnings: Error reporting %s earnings: %v", f.Symbol, err)
+		}
+	}
+}
+
+// reportEarnings publishes a company's results for its next quarter. Analysts expect the last
+// four quarters' average plus some growth; the results beat or miss that by a random surprise,
+// which the simulator turns into a price move once the report is saved.
+func (s *MarketService) reportEarnings(f *models.Fundamentals, now time.Time) (*models.EarningsReport, error) {
+	cfg := s.fundamentalsConfig
+	growth := 0.02 + 0.02*rand.NormFloat64()
+	surprise := math.Round(cfg.SurpriseSigma*rand.NormFloat64()*10000) / 10000
+
+	quarterEPS := f.EPS / 4
+	expectedEPS := math.Round((quarterEPS+math.Abs(quarterEPS)*growth)*10000) / 10000
+	expectedRevenue := math.Round(f.Revenue/4*(1+growth)*100) / 100
+
+	report := &models.EarningsReport{
+		StockID:         f.StockID,
+		Symbol:          f.Symbol,
+		EPS:             math.Round((expectedEPS+math.Abs(expectedEPS)*surprise)*10000) / 10000,
+		ExpectedEPS:     expectedEPS,
+		ExpectedRevenue: expectedRevenue,
+		// Revenue surprises are smaller than earnings surprises
+		Revenue:  math.Round(expectedRevenue*(1+surprise/3)*100) / 100,
+		Surprise: surprise,
+	}
+	report.FiscalYear, report.FiscalQuarter = f.NextQuarter()
+
+	// The new quarter replaces the oldest of the last four
+	f.EPS = math.Round((f.EPS*3/4+report.EPS)*10000) / 10000
+	f.Revenue = math.Round((f.Revenue*3/4+report.Revenue)*100) / 100
+	f.FiscalYear, f.FiscalQuarter = report.FiscalYear, report.FiscalQuarter
+	f.NextEarningsAt = f.NextEarningsAt.Add(cfg.QuarterLength)
+	if !f.NextEarningsAt.After(now) {
+		// Don't publish a backlog of reports after the server has been down
+		f.NextEarningsAt = now.Add(cfg.QuarterLength)
+	}
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.fundamentalsRepo.CreateEarningsReportTx(tx, report); err != nil {
+			return err
+		}
+		return s.fundamentalsRepo.UpdateFundamentalsTx(tx, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Stocks the simulator doesn't know about have no price to move
+	if impact, err := s.simulator.ApplyEarnings(f.StockID, surprise); err == nil && impact != 0 {
+		report.PriceImpact = impact
+		if err := s.fundamentalsRepo.SetReportPriceImpact(report.ID, impact); err != nil {
+			log.Printf("reportEarnings: Error saving the price impact of %s earnings: %v", f.Symbol, err)
+		}
+	}
+
+	log.Printf("reportEarnings: %s Q%d %d EPS %.4f vs %.4f expected", f.Symbol, report.FiscalQuarter, report.FiscalYear, report.EPS, report.ExpectedEPS)
+	s.announceEarnings(report)
+	return report, nil
+}
+
+// announceEarnings tells every client about an earnings report
+func (s *MarketService) announceEarnings(report *models.EarningsReport) {
+	if s.wsHub != nil {
+		s.wsHub.BroadcastMessage("earnings", report)
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// defaultETFPrice is what a new ETF's shares are worth unless the admin says otherwise
+const defaultETFPrice = 100 * money.Dollar
+
+// maxConstituents caps how many stocks one ETF can hold
+const maxConstituents = 50
+
+// basketBook keeps every listed ETF's basket in memory, so ETF prices can follow
+// their constituents' price updates without going to the database
+type basketBook struct {
+	mu      sync.Mutex
+	etfs    map[int]*models.ETF // By the ETF's stock ID
+	holders map[int][]int       // IDs of the ETFs holding each stock
+	prices  map[int]money.Money // Latest price of every constituent
+}
+
+// newBasketBook creates an empty basket book
+func newBasketBook() *basketBook {
+	return &basketBook{
+		etfs:    make(map[int]*models.ETF),
+		holders: make(map[int][]int),
+		prices:  make(map[int]money.Money),
+	}
+}
+
+// load replaces every basket, taking constituent prices from the ETFs
+func (b *basketBook) load(etfs []*models.ETF) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.etfs = make(map[int]*models.ETF, len(etfs))
+	b.holders = make(map[int][]int)
+	for _, etf := range etfs {
+		b.etfs[etf.ID] = etf
+		for _, c := range etf.Constituents {
+			b.holders[c.StockID] = append(b.holders[c.StockID], etf.ID)
+			b.prices[c.StockID] = c.Price
+		}
+	}
+}
+
+// remove stops tracking an ETF
+func (b *basketBook) remove(etfID int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.etfs, etfID)
+}
+
+// get returns a copy of an ETF's basket at the latest prices
+func (b *basketBook) get(etfID int) (*models.ETF, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	etf, ok := b.etfs[etfID]
+	if !ok {
+		return nil, false
+	}
+
+	copied := *etf
+	copied.Constituents = make([]*models.Constituent, len(etf.Constituents))
+	for i, c := range etf.Constituents {
+		constituent := *c
+		copied.Constituents[i] = &constituent
+	}
+	return &copied, true
+}
+
+// reprice records a stock's new price and returns a price update for every ETF whose value it changes
+func (b *basketBook) reprice(update market.StockUpdate) []market.StockUpdate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	etfIDs, ok := b.holders[update.StockID]
+	if !ok {
+		return nil
+	}
+	b.prices[update.StockID] = update.Price
+
+	var updates []market.StockUpdate
+	for _, etfID := range etfIDs {
+		etf, ok := b.etfs[etfID]
+		if !ok {
+			continue
+		}
+
+		previous := etf.Price
+		etf.Reprice(b.prices)
+		if etf.Price != previous {
+			updates = append(updates, market.StockUpdate{
+				StockID: etf.ID,
+				Symbol:  etf.Symbol,
+				Price:   etf.Price,
+				Time:    update.Time,
+			})
+		}
+	}
+	return updates
+}
+
+// loadETFs loads every listed ETF's basket
+func (s *MarketService) loadETFs() error {
+	etfs, err := s.etfRepo.GetETFs()
+	if err != nil {
+		return err
+	}
+	s.baskets.load(etfs)
+	return nil
+}
+
+// reloadETFs reloads the baskets after a change to them in the database
+func (s *MarketService) reloadETFs() {
+	if err := s.loadETFs(); err != nil {
+		log.Printf("reloadETFs: Error loading ETFs: %v", err)
+	}
+}
+
+// updateBaskets reprices the ETFs holding a stock after its price changes, and handles their new prices
+// like any other price update
+func (s *MarketService) updateBaskets(update market.StockUpdate) {
+	for _, etfUpdate := range s.baskets.reprice(update) {
+		s.processUpdate(etfUpdate)
+	}
+}
+
+// CreateETF lists an ETF holding a basket of listed stocks. Each constituent gives a stock ID and
+// its weight in the basket; weights are shared out in proportion and turned into the shares of each
+// stock behind one share of the ETF, so the ETF starts at its current price (100.00 if not given).
+func (s *MarketService) CreateETF(stock *models.Stock, constituents []*models.Constituent) (*models.ETF, error) {
+	if strings.TrimSpace(stock.Sector) == "" {
+		stock.Sector = "ETF"
+	}
+	if err := validateListing(stock); err != nil {
+		return nil, err
+	}
+	if stock.CurrentPrice == 0 {
+		stock.CurrentPrice = defaultETFPrice
+	}
+	if stock.CurrentPrice < 0 {
+		return nil, errors.New("price must be greater than zero")
+	}
+	if len(constituents) == 0 || len(constituents) > maxConstituents {
+		return nil, errors.New("an ETF must hold between 1 and 50 stocks")
+	}
+
+	var totalWeight float64
+	seen := make(map[int]bool)
+	for _, c := range constituents {
+		if c.Weight <= 0 {
+			return nil, errors.New("constituent weights must be positive")
+		}
+		if seen[c.StockID] {
+			return nil, errors.New("each stock can only be in the basket once")
+		}
+		seen[c.StockID] = true
+
+		constituent, err := s.stockRepo.GetStockByID(c.StockID)
+		if err != nil {
+			return nil, err
+		}
+		if constituent.Status != models.StockListed || constituent.Type != models.InstrumentStock {
+			return nil, errors.New(constituent.Symbol + " is not a listed stock")
+		}
+		c.Symbol, c.Sector, c.Price = constituent.Symbol, constituent.Sector, constituent.CurrentPrice
+		totalWeight += c.Weight
+	}
+
+	for _, c := range constituents {
+		c.Units = math.Round(c.Weight/totalWeight*float64(stock.CurrentPrice)/float64(c.Price)*1e8) / 1e8
+	}
+	etf := &models.ETF{Symbol: stock.Symbol, Name: stock.Name, Sector: stock.Sector, Constituents: constituents}
+	etf.Reprice(nil)
+
+	// Rounding the units can move the price by a cent or so
+	stock.CurrentPrice = etf.Price
+	stock.Status = models.StockListed
+	stock.Type = models.InstrumentETF
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.stockRepo.CreateStockTx(tx, stock); err != nil {
+			return err
+		}
+		etf.ID = stock.ID
+		return s.etfRepo.CreateETFTx(tx, etf)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.reloadETFs()
+	s.announceListing("stock_listed", stock)
+	return etf, nil
+}
+
+// GetETFs returns every listed ETF with its basket
+func (s *MarketService) GetETFs() ([]*models.ETF, error) {
+	etfs, err := s.etfRepo.GetETFs()
+	if err != nil {
+		return nil, err
+	}
+	if etfs == nil {
+		etfs = []*models.ETF{}
+	}
+	return etfs, nil
+}
+
+// GetETF returns an ETF with its basket
+func (s *MarketService) GetETF(id int) (*models.ETF, error) {
+	return s.etfRepo.GetETFByID(id)
+}
+
+// fillExposure works out how much of a user's money rides on each stock and sector,
+// looking through the ETFs they hold or have shorted to the stocks inside
+func (s *MarketService) fillExposure(summary *models.PortfolioSummary) {
+	exposures := make(map[int]*models.Exposure)
+	sectors := make(map[string]money.Money)
+
+	exposureTo := func(stockID int, symbol, sector string) *models.Exposure {
+		exposure, ok := exposures[stockID]
+		if !ok {
+			exposure = &models.Exposure{StockID: stockID, Symbol: symbol, Sector: sector}
+			exposures[stockID] = exposure
+		}
+		return exposure
+	}
+
+	// Shares are negative for a short position
+	add := func(stock models.Stock, stockID int, shares float64) {
+		etf, ok := s.baskets.get(stockID)
+		if !ok {
+			value := stock.CurrentPrice.Mul(shares)
+			exposureTo(stockID, stock.Symbol, stock.Sector).Direct += value
+			sectors[stock.Sector] += value
+			return
+		}
+
+		for _, c := range etf.Constituents {
+			value := c.Price.Mul(shares * c.Units)
+			exposureTo(c.StockID, c.Symbol, c.Sector).ViaETFs += value
+			sectors[c.Sector] += value
+		}
+		if etf.Cash != 0 {
+			sectors["Cash"] += etf.Cash.Mul(shares)
+		}
+	}
+
+	for _, item := range summary.PortfolioItems {
+		add(item.Stock, item.StockID, item.Quantity)
+	}
+	for _, position := range summary.ShortPositions {
+		add(position.Stock, position.StockID, -position.Quantity)
+	}
+
+	summary.Exposures = make([]*models.Exposure, 0, len(exposures))
+	for _, exposure := range exposures {
+		exposure.Total = exposure.Direct + exposure.ViaETFs
+		summary.Exposures = append(summary.Exposures, exposure)
+	}
+	sort.Slice(summary.Exposures, func(i, j int) bool {
+		if summary.Exposures[i].Total != summary.Exposures[j].Total {
+			return summary.Exposures[i].Total > summary.Exposures[j].Total
+		}
+		return summary.Exposures[i].Symbol < summary.Exposures[j].Symbol
+	})
+
+	var gross money.Money
+	for _, value := range sectors {
+		gross += value.Abs()
+	}
+	summary.SectorExposures = make([]*models.SectorExposure, 0, len(sectors))
+	for sector, value := range sectors {
+		exposure := &models.SectorExposure{Sector: sector, Value: value}
+		if gross > 0 {
+			exposure.Weight = math.Round(float64(value)/float64(gross)*10000) / 10000
+		}
+		summary.SectorExposures = append(summary.SectorExposures, exposure)
+	}
+	sort.Slice(summary.SectorExposures, func(i, j int) bool {
+		if summary.SectorExposures[i].Value != summary.SectorExposures[j].Value {
+			return summary.SectorExposures[i].Value > summary.SectorExposures[j].Value
+		}
+		return summary.SectorExposures[i].Sector < summary.SectorExposures[j].Sector
+	})
+}
@@ -0,0 +1,29 @@
+package services
+
+import (
+	"database/sql"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// GetFeeSchedule returns the commission schedule currently charged on trades
+func (s *MarketService) GetFeeSchedule() (*models.FeeSchedule, error) {
+	return s.feeRepo.GetCurrentFeeSchedule()
+}
+
+// tradeFee works out the commission for a trade inside the trade's transaction,
+// so a user's monthly volume can't change while their fee is being decided
+func (s *MarketService) tradeFee(tx *sql.Tx, userID int, quantity float64, price money.Money) (money.Money, error) {
+	schedule, err := s.feeRepo.GetCurrentFeeSchedule()
+	if err != nil {
+		return 0, err
+	}
+
+	volume, err := s.transactionRepo.GetMonthlyVolumeTx(tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return schedule.Fee(quantity, price, volume), nil
+}
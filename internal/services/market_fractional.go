@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// FractionalConfig controls how finely shares can be traded
+type FractionalConfig struct {
+	MinFraction float64 // Smallest part of a share that can be traded; quantities must be whole multiples of it
+}
+
+// DefaultFractionalConfig returns the fractional share settings used unless overridden:
+// shares trade in thousandths, so a new player can spread a starting balance over pricey stocks
+func DefaultFractionalConfig() FractionalConfig {
+	return FractionalConfig{
+		MinFraction: 0.001,
+	}
+}
+
+// Validate checks that the minimum fraction is a share or less, and no finer than the schema stores
+func (c FractionalConfig) Validate() error {
+	if c.MinFraction > 1 || c.MinFraction*models.ShareScale < 1 {
+		return fmt.Errorf("minimum fraction must be between %g and 1 share", 1/models.ShareScale)
+	}
+	return nil
+}
+
+// SetFractionalConfig replaces the fractional share settings. A minimum fraction of 1 only allows whole shares.
+func (s *MarketService) SetFractionalConfig(cfg FractionalConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.fractionalConfig = cfg
+	return nil
+}
+
+// checkQuantity checks that a share quantity is positive and a whole multiple of the minimum fraction
+func (s *MarketService) checkQuantity(quantity float64) error {
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	step := s.fractionalConfig.MinFraction
+	if units := quantity / step; math.Abs(units-math.Round(units)) > 1e-6 {
+		return fmt.Errorf("quantity must be a whole multiple of %g shares", step)
+	}
+	return nil
+}
+
+// sharesForAmount works out how many shares amount dollars buys at price,
+// rounded down to a whole multiple of the minimum fraction
+func (s *MarketService) sharesForAmount(amount, price money.Money) (float64, error) {
+	if amount <= 0 {
+		return 0, errors.New("amount must be greater than zero")
+	}
+	if price <= 0 {
+		return 0, errors.New("stock has no price")
+	}
+
+	step := s.fractionalConfig.MinFraction
+	quantity := models.RoundShares(math.Floor(float64(amount)/float64(price)/step+1e-9) * step)
+	if quantity <= 0 {
+		return 0, fmt.Errorf("$%s buys less than the minimum of %g shares", amount, step)
+	}
+	return quantity, nil
+}
+
+// BuyStockAmount buys amount dollars' worth of a stock at the current price, rounded down to the
+// minimum fraction of a share, and returns the shares bought. Commission is charged on top of amount.
+func (s *MarketService) BuyStockAmount(userID, stockID int, amount money.Money) (float64, error) {
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return 0, err
+	}
+
+	quantity, err := s.sharesForAmount(amount, stock.CurrentPrice)
+	if err != nil {
+		return 0, err
+	}
+	return quantity, s.executeBuy(userID, stock, quantity, stock.CurrentPrice, nil)
+}
+
+// SellStockAmount sells amount dollars' worth of a stock at the current price, rounded down to the
+// minimum fraction of a share, and returns the shares sold. Commission comes out of the proceeds.
+func (s *MarketService) SellStockAmount(userID, stockID int, amount money.Money) (float64, error) {
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return 0, err
+	}
+
+	quantity, err := s.sharesForAmount(amount, stock.CurrentPrice)
+	if err != nil {
+		return 0, err
+	}
+	return quantity, s.executeSell(userID, stock, quantity, stock.CurrentPrice, nil)
+}
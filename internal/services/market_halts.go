@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// SetHaltConfig sets the price bands and circuit breakers that halt trading
+func (s *MarketService) SetHaltConfig(cfg market.HaltConfig) {
+	s.simulator.SetHaltConfig(cfg)
+}
+
+// checkTradable rejects market orders while the market is closed or the stock is unlisted or halted
+func (s *MarketService) checkTradable(stock *models.Stock) error {
+	if err := s.checkMarketOpen(); err != nil {
+		return err
+	}
+	if err := checkListed(stock); err != nil {
+		return err
+	}
+	if halt := s.simulator.GetHalt(stock.ID); halt != nil {
+		return errors.New("trading in this stock is halted (" + halt.Reason + ")")
+	}
+	return nil
+}
+
+// HaltStock stops trading in a stock for the given duration, or until it is resumed if the duration is 0
+func (s *MarketService) HaltStock(symbol string, duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("duration cannot be negative")
+	}
+
+	stock, err := s.stockRepo.GetStockBySymbol(symbol)
+	if err != nil {
+		return err
+	}
+
+	return s.simulator.HaltStock(stock.ID, market.HaltAdmin, duration)
+}
+
+// ResumeStock restarts trading in a halted stock
+func (s *MarketService) ResumeStock(symbol string) error {
+	stock, err := s.stockRepo.GetStockBySymbol(symbol)
+	if err != nil {
+		return err
+	}
+
+	return s.simulator.ResumeStock(stock.ID)
+}
+
+// GetHalts returns every stock whose trading is stopped
+func (s *MarketService) GetHalts() ([]*models.TradingHalt, error) {
+	halts := s.simulator.GetHalts()
+	if len(halts) == 0 {
+		return []*models.TradingHalt{}, nil
+	}
+
+	stocks, err := s.stockRepo.GetAllStocks()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.TradingHalt, 0, len(halts))
+	for _, stock := range stocks {
+		halt, ok := halts[stock.ID]
+		if !ok {
+			continue
+		}
+
+		tradingHalt := &models.TradingHalt{
+			StockID: stock.ID,
+			Symbol:  stock.Symbol,
+			Reason:  halt.Reason,
+			Since:   halt.Since,
+		}
+		if !halt.Until.IsZero() {
+			until := halt.Until
+			tradingHalt.Until = &until
+		}
+		result = append(result, tradingHalt)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Symbol < result[j].Symbol })
+	return result, nil
+}
+
+// runHaltJobs broadcasts "trading_halt" and "trading_resume" messages as stocks halt and resume
+func (s *MarketService) runHaltJobs() {
+	for event := range s.simulator.GetHaltChannel() {
+		if s.wsHub == nil {
+			continue
+		}
+
+		messageType := "trading_resume"
+		if event.Halted {
+			messageType = "trading_halt"
+		}
+		s.wsHub.BroadcastMessage(messageType, event)
+	}
+}
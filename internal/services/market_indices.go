@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// maxIndexPoints caps how many index levels a single history request can return
+const maxIndexPoints = 1000
+
+// ErrUnknownIndex is returned for index codes the market doesn't have
+var ErrUnknownIndex = errors.New("unknown index")
+
+// GetIndices returns the composite and every sector index with how far each has moved since the previous close
+func (s *MarketService) GetIndices() ([]*models.MarketIndex, error) {
+	now := time.Now()
+	loc := s.calendar.Location()
+	year, month, day := now.In(loc).Date()
+	dayStart := time.Date(year, month, day, 0, 0, 0, 0, loc)
+
+	values := s.simulator.Indices()
+	indices := make([]*models.MarketIndex, 0, len(values))
+	for _, value := range values {
+		index := &models.MarketIndex{
+			Code:          value.Code,
+			Name:          value.Name,
+			Sector:        value.Sector,
+			Value:         value.Value,
+			PreviousClose: value.Value,
+			Members:       value.Members,
+			UpdatedAt:     value.Time,
+		}
+
+		previous, err := s.indexRepo.GetIndexLevelAt(value.Code, dayStart)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && previous.Value > 0 {
+			index.PreviousClose = previous.Value
+			index.Change = math.Round((index.Value-previous.Value)*100) / 100
+			index.ChangePercent = math.Round(index.Change/previous.Value*10000) / 100
+		}
+		indices = append(indices, index)
+	}
+
+	return indices, nil
+}
+
+// GetIndexHistory returns an index's recorded levels between from and to, up to limit of the latest.
+// A zero to means now, and a zero from means a day before to.
+func (s *MarketService) GetIndexHistory(code string, from, to time.Time, limit int) ([]*models.IndexPoint, error) {
+	if _, err := s.currentIndex(code); err != nil {
+		return nil, err
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-24 * time.Hour)
+	}
+	if from.After(to) {
+		return nil, errors.New("from must be before to")
+	}
+	if limit <= 0 || limit > maxIndexPoints {
+		limit = maxIndexPoints
+	}
+
+	return s.indexRepo.GetIndexHistory(code, from, to, limit)
+}
+
+// GetBenchmark compares a user's return since they joined with an index's over the same time.
+// The composite is used if code is empty.
+func (s *MarketService) GetBenchmark(userID int, code string) (*models.Benchmark, error) {
+	if code == "" {
+		code = market.CompositeIndexCode
+	}
+	current, err := s.currentIndex(code)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	portfolio, err := s.GetUserPortfolio(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	benchmark := &models.Benchmark{
+		IndexCode:      code,
+		Since:          user.CreatedAt,
+		StartingValue:  models.StartingCash,
+		PortfolioValue: portfolio.TotalValue,
+		IndexStart:     current.Value,
+		IndexValue:     current.Value,
+	}
+
+	// Indices only go back as far as their history; measure from there if the user joined earlier
+	start, err := s.indexRepo.GetIndexLevelAt(code, user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if start != nil && start.Value > 0 {
+		benchmark.IndexStart = start.Value
+		if start.RecordedAt.After(benchmark.Since) {
+			benchmark.Since = start.RecordedAt
+		}
+	}
+
+	benchmark.PortfolioReturn = math.Round((benchmark.PortfolioValue.Float()/benchmark.StartingValue.Float()-1)*10000) / 10000
+	benchmark.IndexReturn = math.Round((benchmark.IndexValue/benchmark.IndexStart-1)*10000) / 10000
+	benchmark.ExcessReturn = math.Round((benchmark.PortfolioReturn-benchmark.IndexReturn)*10000) / 10000
+	return benchmark, nil
+}
+
+// currentIndex returns an index's current level by code
+func (s *MarketService) currentIndex(code string) (*market.IndexValue, error) {
+	for _, value := range s.simulator.Indices() {
+		if value.Code == code {
+			return &value, nil
+		}
+	}
+	return nil, ErrUnknownIndex
+}
+
+// restoreIndexLevels carries the indices on from the levels last recorded before a restart
+func (s *MarketService) restoreIndexLevels() error {
+	levels, err := s.indexRepo.GetLatestIndexLevels()
+	if err != nil {
+		return err
+	}
+	return s.simulator.SetIndexLevels(levels)
+}
+
+// runIndexJobs records every tick's index levels and broadcasts them as "index_update" messages
+func (s *MarketService) runIndexJobs() {
+	for values := range s.simulator.GetIndexChannel() {
+		points := make([]*models.IndexPoint, 0, len(values))
+		for _, value := range values {
+			points = append(points, &models.IndexPoint{Code: value.Code, Value: value.Value, RecordedAt: value.Time})
+		}
+		if err := s.indexRepo.SaveIndexPoints(points); err != nil {
+			log.Printf("runIndexJobs: Error saving %d index levels: %v", len(points), err)
+		}
+
+		if s.wsHub != nil {
+			s.wsHub.BroadcastMessage("index_update", values)
+		}
+	}
+}
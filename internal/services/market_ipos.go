@@ -0,0 +1,388 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"officestonks/internal/models"
+)
+
+// IPOConfig controls how long IPOs take subscriptions and how often closed ones are allocated
+type IPOConfig struct {
+	CheckInterval      time.Duration // How often IPOs whose subscriptions have closed are allocated
+	SubscriptionWindow time.Duration // How long an IPO takes subscriptions, unless it says when it closes
+}
+
+// DefaultIPOConfig returns the IPO settings used unless overridden
+func DefaultIPOConfig() IPOConfig {
+	return IPOConfig{
+		CheckInterval:      time.Minute,
+		SubscriptionWindow: time.Hour,
+	}
+}
+
+// SetIPOConfig replaces the IPO settings
+func (s *MarketService) SetIPOConfig(cfg IPOConfig) {
+	s.ipoConfig = cfg
+}
+
+// CreateIPO adds a stock that takes subscriptions for its float at the IPO price until the IPO
+// closes, when the shares are allocated and the stock starts trading. Missing subscription
+// window times are filled in from the config.
+func (s *MarketService) CreateIPO(stock *models.Stock, ipo *models.IPO) error {
+	if err := validateListing(stock); err != nil {
+		return err
+	}
+	if ipo.Float <= 0 {
+		return errors.New("float must be greater than zero")
+	}
+	if ipo.Price <= 0 {
+		return errors.New("IPO price must be greater than zero")
+	}
+
+	now := time.Now()
+	if ipo.OpensAt.IsZero() {
+		ipo.OpensAt = now
+	}
+	if ipo.ClosesAt.IsZero() {
+		ipo.ClosesAt = ipo.OpensAt.Add(s.ipoConfig.SubscriptionWindow)
+	}
+	if !ipo.ClosesAt.After(ipo.OpensAt) || !ipo.ClosesAt.After(now) {
+		return errors.New("the IPO must close in the future, after it opens")
+	}
+
+	// The stock shows the IPO price until it starts trading
+	stock.CurrentPrice = ipo.Price
+	stock.Status = models.StockIPO
+	stock.Type = models.InstrumentStock
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.stockRepo.CreateStockTx(tx, stock); err != nil {
+			return err
+		}
+		ipo.StockID = stock.ID
+		return s.ipoRepo.CreateIPOTx(tx, ipo)
+	})
+	if err != nil {
+		return err
+	}
+	ipo.Symbol, ipo.Name, ipo.Sector = stock.Symbol, stock.Name, stock.Sector
+
+	s.announceIPO(ipo)
+	return nil
+}
+
+// GetIPOs returns IPOs with a status, or every IPO if status is empty, latest first
+func (s *MarketService) GetIPOs(status models.IPOStatus, limit, offset int) ([]*models.IPO, error) {
+	switch status {
+	case "", models.IPOOpen, models.IPOAllocated, models.IPOCancelled:
+		return s.ipoRepo.GetIPOs(status, limit, offset)
+	default:
+		return nil, errors.New("status must be 'open', 'allocated' or 'cancelled'")
+	}
+}
+
+// GetIPO returns an IPO by ID
+func (s *MarketService) GetIPO(id int) (*models.IPO, error) {
+	return s.ipoRepo.GetIPOByID(id)
+}
+
+// GetUserIPOSubscriptions returns every IPO subscription a user has made, latest first
+func (s *MarketService) GetUserIPOSubscriptions(userID int) ([]*models.IPOSubscription, error) {
+	return s.ipoRepo.GetUserSubscriptions(userID)
+}
+
+// SubscribeToIPO requests shares in an open IPO, replacing any earlier request from the user.
+// The cost of the shares is held back from the user's cash until the IPO is allocated.
+func (s *MarketService) SubscribeToIPO(userID, ipoID, quantity int) (*models.IPOSubscription, error) {
+	if quantity <= 0 {
+		return nil, errors.New("quantity must be greater than zero")
+	}
+
+	var subscription *models.IPOSubscription
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the IPO first, so it can't be allocated while the request is made
+		ipo, err := s.ipoRepo.GetIPOForUpdate(tx, ipoID)
+		if err != nil {
+			return err
+		}
+		if err := checkSubscriptionsOpen(ipo); err != nil {
+			return err
+		}
+		if quantity > ipo.Float {
+			return errors.New("cannot request more shares than the IPO offers")
+		}
+
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		existing, err := s.ipoRepo.GetSubscriptionForUpdate(tx, ipoID, userID)
+		if err != nil {
+			return err
+		}
+		previous := 0
+		if existing != nil {
+			previous = existing.Quantity
+		}
+
+		// Only the change in the request moves cash in or out of escrow
+		extra := ipo.Price.Mul(float64(quantity - previous))
+		if extra > 0 {
+			// Cash held back by open buy orders can't be spent
+			reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+			if err != nil {
+				return err
+			}
+			if user.CashBalance-reservedCash < extra {
+				return errors.New("insufficient funds")
+			}
+		}
+		if err := s.postTx(tx, user, nil, models.Transfer(models.CashAccount, models.EscrowAccount, extra)); err != nil {
+			return err
+		}
+
+		if err := s.ipoRepo.SaveSubscriptionTx(tx, ipoID, userID, quantity); err != nil {
+			return err
+		}
+		subscription, err = s.ipoRepo.GetSubscriptionForUpdate(tx, ipoID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+// CancelIPOSubscription withdraws a user's request for shares in an open IPO and refunds its cost
+func (s *MarketService) CancelIPOSubscription(userID, ipoID int) error {
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		ipo, err := s.ipoRepo.GetIPOForUpdate(tx, ipoID)
+		if err != nil {
+			return err
+		}
+		if err := checkSubscriptionsOpen(ipo); err != nil {
+			return err
+		}
+
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		subscription, err := s.ipoRepo.GetSubscriptionForUpdate(tx, ipoID, userID)
+		if err != nil {
+			return err
+		}
+		if subscription == nil {
+			return errors.New("no subscription to this IPO")
+		}
+
+		refund := ipo.Price.Mul(float64(subscription.Quantity))
+		if err := s.postTx(tx, user, nil, models.Transfer(models.EscrowAccount, models.CashAccount, refund)); err != nil {
+			return err
+		}
+		return s.ipoRepo.DeleteSubscriptionTx(tx, subscription.ID)
+	})
+}
+
+// checkSubscriptionsOpen rejects changes to subscriptions outside an IPO's subscription window
+func checkSubscriptionsOpen(ipo *models.IPO) error {
+	now := time.Now()
+	if ipo.Status != models.IPOOpen || !now.Before(ipo.ClosesAt) {
+		return errors.New("IPO is not taking subscriptions")
+	}
+	if now.Before(ipo.OpensAt) {
+		return errors.New("IPO is not taking subscriptions yet")
+	}
+	return nil
+}
+
+// CancelIPO withdraws an IPO before it is allocated, refunds every subscription and delists its stock
+func (s *MarketService) CancelIPO(id int) (*models.IPO, error) {
+	var ipo *models.IPO
+	var subscriptions []*models.IPOSubscription
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		var err error
+		ipo, err = s.ipoRepo.GetIPOForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.ipoRepo.UpdateIPOStatusTx(tx, id, models.IPOOpen, models.IPOCancelled); err != nil {
+			return err
+		}
+
+		subscriptions, err = s.ipoRepo.GetSubscriptionsForUpdate(tx, id)
+		if err != nil {
+			return err
+		}
+		allocations := make([]int, len(subscriptions))
+		if err := s.settleSubscriptionsTx(tx, ipo, subscriptions, allocations); err != nil {
+			return err
+		}
+
+		return s.stockRepo.SetStockStatusTx(tx, ipo.StockID, models.StockIPO, models.StockDelisted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ipo.Status = models.IPOCancelled
+
+	log.Printf("CancelIPO: Cancelled the %s IPO, refunding %d subscriptions", ipo.Symbol, len(subscriptions))
+	for _, subscription := range subscriptions {
+		s.notifyUser(subscription.UserID, "ipo_subscription", subscription)
+	}
+	s.announceIPO(ipo)
+	return ipo, nil
+}
+
+// runIPOJobs allocates IPOs and lists their stocks as their subscriptions close
+func (s *MarketService) runIPOJobs() {
+	ticker := time.NewTicker(s.ipoConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ProcessIPOs()
+	}
+}
+
+// ProcessIPOs allocates every IPO whose subscriptions have closed
+func (s *MarketService) ProcessIPOs() {
+	ipos, err := s.ipoRepo.GetDueIPOs(time.Now())
+	if err != nil {
+		log.Printf("ProcessIPOs: Error loading due IPOs: %v", err)
+		return
+	}
+
+	for _, ipo := range ipos {
+		if err := s.allocateIPO(ipo); err != nil {
+			log.Printf("ProcessIPOs: Error allocating the %s IPO: %v", ipo.Symbol, err)
+		}
+	}
+}
+
+// allocateIPO shares an IPO's float out between its subscriptions, refunds what each couldn't
+// be given and lists the stock, as one database transaction. Each subscription gets everything
+// it asked for if the IPO isn't oversubscribed, or its share of the float if it is; whole shares
+// left over from rounding go to the largest remainders, then the earliest subscriptions.
+func (s *MarketService) allocateIPO(ipo *models.IPO) error {
+	var subscriptions []*models.IPOSubscription
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if _, err := s.ipoRepo.GetIPOForUpdate(tx, ipo.ID); err != nil {
+			return err
+		}
+		if err := s.ipoRepo.UpdateIPOStatusTx(tx, ipo.ID, models.IPOOpen, models.IPOAllocated); err != nil {
+			return err
+		}
+
+		var err error
+		subscriptions, err = s.ipoRepo.GetSubscriptionsForUpdate(tx, ipo.ID)
+		if err != nil {
+			return err
+		}
+
+		quantities := make([]float64, len(subscriptions))
+		requested := 0
+		for i, subscription := range subscriptions {
+			quantities[i] = float64(subscription.Quantity)
+			requested += subscription.Quantity
+		}
+		ratio := 1.0
+		if requested > ipo.Float {
+			ratio = float64(ipo.Float) / float64(requested)
+		}
+
+		// IPO shares are only allocated whole
+		allocations := make([]int, len(subscriptions))
+		for i, allocated := range models.SplitShares(quantities, ratio, 1) {
+			allocations[i] = int(allocated)
+		}
+		if err := s.settleSubscriptionsTx(tx, ipo, subscriptions, allocations); err != nil {
+			return err
+		}
+
+		if err := s.stockRepo.SetStockStatusTx(tx, ipo.StockID, models.StockIPO, models.StockListed); err != nil {
+			return err
+		}
+		return s.stockRepo.UpdateStockPriceTx(tx, ipo.StockID, ipo.Price)
+	})
+	if err != nil {
+		return err
+	}
+	ipo.Status = models.IPOAllocated
+
+	stock, err := s.stockRepo.GetStockByID(ipo.StockID)
+	if err != nil {
+		return err
+	}
+	s.simulator.AddStock(stock.ID, stock.Symbol, stock.Sector, ipo.Price)
+
+	log.Printf("allocateIPO: Listed %s at %s after allocating %d subscriptions", ipo.Symbol, ipo.Price, len(subscriptions))
+	for _, subscription := range subscriptions {
+		s.notifyUser(subscription.UserID, "ipo_subscription", subscription)
+	}
+	s.announceIPO(ipo)
+	s.announceListing("stock_listed", stock)
+	return nil
+}
+
+// settleSubscriptionsTx gives each subscription its allocation of shares at the IPO price and refunds
+// the cash held back for the rest. Users are locked in ID order, as they are everywhere else.
+func (s *MarketService) settleSubscriptionsTx(tx *sql.Tx, ipo *models.IPO, subscriptions []*models.IPOSubscription, allocations []int) error {
+	order := make([]int, len(subscriptions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return subscriptions[order[a]].UserID < subscriptions[order[b]].UserID })
+
+	for _, i := range order {
+		subscription, allocated := subscriptions[i], allocations[i]
+
+		user, err := s.userRepo.GetUserForUpdate(tx, subscription.UserID)
+		if err != nil {
+			return err
+		}
+		refund := ipo.Price.Mul(float64(subscription.Quantity - allocated))
+		if err := s.postTx(tx, user, nil, models.Transfer(models.EscrowAccount, models.CashAccount, refund)); err != nil {
+			return err
+		}
+
+		if allocated > 0 {
+			shares := float64(allocated)
+			if err := s.portfolioRepo.AddStockToPortfolioTx(tx, user.ID, ipo.StockID, shares); err != nil {
+				return err
+			}
+			transaction, err := s.transactionRepo.CreateTransactionTx(tx, user.ID, ipo.StockID, shares, ipo.Price, models.IPOAllocation, 0, 0)
+			if err != nil {
+				return err
+			}
+
+			// The shares are paid for with the cash held back for them
+			if err := s.postTx(tx, user, transaction, models.Transfer(models.EscrowAccount, models.MarketAccount, ipo.Price.Mul(shares))); err != nil {
+				return err
+			}
+			if err := s.addLotTx(tx, user.ID, ipo.StockID, shares, ipo.Price, 0, transaction.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := s.ipoRepo.SetAllocatedTx(tx, subscription.ID, allocated); err != nil {
+			return err
+		}
+		subscription.Allocated = &allocations[i]
+	}
+
+	return nil
+}
+
+// announceIPO tells every client about an IPO's new status
+func (s *MarketService) announceIPO(ipo *models.IPO) {
+	if s.wsHub != nil {
+		s.wsHub.BroadcastMessage("ipo", ipo)
+	}
+}
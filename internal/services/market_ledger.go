@@ -0,0 +1,94 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+// postTx records entries in a locked user's ledger and applies them to the user's cash and
+// margin loan. Every cash movement goes through here, so the balances only ever change by
+// what the ledger says. A non-nil transaction is linked to the entries.
+func (s *MarketService) postTx(tx *sql.Tx, user *models.User, transaction *models.Transaction, entries ...*models.LedgerEntry) error {
+	for _, entry := range entries {
+		entry.UserID = user.ID
+		if transaction != nil {
+			entry.TransactionID = &transaction.ID
+		}
+	}
+
+	cash, loan, err := s.ledgerRepo.PostTx(tx, user.ID, entries)
+	if err != nil {
+		return err
+	}
+	user.CashBalance += cash
+	user.LoanBalance += loan
+	return nil
+}
+
+// AdjustCashBalance sets a user's cash balance on an admin's say-so, posting the difference
+// to the ledger as an adjustment so there is a record of who changed it and why
+func (s *MarketService) AdjustCashBalance(userID int, cashBalance money.Money, adminID int, reason string) (*models.User, error) {
+	var user *models.User
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		var err error
+		user, err = s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		adjustment := models.Transfer(models.AdjustmentAccount, models.CashAccount, cashBalance-user.CashBalance)
+		adjustment.Memo = reason
+		if adminID != 0 {
+			adjustment.CreatedBy = &adminID
+		}
+		return s.postTx(tx, user, nil, adjustment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserLedger returns a user's ledger entries, newest first
+func (s *MarketService) GetUserLedger(userID, limit, offset int) ([]*models.LedgerEntry, error) {
+	return s.ledgerRepo.GetUserEntries(userID, limit, offset)
+}
+
+// ReconcileLedger checks every user's cash, margin loan and IPO escrow against the balances
+// their ledger adds up to, and the cash their transactions moved against the ledger entries
+// for them, and flags the users where they disagree. It replaces replaying every transaction
+// from the starting cash, which couldn't account for admin adjustments or opening balances.
+func (s *MarketService) ReconcileLedger() (*models.LedgerReconciliation, error) {
+	balances, err := s.ledgerRepo.GetBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, balance := range balances {
+		if balance.FirstTransactionID == 0 {
+			continue
+		}
+		transactions, err := s.transactionRepo.GetUserTransactionsBetween(balance.UserID, balance.FirstTransactionID, balance.LastTransactionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, transaction := range transactions {
+			balance.TransactionCash += transaction.CashFlow()
+		}
+	}
+
+	reconciliation := &models.LedgerReconciliation{
+		Checked:   len(balances),
+		Flagged:   []*models.LedgerBalance{},
+		CheckedAt: time.Now(),
+	}
+	for _, balance := range balances {
+		if !balance.Balanced() {
+			reconciliation.Flagged = append(reconciliation.Flagged, balance)
+		}
+	}
+	return reconciliation, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// symbolPattern is what a ticker symbol may look like
+var symbolPattern = regexp.MustCompile(`^[A-Z][A-Z0-9.]{0,9}$`)
+
+// checkListed rejects trading in a stock that hasn't listed yet or has been delisted
+func checkListed(stock *models.Stock) error {
+	switch stock.Status {
+	case models.StockListed:
+		return nil
+	case models.StockIPO:
+		return errors.New(stock.Symbol + " has not listed yet")
+	default:
+		return errors.New(stock.Symbol + " has been delisted")
+	}
+}
+
+// validateListing tidies up and checks the details of a new or changed listing
+func validateListing(stock *models.Stock) error {
+	stock.Symbol = strings.ToUpper(strings.TrimSpace(stock.Symbol))
+	stock.Name = strings.TrimSpace(stock.Name)
+	stock.Sector = strings.TrimSpace(stock.Sector)
+
+	if !symbolPattern.MatchString(stock.Symbol) {
+		return errors.New("symbol must be 1 to 10 letters, digits or dots, starting with a letter")
+	}
+	if stock.Name == "" || len(stock.Name) > 100 {
+		return errors.New("name must be 1 to 100 characters")
+	}
+	if stock.Sector == "" || len(stock.Sector) > 50 {
+		return errors.New("sector must be 1 to 50 characters")
+	}
+	return nil
+}
+
+// GetStocksByStatus returns the stocks at one stage of their listing, or every stock if status is empty
+func (s *MarketService) GetStocksByStatus(status models.StockStatus) ([]*models.Stock, error) {
+	switch status {
+	case "", models.StockIPO, models.StockListed, models.StockDelisted:
+		return s.stockRepo.GetStocksByStatus(status)
+	default:
+		return nil, errors.New("status must be 'ipo', 'listed' or 'delisted'")
+	}
+}
+
+// CreateListing lists a new stock at a price straight away and starts simulating it
+func (s *MarketService) CreateListing(stock *models.Stock) error {
+	if err := validateListing(stock); err != nil {
+		return err
+	}
+	if stock.CurrentPrice <= 0 {
+		return errors.New("price must be greater than zero")
+	}
+	stock.Status = models.StockListed
+	stock.Type = models.InstrumentStock
+
+	if err := s.stockRepo.CreateStock(stock); err != nil {
+		return err
+	}
+
+	s.simulator.AddStock(stock.ID, stock.Symbol, stock.Sector, stock.CurrentPrice)
+	s.announceListing("stock_listed", stock)
+	return nil
+}
+
+// UpdateListing changes a stock's name and sector
+func (s *MarketService) UpdateListing(stock *models.Stock) (*models.Stock, error) {
+	existing, err := s.stockRepo.GetStockByID(stock.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The symbol can't change, so check everything else against it
+	stock.Symbol = existing.Symbol
+	if err := validateListing(stock); err != nil {
+		return nil, err
+	}
+
+	if err := s.stockRepo.UpdateStock(stock); err != nil {
+		return nil, err
+	}
+	if existing.Status == models.StockListed && existing.Type == models.InstrumentStock && stock.Sector != existing.Sector {
+		if err := s.simulator.SetStockSector(stock.ID, stock.Sector); err != nil {
+			log.Printf("UpdateListing: Error moving %s into %s: %v", stock.Symbol, stock.Sector, err)
+		}
+	}
+
+	existing.Name = stock.Name
+	existing.Sector = stock.Sector
+	return existing, nil
+}
+
+// DelistStock stops trading in a stock, cancels its open orders and cashes out everyone
+// holding or short the stock at its last price, then stops simulating it
+func (s *MarketService) DelistStock(stockID int) (*models.Stock, error) {
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return nil, err
+	}
+	if stock.Status != models.StockListed {
+		return nil, errors.New(stock.Symbol + " is not listed")
+	}
+
+	// Stop the price moving first, so the last price stored is the one everyone is paid.
+	// Stocks the simulator doesn't know about can't be traded anyway.
+	halted := s.simulator.HaltStock(stockID, market.HaltDelisting, 0) == nil
+	if halted {
+		if stock, err = s.stockRepo.GetStockByID(stockID); err != nil {
+			s.simulator.ResumeStock(stockID)
+			return nil, err
+		}
+	}
+	// An ETF's price stops following its basket
+	s.baskets.remove(stockID)
+	price := stock.CurrentPrice
+
+	err = s.delistTx(stock, price)
+	s.reloadETFs()
+	if err != nil {
+		if halted {
+			s.simulator.ResumeStock(stockID)
+		}
+		return nil, err
+	}
+	stock.Status = models.StockDelisted
+
+	if halted {
+		s.simulator.RemoveStock(stockID)
+	}
+
+	// Options on the stock can't wait for expiry, so they are settled at the same price
+	s.settleStockOptions(stockID, price)
+
+	log.Printf("DelistStock: Delisted %s at %s", stock.Symbol, price)
+	s.announceListing("stock_delisted", stock)
+	return stock, nil
+}
+
+// delistTx marks a stock delisted, cancels its open orders and settles every position in it at price, as one transaction
+func (s *MarketService) delistTx(stock *models.Stock, price money.Money) error {
+	// Everyone who holds or owes shares, in ID order so users are always locked in the same order
+	holderIDs, err := s.portfolioRepo.GetUserIDsHoldingStock(stock.ID)
+	if err != nil {
+		return err
+	}
+	shortIDs, err := s.shortRepo.GetUserIDsWithShortsInStock(stock.ID)
+	if err != nil {
+		return err
+	}
+	userIDs := uniqueSortedIDs(append(holderIDs, shortIDs...))
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.stockRepo.SetStockStatusTx(tx, stock.ID, models.StockListed, models.StockDelisted); err != nil {
+			return err
+		}
+		if err := s.orderRepo.CancelOpenOrdersForStockTx(tx, stock.ID); err != nil {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			if err := s.settleDelistedPositionsTx(tx, userID, stock.ID, price); err != nil {
+				return err
+			}
+		}
+
+		// ETFs holding the stock are paid out in cash
+		if err := s.etfRepo.RemoveConstituentTx(tx, stock.ID, price); err != nil {
+			return err
+		}
+		return s.stockRepo.UpdateStockPriceTx(tx, stock.ID, price)
+	})
+}
+
+// settleDelistedPositionsTx sells a user's holding in a delisted stock and buys back their short position, both at price
+func (s *MarketService) settleDelistedPositionsTx(tx *sql.Tx, userID, stockID int, price money.Money) error {
+	user, err := s.userRepo.GetUserForUpdate(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stockID)
+	if err != nil {
+		return err
+	}
+	if holding != nil && holding.Quantity > 0 {
+		proceeds := price.Mul(holding.Quantity)
+		costBasis, err := s.consumeLotsTx(tx, user, stockID, holding.Quantity, price)
+		if err != nil {
+			return err
+		}
+		if err := s.portfolioRepo.UpdateStockQuantityTx(tx, holding.ID, 0); err != nil {
+			return err
+		}
+
+		transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, holding.Quantity, price, models.DelistSale, 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, proceeds-costBasis); err != nil {
+			return err
+		}
+
+		// The proceeds pay down any margin loan first, as a sale's would
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.MarketAccount, models.CashAccount, proceeds),
+			models.Transfer(models.CashAccount, models.LoanAccount, money.Min(user.LoanBalance, proceeds)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	position, err := s.shortRepo.GetShortPositionForUpdate(tx, userID, stockID)
+	if err != nil {
+		return err
+	}
+	if position != nil && position.Quantity > 0 {
+		cost := price.Mul(position.Quantity)
+		if err := s.shortRepo.UpdateShortQuantityTx(tx, position.ID, 0); err != nil {
+			return err
+		}
+
+		transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, position.Quantity, price, models.DelistCover, 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, position.EntryPrice.Mul(position.Quantity)-cost); err != nil {
+			return err
+		}
+		return s.postTx(tx, user, transaction, models.Transfer(models.CashAccount, models.MarketAccount, cost))
+	}
+
+	return nil
+}
+
+// announceListing tells every client that a stock has listed or delisted
+func (s *MarketService) announceListing(messageType string, stock *models.Stock) {
+	if s.wsHub != nil {
+		s.wsHub.BroadcastMessage(messageType, stock)
+	}
+}
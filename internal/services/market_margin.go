@@ -0,0 +1,242 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// MarginConfig controls margin accounts
+type MarginConfig struct {
+	MaxLeverage       float64       // Long stock value may not exceed this multiple of equity
+	InterestRate      float64       // Annual interest rate charged on margin loans
+	InterestInterval  time.Duration // How often interest is added to loans
+	MaintenanceMargin float64       // Equity below which holdings are liquidated, as a fraction of long stock value
+}
+
+// DefaultMarginConfig returns the margin settings used unless overridden
+func DefaultMarginConfig() MarginConfig {
+	return MarginConfig{
+		MaxLeverage:       2.0,
+		InterestRate:      0.08,
+		InterestInterval:  24 * time.Hour,
+		MaintenanceMargin: 0.25,
+	}
+}
+
+// SetMarginConfig replaces the margin settings
+func (s *MarketService) SetMarginConfig(cfg MarginConfig) {
+	s.marginConfig = cfg
+}
+
+// SetMarginAccount turns a user's margin account on or off.
+// A margin account can only be turned off once its loan is repaid.
+func (s *MarketService) SetMarginAccount(userID int, enabled bool) error {
+	user, err := s.userRepo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled && user.LoanBalance > 0 {
+		return errors.New("repay your margin loan before closing your margin account")
+	}
+
+	return s.userRepo.SetMarginEnabled(userID, enabled)
+}
+
+// RepayLoan pays down a user's margin loan from their cash. Paying more than
+// is owed repays the loan in full.
+func (s *MarketService) RepayLoan(userID int, amount money.Money) error {
+	if amount <= 0 {
+		return errors.New("amount must be greater than zero")
+	}
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.LoanBalance <= 0 {
+			return errors.New("no margin loan to repay")
+		}
+		if amount > user.LoanBalance {
+			amount = user.LoanBalance
+		}
+
+		// Cash held back by open buy orders can't be spent
+		reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.CashBalance-reservedCash < amount {
+			return errors.New("insufficient funds")
+		}
+
+		return s.postTx(tx, user, nil, models.Transfer(models.CashAccount, models.LoanAccount, amount))
+	})
+}
+
+// buyingPower returns how much a user can spend on stock. Without a margin account
+// that is their unreserved cash; with one, it is however much more stock they can
+// hold before their long stock value reaches the leverage limit.
+func (s *MarketService) buyingPower(user *models.User, reservedCash money.Money) (money.Money, error) {
+	cash := money.Max(user.CashBalance-reservedCash, 0)
+	if !user.MarginEnabled {
+		return cash, nil
+	}
+
+	equity, err := s.portfolioRepo.CalculatePortfolioValue(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	stockValue, err := s.portfolioRepo.CalculateStockValue(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return money.Max(cash, equity.MulRate(s.marginConfig.MaxLeverage)-stockValue-reservedCash), nil
+}
+
+// runMarginJobs charges interest on margin loans on a schedule until the simulator stops
+func (s *MarketService) runMarginJobs() {
+	ticker := time.NewTicker(s.marginConfig.InterestInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.accrueInterest()
+	}
+}
+
+// accrueInterest adds one interval's interest to every outstanding margin loan, then
+// makes sure the larger loans haven't pushed anyone below the maintenance margin
+func (s *MarketService) accrueInterest() {
+	userIDs, err := s.userRepo.GetUserIDsWithLoans()
+	if err != nil {
+		log.Printf("accrueInterest: Error loading users with loans: %v", err)
+		return
+	}
+
+	periodRate := s.marginConfig.InterestRate * s.marginConfig.InterestInterval.Hours() / (365 * 24)
+	for _, userID := range userIDs {
+		err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+			user, err := s.userRepo.GetUserForUpdate(tx, userID)
+			if err != nil {
+				return err
+			}
+
+			// Charge a whole number of cents, at least one
+			interest := money.Max(user.LoanBalance.MulRate(periodRate), money.Cent)
+			transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, 0, 0, interest, models.MarginInterest, 0, 0)
+			if err != nil {
+				return err
+			}
+			if err := s.postTx(tx, user, transaction, models.Transfer(models.LoanAccount, models.InterestAccount, interest)); err != nil {
+				return err
+			}
+
+			// Interest is a cost of borrowing, realized as it is charged
+			return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, -interest)
+		})
+		if err != nil {
+			log.Printf("accrueInterest: Error charging interest to user %d: %v", userID, err)
+			continue
+		}
+
+		s.enforceMarginMaintenance(userID)
+	}
+}
+
+// checkMarginCalls re-checks the margin of every borrower who holds the updated stock
+func (s *MarketService) checkMarginCalls(update market.StockUpdate) {
+	userIDs, err := s.userRepo.GetUserIDsWithLoansHoldingStock(update.StockID)
+	if err != nil {
+		log.Printf("checkMarginCalls: Error loading borrowers holding stock %d: %v", update.StockID, err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		s.enforceMarginMaintenance(userID)
+	}
+}
+
+// enforceMarginMaintenance liquidates a borrower's holdings, largest first, until
+// their equity is back above the maintenance margin or their loan is repaid.
+// Sale proceeds go towards the loan first.
+func (s *MarketService) enforceMarginMaintenance(userID int) {
+	var liquidated []*models.Portfolio
+
+	for {
+		user, err := s.userRepo.GetUserByID(userID)
+		if err != nil {
+			log.Printf("enforceMarginMaintenance: Error loading user %d: %v", userID, err)
+			break
+		}
+		if user.LoanBalance <= 0 {
+			break
+		}
+
+		equity, err := s.portfolioRepo.CalculatePortfolioValue(userID)
+		if err != nil {
+			log.Printf("enforceMarginMaintenance: Error calculating equity for user %d: %v", userID, err)
+			break
+		}
+		items, err := s.portfolioRepo.GetUserPortfolio(userID)
+		if err != nil {
+			log.Printf("enforceMarginMaintenance: Error loading portfolio for user %d: %v", userID, err)
+			break
+		}
+
+		var stockValue money.Money
+		var largest *models.Portfolio
+		for _, item := range items {
+			value := item.Stock.CurrentPrice.Mul(item.Quantity)
+			stockValue += value
+			if largest == nil || value > largest.Stock.CurrentPrice.Mul(largest.Quantity) {
+				largest = item
+			}
+		}
+		if largest == nil || equity >= stockValue.MulRate(s.marginConfig.MaintenanceMargin) {
+			break
+		}
+
+		// Shares reserved by open sell orders would block the sale, so cancel those orders first
+		s.cancelOpenSellOrders(userID, largest.StockID)
+
+		stock := largest.Stock
+		stock.ID = largest.StockID
+		if err := s.executeSell(userID, &stock, largest.Quantity, stock.CurrentPrice, nil); err != nil {
+			log.Printf("enforceMarginMaintenance: Error selling %s for user %d: %v", stock.Symbol, userID, err)
+			break
+		}
+		log.Printf("enforceMarginMaintenance: Margin call sold %g %s for user %d", largest.Quantity, stock.Symbol, userID)
+		liquidated = append(liquidated, largest)
+	}
+
+	if len(liquidated) > 0 {
+		s.notifyUser(userID, "margin_call", liquidated)
+	}
+}
+
+// cancelOpenSellOrders cancels a user's open limit sell orders for a stock
+func (s *MarketService) cancelOpenSellOrders(userID, stockID int) {
+	orders, err := s.orderRepo.GetUserOrders(userID, models.OrderOpen)
+	if err != nil {
+		log.Printf("cancelOpenSellOrders: Error loading orders for user %d: %v", userID, err)
+		return
+	}
+
+	for _, order := range orders {
+		if order.StockID != stockID || order.Side != models.Sell || order.OrderType != models.LimitOrder {
+			continue
+		}
+		if err := s.orderRepo.CancelOrder(order.ID, userID); err != nil {
+			log.Printf("cancelOpenSellOrders: Error cancelling order %d: %v", order.ID, err)
+			continue
+		}
+		s.notifyOrder(order, "order_cancelled")
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// loadPriceModels hands the simulator the stock and sector price models stored in the database
+func (s *MarketService) loadPriceModels() error {
+	sectorModels, err := s.modelRepo.GetSectorModels()
+	if err != nil {
+		return err
+	}
+	for sector, params := range sectorModels {
+		if err := s.simulator.SetSectorParams(sector, params); err != nil {
+			return err
+		}
+	}
+
+	stockModels, err := s.modelRepo.GetStockModels()
+	if err != nil {
+		return err
+	}
+	for stockID, params := range stockModels {
+		if err := s.simulator.SetStockParams(stockID, params); err != nil {
+			return err
+		}
+	}
+
+	betas, err := s.modelRepo.GetStockBetas()
+	if err != nil {
+		return err
+	}
+	for stockID, b := range betas {
+		if err := s.simulator.SetBetas(stockID, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetFactorConfig sets how much the market and each sector move together
+func (s *MarketService) SetFactorConfig(cfg market.FactorConfig) {
+	s.simulator.SetFactorConfig(cfg)
+}
+
+// GetPriceModels returns the default price model and the ones chosen for sectors and stocks
+func (s *MarketService) GetPriceModels() (*models.PriceModels, error) {
+	sectorModels, err := s.modelRepo.GetSectorModels()
+	if err != nil {
+		return nil, err
+	}
+
+	stockModels, err := s.modelRepo.GetStockModels()
+	if err != nil {
+		return nil, err
+	}
+
+	betas, err := s.modelRepo.GetStockBetas()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PriceModels{
+		Default: s.simulator.DefaultParams(),
+		Sectors: sectorModels,
+		Stocks:  stockModels,
+		Factors: s.simulator.FactorConfig(),
+		Betas:   betas,
+	}, nil
+}
+
+// SetStockPriceModel gives a stock its own price model, or with nil goes back to its sector's.
+// The change takes effect on the simulator's next tick.
+func (s *MarketService) SetStockPriceModel(stockID int, params *market.ModelParams) error {
+	if params != nil {
+		if err := params.Validate(); err != nil {
+			return err
+		}
+	}
+
+	// Make sure the stock exists
+	if _, err := s.stockRepo.GetStockByID(stockID); err != nil {
+		return err
+	}
+
+	if err := s.modelRepo.SetStockModel(stockID, params); err != nil {
+		return err
+	}
+
+	// A stock the simulator isn't running picks the stored model up when it is added
+	s.simulator.SetStockParams(stockID, params)
+
+	return nil
+}
+
+// SetSectorPriceModel sets the price model for stocks in a sector that don't have their own,
+// or with nil goes back to the default. The change takes effect on the simulator's next tick.
+func (s *MarketService) SetSectorPriceModel(sector string, params *market.ModelParams) error {
+	if params != nil {
+		if err := params.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := s.modelRepo.SetSectorModel(sector, params); err != nil {
+		return err
+	}
+
+	return s.simulator.SetSectorParams(sector, params)
+}
+
+// SetStockBetas sets how strongly a stock follows the market and its sector.
+// The change takes effect on the simulator's next tick.
+func (s *MarketService) SetStockBetas(stockID int, betas market.Betas) error {
+	if err := betas.Validate(); err != nil {
+		return err
+	}
+
+	// Make sure the stock exists
+	if _, err := s.stockRepo.GetStockByID(stockID); err != nil {
+		return err
+	}
+
+	if err := s.modelRepo.SetStockBetas(stockID, betas); err != nil {
+		return err
+	}
+
+	// A stock the simulator isn't running picks the stored betas up when it is added
+	s.simulator.SetBetas(stockID, betas)
+
+	return nil
+}
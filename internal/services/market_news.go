@@ -0,0 +1,15 @@
+package services
+
+import (
+	"officestonks/pkg/market"
+)
+
+// ApplyMarketEvent moves the prices of the stocks a piece of news targets and returns how many it moved
+func (s *MarketService) ApplyMarketEvent(event market.Event) (int, error) {
+	return s.simulator.ApplyEvent(event)
+}
+
+// RandomMarketEvent makes up a piece of news with the given chance, from the simulator's random numbers
+func (s *MarketService) RandomMarketEvent(chance float64) (market.Event, bool) {
+	return s.simulator.RandomEvent(chance)
+}
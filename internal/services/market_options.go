@@ -0,0 +1,598 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// OptionsConfig controls which option contracts are listed and how they are priced
+type OptionsConfig struct {
+	CheckInterval  time.Duration // How often new contracts are listed and expired ones settled
+	ExpiryInterval time.Duration // Time between expiries; contracts expire on whole multiples of it
+	Expiries       int           // How many upcoming expiries are listed at a time
+	Strikes        int           // Strikes listed either side of the money
+	StrikeStep     float64       // Rough gap between strikes, as a fraction of the stock's price
+	ContractSize   int           // Shares each new contract delivers
+	RiskFreeRate   float64       // Annual interest rate options are priced with
+}
+
+// DefaultOptionsConfig returns the option settings used unless overridden. Contracts are
+// smaller than the usual 100 shares so players can afford them on a starting balance.
+func DefaultOptionsConfig() OptionsConfig {
+	return OptionsConfig{
+		CheckInterval:  time.Minute,
+		ExpiryInterval: 24 * time.Hour,
+		Expiries:       3,
+		Strikes:        2,
+		StrikeStep:     0.05,
+		ContractSize:   10,
+		RiskFreeRate:   0.05,
+	}
+}
+
+// Validate checks that the settings list at least one contract and price it sensibly
+func (c OptionsConfig) Validate() error {
+	if c.CheckInterval <= 0 || c.ExpiryInterval <= 0 {
+		return errors.New("check and expiry intervals must be positive")
+	}
+	if c.Expiries < 1 || c.Strikes < 0 || c.StrikeStep <= 0 || c.ContractSize < 1 {
+		return errors.New("at least one expiry, a positive strike step and contract size are needed")
+	}
+	if c.RiskFreeRate < 0 || c.RiskFreeRate > 1 {
+		return errors.New("risk-free rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// SetOptionsConfig replaces the option settings
+func (s *MarketService) SetOptionsConfig(cfg OptionsConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.optionsConfig = cfg
+	return nil
+}
+
+// strikeIncrement rounds a gap between strikes to 1, 2 or 5 times a power of ten
+func strikeIncrement(gap float64) float64 {
+	if gap <= 0.01 {
+		return 0.01
+	}
+
+	magnitude := math.Pow(10, math.Floor(math.Log10(gap)))
+	for _, m := range []float64{1, 2, 5} {
+		if gap <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// strikesFor returns the strikes listed for a stock at a price: the one nearest the money
+// and count more either side, leaving out any that aren't positive
+func strikesFor(price money.Money, step float64, count int) []money.Money {
+	increment := money.FromFloat(strikeIncrement(price.Float() * step))
+	atTheMoney := (price + increment/2) / increment * increment
+
+	var strikes []money.Money
+	for i := -count; i <= count; i++ {
+		strike := atTheMoney + money.Money(i)*increment
+		if strike > 0 {
+			strikes = append(strikes, strike)
+		}
+	}
+	return strikes
+}
+
+// runOptionJobs lists new option contracts and settles expired ones on a schedule
+func (s *MarketService) runOptionJobs() {
+	ticker := time.NewTicker(s.optionsConfig.CheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.ProcessOptions()
+	}
+}
+
+// ProcessOptions settles every contract that has expired, then lists contracts for the
+// upcoming expiries around every stock's current price
+func (s *MarketService) ProcessOptions() {
+	now := time.Now()
+	s.settleExpiredOptions(now)
+	s.listOptions(now)
+}
+
+// listOptions lists calls and puts on every listed stock for each upcoming expiry, at strikes
+// around its current price. Contracts that are already listed are left alone, so strikes are
+// added as prices move but never taken away.
+func (s *MarketService) listOptions(now time.Time) {
+	cfg := s.optionsConfig
+
+	stocks, err := s.stockRepo.GetAllStocks()
+	if err != nil {
+		log.Printf("listOptions: Error loading stocks: %v", err)
+		return
+	}
+
+	base := now.Truncate(cfg.ExpiryInterval)
+	for _, stock := range stocks {
+		// Only stocks the simulator prices have a volatility to price options with
+		if stock.Type != models.InstrumentStock {
+			continue
+		}
+
+		var contracts []*models.OptionContract
+		for i := 1; i <= cfg.Expiries; i++ {
+			expiry := base.Add(time.Duration(i) * cfg.ExpiryInterval)
+			for _, strike := range strikesFor(stock.CurrentPrice, cfg.StrikeStep, cfg.Strikes) {
+				for _, optionType := range []models.OptionType{models.CallOption, models.PutOption} {
+					contracts = append(contracts, &models.OptionContract{
+						StockID:   stock.ID,
+						Type:      optionType,
+						Strike:    strike,
+						Shares:    cfg.ContractSize,
+						ExpiresAt: expiry,
+					})
+				}
+			}
+		}
+
+		if _, err := s.optionRepo.CreateContracts(contracts); err != nil {
+			log.Printf("listOptions: Error listing options on %s: %v", stock.Symbol, err)
+		}
+	}
+}
+
+// priceContract fills in a contract's premium and Greeks at the underlying's price. Expired
+// contracts, and those whose stock the simulator isn't pricing, are worth their intrinsic value.
+func (s *MarketService) priceContract(contract *models.OptionContract, price money.Money, volatility float64, now time.Time) {
+	years := 0.0
+	if contract.Status == models.OptionActive {
+		years = market.YearsUntil(now, contract.ExpiresAt)
+	}
+
+	quote := market.BlackScholes(contract.IsCall(), price.Float(), contract.Strike.Float(), years, s.optionsConfig.RiskFreeRate, volatility)
+	contract.UnderlyingPrice = price
+	contract.Premium = money.FromFloat(quote.Price)
+	contract.Greeks = &models.Greeks{
+		Delta: math.Round(quote.Delta*10000) / 10000,
+		Gamma: math.Round(quote.Gamma*10000) / 10000,
+		Theta: math.Round(quote.Theta*10000) / 10000,
+		Vega:  math.Round(quote.Vega*10000) / 10000,
+		Rho:   math.Round(quote.Rho*10000) / 10000,
+	}
+}
+
+// stockVolatility returns the volatility to price a stock's options with, or 0 if the simulator isn't pricing it
+func (s *MarketService) stockVolatility(stockID int) float64 {
+	volatility, err := s.simulator.Volatility(stockID)
+	if err != nil {
+		return 0
+	}
+	return volatility
+}
+
+// GetOptionChain returns every active contract on a stock with its premium and Greeks
+func (s *MarketService) GetOptionChain(stockID int) (*models.OptionChain, error) {
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return nil, err
+	}
+
+	contracts, err := s.optionRepo.GetActiveContracts(stockID)
+	if err != nil {
+		return nil, err
+	}
+	if contracts == nil {
+		contracts = []*models.OptionContract{}
+	}
+
+	chain := &models.OptionChain{
+		StockID:         stock.ID,
+		Symbol:          stock.Symbol,
+		UnderlyingPrice: stock.CurrentPrice,
+		Volatility:      math.Round(s.stockVolatility(stockID)*10000) / 10000,
+		RiskFreeRate:    s.optionsConfig.RiskFreeRate,
+		Contracts:       contracts,
+	}
+
+	now := time.Now()
+	for _, contract := range contracts {
+		s.priceContract(contract, chain.UnderlyingPrice, chain.Volatility, now)
+	}
+	return chain, nil
+}
+
+// tradableContract loads an option contract and its stock, checks that both can be traded
+// and prices the contract
+func (s *MarketService) tradableContract(contractID int) (*models.OptionContract, error) {
+	contract, err := s.optionRepo.GetContractByID(contractID)
+	if err != nil {
+		return nil, err
+	}
+	if contract.Status != models.OptionActive || !contract.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("option contract has expired")
+	}
+
+	stock, err := s.stockRepo.GetStockByID(contract.StockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return nil, err
+	}
+
+	s.priceContract(contract, stock.CurrentPrice, s.stockVolatility(stock.ID), time.Now())
+	if contract.Premium < money.Cent {
+		return nil, errors.New("option contract is worthless and can't be traded")
+	}
+	return contract, nil
+}
+
+// lockActiveContractTx locks a contract so it can't be settled while it is traded, and checks it is still active
+func (s *MarketService) lockActiveContractTx(tx *sql.Tx, contractID int) error {
+	locked, err := s.optionRepo.GetContractForUpdate(tx, contractID)
+	if err != nil {
+		return err
+	}
+	if locked.Status != models.OptionActive {
+		return errors.New("option contract has expired")
+	}
+	return nil
+}
+
+// BuyOption buys option contracts to open a position, paying the premium and commission in cash.
+// Options can't be bought on margin.
+func (s *MarketService) BuyOption(userID, contractID, quantity int) error {
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	contract, err := s.tradableContract(contractID)
+	if err != nil {
+		return err
+	}
+	pricePerContract := contract.Premium.Mul(float64(contract.Shares))
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the contract before the user, as settlement does
+		if err := s.lockActiveContractTx(tx, contractID); err != nil {
+			return err
+		}
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		fee, err := s.tradeFee(tx, userID, float64(quantity), pricePerContract)
+		if err != nil {
+			return err
+		}
+		totalCost := pricePerContract.Mul(float64(quantity)) + fee
+
+		// Cash held back by open buy orders can't be spent
+		reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.CashBalance-reservedCash < totalCost {
+			return errors.New("insufficient funds")
+		}
+
+		if err := s.optionRepo.AddOptionPositionTx(tx, userID, contractID, quantity, totalCost.MulRate(1/float64(quantity))); err != nil {
+			return err
+		}
+
+		transaction, err := s.recordTrade(tx, userID, contract.StockID, float64(quantity), pricePerContract, models.OptionBuy, fee, nil)
+		if err != nil {
+			return err
+		}
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.CashAccount, models.MarketAccount, pricePerContract.Mul(float64(quantity))),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+		)
+		if err != nil {
+			return err
+		}
+		return s.transactionRepo.SetOptionTx(tx, transaction.ID, contractID)
+	})
+}
+
+// SellOption sells option contracts the user holds to close the position
+func (s *MarketService) SellOption(userID, contractID, quantity int) error {
+	if quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	contract, err := s.tradableContract(contractID)
+	if err != nil {
+		return err
+	}
+	pricePerContract := contract.Premium.Mul(float64(contract.Shares))
+
+	return s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.lockActiveContractTx(tx, contractID); err != nil {
+			return err
+		}
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		position, err := s.optionRepo.GetOptionPositionForUpdate(tx, userID, contractID)
+		if err != nil {
+			return err
+		}
+		if position == nil || position.Quantity < quantity {
+			return errors.New("insufficient contracts")
+		}
+
+		fee, err := s.tradeFee(tx, userID, float64(quantity), pricePerContract)
+		if err != nil {
+			return err
+		}
+		totalProceeds := pricePerContract.Mul(float64(quantity)) - fee
+
+		if err := s.optionRepo.UpdateOptionQuantityTx(tx, position.ID, position.Quantity-quantity); err != nil {
+			return err
+		}
+
+		transaction, err := s.recordTrade(tx, userID, contract.StockID, float64(quantity), pricePerContract, models.OptionSell, fee, nil)
+		if err != nil {
+			return err
+		}
+
+		// Pay down any margin loan first, as a sale of shares would
+		var repaid money.Money
+		if user.LoanBalance > 0 && totalProceeds > 0 {
+			repaid = money.Min(user.LoanBalance, totalProceeds)
+		}
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.MarketAccount, models.CashAccount, pricePerContract.Mul(float64(quantity))),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+			models.Transfer(models.CashAccount, models.LoanAccount, repaid),
+		)
+		if err != nil {
+			return err
+		}
+		if err := s.transactionRepo.SetOptionTx(tx, transaction.ID, contractID); err != nil {
+			return err
+		}
+		return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, totalProceeds-position.AverageCost.Mul(float64(quantity)))
+	})
+}
+
+// settleExpiredOptions settles every contract that has reached expiry at its stock's current price
+func (s *MarketService) settleExpiredOptions(now time.Time) {
+	contracts, err := s.optionRepo.GetExpiredContracts(now)
+	if err != nil {
+		log.Printf("settleExpiredOptions: Error loading expired contracts: %v", err)
+		return
+	}
+
+	for _, contract := range contracts {
+		stock, err := s.stockRepo.GetStockByID(contract.StockID)
+		if err != nil {
+			log.Printf("settleExpiredOptions: Error loading %s: %v", contract.Symbol, err)
+			continue
+		}
+
+		// Shares of a delisted stock can't change hands, so its options are settled in cash
+		deliver := stock.Status == models.StockListed
+		if err := s.settleContract(contract, stock.CurrentPrice, deliver); err != nil {
+			log.Printf("settleExpiredOptions: Error settling %s option %d: %v", contract.Symbol, contract.ID, err)
+		}
+	}
+}
+
+// settleStockOptions settles every active contract on a stock straight away at price, in cash.
+// It is used when the stock is delisted.
+func (s *MarketService) settleStockOptions(stockID int, price money.Money) {
+	contracts, err := s.optionRepo.GetActiveContracts(stockID)
+	if err != nil {
+		log.Printf("settleStockOptions: Error loading contracts: %v", err)
+		return
+	}
+
+	for _, contract := range contracts {
+		if err := s.settleContract(contract, price, false); err != nil {
+			log.Printf("settleStockOptions: Error settling %s option %d: %v", contract.Symbol, contract.ID, err)
+		}
+	}
+}
+
+// settleContract expires a contract at the underlying's price and settles every position in it,
+// as one database transaction
+func (s *MarketService) settleContract(contract *models.OptionContract, price money.Money, deliver bool) error {
+	var settled []*models.Transaction
+
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if err := s.lockActiveContractTx(tx, contract.ID); err != nil {
+			return err
+		}
+		if err := s.optionRepo.SettleContractTx(tx, contract.ID, price); err != nil {
+			return err
+		}
+
+		positions, err := s.optionRepo.GetContractPositionsForUpdate(tx, contract.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, position := range positions {
+			transactions, err := s.settleOptionPositionTx(tx, contract, position, price, deliver)
+			if err != nil {
+				return err
+			}
+			settled = append(settled, transactions...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range settled {
+		s.notifyUser(transaction.UserID, "option_settled", transaction)
+	}
+	return nil
+}
+
+// settleOptionPositionTx settles a position at expiry and closes it. Out-of-the-money contracts
+// expire worthless. In-the-money calls are exercised, buying the shares at the strike, if the
+// user has the cash; in-the-money puts are exercised, selling the shares at the strike, for as
+// many contracts as the user has the shares for. Anything left, and everything when deliver is
+// false, is settled in cash at the contract's intrinsic value.
+func (s *MarketService) settleOptionPositionTx(tx *sql.Tx, contract *models.OptionContract, position *models.OptionPosition, price money.Money, deliver bool) ([]*models.Transaction, error) {
+	user, err := s.userRepo.GetUserForUpdate(tx, position.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []*models.Transaction
+	record := func(transType models.TransactionType, quantity float64, price, pnl money.Money, realized bool, entries ...*models.LedgerEntry) error {
+		transaction, err := s.transactionRepo.CreateTransactionTx(tx, user.ID, contract.StockID, quantity, price, transType, 0, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.postTx(tx, user, transaction, entries...); err != nil {
+			return err
+		}
+		if err := s.transactionRepo.SetOptionTx(tx, transaction.ID, contract.ID); err != nil {
+			return err
+		}
+		if realized {
+			if err := s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, pnl); err != nil {
+				return err
+			}
+		}
+		transactions = append(transactions, transaction)
+		return nil
+	}
+
+	intrinsic := contract.IntrinsicValue(price)
+	remaining := position.Quantity
+
+	if intrinsic > 0 && deliver && contract.IsCall() {
+		// Exercise every contract if the user can pay for the shares; the premium becomes part of their cost
+		shares := float64(remaining * contract.Shares)
+		strike := contract.Strike
+		exerciseCost := strike.Mul(shares)
+		reservedCash, err := s.orderRepo.GetReservedCashTx(tx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if user.CashBalance-reservedCash >= exerciseCost {
+			if err := s.portfolioRepo.AddStockToPortfolioTx(tx, user.ID, contract.StockID, shares); err != nil {
+				return nil, err
+			}
+			if err := record(models.CallExercise, shares, strike, 0, false, models.Transfer(models.CashAccount, models.MarketAccount, exerciseCost)); err != nil {
+				return nil, err
+			}
+			premium := position.AverageCost.Mul(float64(remaining))
+			if err := s.addLotTx(tx, user.ID, contract.StockID, shares, strike, premium, transactions[len(transactions)-1].ID); err != nil {
+				return nil, err
+			}
+			remaining = 0
+		}
+	} else if intrinsic > 0 && deliver {
+		// Exercise as many puts as the user has unreserved shares for
+		holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, user.ID, contract.StockID)
+		if err != nil {
+			return nil, err
+		}
+		reservedShares, err := s.orderRepo.GetReservedSharesTx(tx, user.ID, contract.StockID)
+		if err != nil {
+			return nil, err
+		}
+
+		exercised := 0
+		if holding != nil {
+			exercised = int(math.Min(float64(remaining), math.Floor((holding.Quantity-reservedShares)/float64(contract.Shares)+1e-9)))
+		}
+		if exercised > 0 {
+			shares := float64(exercised * contract.Shares)
+			strike := contract.Strike
+			proceeds := strike.Mul(shares)
+			if err := s.portfolioRepo.UpdateStockQuantityTx(tx, holding.ID, models.RoundShares(holding.Quantity-shares)); err != nil {
+				return nil, err
+			}
+			costBasis, err := s.consumeLotsTx(tx, user, contract.StockID, shares, strike)
+			if err != nil {
+				return nil, err
+			}
+			premium := position.AverageCost.Mul(float64(exercised))
+
+			// The proceeds pay down any margin loan first, as a sale's would
+			repaid := money.Min(user.LoanBalance, proceeds)
+			err = record(models.PutExercise, shares, strike, proceeds-costBasis-premium, true,
+				models.Transfer(models.MarketAccount, models.CashAccount, proceeds),
+				models.Transfer(models.CashAccount, models.LoanAccount, repaid),
+			)
+			if err != nil {
+				return nil, err
+			}
+			remaining -= exercised
+		}
+	}
+
+	if remaining > 0 {
+		// Settle the rest in cash; worthless contracts just expire
+		perContract := intrinsic.Mul(float64(contract.Shares))
+		payout := perContract.Mul(float64(remaining))
+		repaid := money.Min(user.LoanBalance, payout)
+		err := record(models.OptionSettle, float64(remaining), perContract, payout-position.AverageCost.Mul(float64(remaining)), true,
+			models.Transfer(models.MarketAccount, models.CashAccount, payout),
+			models.Transfer(models.CashAccount, models.LoanAccount, repaid),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.optionRepo.UpdateOptionQuantityTx(tx, position.ID, 0); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// fillOptionPositions prices a user's option positions and adds their value to the portfolio summary
+func (s *MarketService) fillOptionPositions(summary *models.PortfolioSummary, userID int) error {
+	positions, err := s.optionRepo.GetUserOptionPositions(userID)
+	if err != nil {
+		return err
+	}
+	if positions == nil {
+		positions = []*models.OptionPosition{}
+	}
+
+	now := time.Now()
+	prices := make(map[int]money.Money)
+	volatilities := make(map[int]float64)
+	for _, position := range positions {
+		stockID := position.Contract.StockID
+		if _, ok := prices[stockID]; !ok {
+			stock, err := s.stockRepo.GetStockByID(stockID)
+			if err != nil {
+				return err
+			}
+			prices[stockID] = stock.CurrentPrice
+			volatilities[stockID] = s.stockVolatility(stockID)
+		}
+
+		s.priceContract(&position.Contract, prices[stockID], volatilities[stockID], now)
+		position.MarketValue = position.Contract.Premium.Mul(float64(position.Contract.Shares * position.Quantity))
+		summary.OptionValue += position.MarketValue
+	}
+
+	summary.OptionPositions = positions
+	summary.TotalValue += summary.OptionValue
+	return nil
+}
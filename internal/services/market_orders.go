@@ -0,0 +1,299 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// errNotTradable marks an order that can't execute right now because the market is closed
+// or the stock is halted or delisted. The order stays open rather than being cancelled.
+var errNotTradable = errors.New("stock is not tradable")
+
+// PlaceLimitOrder rests a buy or sell order until the market reaches the limit price.
+// The order's cash (for buys) or shares (for sells) are reserved until it fills or is cancelled.
+func (s *MarketService) PlaceLimitOrder(userID, stockID int, quantity float64, limitPrice money.Money, side models.TransactionType) (*models.Order, error) {
+	// Input validation
+	if err := s.checkQuantity(quantity); err != nil {
+		return nil, err
+	}
+	if limitPrice <= 0 {
+		return nil, errors.New("limit price must be greater than zero")
+	}
+	if side != models.Buy && side != models.Sell {
+		return nil, errors.New("side must be 'buy' or 'sell'")
+	}
+
+	// Make sure the stock exists and is traded
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkListed(stock); err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		UserID:     userID,
+		StockID:    stockID,
+		Side:       side,
+		OrderType:  models.LimitOrder,
+		Quantity:   quantity,
+		LimitPrice: limitPrice,
+	}
+
+	// Check and reserve in one transaction so concurrent orders and trades can't
+	// commit the same cash or shares twice
+	var created *models.Order
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Make sure the order can be covered on top of what is already reserved
+		if side == models.Buy {
+			reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+			if err != nil {
+				return err
+			}
+			// The commission is reserved with the order, so the fill can always pay it
+			fee, err := s.tradeFee(tx, userID, quantity, limitPrice)
+			if err != nil {
+				return err
+			}
+			if user.CashBalance-reservedCash < limitPrice.Mul(quantity)+fee {
+				return errors.New("insufficient funds")
+			}
+			order.ReservedFee = fee
+		} else {
+			holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stockID)
+			if err != nil {
+				return err
+			}
+			reservedShares, err := s.orderRepo.GetReservedSharesTx(tx, userID, stockID)
+			if err != nil {
+				return err
+			}
+			if holding == nil || models.RoundShares(holding.Quantity-reservedShares) < quantity {
+				return errors.New("insufficient shares")
+			}
+		}
+
+		created, err = s.orderRepo.CreateOrderTx(tx, order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	created.Stock = *stock
+	return created, nil
+}
+
+// PlaceConditionalOrder creates a stop-loss, take-profit or trailing-stop order that
+// sells the position at market once the price crosses its trigger.
+// Trailing stops take either a dollar trailAmount or a trailPercent, not both.
+// Conditional orders don't reserve their shares, so a stop and a target can protect the
+// same position; a triggered order sells whatever is still available at the time.
+func (s *MarketService) PlaceConditionalOrder(userID, stockID int, quantity float64, orderType models.OrderType, stopPrice, trailAmount money.Money, trailPercent float64) (*models.Order, error) {
+	// Input validation
+	if err := s.checkQuantity(quantity); err != nil {
+		return nil, err
+	}
+	if !orderType.IsConditional() {
+		return nil, errors.New("order type must be 'stop_loss', 'take_profit' or 'trailing_stop'")
+	}
+
+	order := &models.Order{
+		UserID:    userID,
+		StockID:   stockID,
+		Side:      models.Sell,
+		OrderType: orderType,
+		Quantity:  quantity,
+	}
+
+	if orderType == models.TrailingStopOrder {
+		if (trailAmount > 0) == (trailPercent > 0) {
+			return nil, errors.New("trailing stops need either a trail amount or a trail percent")
+		}
+		if trailPercent >= 100 {
+			return nil, errors.New("trail percent must be less than 100")
+		}
+		if trailAmount < 0 || trailPercent < 0 {
+			return nil, errors.New("trail must be greater than zero")
+		}
+		order.TrailAmount = trailAmount
+		order.TrailPercent = trailPercent
+	} else {
+		if stopPrice <= 0 {
+			return nil, errors.New("stop price must be greater than zero")
+		}
+		order.StopPrice = stopPrice
+	}
+
+	// Get the stock
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkListed(stock); err != nil {
+		return nil, err
+	}
+
+	// A trailing stop starts trailing the current price
+	if orderType == models.TrailingStopOrder {
+		order.HighWaterMark = stock.CurrentPrice
+		order.StopPrice = order.TrailingStopPrice()
+	}
+
+	// Check the holding under the same locks as a trade so a concurrent sell can't slip in between
+	var created *models.Order
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		if _, err := s.userRepo.GetUserForUpdate(tx, userID); err != nil {
+			return err
+		}
+
+		// The order protects an existing position, so the user must hold the shares
+		// on top of any already set aside for open limit sells
+		holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stockID)
+		if err != nil {
+			return err
+		}
+		reservedShares, err := s.orderRepo.GetReservedSharesTx(tx, userID, stockID)
+		if err != nil {
+			return err
+		}
+		if holding == nil || models.RoundShares(holding.Quantity-reservedShares) < quantity {
+			return errors.New("insufficient shares")
+		}
+
+		created, err = s.orderRepo.CreateOrderTx(tx, order)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	created.Stock = *stock
+	return created, nil
+}
+
+// GetUserOrders returns a user's orders, optionally filtered by status
+func (s *MarketService) GetUserOrders(userID int, status models.OrderStatus) ([]*models.Order, error) {
+	return s.orderRepo.GetUserOrders(userID, status)
+}
+
+// CancelOrder cancels one of the user's open orders, releasing its reservation
+func (s *MarketService) CancelOrder(userID, orderID int) error {
+	return s.orderRepo.CancelOrder(orderID, userID)
+}
+
+// matchOrders fills every open order for the updated stock whose limit or trigger the new price has crossed
+func (s *MarketService) matchOrders(update market.StockUpdate) {
+	orders, err := s.orderRepo.GetOpenOrdersForStock(update.StockID)
+	if err != nil {
+		log.Printf("matchOrders: Error loading open orders for stock %d: %v", update.StockID, err)
+		return
+	}
+
+	for _, order := range orders {
+		if order.OrderType.IsConditional() {
+			s.checkConditionalOrder(order, update.Price)
+			continue
+		}
+
+		if !order.LimitCrossed(update.Price) {
+			continue
+		}
+
+		if err := s.fillOrder(order, update.Price); err != nil {
+			if errors.Is(err, errNotTradable) {
+				continue
+			}
+			s.cancelFailedOrder(order, err)
+			continue
+		}
+
+		s.notifyOrder(order, "order_filled")
+	}
+}
+
+// checkConditionalOrder moves a trailing stop up behind the price and triggers the
+// order once the price crosses its stop (stop-loss, trailing stop) or target (take-profit)
+func (s *MarketService) checkConditionalOrder(order *models.Order, price money.Money) {
+	if order.RaiseTrail(price) {
+		if err := s.orderRepo.UpdateTrailingStop(order.ID, order.HighWaterMark, order.StopPrice); err != nil {
+			log.Printf("checkConditionalOrder: Error updating trailing stop %d: %v", order.ID, err)
+		}
+		return
+	}
+
+	if !order.Triggered(price) {
+		return
+	}
+
+	if err := s.triggerConditionalOrder(order, price); err != nil {
+		if errors.Is(err, errNotTradable) {
+			return
+		}
+		s.cancelFailedOrder(order, err)
+		return
+	}
+
+	s.notifyOrder(order, "order_triggered")
+}
+
+// triggerConditionalOrder converts a triggered order into a market sell
+func (s *MarketService) triggerConditionalOrder(order *models.Order, price money.Money) error {
+	stock, err := s.stockRepo.GetStockByID(order.StockID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return fmt.Errorf("%w: %v", errNotTradable, err)
+	}
+
+	return s.executeSell(order.UserID, stock, order.Quantity, price, order)
+}
+
+// fillOrder executes an open limit order at the given price
+func (s *MarketService) fillOrder(order *models.Order, price money.Money) error {
+	stock, err := s.stockRepo.GetStockByID(order.StockID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return fmt.Errorf("%w: %v", errNotTradable, err)
+	}
+
+	if order.Side == models.Buy {
+		return s.executeBuy(order.UserID, stock, order.Quantity, price, order)
+	}
+	return s.executeSell(order.UserID, stock, order.Quantity, price, order)
+}
+
+// cancelFailedOrder cancels an order that could not be executed and tells its owner
+func (s *MarketService) cancelFailedOrder(order *models.Order, cause error) {
+	log.Printf("Could not execute order %d, cancelling it: %v", order.ID, cause)
+	if err := s.orderRepo.CancelOrder(order.ID, order.UserID); err != nil {
+		log.Printf("Error cancelling order %d: %v", order.ID, err)
+		return
+	}
+	s.notifyOrder(order, "order_cancelled")
+}
+
+// notifyOrder pushes the latest state of an executed order to its owner
+func (s *MarketService) notifyOrder(order *models.Order, messageType string) {
+	updated, err := s.orderRepo.GetOrderByID(order.ID)
+	if err != nil {
+		log.Printf("notifyOrder: Error reloading order %d: %v", order.ID, err)
+		updated = order
+	}
+	s.notifyUser(order.UserID, messageType, updated)
+}
@@ -1,40 +1,130 @@
 package services
 
 import (
+	"database/sql"
 	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"officestonks/internal/models"
+	"officestonks/internal/websocket"
 	"officestonks/pkg/market"
+	"officestonks/pkg/money"
 )
 
 // MarketService handles stock market operations
 type MarketService struct {
-	stockRepo      models.StockRepository
-	userRepo       models.UserRepository
-	portfolioRepo  models.PortfolioRepository
-	transactionRepo models.TransactionRepository
-	simulator      *market.MarketSimulator
+	stockRepo          models.StockRepository
+	userRepo           models.UserRepository
+	portfolioRepo      models.PortfolioRepository
+	transactionRepo    models.TransactionRepository
+	orderRepo          models.OrderRepository
+	lotRepo            models.TaxLotRepository
+	shortRepo          models.ShortPositionRepository
+	feeRepo            models.FeeScheduleRepository
+	modelRepo          models.PriceModelRepository
+	stateRepo          models.SimulatorStateRepository
+	actionRepo         models.CorporateActionRepository
+	historyRepo        models.PriceHistoryRepository
+	ipoRepo            models.IPORepository
+	fundamentalsRepo   models.FundamentalsRepository
+	indexRepo          models.IndexRepository
+	etfRepo            models.ETFRepository
+	optionRepo         models.OptionRepository
+	ledgerRepo         models.LedgerRepository
+	txRunner           models.TxRunner
+	simulator          *market.MarketSimulator
+	wsHub              *websocket.Hub
+	shortConfig        ShortConfig
+	marginConfig       MarginConfig
+	snapshotInterval   time.Duration
+	calendar           *market.Calendar // When the market is open; nil means always
+	actionConfig       CorporateActionConfig
+	ipoConfig          IPOConfig
+	fundamentalsConfig FundamentalsConfig
+	baskets            *basketBook // Listed ETFs, repriced as their constituents move
+	optionsConfig      OptionsConfig
+	fractionalConfig   FractionalConfig
+
+	// Subscribers receive every price update after it has been persisted
+	subscribers   []chan market.StockUpdate
+	subscribersMu sync.Mutex
+}
+
+// MarketDeps is the data access a MarketService is built on
+type MarketDeps struct {
+	StockRepo        models.StockRepository
+	UserRepo         models.UserRepository
+	PortfolioRepo    models.PortfolioRepository
+	TransactionRepo  models.TransactionRepository
+	OrderRepo        models.OrderRepository
+	LotRepo          models.TaxLotRepository
+	ShortRepo        models.ShortPositionRepository
+	FeeRepo          models.FeeScheduleRepository
+	ModelRepo        models.PriceModelRepository
+	StateRepo        models.SimulatorStateRepository
+	ActionRepo       models.CorporateActionRepository
+	HistoryRepo      models.PriceHistoryRepository
+	IPORepo          models.IPORepository
+	FundamentalsRepo models.FundamentalsRepository
+	IndexRepo        models.IndexRepository
+	ETFRepo          models.ETFRepository
+	OptionRepo       models.OptionRepository
+	LedgerRepo       models.LedgerRepository
+	TxRunner         models.TxRunner
 }
 
 // NewMarketService creates a new market service
-func NewMarketService(
-	stockRepo models.StockRepository,
-	userRepo models.UserRepository,
-	portfolioRepo models.PortfolioRepository,
-	transactionRepo models.TransactionRepository,
-) *MarketService {
+func NewMarketService(deps MarketDeps) *MarketService {
 	// Create a market simulator with faster updates and higher volatility for more dynamic price movements
 	// 2-second updates and 5% volatility
 	simulator := market.NewMarketSimulator(2*time.Second, 0.05)
-	
+
 	// Return the service
 	return &MarketService{
-		stockRepo:      stockRepo,
-		userRepo:       userRepo,
-		portfolioRepo:  portfolioRepo,
-		transactionRepo: transactionRepo,
-		simulator:      simulator,
+		stockRepo:          deps.StockRepo,
+		userRepo:           deps.UserRepo,
+		portfolioRepo:      deps.PortfolioRepo,
+		transactionRepo:    deps.TransactionRepo,
+		orderRepo:          deps.OrderRepo,
+		lotRepo:            deps.LotRepo,
+		shortRepo:          deps.ShortRepo,
+		feeRepo:            deps.FeeRepo,
+		modelRepo:          deps.ModelRepo,
+		stateRepo:          deps.StateRepo,
+		actionRepo:         deps.ActionRepo,
+		historyRepo:        deps.HistoryRepo,
+		ipoRepo:            deps.IPORepo,
+		fundamentalsRepo:   deps.FundamentalsRepo,
+		indexRepo:          deps.IndexRepo,
+		etfRepo:            deps.ETFRepo,
+		optionRepo:         deps.OptionRepo,
+		ledgerRepo:         deps.LedgerRepo,
+		txRunner:           deps.TxRunner,
+		simulator:          simulator,
+		shortConfig:        DefaultShortConfig(),
+		marginConfig:       DefaultMarginConfig(),
+		snapshotInterval:   time.Minute,
+		actionConfig:       DefaultCorporateActionConfig(),
+		ipoConfig:          DefaultIPOConfig(),
+		fundamentalsConfig: DefaultFundamentalsConfig(),
+		baskets:            newBasketBook(),
+		optionsConfig:      DefaultOptionsConfig(),
+		fractionalConfig:   DefaultFractionalConfig(),
+	}
+}
+
+// SetHub sets the websocket hub used to notify users about their orders.
+// The hub is created after the service because it consumes the service's price updates.
+func (s *MarketService) SetHub(wsHub *websocket.Hub) {
+	s.wsHub = wsHub
+}
+
+// notifyUser pushes a message to one user's websocket connections, if a hub is set
+func (s *MarketService) notifyUser(userID int, messageType string, data interface{}) {
+	if s.wsHub != nil {
+		s.wsHub.SendToUser(userID, messageType, data)
 	}
 }
 
@@ -45,43 +135,177 @@ func (s *MarketService) InitializeSimulator() error {
 	if err != nil {
 		return err
 	}
-	
-	// Add stocks to the simulator
-	for id, stock := range stocks {
+
+	// Add stocks to the simulator in ID order, so a seeded simulator gives them the same starting trends
+	ids := make([]int, 0, len(stocks))
+	for id := range stocks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		stock := stocks[id]
 		s.simulator.AddStock(id, stock.Symbol, stock.Sector, stock.Price)
 	}
-	
+
+	// Carry on with the trends and random numbers from before the last restart
+	if err := s.restoreSnapshot(); err != nil {
+		return err
+	}
+
+	// Give stocks and sectors the price models admins have chosen for them
+	if err := s.loadPriceModels(); err != nil {
+		return err
+	}
+
+	// Carry the indices on from where they were before the last restart
+	if err := s.restoreIndexLevels(); err != nil {
+		return err
+	}
+
+	// ETFs follow the stocks in their baskets
+	if err := s.loadETFs(); err != nil {
+		return err
+	}
+
 	// Start the simulator
 	s.simulator.Start()
-	
+
 	// Start a goroutine to update stock prices in the database
 	go s.updateStockPrices()
-	
+
+	// Charge borrow fees on open short positions
+	go s.runShortJobs()
+
+	// Charge interest on margin loans
+	go s.runMarginJobs()
+
+	// Save the simulator's state regularly in case the server stops without warning
+	go s.runSnapshotJobs()
+
+	// Tell clients when stocks halt and resume
+	go s.runHaltJobs()
+
+	// Pay dividends and apply splits as they fall due
+	go s.runCorporateActionJobs()
+
+	// Allocate IPOs and list their stocks as subscriptions close
+	go s.runIPOJobs()
+
+	// Publish earnings reports as they fall due
+	go s.runEarningsJobs()
+
+	// Record index levels and tell clients about them
+	go s.runIndexJobs()
+
+	// List option contracts and settle them at expiry
+	go s.runOptionJobs()
+
+	// Tell clients when the market opens and closes
+	if s.calendar != nil {
+		go s.runCalendarJobs()
+	}
+
 	return nil
 }
 
 // updateStockPrices handles updates from the simulator
 func (s *MarketService) updateStockPrices() {
 	updateChan := s.simulator.GetUpdateChannel()
-	
+
 	for update := range updateChan {
-		// Update the stock price in the database
-		if err := s.stockRepo.UpdateStockPrice(update.StockID, update.Price); err != nil {
-			// Log the error but continue processing updates
-			// In a real application, you'd want better error handling
-			continue
+		s.processUpdate(update)
+
+		// ETFs holding the stock move with it
+		s.updateBaskets(update)
+	}
+
+	// The simulator has stopped, so close all subscriber channels
+	s.subscribersMu.Lock()
+	for _, ch := range s.subscribers {
+		close(ch)
+	}
+	s.subscribers = nil
+	s.subscribersMu.Unlock()
+}
+
+// processUpdate stores a new price and acts on it
+func (s *MarketService) processUpdate(update market.StockUpdate) {
+	// Update the stock price in the database
+	if err := s.stockRepo.UpdateStockPrice(update.StockID, update.Price); err != nil {
+		// Log the error but continue processing updates
+		// In a real application, you'd want better error handling
+		return
+	}
+
+	// Fill any resting orders the new price has crossed
+	s.matchOrders(update)
+
+	// Force-cover shorts the new price has pushed below the maintenance margin
+	s.checkShortMargins(update)
+
+	// Liquidate borrowers the new price has pushed below the maintenance margin
+	s.checkMarginCalls(update)
+
+	// Pass the update on to subscribers (e.g. the websocket hub)
+	s.publishUpdate(update)
+}
+
+// publishUpdate forwards a price update to every subscriber without blocking
+func (s *MarketService) publishUpdate(update market.StockUpdate) {
+	s.subscribersMu.Lock()
+	defer s.subscribersMu.Unlock()
+
+	for _, ch := range s.subscribers {
+		select {
+		case ch <- update:
+		default:
+			// Subscriber is not keeping up, skip this update
 		}
 	}
 }
 
+// SubscribeUpdates returns a new channel that receives every stock price update
+func (s *MarketService) SubscribeUpdates() <-chan market.StockUpdate {
+	ch := make(chan market.StockUpdate, 100)
+
+	s.subscribersMu.Lock()
+	s.subscribers = append(s.subscribers, ch)
+	s.subscribersMu.Unlock()
+
+	return ch
+}
+
 // GetAllStocks returns all available stocks
 func (s *MarketService) GetAllStocks() ([]*models.Stock, error) {
-	return s.stockRepo.GetAllStocks()
+	stocks, err := s.stockRepo.GetAllStocks()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := s.simulator.GetAllVolumeStats()
+	for _, stock := range stocks {
+		if stockStats, ok := stats[stock.ID]; ok {
+			stock.VolumeStats = &stockStats
+		}
+	}
+	return stocks, nil
 }
 
 // GetStockByID returns a stock by ID
 func (s *MarketService) GetStockByID(id int) (*models.Stock, error) {
-	return s.stockRepo.GetStockByID(id)
+	stock, err := s.stockRepo.GetStockByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := s.simulator.GetVolumeStats(id)
+	stock.VolumeStats = &stats
+	return stock, nil
+}
+
+// SetFlowConfig sets how trading volume is tracked and how order flow moves prices
+func (s *MarketService) SetFlowConfig(cfg market.FlowConfig) error {
+	return s.simulator.SetFlowConfig(cfg)
 }
 
 // GetUserPortfolio returns a user's portfolio
@@ -91,143 +315,308 @@ func (s *MarketService) GetUserPortfolio(userID int) (*models.PortfolioSummary,
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Get the user's cash balance
 	user, err := s.userRepo.GetUserByID(userID)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Calculate total stock value
-	var stockValue float64
+	var stockValue money.Money
 	for _, item := range items {
-		stockValue += float64(item.Quantity) * item.Stock.CurrentPrice
+		stockValue += item.Stock.CurrentPrice.Mul(item.Quantity)
+	}
+
+	// Get the user's short positions; covering them is what the user owes
+	shorts, err := s.shortRepo.GetUserShortPositions(userID)
+	if err != nil {
+		return nil, err
+	}
+	if shorts == nil {
+		shorts = []*models.ShortPosition{}
+	}
+
+	var shortExposure money.Money
+	for _, position := range shorts {
+		shortExposure += position.MarketValue()
 	}
-	
+
 	// Create the portfolio summary
 	summary := &models.PortfolioSummary{
 		CashBalance:    user.CashBalance,
 		StockValue:     stockValue,
-		TotalValue:     user.CashBalance + stockValue,
+		TotalValue:     user.CashBalance + stockValue - shortExposure - user.LoanBalance,
 		PortfolioItems: items,
+		ShortPositions: shorts,
+		ShortExposure:  shortExposure,
+		Liabilities:    shortExposure + user.LoanBalance,
+		MarginEnabled:  user.MarginEnabled,
+		LoanBalance:    user.LoanBalance,
+	}
+
+	// Commission is part of the user's trading P&L
+	summary.TotalFees, err = s.transactionRepo.GetTotalFees(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cost basis and unrealized P&L come from the open tax lots
+	if err := s.fillCostBasis(summary); err != nil {
+		return nil, err
+	}
+	summary.RealizedPnL, err = s.transactionRepo.GetRealizedPnL(userID)
+	if err != nil {
+		return nil, err
 	}
-	
+
+	// Options are valued at their current premium
+	if err := s.fillOptionPositions(summary, userID); err != nil {
+		return nil, err
+	}
+
+	// Show what the user is really exposed to, looking through ETFs
+	s.fillExposure(summary)
+
+	// Buying power depends on equity, so work it out from the finished summary
+	reservedCash, err := s.orderRepo.GetReservedCash(userID)
+	if err != nil {
+		return nil, err
+	}
+	summary.BuyingPower = money.Max(user.CashBalance-reservedCash, 0)
+	if user.MarginEnabled {
+		summary.BuyingPower = money.Max(summary.BuyingPower, summary.TotalValue.MulRate(s.marginConfig.MaxLeverage)-stockValue-reservedCash)
+	}
+
 	return summary, nil
 }
 
-// BuyStock handles a stock purchase
-func (s *MarketService) BuyStock(userID, stockID, quantity int) error {
+// BuyStock handles a stock purchase; quantity can be a fraction of a share
+func (s *MarketService) BuyStock(userID, stockID int, quantity float64) error {
 	// Input validation
-	if quantity <= 0 {
-		return errors.New("quantity must be greater than zero")
+	if err := s.checkQuantity(quantity); err != nil {
+		return err
 	}
-	
+
 	// Get the stock
 	stock, err := s.stockRepo.GetStockByID(stockID)
 	if err != nil {
 		return err
 	}
-	
-	// Get the user
-	user, err := s.userRepo.GetUserByID(userID)
-	if err != nil {
-		return err
-	}
-	
-	// Calculate total cost
-	totalCost := stock.CurrentPrice * float64(quantity)
-	
-	// Check if user has enough cash
-	if user.CashBalance < totalCost {
-		return errors.New("insufficient funds")
-	}
-	
-	// Begin transaction (in a real app, you'd use a database transaction here)
-	
-	// Update user's cash balance
-	newBalance := user.CashBalance - totalCost
-	if err := s.userRepo.UpdateUserBalance(userID, newBalance); err != nil {
+	if err := s.checkTradable(stock); err != nil {
 		return err
 	}
-	
-	// Update user's portfolio
-	if err := s.portfolioRepo.AddStockToPortfolio(userID, stockID, quantity); err != nil {
-		// In a real app, you'd roll back the balance change on error
-		return err
-	}
-	
-	// Record the transaction
-	_, err = s.transactionRepo.CreateTransaction(userID, stockID, quantity, stock.CurrentPrice, models.Buy)
+
+	return s.executeBuy(userID, stock, quantity, stock.CurrentPrice, nil)
+}
+
+// executeBuy buys shares at the given price as a single database transaction.
+// When the trade fills an order, the order's own reservation is available to it
+// and the order is marked filled in the same transaction.
+func (s *MarketService) executeBuy(userID int, stock *models.Stock, quantity float64, price money.Money, order *models.Order) error {
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the user's row so concurrent trades can't spend the same cash
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Calculate total cost, including commission
+		fee, err := s.tradeFee(tx, userID, quantity, price)
+		if err != nil {
+			return err
+		}
+		totalCost := price.Mul(quantity) + fee
+
+		// Cash held back by open buy orders can't be spent
+		reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+		if err != nil {
+			return err
+		}
+		if order != nil && order.OrderType == models.LimitOrder {
+			reservedCash -= order.LimitPrice.Mul(order.Quantity) + order.ReservedFee
+		}
+
+		// Check if user has enough cash, borrowing the shortfall on a margin account
+		var borrowed money.Money
+		if available := user.CashBalance - reservedCash; available < totalCost {
+			if !user.MarginEnabled {
+				return errors.New("insufficient funds")
+			}
+			buyingPower, err := s.buyingPower(user, reservedCash)
+			if err != nil {
+				return err
+			}
+			if buyingPower < totalCost {
+				return errors.New("insufficient buying power")
+			}
+			borrowed = totalCost - money.Max(available, 0)
+		}
+
+		// Update user's portfolio
+		if err := s.portfolioRepo.AddStockToPortfolioTx(tx, userID, stock.ID, quantity); err != nil {
+			return err
+		}
+
+		transaction, err := s.recordTrade(tx, userID, stock.ID, quantity, price, models.Buy, fee, order)
+		if err != nil {
+			return err
+		}
+
+		// Pay for the shares and the commission
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.LoanAccount, models.CashAccount, borrowed),
+			models.Transfer(models.CashAccount, models.MarketAccount, price.Mul(quantity)),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+		)
+		if err != nil {
+			return err
+		}
+
+		// Track the shares as a new tax lot
+		return s.addLotTx(tx, userID, stock.ID, quantity, price, fee, transaction.ID)
+	})
 	if err != nil {
-		// In a real app, you'd roll back the previous changes on error
 		return err
 	}
-	
+
 	// Update market simulation
-	s.simulator.ProcessTransaction(stockID, quantity, true)
-	
+	s.simulator.ProcessTransaction(stock.ID, quantity, true)
+
 	return nil
 }
 
-// SellStock handles a stock sale
-func (s *MarketService) SellStock(userID, stockID, quantity int) error {
+// SellStock handles a stock sale; quantity can be a fraction of a share
+func (s *MarketService) SellStock(userID, stockID int, quantity float64) error {
 	// Input validation
-	if quantity <= 0 {
-		return errors.New("quantity must be greater than zero")
+	if err := s.checkQuantity(quantity); err != nil {
+		return err
 	}
-	
+
 	// Get the stock
 	stock, err := s.stockRepo.GetStockByID(stockID)
 	if err != nil {
 		return err
 	}
-	
-	// Get the user's holding for this stock
-	holding, err := s.portfolioRepo.GetUserStockHolding(userID, stockID)
-	if err != nil {
+	if err := s.checkTradable(stock); err != nil {
 		return err
 	}
-	
-	// Check if user owns the stock and has enough shares
-	if holding == nil || holding.Quantity < quantity {
-		return errors.New("insufficient shares")
-	}
-	
-	// Get the user
-	user, err := s.userRepo.GetUserByID(userID)
+
+	return s.executeSell(userID, stock, quantity, stock.CurrentPrice, nil)
+}
+
+// executeSell sells shares at the given price as a single database transaction.
+// When the trade fills an order, the order's own reservation is available to it
+// and the order is marked filled in the same transaction. A triggered conditional
+// order sells whatever is still available if the user has since sold some shares.
+func (s *MarketService) executeSell(userID int, stock *models.Stock, quantity float64, price money.Money, order *models.Order) error {
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the user's row first so all trades for a user take locks in the same order
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Lock the user's holding for this stock
+		holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stock.ID)
+		if err != nil {
+			return err
+		}
+
+		// Shares held back by open sell orders can't be sold
+		reservedShares, err := s.orderRepo.GetReservedSharesTx(tx, userID, stock.ID)
+		if err != nil {
+			return err
+		}
+		if order != nil && order.OrderType == models.LimitOrder {
+			reservedShares -= order.Quantity
+		}
+
+		available := 0.0
+		if holding != nil {
+			available = models.RoundShares(holding.Quantity - reservedShares)
+		}
+		if order != nil && order.OrderType.IsConditional() && quantity > available {
+			quantity = available
+		}
+
+		// Check if user owns the stock and has enough shares
+		if available <= 0 || available < quantity {
+			return errors.New("insufficient shares")
+		}
+
+		// Calculate total proceeds, net of commission
+		fee, err := s.tradeFee(tx, userID, quantity, price)
+		if err != nil {
+			return err
+		}
+		totalProceeds := price.Mul(quantity) - fee
+
+		// Update user's portfolio
+		newQuantity := models.RoundShares(holding.Quantity - quantity)
+		if err := s.portfolioRepo.UpdateStockQuantityTx(tx, holding.ID, newQuantity); err != nil {
+			return err
+		}
+
+		// Use up tax lots to work out what the shares cost
+		costBasis, err := s.consumeLotsTx(tx, user, stock.ID, quantity, price)
+		if err != nil {
+			return err
+		}
+
+		transaction, err := s.recordTrade(tx, userID, stock.ID, quantity, price, models.Sell, fee, order)
+		if err != nil {
+			return err
+		}
+
+		// Collect the proceeds less commission, paying down any margin loan first
+		var repaid money.Money
+		if user.LoanBalance > 0 && totalProceeds > 0 {
+			repaid = money.Min(user.LoanBalance, totalProceeds)
+		}
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.MarketAccount, models.CashAccount, price.Mul(quantity)),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+			models.Transfer(models.CashAccount, models.LoanAccount, repaid),
+		)
+		if err != nil {
+			return err
+		}
+		return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, totalProceeds-costBasis)
+	})
 	if err != nil {
 		return err
 	}
-	
-	// Calculate total proceeds
-	totalProceeds := stock.CurrentPrice * float64(quantity)
-	
-	// Begin transaction (in a real app, you'd use a database transaction here)
-	
-	// Update user's cash balance
-	newBalance := user.CashBalance + totalProceeds
-	if err := s.userRepo.UpdateUserBalance(userID, newBalance); err != nil {
-		return err
+
+	if order != nil {
+		order.Quantity = quantity
 	}
-	
-	// Update user's portfolio
-	newQuantity := holding.Quantity - quantity
-	if err := s.portfolioRepo.UpdateStockQuantity(holding.ID, newQuantity); err != nil {
-		// In a real app, you'd roll back the balance change on error
-		return err
+
+	// Update market simulation
+	s.simulator.ProcessTransaction(stock.ID, quantity, false)
+
+	return nil
+}
+
+// recordTrade records the transaction for a trade and, if the trade filled an order,
+// marks the order filled. This fails if the order was cancelled while it was being filled.
+func (s *MarketService) recordTrade(tx *sql.Tx, userID, stockID int, quantity float64, price money.Money, transType models.TransactionType, fee money.Money, order *models.Order) (*models.Transaction, error) {
+	orderID := 0
+	if order != nil {
+		orderID = order.ID
 	}
-	
-	// Record the transaction
-	_, err = s.transactionRepo.CreateTransaction(userID, stockID, quantity, stock.CurrentPrice, models.Sell)
+
+	transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, quantity, price, transType, fee, orderID)
 	if err != nil {
-		// In a real app, you'd roll back the previous changes on error
-		return err
+		return nil, err
 	}
-	
-	// Update market simulation
-	s.simulator.ProcessTransaction(stockID, quantity, false)
-	
-	return nil
+
+	if order != nil {
+		if err := s.orderRepo.MarkOrderFilledTx(tx, order.ID, quantity, price); err != nil {
+			return nil, err
+		}
+	}
+	return transaction, nil
 }
 
 // GetUserTransactions returns a user's transaction history
@@ -235,7 +624,13 @@ func (s *MarketService) GetUserTransactions(userID, limit, offset int) ([]*model
 	return s.transactionRepo.GetUserTransactions(userID, limit, offset)
 }
 
-// GetSimulatorUpdates returns the channel for stock price updates
+// SetSimulatorSeed makes the simulator's prices reproducible from seed.
+// Call it before InitializeSimulator so the stocks' starting trends use the seed too.
+func (s *MarketService) SetSimulatorSeed(seed int64) {
+	s.simulator.SetSeed(seed)
+}
+
+// GetSimulatorUpdates returns a channel for stock price updates
 func (s *MarketService) GetSimulatorUpdates() <-chan market.StockUpdate {
-	return s.simulator.GetUpdateChannel()
-}
\ No newline at end of file
+	return s.SubscribeUpdates()
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// ShortConfig controls short selling
+type ShortConfig struct {
+	BorrowFeeRate     float64       // Fee charged every FeeInterval, as a fraction of a position's market value
+	FeeInterval       time.Duration // How often borrow fees are charged
+	InitialMargin     float64       // Equity needed to open a short, as a fraction of total short exposure
+	MaintenanceMargin float64       // Equity below which shorts are force-covered, as a fraction of exposure
+}
+
+// DefaultShortConfig returns the short selling settings used unless overridden
+func DefaultShortConfig() ShortConfig {
+	return ShortConfig{
+		BorrowFeeRate:     0.001, // 0.1% per day
+		FeeInterval:       24 * time.Hour,
+		InitialMargin:     0.5,
+		MaintenanceMargin: 0.3,
+	}
+}
+
+// SetShortConfig replaces the short selling settings
+func (s *MarketService) SetShortConfig(cfg ShortConfig) {
+	s.shortConfig = cfg
+}
+
+// ShortStock sells borrowed shares at the current price. The proceeds are credited
+// to the user's cash, and the user must keep enough equity to cover the position.
+func (s *MarketService) ShortStock(userID, stockID int, quantity float64) error {
+	// Input validation
+	if err := s.checkQuantity(quantity); err != nil {
+		return err
+	}
+
+	// Get the stock
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return err
+	}
+
+	price := stock.CurrentPrice
+	proceeds := price.Mul(quantity)
+
+	err = s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the user's row so concurrent trades see each other's changes
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		fee, err := s.tradeFee(tx, userID, quantity, price)
+		if err != nil {
+			return err
+		}
+
+		// Long and short positions in the same stock aren't netted, so don't allow both
+		holding, err := s.portfolioRepo.GetUserStockHoldingForUpdate(tx, userID, stockID)
+		if err != nil {
+			return err
+		}
+		if holding != nil {
+			return errors.New("sell your shares before shorting this stock")
+		}
+
+		if _, err := s.shortRepo.GetShortPositionForUpdate(tx, userID, stockID); err != nil {
+			return err
+		}
+
+		// Shorting doesn't change equity (cash and liabilities grow together),
+		// but the equity must cover the initial margin on the larger exposure
+		equity, err := s.portfolioRepo.CalculatePortfolioValue(userID)
+		if err != nil {
+			return err
+		}
+		exposure, err := s.shortRepo.GetShortMarketValue(userID)
+		if err != nil {
+			return err
+		}
+		if equity < (exposure + proceeds).MulRate(s.shortConfig.InitialMargin) {
+			return errors.New("insufficient margin")
+		}
+
+		// Open the position and credit the proceeds, less commission
+		if err := s.shortRepo.AddShortTx(tx, userID, stockID, quantity, price); err != nil {
+			return err
+		}
+		transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, stockID, quantity, price, models.Short, fee, 0)
+		if err != nil {
+			return err
+		}
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.MarketAccount, models.CashAccount, proceeds),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+		)
+		if err != nil {
+			return err
+		}
+
+		// The commission is realized straight away; the sale itself is realized when it's covered
+		return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, -fee)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Short sales push the price down like any other sale
+	s.simulator.ProcessTransaction(stockID, quantity, false)
+
+	return nil
+}
+
+// CoverShort buys back borrowed shares at the current price
+func (s *MarketService) CoverShort(userID, stockID int, quantity float64) error {
+	// Input validation
+	if err := s.checkQuantity(quantity); err != nil {
+		return err
+	}
+
+	// Get the stock
+	stock, err := s.stockRepo.GetStockByID(stockID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkTradable(stock); err != nil {
+		return err
+	}
+
+	return s.executeCover(userID, stock, quantity, stock.CurrentPrice, false)
+}
+
+// executeCover buys back borrowed shares at the given price as a single database transaction.
+// Forced covers (margin calls) go through even if they leave the user's cash negative.
+func (s *MarketService) executeCover(userID int, stock *models.Stock, quantity float64, price money.Money, forced bool) error {
+	err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+		// Lock the user's row first so all trades for a user take locks in the same order
+		user, err := s.userRepo.GetUserForUpdate(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		fee, err := s.tradeFee(tx, userID, quantity, price)
+		if err != nil {
+			return err
+		}
+		cost := price.Mul(quantity) + fee
+
+		position, err := s.shortRepo.GetShortPositionForUpdate(tx, userID, stock.ID)
+		if err != nil {
+			return err
+		}
+		if position == nil || position.Quantity < quantity {
+			return errors.New("insufficient short position")
+		}
+
+		if !forced {
+			// Cash held back by open buy orders can't be spent
+			reservedCash, err := s.orderRepo.GetReservedCashTx(tx, userID)
+			if err != nil {
+				return err
+			}
+			if user.CashBalance-reservedCash < cost {
+				return errors.New("insufficient funds")
+			}
+		}
+
+		if err := s.shortRepo.UpdateShortQuantityTx(tx, position.ID, models.RoundShares(position.Quantity-quantity)); err != nil {
+			return err
+		}
+
+		transaction, err := s.transactionRepo.CreateTransactionTx(tx, userID, stock.ID, quantity, price, models.Cover, fee, 0)
+		if err != nil {
+			return err
+		}
+		err = s.postTx(tx, user, transaction,
+			models.Transfer(models.CashAccount, models.MarketAccount, price.Mul(quantity)),
+			models.Transfer(models.CashAccount, models.FeeAccount, fee),
+		)
+		if err != nil {
+			return err
+		}
+		return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, position.EntryPrice.Mul(quantity)-price.Mul(quantity)-fee)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Covering is a purchase, so it pushes the price up
+	s.simulator.ProcessTransaction(stock.ID, quantity, true)
+
+	return nil
+}
+
+// runShortJobs charges borrow fees on a schedule until the simulator stops
+func (s *MarketService) runShortJobs() {
+	ticker := time.NewTicker(s.shortConfig.FeeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.chargeBorrowFees()
+	}
+}
+
+// chargeBorrowFees charges every open short position its borrow fee, then makes
+// sure the fees haven't pushed anyone below the maintenance margin
+func (s *MarketService) chargeBorrowFees() {
+	positions, err := s.shortRepo.GetAllShortPositions()
+	if err != nil {
+		log.Printf("chargeBorrowFees: Error loading short positions: %v", err)
+		return
+	}
+
+	charged := make(map[int]bool)
+	for _, position := range positions {
+		// Charge a whole number of cents per share, at least one
+		feePerShare := money.Max(position.Stock.CurrentPrice.MulRate(s.shortConfig.BorrowFeeRate), money.Cent)
+		fee := feePerShare.Mul(position.Quantity)
+
+		err := s.txRunner.RunInTx(func(tx *sql.Tx) error {
+			user, err := s.userRepo.GetUserForUpdate(tx, position.UserID)
+			if err != nil {
+				return err
+			}
+			transaction, err := s.transactionRepo.CreateTransactionTx(tx, position.UserID, position.StockID,
+				position.Quantity, feePerShare, models.BorrowFee, 0, 0)
+			if err != nil {
+				return err
+			}
+			if err := s.postTx(tx, user, transaction, models.Transfer(models.CashAccount, models.FeeAccount, fee)); err != nil {
+				return err
+			}
+			return s.transactionRepo.SetRealizedPnLTx(tx, transaction.ID, -fee)
+		})
+		if err != nil {
+			log.Printf("chargeBorrowFees: Error charging user %d for %s: %v", position.UserID, position.Stock.Symbol, err)
+			continue
+		}
+		charged[position.UserID] = true
+	}
+
+	for userID := range charged {
+		s.enforceShortMargin(userID)
+	}
+}
+
+// checkShortMargins re-checks the margin of every user who is short the updated stock
+func (s *MarketService) checkShortMargins(update market.StockUpdate) {
+	userIDs, err := s.shortRepo.GetUserIDsWithShortsInStock(update.StockID)
+	if err != nil {
+		log.Printf("checkShortMargins: Error loading short sellers of stock %d: %v", update.StockID, err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		s.enforceShortMargin(userID)
+	}
+}
+
+// enforceShortMargin force-covers a user's short positions, largest first,
+// until their equity is back above the maintenance margin
+func (s *MarketService) enforceShortMargin(userID int) {
+	var covered []*models.ShortPosition
+
+	for {
+		equity, err := s.portfolioRepo.CalculatePortfolioValue(userID)
+		if err != nil {
+			log.Printf("enforceShortMargin: Error calculating equity for user %d: %v", userID, err)
+			break
+		}
+		positions, err := s.shortRepo.GetUserShortPositions(userID)
+		if err != nil {
+			log.Printf("enforceShortMargin: Error loading short positions for user %d: %v", userID, err)
+			break
+		}
+
+		var exposure money.Money
+		for _, position := range positions {
+			exposure += position.MarketValue()
+		}
+		if len(positions) == 0 || equity >= exposure.MulRate(s.shortConfig.MaintenanceMargin) {
+			break
+		}
+
+		// Cover the largest position first
+		sort.Slice(positions, func(i, j int) bool {
+			return positions[i].MarketValue() > positions[j].MarketValue()
+		})
+		position := positions[0]
+		if err := s.executeCover(userID, &position.Stock, position.Quantity, position.Stock.CurrentPrice, true); err != nil {
+			log.Printf("enforceShortMargin: Error covering %s for user %d: %v", position.Stock.Symbol, userID, err)
+			break
+		}
+		log.Printf("enforceShortMargin: Margin call covered %g %s for user %d", position.Quantity, position.Stock.Symbol, userID)
+		covered = append(covered, position)
+	}
+
+	if len(covered) > 0 {
+		s.notifyUser(userID, "margin_call", covered)
+	}
+}
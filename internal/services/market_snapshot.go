@@ -0,0 +1,46 @@
+package services
+
+import (
+	"log"
+	"time"
+)
+
+// SetSnapshotInterval sets how often the simulator's state is saved
+func (s *MarketService) SetSnapshotInterval(interval time.Duration) {
+	s.snapshotInterval = interval
+}
+
+// restoreSnapshot loads the last saved simulator state, if there is one
+func (s *MarketService) restoreSnapshot() error {
+	snapshot, err := s.stateRepo.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	if err := s.simulator.Restore(snapshot); err != nil {
+		return err
+	}
+
+	log.Printf("restoreSnapshot: Restored simulator state saved at %s", snapshot.TakenAt.Format(time.RFC3339))
+	return nil
+}
+
+// SaveSnapshot saves the simulator's state so it carries on where it left off after a restart
+func (s *MarketService) SaveSnapshot() error {
+	return s.stateRepo.SaveSnapshot(s.simulator.Snapshot())
+}
+
+// runSnapshotJobs saves the simulator's state every snapshot interval
+func (s *MarketService) runSnapshotJobs() {
+	ticker := time.NewTicker(s.snapshotInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.SaveSnapshot(); err != nil {
+			log.Printf("runSnapshotJobs: Error saving simulator state: %v", err)
+		}
+	}
+}
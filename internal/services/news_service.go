@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/websocket"
+	"officestonks/pkg/market"
+)
+
+// NewsConfig controls how often the simulator makes up news
+type NewsConfig struct {
+	Interval time.Duration // How often there is a chance of news
+	Chance   float64       // Chance of news each interval, from 0 to 1
+}
+
+// DefaultNewsConfig returns the news settings used unless overridden
+func DefaultNewsConfig() NewsConfig {
+	return NewsConfig{
+		Interval: time.Minute,
+		Chance:   0.2,
+	}
+}
+
+// NewsService publishes market news, which moves prices and is broadcast to every client
+type NewsService struct {
+	eventRepo     models.MarketEventRepository
+	stockRepo     models.StockRepository
+	marketService *MarketService
+	wsHub         *websocket.Hub
+	config        NewsConfig
+}
+
+// NewNewsService creates a new news service
+func NewNewsService(
+	eventRepo models.MarketEventRepository,
+	stockRepo models.StockRepository,
+	marketService *MarketService,
+	wsHub *websocket.Hub,
+	config NewsConfig,
+) *NewsService {
+	return &NewsService{
+		eventRepo:     eventRepo,
+		stockRepo:     stockRepo,
+		marketService: marketService,
+		wsHub:         wsHub,
+		config:        config,
+	}
+}
+
+// Start makes up news in the background
+func (s *NewsService) Start() {
+	if s.config.Interval <= 0 || s.config.Chance <= 0 {
+		return
+	}
+	go s.runNewsJobs()
+}
+
+// runNewsJobs gives the simulator a chance to make up news every interval
+func (s *NewsService) runNewsJobs() {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		event, ok := s.marketService.RandomMarketEvent(s.config.Chance)
+		if !ok {
+			continue
+		}
+
+		news := &models.MarketEvent{
+			Scope:       event.Scope,
+			Sector:      event.Sector,
+			Headline:    event.Headline,
+			PriceImpact: event.PriceImpact,
+			TrendImpact: event.TrendImpact,
+			Source:      models.EventSourceGenerated,
+		}
+		if event.Scope == market.ScopeStock {
+			news.StockID = &event.StockID
+		}
+
+		if err := s.PublishEvent(news); err != nil {
+			log.Printf("runNewsJobs: failed to publish %q: %v", event.Headline, err)
+		}
+	}
+}
+
+// PublishEvent moves the prices of the stocks the news targets, records it and broadcasts it
+// to every client as a "news" message
+func (s *NewsService) PublishEvent(event *models.MarketEvent) error {
+	simEvent := market.Event{
+		Scope:       event.Scope,
+		Sector:      event.Sector,
+		Headline:    event.Headline,
+		PriceImpact: event.PriceImpact,
+		TrendImpact: event.TrendImpact,
+	}
+
+	switch event.Scope {
+	case market.ScopeStock:
+		if event.StockID == nil {
+			return errors.New("a stock event needs a stock")
+		}
+		stock, err := s.stockRepo.GetStockByID(*event.StockID)
+		if err != nil {
+			return err
+		}
+		simEvent.StockID = stock.ID
+		event.Symbol = stock.Symbol
+		event.Sector = ""
+	case market.ScopeSector:
+		event.StockID = nil
+	case market.ScopeMarket:
+		event.StockID = nil
+		event.Sector = ""
+	}
+
+	if _, err := s.marketService.ApplyMarketEvent(simEvent); err != nil {
+		return err
+	}
+
+	if err := s.eventRepo.CreateEvent(event); err != nil {
+		// The prices have already moved, so still tell everyone why
+		log.Printf("PublishEvent: failed to save %q: %v", event.Headline, err)
+		event.CreatedAt = time.Now()
+	}
+
+	if s.wsHub != nil {
+		s.wsHub.BroadcastMessage("news", event)
+	}
+
+	return nil
+}
+
+// GetNews returns published news, newest first
+func (s *NewsService) GetNews(limit, offset int) ([]*models.MarketEvent, error) {
+	return s.eventRepo.GetRecentEvents(limit, offset)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/market"
+)
+
+// PriceHistoryConfig controls how price ticks are written to the database
+type PriceHistoryConfig struct {
+	BatchSize     int           // Ticks buffered before they are written
+	FlushInterval time.Duration // Longest a tick waits in the buffer
+}
+
+// DefaultPriceHistoryConfig returns the price history settings used unless overridden
+func DefaultPriceHistoryConfig() PriceHistoryConfig {
+	return PriceHistoryConfig{
+		BatchSize:     200,
+		FlushInterval: 5 * time.Second,
+	}
+}
+
+// maxCandles caps how many candles a single request can return
+const maxCandles = 1000
+
+// PriceHistoryService records simulated prices and serves them as OHLC candles
+type PriceHistoryService struct {
+	historyRepo models.PriceHistoryRepository
+	stockRepo   models.StockRepository
+	config      PriceHistoryConfig
+}
+
+// NewPriceHistoryService creates a new price history service
+func NewPriceHistoryService(
+	historyRepo models.PriceHistoryRepository,
+	stockRepo models.StockRepository,
+	config PriceHistoryConfig,
+) *PriceHistoryService {
+	return &PriceHistoryService{
+		historyRepo: historyRepo,
+		stockRepo:   stockRepo,
+		config:      config,
+	}
+}
+
+// Start records every update from the channel until it is closed
+func (s *PriceHistoryService) Start(updates <-chan market.StockUpdate) {
+	go s.record(updates)
+}
+
+// record buffers ticks and writes them in batches, when the buffer fills up or the flush interval passes
+func (s *PriceHistoryService) record(updates <-chan market.StockUpdate) {
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.PriceTick, 0, s.config.BatchSize)
+
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				s.flush(batch)
+				return
+			}
+
+			tick := &models.PriceTick{
+				StockID:   update.StockID,
+				Price:     update.Price,
+				Volume:    update.Volume,
+				CreatedAt: update.Time,
+			}
+			if tick.CreatedAt.IsZero() {
+				tick.CreatedAt = time.Now()
+			}
+			batch = append(batch, tick)
+
+			if len(batch) >= s.config.BatchSize {
+				s.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			s.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush writes a batch of ticks and rolls them up into every candle interval
+func (s *PriceHistoryService) flush(batch []*models.PriceTick) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := s.historyRepo.SaveTicks(batch); err != nil {
+		log.Printf("flush: failed to save %d price ticks: %v", len(batch), err)
+		return
+	}
+
+	for _, interval := range models.CandleIntervals {
+		if err := s.historyRepo.SaveCandles(models.BuildCandles(batch, interval)); err != nil {
+			log.Printf("flush: failed to save %s candles: %v", interval, err)
+		}
+	}
+}
+
+// GetCandles returns a stock's candles for an interval between from and to. A zero to means now,
+// and a zero from means enough time before to for the most candles a request can return.
+func (s *PriceHistoryService) GetCandles(stockID int, interval models.CandleInterval, from, to time.Time) ([]*models.Candle, error) {
+	if !interval.IsValid() {
+		return nil, errors.New("interval must be '1m', '5m', '1h' or '1d'")
+	}
+
+	// Make sure the stock exists
+	if _, err := s.stockRepo.GetStockByID(stockID); err != nil {
+		return nil, err
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-maxCandles * interval.Duration())
+	}
+	if from.After(to) {
+		return nil, errors.New("from must be before to")
+	}
+	if to.Sub(from) > maxCandles*interval.Duration() {
+		return nil, errors.New("time range covers too many candles for this interval")
+	}
+
+	return s.historyRepo.GetCandles(stockID, interval, interval.BucketStart(from), to)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"officestonks/internal/models"
+	"officestonks/pkg/money"
 )
 
 // UserService handles user-related business logic
@@ -20,17 +21,18 @@ func NewUserService(userRepo models.UserRepository, portfolioRepo models.Portfol
 
 // LeaderboardEntry represents a user in the leaderboard
 type LeaderboardEntry struct {
-	UserID      int     `json:"user_id"`
-	Username    string  `json:"username"`
-	CashBalance float64 `json:"cash_balance"`
-	StockValue  float64 `json:"stock_value"`
-	TotalValue  float64 `json:"total_value"`
-	Rank        int     `json:"rank"`
+	UserID      int         `json:"user_id"`
+	Username    string      `json:"username"`
+	CashBalance money.Money `json:"cash_balance"`
+	StockValue  money.Money `json:"stock_value"`
+	TotalValue  money.Money `json:"total_value"` // Net equity
+	Liabilities money.Money `json:"liabilities"` // Short positions and margin loans
+	Rank        int         `json:"rank"`
 }
 
-// GetLeaderboard returns the top users by portfolio value
+// GetLeaderboard returns the top users by net equity, so borrowed money doesn't inflate a rank
 func (s *UserService) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
-	// Get all users
+	// Get the top users, already ranked by net equity
 	users, err := s.userRepo.GetTopUsers(limit)
 	if err != nil {
 		return nil, err
@@ -40,14 +42,15 @@ func (s *UserService) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 	leaderboard := make([]LeaderboardEntry, 0, len(users))
 	
 	for i, user := range users {
-		// Calculate portfolio value
+		// Calculate net equity and gross stock value
 		portfolioValue, err := s.portfolioRepo.CalculatePortfolioValue(user.ID)
 		if err != nil {
 			return nil, err
 		}
-		
-		// Get stock value (portfolio value - cash balance)
-		stockValue := portfolioValue - user.CashBalance
+		stockValue, err := s.portfolioRepo.CalculateStockValue(user.ID)
+		if err != nil {
+			return nil, err
+		}
 		
 		// Create leaderboard entry
 		entry := LeaderboardEntry{
@@ -56,6 +59,7 @@ func (s *UserService) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 			CashBalance: user.CashBalance,
 			StockValue:  stockValue,
 			TotalValue:  portfolioValue,
+			Liabilities: user.CashBalance + stockValue - portfolioValue,
 			Rank:        i + 1, // 1-based ranking
 		}
 		
@@ -67,12 +71,12 @@ func (s *UserService) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 
 // UserProfile represents a user's profile information
 type UserProfile struct {
-	UserID      int     `json:"user_id"`
-	Username    string  `json:"username"`
-	CashBalance float64 `json:"cash_balance"`
-	StockValue  float64 `json:"stock_value"`
-	TotalValue  float64 `json:"total_value"`
-	JoinedDate  string  `json:"joined_date"`
+	UserID      int         `json:"user_id"`
+	Username    string      `json:"username"`
+	CashBalance money.Money `json:"cash_balance"`
+	StockValue  money.Money `json:"stock_value"`
+	TotalValue  money.Money `json:"total_value"` // Net equity
+	JoinedDate  string      `json:"joined_date"`
 }
 
 // GetUserProfile returns the profile for a specific user
@@ -89,8 +93,11 @@ func (s *UserService) GetUserProfile(userID int) (*UserProfile, error) {
 		return nil, err
 	}
 	
-	// Get stock value (portfolio value - cash balance)
-	stockValue := portfolioValue - user.CashBalance
+	// Get stock value
+	stockValue, err := s.portfolioRepo.CalculateStockValue(userID)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Create user profile
 	profile := &UserProfile{
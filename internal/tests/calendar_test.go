@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"officestonks/internal/services"
+	"officestonks/pkg/market"
+)
+
+func TestMarketCalendar(t *testing.T) {
+	calendar, err := market.NewCalendar(market.CalendarConfig{
+		Timezone: "America/New_York",
+		Open:     "09:30",
+		Close:    "16:00",
+		Holidays: []market.Holiday{
+			{Date: "2024-12-24", Name: "Christmas Eve", EarlyClose: "13:00"},
+			{Date: "2024-12-25", Name: "Christmas Day"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create calendar: %v", err)
+	}
+
+	ny, _ := time.LoadLocation("America/New_York")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 12, day, hour, minute, 0, 0, ny)
+	}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		open      bool
+		nextOpen  time.Time
+		nextClose time.Time
+	}{
+		{"before the open", at(20, 9, 0), false, at(20, 9, 30), at(20, 16, 0)},
+		{"during the session", at(20, 12, 0), true, at(23, 9, 30), at(20, 16, 0)},
+		{"at the close", at(20, 16, 0), false, at(23, 9, 30), at(23, 16, 0)},
+		{"weekend", at(21, 12, 0), false, at(23, 9, 30), at(23, 16, 0)},
+		{"after an early close", at(24, 14, 0), false, at(26, 9, 30), at(26, 16, 0)},
+		{"before an early close", at(24, 12, 0), true, at(26, 9, 30), at(24, 13, 0)},
+		{"holiday", at(25, 12, 0), false, at(26, 9, 30), at(26, 16, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if open := calendar.IsOpen(tt.t); open != tt.open {
+				t.Errorf("Expected open=%v, got %v", tt.open, open)
+			}
+			if next := calendar.NextOpen(tt.t); !next.Equal(tt.nextOpen) {
+				t.Errorf("Expected next open %v, got %v", tt.nextOpen, next)
+			}
+			if next := calendar.NextClose(tt.t); !next.Equal(tt.nextClose) {
+				t.Errorf("Expected next close %v, got %v", tt.nextClose, next)
+			}
+		})
+	}
+
+	// Times in other zones are converted to the calendar's
+	if !calendar.IsOpen(time.Date(2024, 12, 20, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the market to be open at 15:00 UTC, which is 10:00 in New York")
+	}
+
+	// A nil calendar is always open
+	var always *market.Calendar
+	if !always.IsOpen(at(25, 3, 0)) || !always.NextOpen(at(25, 3, 0)).IsZero() {
+		t.Errorf("Expected a nil calendar to always be open")
+	}
+
+	if _, err := market.NewCalendar(market.CalendarConfig{Timezone: "UTC", Open: "16:00", Close: "09:30"}); err == nil {
+		t.Errorf("Expected a calendar that closes before it opens to be rejected")
+	}
+}
+
+func TestSimulatorPausesWhenClosed(t *testing.T) {
+	calendar, err := market.NewCalendar(market.CalendarConfig{Timezone: "UTC", Open: "09:00", Close: "17:00"})
+	if err != nil {
+		t.Fatalf("Failed to create calendar: %v", err)
+	}
+
+	// Saturday, so the market is closed
+	sim := newSeededSimulator(1, fixedClock{now: time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)})
+	sim.SetCalendar(calendar, 0)
+	sim.Start()
+	defer sim.Stop()
+
+	select {
+	case update := <-sim.GetUpdateChannel():
+		t.Errorf("Expected no price updates while the market is closed, got %+v", update)
+	case <-time.After(2500 * time.Millisecond):
+	}
+}
+
+func TestMarketServiceUsesSimulatorClock(t *testing.T) {
+	calendar, err := market.NewCalendar(market.CalendarConfig{Timezone: "UTC", Open: "09:00", Close: "17:00"})
+	if err != nil {
+		t.Fatalf("Failed to create calendar: %v", err)
+	}
+
+	marketService := services.NewMarketService(services.MarketDeps{})
+	marketService.SetCalendar(calendar, 0)
+
+	// Saturday, so the market is closed whatever the wall clock says
+	saturday := time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC)
+	marketService.SetClock(fixedClock{now: saturday})
+	if marketService.IsMarketOpen() {
+		t.Errorf("Expected the market to be closed on a Saturday")
+	}
+	status := marketService.GetMarketStatus()
+	if status.IsOpen || !status.ServerTime.Equal(saturday) {
+		t.Errorf("Expected a closed status at %v, got open=%v at %v", saturday, status.IsOpen, status.ServerTime)
+	}
+	if monday := time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC); status.NextOpen == nil || !status.NextOpen.Equal(monday) {
+		t.Errorf("Expected the market to next open at %v, got %v", monday, status.NextOpen)
+	}
+
+	marketService.SetClock(fixedClock{now: time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)})
+	if !marketService.IsMarketOpen() {
+		t.Errorf("Expected the market to be open on a Monday morning")
+	}
+}
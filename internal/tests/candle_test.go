@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+func TestBuildCandles(t *testing.T) {
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	tick := func(offset time.Duration, price money.Money, volume float64) *models.PriceTick {
+		return &models.PriceTick{StockID: 1, Price: price, Volume: volume, CreatedAt: start.Add(offset)}
+	}
+
+	ticks := []*models.PriceTick{
+		tick(0, 100*money.Dollar, 5),
+		tick(20*time.Second, 104*money.Dollar, 0),
+		tick(40*time.Second, 98*money.Dollar, 10),
+		tick(61*time.Second, 101*money.Dollar, 3),
+		tick(6*time.Minute, 99*money.Dollar, 2),
+	}
+
+	tests := []struct {
+		interval models.CandleInterval
+		expected []models.Candle
+	}{
+		{models.OneMinute, []models.Candle{
+			{BucketStart: start, Open: 100 * money.Dollar, High: 104 * money.Dollar, Low: 98 * money.Dollar, Close: 98 * money.Dollar, Volume: 15},
+			{BucketStart: start.Add(time.Minute), Open: 101 * money.Dollar, High: 101 * money.Dollar, Low: 101 * money.Dollar, Close: 101 * money.Dollar, Volume: 3},
+			{BucketStart: start.Add(6 * time.Minute), Open: 99 * money.Dollar, High: 99 * money.Dollar, Low: 99 * money.Dollar, Close: 99 * money.Dollar, Volume: 2},
+		}},
+		{models.FiveMinutes, []models.Candle{
+			{BucketStart: start, Open: 100 * money.Dollar, High: 104 * money.Dollar, Low: 98 * money.Dollar, Close: 101 * money.Dollar, Volume: 18},
+			{BucketStart: start.Add(5 * time.Minute), Open: 99 * money.Dollar, High: 99 * money.Dollar, Low: 99 * money.Dollar, Close: 99 * money.Dollar, Volume: 2},
+		}},
+		{models.OneDay, []models.Candle{
+			{BucketStart: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Open: 100 * money.Dollar, High: 104 * money.Dollar, Low: 98 * money.Dollar, Close: 99 * money.Dollar, Volume: 20},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.interval), func(t *testing.T) {
+			candles := models.BuildCandles(ticks, tt.interval)
+			if len(candles) != len(tt.expected) {
+				t.Fatalf("Expected %d candles, got %d", len(tt.expected), len(candles))
+			}
+
+			for i, expected := range tt.expected {
+				got := candles[i]
+				if !got.BucketStart.Equal(expected.BucketStart) || got.Open != expected.Open || got.High != expected.High ||
+					got.Low != expected.Low || got.Close != expected.Close || got.Volume != expected.Volume {
+					t.Errorf("Candle %d: expected %+v, got %+v", i, expected, *got)
+				}
+			}
+		})
+	}
+
+	if models.CandleInterval("2m").IsValid() {
+		t.Errorf("Expected an unsupported interval to be rejected")
+	}
+}
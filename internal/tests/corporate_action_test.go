@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestSplitShares(t *testing.T) {
+	tests := []struct {
+		quantities []float64
+		ratio      float64
+		step       float64
+		expected   []float64
+	}{
+		{[]float64{10, 5}, 2, 1, []float64{20, 10}},
+		{[]float64{25}, 0.1, 1, []float64{2}},
+		{[]float64{7, 8}, 0.1, 1, []float64{0, 1}}, // 15 shares make one whole share, which goes to the larger block
+		{[]float64{3, 5}, 1.5, 1, []float64{5, 7}}, // 4.5 and 7.5 add up to 12 whole shares
+		{[]float64{2.5, 0.25}, 0.5, 0.001, []float64{1.25, 0.125}},
+		{[]float64{0.003, 0.001}, 0.5, 0.001, []float64{0.002, 0}}, // 0.0015 and 0.0005 add up to 2 thousandths
+	}
+
+	for _, tt := range tests {
+		if got := models.SplitShares(tt.quantities, tt.ratio, tt.step); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("SplitShares(%v, %v, %v) = %v, expected %v", tt.quantities, tt.ratio, tt.step, got, tt.expected)
+		}
+	}
+}
+
+func TestSimulatorCorporateActions(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	// A 2-for-1 split halves the price and sends an update
+	price, err := sim.ApplySplit(1, 2)
+	if err != nil {
+		t.Fatalf("Failed to apply split: %v", err)
+	}
+	if price != 50*money.Dollar {
+		t.Errorf("Expected a 2-for-1 split to halve the price to 50, got %s", price)
+	}
+	if update := <-sim.GetUpdateChannel(); update.StockID != 1 || update.Price != 50*money.Dollar {
+		t.Errorf("Expected an update for the split price, got %+v", update)
+	}
+
+	// A 1-for-10 reverse split multiplies it by ten
+	if price, err := sim.ApplySplit(3, 0.1); err != nil || price != 200*money.Dollar {
+		t.Errorf("Expected a 1-for-10 reverse split to raise the price to 200, got %s (%v)", price, err)
+	}
+
+	// Going ex-dividend drops the price by the dividend
+	if price, err := sim.ApplyDividend(2, money.FromFloat(1.5)); err != nil || price != money.FromFloat(48.5) {
+		t.Errorf("Expected the ex-dividend price to be 48.50, got %s (%v)", price, err)
+	}
+
+	if _, err := sim.ApplySplit(1, 0); err == nil {
+		t.Errorf("Expected a zero split ratio to fail")
+	}
+	if _, err := sim.ApplyDividend(1, -money.Dollar); err == nil {
+		t.Errorf("Expected a negative dividend to fail")
+	}
+	if _, err := sim.ApplySplit(99, 2); err == nil {
+		t.Errorf("Expected splitting an unknown stock to fail")
+	}
+}
+
+func TestDividendAndSplits(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+	stockRepo := repository.NewStockRepo(TestDB)
+	portfolioRepo := repository.NewPortfolioRepo(TestDB)
+
+	username := fmt.Sprintf("actions_%d", time.Now().UnixNano())
+	user, err := userRepo.CreateUser(username, "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stock, err := stockRepo.GetStockBySymbol("TSLA")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+	defer stockRepo.UpdateStockPrice(stock.ID, stock.CurrentPrice)
+
+	if err := marketService.BuyStock(user.ID, stock.ID, 5); err != nil {
+		t.Fatalf("Failed to buy stock: %v", err)
+	}
+	user, err = userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	// A dividend already past its ex and pay dates goes ex on one pass and is paid on the next
+	past := time.Now().Add(-time.Minute)
+	dividend := &models.CorporateAction{StockID: stock.ID, Type: models.DividendAction, Amount: 2 * money.Dollar, ExDate: past, PayDate: &past}
+	if err := marketService.DeclareCorporateAction(dividend); err != nil {
+		t.Fatalf("Failed to declare dividend: %v", err)
+	}
+	marketService.ProcessCorporateActions()
+	marketService.ProcessCorporateActions()
+
+	dividend, err = repository.NewCorporateActionRepo(TestDB).GetActionByID(dividend.ID)
+	if err != nil {
+		t.Fatalf("Failed to get dividend: %v", err)
+	}
+	if dividend.Status != models.ActionPaid {
+		t.Errorf("Expected the dividend to be paid, got %s", dividend.Status)
+	}
+	paid, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if paid.CashBalance != user.CashBalance+10*money.Dollar {
+		t.Errorf("Expected a dividend of 10.00 on 5 shares, cash went from %s to %s", user.CashBalance, paid.CashBalance)
+	}
+
+	transactions, err := repository.NewTransactionRepo(TestDB).GetUserTransactions(user.ID, 1, 0)
+	if err != nil || len(transactions) != 1 || transactions[0].TransactionType != models.Dividend {
+		t.Fatalf("Expected the latest transaction to be the dividend, got %+v (%v)", transactions, err)
+	}
+
+	// A 2-for-1 split doubles the holding and halves the price
+	split := &models.CorporateAction{StockID: stock.ID, Type: models.SplitAction, SplitTo: 2, SplitFrom: 1, ExDate: past}
+	if err := marketService.DeclareCorporateAction(split); err != nil {
+		t.Fatalf("Failed to declare split: %v", err)
+	}
+	marketService.ProcessCorporateActions()
+
+	holding, err := portfolioRepo.GetUserStockHolding(user.ID, stock.ID)
+	if err != nil || holding.Quantity != 10 {
+		t.Fatalf("Expected a holding of 10 shares after the split, got %+v (%v)", holding, err)
+	}
+	split1, err := stockRepo.GetStockByID(stock.ID)
+	if err != nil || split1.CurrentPrice != stock.CurrentPrice.MulRate(0.5) {
+		t.Errorf("Expected the split to halve the price, got %+v (%v)", split1, err)
+	}
+
+	// A 1-for-4 reverse split leaves 2 shares and pays the half share left over in cash
+	reverse := &models.CorporateAction{StockID: stock.ID, Type: models.SplitAction, SplitTo: 1, SplitFrom: 4, ExDate: past}
+	if err := marketService.DeclareCorporateAction(reverse); err != nil {
+		t.Fatalf("Failed to declare reverse split: %v", err)
+	}
+	marketService.ProcessCorporateActions()
+
+	holding, err = portfolioRepo.GetUserStockHolding(user.ID, stock.ID)
+	if err != nil || holding.Quantity != 2 {
+		t.Fatalf("Expected a holding of 2 shares after the reverse split, got %+v (%v)", holding, err)
+	}
+	after, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	cashInLieu := split1.CurrentPrice.MulRate(4).Mul(0.5)
+	if after.CashBalance != paid.CashBalance+cashInLieu {
+		t.Errorf("Expected %s cash in lieu of the half share, cash went from %s to %s", cashInLieu, paid.CashBalance, after.CashBalance)
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestCostBasisMethods(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+	stockRepo := repository.NewStockRepo(TestDB)
+	fees := models.DefaultFeeSchedule()
+
+	stock, err := stockRepo.GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+	defer stockRepo.UpdateStockPrice(stock.ID, stock.CurrentPrice)
+
+	for _, tt := range []struct {
+		method       models.CostBasisMethod
+		costPerShare money.Money // Cost of the shares the sale uses up, before commission
+	}{
+		{models.FIFO, 100 * money.Dollar},
+		{models.LIFO, 120 * money.Dollar},
+		{models.AverageCost, 110 * money.Dollar},
+	} {
+		t.Run(string(tt.method), func(t *testing.T) {
+			username := fmt.Sprintf("lots_%s_%d", tt.method, time.Now().UnixNano())
+			user, err := userRepo.CreateUser(username, "hash")
+			if err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+			if err := marketService.SetCostBasisMethod(user.ID, tt.method); err != nil {
+				t.Fatalf("Failed to set cost basis method: %v", err)
+			}
+
+			// Buy two lots at different prices, then sell part of the holding higher up
+			for _, price := range []money.Money{100 * money.Dollar, 120 * money.Dollar} {
+				stockRepo.UpdateStockPrice(stock.ID, price)
+				if err := marketService.BuyStock(user.ID, stock.ID, 10); err != nil {
+					t.Fatalf("Failed to buy at %s: %v", price, err)
+				}
+			}
+			stockRepo.UpdateStockPrice(stock.ID, 150*money.Dollar)
+			if err := marketService.SellStock(user.ID, stock.ID, 5); err != nil {
+				t.Fatalf("Failed to sell: %v", err)
+			}
+
+			// Each lot's commission is spread over its 10 shares
+			buyFee := fees.Fee(10, 100*money.Dollar, 0) // The same for both buys with the default schedule
+			soldCost := 5*tt.costPerShare + buyFee.MulRate(0.5)
+			expectedRealized := 5*150*money.Dollar - fees.Fee(5, 150*money.Dollar, 0) - soldCost
+
+			summary, err := marketService.GetUserPortfolio(user.ID)
+			if err != nil {
+				t.Fatalf("Failed to get portfolio: %v", err)
+			}
+			if (summary.RealizedPnL - expectedRealized).Abs() > money.Cent {
+				t.Errorf("Expected realized P&L %s, got %s", expectedRealized, summary.RealizedPnL)
+			}
+
+			// What's left is everything bought minus what was sold
+			expectedBasis := 10*100*money.Dollar + 10*120*money.Dollar + 2*buyFee - soldCost
+			if (summary.CostBasis - expectedBasis).Abs() > money.Cent {
+				t.Errorf("Expected remaining cost basis %s, got %s", expectedBasis, summary.CostBasis)
+			}
+			if expectedUnrealized := 15*150*money.Dollar - expectedBasis; (summary.UnrealizedPnL - expectedUnrealized).Abs() > money.Cent {
+				t.Errorf("Expected unrealized P&L %s, got %s", expectedUnrealized, summary.UnrealizedPnL)
+			}
+		})
+	}
+}
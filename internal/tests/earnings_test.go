@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"officestonks/internal/repository"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestEarningsReaction(t *testing.T) {
+	cfg := market.EarningsConfig{Sensitivity: 0.5, MaxReaction: 0.15, DriftShare: 0.1}
+
+	tests := []struct {
+		name     string
+		surprise float64
+		expected float64
+	}{
+		{"In line", 0, 0},
+		{"Small beat", 0.1, 0.05},
+		{"Small miss", -0.06, -0.03},
+		{"Huge beat is capped", 1, 0.15},
+		{"Huge miss is capped", -2, -0.15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reaction := cfg.Reaction(tt.surprise); reaction != tt.expected {
+				t.Errorf("Expected a %.2f surprise to move the price %.4f, got %.4f", tt.surprise, tt.expected, reaction)
+			}
+		})
+	}
+
+	if err := (market.EarningsConfig{Sensitivity: -1, MaxReaction: 0.1}).Validate(); err == nil {
+		t.Errorf("Expected a negative sensitivity to be invalid")
+	}
+	if err := (market.EarningsConfig{Sensitivity: 1, MaxReaction: 1}).Validate(); err == nil {
+		t.Errorf("Expected a max reaction of 100%% to be invalid")
+	}
+}
+
+func TestSimulatorApplyEarnings(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	// A 10% beat lifts the price 5% with the default settings
+	reaction, err := sim.ApplyEarnings(1, 0.1)
+	if err != nil {
+		t.Fatalf("Failed to apply earnings: %v", err)
+	}
+	if reaction != 0.05 {
+		t.Errorf("Expected a 5%% reaction, got %.4f", reaction)
+	}
+	if update := <-sim.GetUpdateChannel(); update.StockID != 1 || update.Price != 105*money.Dollar {
+		t.Errorf("Expected an update for the new price of 105, got %+v", update)
+	}
+
+	// A miss is capped at the max reaction
+	if reaction, err := sim.ApplyEarnings(2, -1); err != nil || reaction != -0.15 {
+		t.Errorf("Expected a huge miss to be capped at -15%%, got %.4f (%v)", reaction, err)
+	}
+	if update := <-sim.GetUpdateChannel(); update.StockID != 2 || update.Price != money.FromFloat(42.5) {
+		t.Errorf("Expected an update for the new price of 42.50, got %+v", update)
+	}
+
+	// Results in line with expectations leave the price alone
+	if reaction, err := sim.ApplyEarnings(3, 0); err != nil || reaction != 0 {
+		t.Errorf("Expected no reaction to an in-line report, got %.4f (%v)", reaction, err)
+	}
+
+	if _, err := sim.ApplyEarnings(99, 0.1); err == nil {
+		t.Errorf("Expected earnings for an unknown stock to fail")
+	}
+	if err := sim.SetEarningsConfig(market.EarningsConfig{Sensitivity: 1, MaxReaction: -0.1}); err == nil {
+		t.Errorf("Expected an invalid earnings config to be rejected")
+	}
+}
+
+func TestFundamentalsAndEarnings(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	stockRepo := repository.NewStockRepo(TestDB)
+
+	stocks, err := stockRepo.GetAllStocks()
+	if err != nil || len(stocks) == 0 {
+		t.Fatalf("Failed to get stocks: %v", err)
+	}
+	stock := stocks[0]
+
+	// Fundamentals are made up the first time they're asked for, and kept after that
+	f, err := marketService.GetFundamentals(stock.ID)
+	if err != nil {
+		t.Fatalf("Failed to get fundamentals: %v", err)
+	}
+	if f.SharesOutstanding <= 0 || f.Revenue <= 0 || f.EPS == 0 {
+		t.Errorf("Expected plausible fundamentals, got %+v", f)
+	}
+	if f.MarketCap <= 0 || f.Price != stock.CurrentPrice.Float() {
+		t.Errorf("Expected the market cap to use the current price of %s, got %+v", stock.CurrentPrice, f)
+	}
+	if (f.EPS > 0) != (f.PERatio != nil) {
+		t.Errorf("Expected a P/E ratio only for a profitable company, got %+v", f)
+	}
+	again, err := marketService.GetFundamentals(stock.ID)
+	if err != nil || again.SharesOutstanding != f.SharesOutstanding {
+		t.Errorf("Expected the same fundamentals the second time, got %+v (%v)", again, err)
+	}
+
+	// Bring the next report forward and publish it
+	if _, err := TestDB.Exec("UPDATE stock_fundamentals SET next_earnings_at = ? WHERE stock_id = ?", time.Now().Add(-time.Second), stock.ID); err != nil {
+		t.Fatalf("Failed to bring earnings forward: %v", err)
+	}
+	marketService.ProcessEarnings()
+
+	reports, err := marketService.GetEarningsReports(stock.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get earnings reports: %v", err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("Expected one earnings report, got %d", len(reports))
+	}
+	year, quarter := f.NextQuarter()
+	if reports[0].FiscalYear != year || reports[0].FiscalQuarter != quarter {
+		t.Errorf("Expected a report for Q%d %d, got %+v", quarter, year, reports[0])
+	}
+
+	after, err := marketService.GetFundamentals(stock.ID)
+	if err != nil {
+		t.Fatalf("Failed to get fundamentals: %v", err)
+	}
+	if after.FiscalQuarter != quarter || !after.NextEarningsAt.After(time.Now()) {
+		t.Errorf("Expected the report to move the fundamentals on a quarter, got %+v", after)
+	}
+
+	// Nothing else is due, so checking again publishes nothing
+	marketService.ProcessEarnings()
+	if reports, err := marketService.GetEarningsReports(stock.ID, 10, 0); err != nil || len(reports) != 1 {
+		t.Errorf("Expected still one earnings report, got %d (%v)", len(reports), err)
+	}
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestETFReprice(t *testing.T) {
+	etf := &models.ETF{
+		Cash: 5 * money.Dollar,
+		Constituents: []*models.Constituent{
+			{StockID: 1, Units: 0.5, Price: 100 * money.Dollar},
+			{StockID: 2, Units: 2, Price: 20 * money.Dollar},
+		},
+	}
+
+	etf.Reprice(nil)
+	if etf.Price != 95*money.Dollar {
+		t.Errorf("Expected a NAV of 95.00, got %s", etf.Price)
+	}
+
+	// Only the constituents with new prices change
+	etf.Reprice(map[int]money.Money{1: 150 * money.Dollar})
+	if etf.Price != 120*money.Dollar {
+		t.Errorf("Expected a NAV of 120.00 after the first stock rose, got %s", etf.Price)
+	}
+	if etf.Constituents[0].Weight != 0.625 || etf.Constituents[1].Weight != 0.3333 {
+		t.Errorf("Expected weights of 0.625 and 0.3333, got %.4f and %.4f", etf.Constituents[0].Weight, etf.Constituents[1].Weight)
+	}
+}
+
+func TestETFTradingAndExposure(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+
+	suffix := time.Now().UnixNano() % 10000000
+	tech := &models.Stock{Symbol: fmt.Sprintf("T%d", suffix), Name: "Tech Co", Sector: "Technology", CurrentPrice: 50 * money.Dollar}
+	retail := &models.Stock{Symbol: fmt.Sprintf("R%d", suffix), Name: "Retail Co", Sector: "Retail", CurrentPrice: 25 * money.Dollar}
+	for _, stock := range []*models.Stock{tech, retail} {
+		if err := marketService.CreateListing(stock); err != nil {
+			t.Fatalf("Failed to list stock: %v", err)
+		}
+	}
+
+	// Three quarters tech, a quarter retail
+	etf, err := marketService.CreateETF(
+		&models.Stock{Symbol: fmt.Sprintf("E%d", suffix), Name: "Office Tech ETF"},
+		[]*models.Constituent{{StockID: tech.ID, Weight: 3}, {StockID: retail.ID, Weight: 1}},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create ETF: %v", err)
+	}
+	if etf.Price != 100*money.Dollar || etf.Sector != "ETF" {
+		t.Errorf("Expected the ETF to start at 100.00 in the ETF sector, got %s in %q", etf.Price, etf.Sector)
+	}
+	if _, err := marketService.CreateETF(
+		&models.Stock{Symbol: fmt.Sprintf("F%d", suffix), Name: "ETF of ETFs"},
+		[]*models.Constituent{{StockID: etf.ID, Weight: 1}},
+	); err == nil {
+		t.Errorf("Expected an ETF holding another ETF to be rejected")
+	}
+
+	// ETFs trade like any other stock
+	user, err := repository.NewUserRepo(TestDB).CreateUser(fmt.Sprintf("etf_%d", suffix), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := marketService.BuyStock(user.ID, etf.ID, 2); err != nil {
+		t.Fatalf("Failed to buy ETF: %v", err)
+	}
+	if err := marketService.BuyStock(user.ID, tech.ID, 1); err != nil {
+		t.Fatalf("Failed to buy stock: %v", err)
+	}
+
+	summary, err := marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+
+	exposures := make(map[int]*models.Exposure)
+	for _, exposure := range summary.Exposures {
+		exposures[exposure.StockID] = exposure
+	}
+	if e := exposures[tech.ID]; e == nil || e.Direct != 50*money.Dollar || (e.ViaETFs-150*money.Dollar).Abs() > 2*money.Cent {
+		t.Errorf("Expected 50.00 of tech held directly and 150.00 through the ETF, got %+v", e)
+	}
+	if e := exposures[retail.ID]; e == nil || e.Direct != 0 || (e.ViaETFs-50*money.Dollar).Abs() > 2*money.Cent {
+		t.Errorf("Expected 50.00 of retail through the ETF, got %+v", e)
+	}
+	if _, ok := exposures[etf.ID]; ok {
+		t.Errorf("Expected the ETF itself to be looked through")
+	}
+
+	sectors := make(map[string]float64)
+	for _, exposure := range summary.SectorExposures {
+		sectors[exposure.Sector] = exposure.Weight
+	}
+	if math.Abs(sectors["Technology"]-0.8) > 0.001 || math.Abs(sectors["Retail"]-0.2) > 0.001 {
+		t.Errorf("Expected 80%% technology and 20%% retail, got %v", sectors)
+	}
+}
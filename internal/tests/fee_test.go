@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"testing"
+
+	"officestonks/internal/models"
+	"officestonks/pkg/money"
+)
+
+func TestFeeSchedules(t *testing.T) {
+	tiered := &models.FeeSchedule{
+		Type: models.TieredFee,
+		Tiers: []models.FeeTier{
+			{MinVolume: 0, Percent: 0.2},
+			{MinVolume: 100000 * money.Dollar, Percent: 0.1},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		schedule *models.FeeSchedule
+		quantity float64
+		price    money.Money
+		volume   money.Money
+		expected money.Money
+	}{
+		{"flat", &models.FeeSchedule{Type: models.FlatFee, FlatFee: 495}, 10, 100 * money.Dollar, 0, 495},
+		{"per share", &models.FeeSchedule{Type: models.PerShareFee, PerShare: money.Cent}, 500, 10 * money.Dollar, 0, 5 * money.Dollar},
+		{"per share fractional", &models.FeeSchedule{Type: models.PerShareFee, PerShare: 2 * money.Cent}, 2.25, 10 * money.Dollar, 0, 5},
+		{"percentage", &models.FeeSchedule{Type: models.PercentageFee, Percent: 0.1}, 10, 150 * money.Dollar, 0, 150},
+		{"fractional shares", &models.FeeSchedule{Type: models.PercentageFee, Percent: 0.1}, 2.5, 800 * money.Dollar, 0, 2 * money.Dollar},
+		{"min fee", &models.FeeSchedule{Type: models.PercentageFee, Percent: 0.1, MinFee: money.Dollar}, 1, 50 * money.Dollar, 0, money.Dollar},
+		{"max fee", &models.FeeSchedule{Type: models.PerShareFee, PerShare: money.Cent, MaxFee: 5 * money.Dollar}, 1000, 10 * money.Dollar, 0, 5 * money.Dollar},
+		{"tiered low volume", tiered, 10, 100 * money.Dollar, 5000 * money.Dollar, 2 * money.Dollar},
+		{"tiered high volume", tiered, 10, 100 * money.Dollar, 250000 * money.Dollar, money.Dollar},
+		{"rounded to the cent", &models.FeeSchedule{Type: models.PercentageFee, Percent: 0.1}, 3, 3333, 0, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.Validate(); err != nil {
+				t.Fatalf("Expected schedule to be valid: %v", err)
+			}
+			fee := tt.schedule.Fee(tt.quantity, tt.price, tt.volume)
+			if fee != tt.expected {
+				t.Errorf("Expected fee %s, got %s", tt.expected, fee)
+			}
+		})
+	}
+
+	// Trades are free until an admin configures a schedule
+	if fee := models.DefaultFeeSchedule().Fee(100, 150*money.Dollar, 0); fee != 0 {
+		t.Errorf("Expected the default schedule to charge nothing, got %s", fee)
+	}
+
+	// Tiers must be in increasing order of volume
+	invalid := &models.FeeSchedule{Type: models.TieredFee, Tiers: []models.FeeTier{{MinVolume: 10 * money.Dollar}, {MinVolume: 5 * money.Dollar}}}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("Expected out-of-order tiers to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/internal/services"
+	"officestonks/pkg/money"
+)
+
+func TestFractionalConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		fraction float64
+		valid    bool
+	}{
+		{0.001, true},
+		{1, true},
+		{0.000001, true},
+		{0.0000001, false}, // Finer than the schema stores
+		{2, false},
+		{0, false},
+	} {
+		err := services.FractionalConfig{MinFraction: tt.fraction}.Validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%g) = %v, expected valid %v", tt.fraction, err, tt.valid)
+		}
+	}
+}
+
+func TestSimulatorFractionalVolume(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	// Fractions of a share move the price and count towards volume like whole shares
+	sim.ProcessTransaction(1, 0.5, true)
+	if update := <-sim.GetUpdateChannel(); update.Volume != 0.5 || update.Price <= 100*money.Dollar {
+		t.Errorf("Expected half a share bought to push the price up, got %+v", update)
+	}
+	sim.ProcessTransaction(1, 0.25, false)
+	<-sim.GetUpdateChannel()
+
+	stats := sim.GetVolumeStats(1)
+	if stats.Volume != 0.75 || math.Abs(stats.Imbalance-1.0/3) > 1e-9 {
+		t.Errorf("Expected 0.75 shares traded with an imbalance of 1/3, got %+v", stats)
+	}
+}
+
+func TestFractionalTrading(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	portfolioRepo := repository.NewPortfolioRepo(TestDB)
+
+	suffix := time.Now().UnixNano() % 10000000
+	stock := &models.Stock{Symbol: fmt.Sprintf("F%d", suffix), Name: "Fractional Inc.", Sector: "Technology", CurrentPrice: 2000 * money.Dollar}
+	if err := marketService.CreateListing(stock); err != nil {
+		t.Fatalf("Failed to list stock: %v", err)
+	}
+	user, err := repository.NewUserRepo(TestDB).CreateUser(fmt.Sprintf("fractional_%d", suffix), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Quantities have to be whole multiples of the minimum fraction
+	if err := marketService.BuyStock(user.ID, stock.ID, 0.0005); err == nil {
+		t.Errorf("Expected buying less than the minimum fraction to fail")
+	}
+	if err := marketService.BuyStock(user.ID, stock.ID, 1.25); err != nil {
+		t.Fatalf("Failed to buy fractional shares: %v", err)
+	}
+
+	// $500 buys a quarter of a share at 2000.00
+	bought, err := marketService.BuyStockAmount(user.ID, stock.ID, 500*money.Dollar)
+	if err != nil || bought != 0.25 {
+		t.Fatalf("Expected $500 to buy 0.25 shares, got %g (%v)", bought, err)
+	}
+	if _, err := marketService.BuyStockAmount(user.ID, stock.ID, money.Dollar); err == nil {
+		t.Errorf("Expected an amount worth less than the minimum fraction to fail")
+	}
+
+	if err := marketService.SellStock(user.ID, stock.ID, 0.3); err != nil {
+		t.Fatalf("Failed to sell fractional shares: %v", err)
+	}
+	if err := marketService.SellStock(user.ID, stock.ID, 1.201); err == nil {
+		t.Errorf("Expected selling more than the 1.2 shares held to fail")
+	}
+
+	holding, err := portfolioRepo.GetUserStockHolding(user.ID, stock.ID)
+	if err != nil || holding == nil || holding.Quantity != 1.2 {
+		t.Fatalf("Expected 1.2 shares left, got %+v (%v)", holding, err)
+	}
+
+	// The holding is valued, and its lots costed, by the fraction held
+	summary, err := marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+	price := summary.PortfolioItems[0].Stock.CurrentPrice
+	if item := summary.PortfolioItems[0]; item.MarketValue != price.Mul(1.2) || item.AverageCost < 2000 {
+		t.Errorf("Expected 1.2 shares worth %s costing at least 2000.00 each, got %+v", price.Mul(1.2), item)
+	}
+}
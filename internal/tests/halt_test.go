@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"officestonks/pkg/market"
+)
+
+// manualClock returns a time that tests move forward themselves
+type manualClock struct {
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time { return c.now }
+
+// drainHalts returns every halt and resume event the simulator has sent
+func drainHalts(sim *market.MarketSimulator) []market.HaltEvent {
+	var events []market.HaltEvent
+	for len(sim.GetHaltChannel()) > 0 {
+		events = append(events, <-sim.GetHaltChannel())
+	}
+	return events
+}
+
+// holdPrices keeps the given stocks' prices still so they can't break a band
+func holdPrices(t *testing.T, sim *market.MarketSimulator, ids ...int) {
+	for _, id := range ids {
+		if err := sim.SetStockParams(id, &market.ModelParams{Model: market.ModelGBM}); err != nil {
+			t.Fatalf("Failed to set stock params: %v", err)
+		}
+	}
+}
+
+func TestPriceBandsHaltStock(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+	sim := newSeededSimulator(42, clock)
+	sim.SetFactorConfig(market.FactorConfig{})
+	sim.SetHaltConfig(market.HaltConfig{BandPercent: 0.1, BandWindow: time.Hour, HaltDuration: 5 * time.Minute})
+	holdPrices(t, sim, 2, 3)
+
+	// A 50% jump is stopped at the top of the 10% band
+	if err := sim.SetStockParams(1, &market.ModelParams{Model: market.ModelGBM, Drift: 0.5}); err != nil {
+		t.Fatalf("Failed to set stock params: %v", err)
+	}
+
+	prices := make(map[int]float64)
+	for _, update := range stepAndCollect(sim, 1) {
+		prices[update.StockID] = update.Price.Float()
+	}
+	if prices[1] != 110 {
+		t.Errorf("Expected the price to stop at the band edge of 110, got %.2f", prices[1])
+	}
+
+	events := drainHalts(sim)
+	if len(events) != 1 || events[0].StockID != 1 || !events[0].Halted || events[0].Reason != market.HaltLimitUp {
+		t.Fatalf("Expected a limit up halt for stock 1, got %+v", events)
+	}
+	if expected := clock.now.Add(5 * time.Minute); !events[0].Until.Equal(expected) {
+		t.Errorf("Expected the halt to last until %v, got %v", expected, events[0].Until)
+	}
+
+	// The halted stock is frozen, even when it is traded
+	clock.now = clock.now.Add(time.Minute)
+	sim.ProcessTransaction(1, 1000, true)
+	for _, update := range stepAndCollect(sim, 3) {
+		if update.StockID == 1 {
+			t.Errorf("Expected no updates for a halted stock, got %+v", update)
+		}
+	}
+	if halt := sim.GetHalt(1); halt == nil || halt.Reason != market.HaltLimitUp {
+		t.Errorf("Expected stock 1 to still be halted, got %+v", halt)
+	}
+
+	// Once the halt runs out the stock trades again, with a new band around its price
+	clock.now = clock.now.Add(5 * time.Minute)
+	if halt := sim.GetHalt(1); halt != nil {
+		t.Errorf("Expected the halt to have run out, got %+v", halt)
+	}
+	prices = make(map[int]float64)
+	for _, update := range stepAndCollect(sim, 1) {
+		prices[update.StockID] = update.Price.Float()
+	}
+	if prices[1] != 121 {
+		t.Errorf("Expected the price to move to the new band edge of 121, got %.2f", prices[1])
+	}
+
+	events = drainHalts(sim)
+	if len(events) != 2 || events[0].Halted || !events[1].Halted {
+		t.Fatalf("Expected a resume then another halt, got %+v", events)
+	}
+}
+
+func TestCircuitBreakerHaltsMarket(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+	sim := newSeededSimulator(42, clock)
+	sim.SetFactorConfig(market.FactorConfig{})
+	sim.SetHaltConfig(market.HaltConfig{MarketDropPercent: 0.07, MarketWindow: 15 * time.Minute, MarketHaltDuration: 15 * time.Minute})
+
+	// Every stock falls 4% a tick
+	for id := 1; id <= 3; id++ {
+		if err := sim.SetStockParams(id, &market.ModelParams{Model: market.ModelGBM, Drift: -0.04}); err != nil {
+			t.Fatalf("Failed to set stock params: %v", err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		clock.now = clock.now.Add(time.Minute)
+		sim.Step()
+	}
+	if halts := sim.GetHalts(); len(halts) != 0 {
+		t.Fatalf("Expected no halts after a 4%% fall, got %+v", halts)
+	}
+
+	// The third fall takes the index more than 7% below its high
+	clock.now = clock.now.Add(time.Minute)
+	sim.Step()
+
+	halts := sim.GetHalts()
+	if len(halts) != 3 {
+		t.Fatalf("Expected every stock to be halted, got %+v", halts)
+	}
+	for id, halt := range halts {
+		if halt.Reason != market.HaltCircuitBreaker {
+			t.Errorf("Expected stock %d to be halted by the circuit breaker, got %q", id, halt.Reason)
+		}
+	}
+	if events := drainHalts(sim); len(events) != 3 {
+		t.Errorf("Expected 3 halt events, got %d", len(events))
+	}
+
+	// The market reopens when the halt runs out
+	clock.now = clock.now.Add(15 * time.Minute)
+	if halts := sim.GetHalts(); len(halts) != 0 {
+		t.Errorf("Expected the circuit breaker halt to have run out, got %+v", halts)
+	}
+}
+
+func TestManualHalt(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+	sim := newSeededSimulator(42, clock)
+
+	if err := sim.HaltStock(99, market.HaltAdmin, 0); err == nil {
+		t.Errorf("Expected halting an unknown stock to fail")
+	}
+	if err := sim.ResumeStock(1); err == nil {
+		t.Errorf("Expected resuming a stock that isn't halted to fail")
+	}
+
+	// A halt without a duration lasts until the stock is resumed
+	if err := sim.HaltStock(1, market.HaltAdmin, 0); err != nil {
+		t.Fatalf("Failed to halt stock: %v", err)
+	}
+	clock.now = clock.now.Add(24 * time.Hour)
+	for _, update := range stepAndCollect(sim, 5) {
+		if update.StockID == 1 {
+			t.Errorf("Expected no updates for a halted stock, got %+v", update)
+		}
+	}
+	if halt := sim.GetHalt(1); halt == nil || halt.Reason != market.HaltAdmin || !halt.Until.IsZero() {
+		t.Fatalf("Expected stock 1 to be halted by an admin indefinitely, got %+v", halt)
+	}
+
+	if err := sim.ResumeStock(1); err != nil {
+		t.Fatalf("Failed to resume stock: %v", err)
+	}
+	if halt := sim.GetHalt(1); halt != nil {
+		t.Errorf("Expected stock 1 to be trading, got %+v", halt)
+	}
+
+	events := drainHalts(sim)
+	if len(events) != 2 || !events[0].Halted || events[1].Halted {
+		t.Errorf("Expected a halt then a resume event, got %+v", events)
+	}
+}
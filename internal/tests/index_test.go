@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/internal/services"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestSectorIndexCode(t *testing.T) {
+	tests := []struct {
+		sector   string
+		expected string
+	}{
+		{"Technology", "TECHNOLOGY"},
+		{"Consumer Goods", "CONSUMER_GOODS"},
+		{" Oil & Gas ", "OIL_GAS"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sector, func(t *testing.T) {
+			if code := market.SectorIndexCode(tt.sector); code != tt.expected {
+				t.Errorf("Expected %q to have the code %q, got %q", tt.sector, tt.expected, code)
+			}
+		})
+	}
+}
+
+// indexLevel returns an index's current level from a simulator, or 0 if it has no such index
+func indexLevel(sim *market.MarketSimulator, code string) float64 {
+	for _, value := range sim.Indices() {
+		if value.Code == code {
+			return value.Value
+		}
+	}
+	return 0
+}
+
+func TestSimulatorIndices(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	// Every index starts at the base level, the composite first
+	indices := sim.Indices()
+	if len(indices) != 4 || indices[0].Code != market.CompositeIndexCode || indices[0].Members != 3 {
+		t.Fatalf("Expected the composite and three sector indices, got %+v", indices)
+	}
+	for _, index := range indices {
+		if index.Value != 1000 {
+			t.Errorf("Expected %s to start at 1000, got %.2f", index.Code, index.Value)
+		}
+	}
+
+	// A split, a new listing and a delisting don't move the market
+	if _, err := sim.ApplySplit(1, 2); err != nil {
+		t.Fatalf("Failed to apply split: %v", err)
+	}
+	sim.AddStock(4, "DDD", "Technology", 400*money.Dollar)
+	if _, err := sim.RemoveStock(2); err != nil {
+		t.Fatalf("Failed to remove stock: %v", err)
+	}
+	for _, code := range []string{market.CompositeIndexCode, "TECHNOLOGY", "HEALTHCARE"} {
+		if level := indexLevel(sim, code); math.Abs(level-1000) > 0.01 {
+			t.Errorf("Expected %s to stay at 1000, got %.2f", code, level)
+		}
+	}
+	if level := indexLevel(sim, "RETAIL"); level != 0 {
+		t.Errorf("Expected the index of an empty sector to go, got %.2f", level)
+	}
+
+	// A dividend does, since the indices track prices
+	if _, err := sim.ApplyDividend(3, 2*money.Dollar); err != nil {
+		t.Fatalf("Failed to apply dividend: %v", err)
+	}
+	if level := indexLevel(sim, "HEALTHCARE"); level != 900 {
+		t.Errorf("Expected a 10%% drop in the only healthcare stock to take its index to 900, got %.2f", level)
+	}
+
+	// Levels carry on from where they were left
+	if err := sim.SetIndexLevels(map[string]float64{market.CompositeIndexCode: 1500}); err != nil {
+		t.Fatalf("Failed to set index levels: %v", err)
+	}
+	if level := indexLevel(sim, market.CompositeIndexCode); level != 1500 {
+		t.Errorf("Expected the composite to carry on from 1500, got %.2f", level)
+	}
+	if err := sim.SetIndexLevels(map[string]float64{market.CompositeIndexCode: 0}); err == nil {
+		t.Errorf("Expected a zero index level to be rejected")
+	}
+
+	// Each tick sends every index's level
+	stepAndCollect(sim, 1)
+	select {
+	case values := <-sim.GetIndexChannel():
+		if len(values) != 3 || values[0].Code != market.CompositeIndexCode {
+			t.Errorf("Expected the composite and two sector indices after a tick, got %+v", values)
+		}
+	default:
+		t.Errorf("Expected index levels after a tick")
+	}
+}
+
+func TestIndexHistoryAndBenchmark(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	indexRepo := repository.NewIndexRepo(TestDB)
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	points := []*models.IndexPoint{
+		{Code: "TEST", Value: 1000, RecordedAt: start},
+		{Code: "TEST", Value: 1010, RecordedAt: start.Add(time.Minute)},
+		{Code: "TEST", Value: 990, RecordedAt: start.Add(2 * time.Minute)},
+	}
+	if err := indexRepo.SaveIndexPoints(points); err != nil {
+		t.Fatalf("Failed to save index points: %v", err)
+	}
+
+	// The level at a time is the last one recorded by then, or the first one after if there is none
+	for _, tt := range []struct {
+		at       time.Time
+		expected float64
+	}{
+		{start.Add(-time.Minute), 1000},
+		{start.Add(90 * time.Second), 1010},
+		{start.Add(time.Hour), 990},
+	} {
+		point, err := indexRepo.GetIndexLevelAt("TEST", tt.at)
+		if err != nil || point == nil || point.Value != tt.expected {
+			t.Errorf("Expected the level at %s to be %.2f, got %+v (%v)", tt.at, tt.expected, point, err)
+		}
+	}
+
+	history, err := indexRepo.GetIndexHistory("TEST", start, start.Add(time.Hour), 2)
+	if err != nil {
+		t.Fatalf("Failed to get index history: %v", err)
+	}
+	if len(history) != 2 || history[0].Value != 1010 || history[1].Value != 990 {
+		t.Errorf("Expected the latest two levels oldest first, got %+v", history)
+	}
+
+	levels, err := indexRepo.GetLatestIndexLevels()
+	if err != nil || levels["TEST"] != 990 {
+		t.Errorf("Expected the latest level to be 990, got %v (%v)", levels, err)
+	}
+
+	// Indices the market doesn't have can't be benchmarked against
+	marketService := SetupTestMarketService(TestDB)
+	if _, err := marketService.GetBenchmark(1, "NOPE"); err != services.ErrUnknownIndex {
+		t.Errorf("Expected an unknown index to fail, got %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package tests
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"officestonks/internal/repository"
+	"officestonks/pkg/money"
 )
 
 // TestUserRepositoryIntegration tests the user repository against a real database
@@ -33,8 +36,8 @@ func TestUserRepositoryIntegration(t *testing.T) {
 		if user.Username != username {
 			t.Errorf("Expected username %s, got %s", username, user.Username)
 		}
-		if user.CashBalance != 10000.0 {
-			t.Errorf("Expected initial cash balance 10000.0, got %f", user.CashBalance)
+		if user.CashBalance != 10000*money.Dollar {
+			t.Errorf("Expected initial cash balance 10000.00, got %s", user.CashBalance)
 		}
 	})
 
@@ -59,8 +62,8 @@ func TestUserRepositoryIntegration(t *testing.T) {
 		}
 	})
 
-	// Test UpdateUserBalance
-	t.Run("UpdateUserBalance", func(t *testing.T) {
+	// Test AdjustCashBalance, which is how balances are changed now they come from the ledger
+	t.Run("AdjustCashBalance", func(t *testing.T) {
 		// Get user by username first
 		user, err := userRepo.GetUserByUsername(username)
 		if err != nil {
@@ -68,8 +71,8 @@ func TestUserRepositoryIntegration(t *testing.T) {
 		}
 
 		// Update balance
-		newBalance := 5000.0
-		err = userRepo.UpdateUserBalance(user.ID, newBalance)
+		newBalance := 5000 * money.Dollar
+		_, err = SetupTestMarketService(TestDB).AdjustCashBalance(user.ID, newBalance, 0, "Integration test")
 		if err != nil {
 			t.Fatalf("Failed to update user balance: %v", err)
 		}
@@ -81,11 +84,68 @@ func TestUserRepositoryIntegration(t *testing.T) {
 		}
 
 		if updatedUser.CashBalance != newBalance {
-			t.Errorf("Expected updated cash balance %f, got %f", newBalance, updatedUser.CashBalance)
+			t.Errorf("Expected updated cash balance %s, got %s", newBalance, updatedUser.CashBalance)
 		}
 	})
 }
 
+// TestDeleteUser tests that a user who has traded can be deleted along with everything that refers to them
+func TestDeleteUser(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	userRepo := repository.NewUserRepo(TestDB)
+	user, err := userRepo.CreateUser(fmt.Sprintf("delete_%d", time.Now().UnixNano()), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+
+	insert := func(query string, args ...interface{}) int64 {
+		result, err := TestDB.Exec(query, args...)
+		if err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		return id
+	}
+
+	// A dividend the user is owed
+	actionID := insert("INSERT INTO corporate_actions (stock_id, action_type, amount, ex_date, status, source) VALUES (?, 'dividend', 1.00, NOW(), 'ex', 'admin')", stock.ID)
+	insert("INSERT INTO dividend_entitlements (action_id, user_id, quantity, amount) VALUES (?, ?, 5, 5.00)", actionID, user.ID)
+
+	// A subscription to an IPO, which needs a stock of its own
+	listingID := insert("INSERT INTO stocks (symbol, name, sector, current_price) VALUES (?, 'Delete Co', 'Technology', 10.00)", fmt.Sprintf("D%d", time.Now().UnixNano()%10000000))
+	ipoID := insert("INSERT INTO ipos (stock_id, float_shares, ipo_price, opens_at, closes_at) VALUES (?, 1000, 10.00, NOW(), NOW())", listingID)
+	insert("INSERT INTO ipo_subscriptions (ipo_id, user_id, quantity) VALUES (?, ?, 10)", ipoID, user.ID)
+
+	// Option contracts the user holds
+	contractID := insert("INSERT INTO option_contracts (stock_id, option_type, strike, shares, expires_at) VALUES (?, 'call', 10.00, 10, NOW())", listingID)
+	insert("INSERT INTO option_positions (user_id, contract_id, quantity, average_cost) VALUES (?, ?, 2, 5.00)", user.ID, contractID)
+
+	if err := userRepo.DeleteUser(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if _, err := userRepo.GetUserByID(user.ID); err == nil {
+		t.Errorf("Expected the user to be gone")
+	}
+
+	for _, table := range []string{"dividend_entitlements", "ipo_subscriptions", "option_positions", "ledger_entries"} {
+		var count int
+		if err := TestDB.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE user_id = ?", user.ID).Scan(&count); err != nil {
+			t.Fatalf("Failed to count %s: %v", table, err)
+		}
+		if count != 0 {
+			t.Errorf("Expected the user's %s to be deleted, %d left", table, count)
+		}
+	}
+}
+
 // TestStockRepositoryIntegration tests the stock repository against a real database
 func TestStockRepositoryIntegration(t *testing.T) {
 	// Skip if no test database connection
@@ -120,7 +180,7 @@ func TestStockRepositoryIntegration(t *testing.T) {
 				t.Error("Expected stock name, got empty string")
 			}
 			if stock.CurrentPrice <= 0 {
-				t.Errorf("Expected positive stock price, got %f", stock.CurrentPrice)
+				t.Errorf("Expected positive stock price, got %s", stock.CurrentPrice)
 			}
 		}
 	})
@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestLedgerTransfer(t *testing.T) {
+	entry := models.Transfer(models.CashAccount, models.FeeAccount, 150)
+	if entry.DebitAccount != models.FeeAccount || entry.CreditAccount != models.CashAccount || entry.Amount != 150 {
+		t.Errorf("Expected 1.50 to move from cash to fees, got %+v", entry)
+	}
+	if entry.Change(models.CashAccount) != -150 || entry.Change(models.FeeAccount) != 150 || entry.Change(models.LoanAccount) != 0 {
+		t.Errorf("Expected the fee to take 1.50 from cash only")
+	}
+
+	// A negative amount moves the other way, so amounts are always positive
+	entry = models.Transfer(models.CorporateActionAccount, models.CashAccount, -250)
+	if entry.DebitAccount != models.CorporateActionAccount || entry.CreditAccount != models.CashAccount || entry.Amount != 250 {
+		t.Errorf("Expected a dividend charge of 2.50 to move from cash, got %+v", entry)
+	}
+
+	// Borrowing adds to cash and to what is owed, which the loan account holds negated
+	entry = models.Transfer(models.LoanAccount, models.CashAccount, 10*money.Dollar)
+	if entry.Change(models.CashAccount) != 10*money.Dollar || entry.Change(models.LoanAccount) != -10*money.Dollar {
+		t.Errorf("Expected borrowing 10.00 to add it to cash and take it from the loan account, got %+v", entry)
+	}
+
+	balance := &models.LedgerBalance{CashBalance: 100, LedgerCash: 100, LoanBalance: 5, LedgerLoan: 5}
+	if !balance.Balanced() {
+		t.Errorf("Expected matching balances to be balanced")
+	}
+	balance.Escrow = 1
+	if balance.Balanced() {
+		t.Errorf("Expected escrow the ledger doesn't account for to be flagged")
+	}
+	balance.Escrow, balance.TransactionCash = 0, -1
+	if balance.Balanced() {
+		t.Errorf("Expected transactions the ledger doesn't account for to be flagged")
+	}
+}
+
+func TestTransactionCashFlow(t *testing.T) {
+	pnl := 6 * money.Dollar
+	tests := []struct {
+		transaction models.Transaction
+		expected    money.Money
+	}{
+		{models.Transaction{Quantity: 10, Price: 100 * money.Dollar, Fee: money.Dollar, TransactionType: models.Buy}, -1001 * money.Dollar},
+		{models.Transaction{Quantity: 4, Price: 110 * money.Dollar, Fee: money.Dollar, TransactionType: models.Sell}, 439 * money.Dollar},
+		{models.Transaction{Quantity: 5, Price: 50 * money.Dollar, Fee: money.Dollar, TransactionType: models.Short}, 249 * money.Dollar},
+		{models.Transaction{Quantity: 5, Price: 33, TransactionType: models.BorrowFee}, -165},
+		{models.Transaction{Quantity: 6, Price: 100 * money.Dollar, TransactionType: models.Dividend, RealizedPnL: &pnl}, 6 * money.Dollar},
+		{models.Transaction{Quantity: 12, Price: 55 * money.Dollar, TransactionType: models.StockSplit}, 0},
+		{models.Transaction{Price: 2750, TransactionType: models.CashInLieu}, 2750},
+		{models.Transaction{Price: 321, TransactionType: models.MarginInterest}, -321},
+		{models.Transaction{Quantity: 2, Price: 150 * money.Dollar, TransactionType: models.OptionSettle}, 300 * money.Dollar},
+	}
+
+	for _, tt := range tests {
+		if got := tt.transaction.CashFlow(); got != tt.expected {
+			t.Errorf("Expected a %s to move %s, got %s", tt.transaction.TransactionType, tt.expected, got)
+		}
+	}
+}
+
+func TestLedgerReconciliation(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+
+	user, err := userRepo.CreateUser(fmt.Sprintf("ledger_%d", time.Now().UnixNano()), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+
+	// Fractional trades, shorts and fees all have to add up to the cent
+	if err := marketService.BuyStock(user.ID, stock.ID, 3.333); err != nil {
+		t.Fatalf("Failed to buy stock: %v", err)
+	}
+	if err := marketService.SellStock(user.ID, stock.ID, 1.111); err != nil {
+		t.Fatalf("Failed to sell stock: %v", err)
+	}
+	if err := marketService.ShortStock(user.ID, stock.ID, 2); err != nil {
+		t.Fatalf("Failed to short stock: %v", err)
+	}
+	adjusted, err := marketService.AdjustCashBalance(user.ID, 5000*money.Dollar, 1, "Correction")
+	if err != nil {
+		t.Fatalf("Failed to adjust cash balance: %v", err)
+	}
+	if adjusted.CashBalance != 5000*money.Dollar {
+		t.Errorf("Expected the adjusted balance to be 5000.00, got %s", adjusted.CashBalance)
+	}
+
+	// The adjustment is the newest entry, with who made it and why
+	entries, err := marketService.GetUserLedger(user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get ledger: %v", err)
+	}
+	if len(entries) == 0 || entries[0].CreditAccount != models.AdjustmentAccount || entries[0].Memo != "Correction" ||
+		entries[0].CreatedBy == nil || *entries[0].CreatedBy != 1 {
+		t.Fatalf("Expected the newest entry to be the adjustment, got %+v", entries)
+	}
+	var cash money.Money
+	for _, entry := range entries {
+		cash += entry.Change(models.CashAccount)
+	}
+	if cash != adjusted.CashBalance {
+		t.Errorf("Expected the entries to add up to the cash balance %s, got %s", adjusted.CashBalance, cash)
+	}
+
+	flagged := func() *models.LedgerBalance {
+		reconciliation, err := marketService.ReconcileLedger()
+		if err != nil {
+			t.Fatalf("Failed to reconcile the ledger: %v", err)
+		}
+		for _, balance := range reconciliation.Flagged {
+			if balance.UserID == user.ID {
+				return balance
+			}
+		}
+		return nil
+	}
+	if balance := flagged(); balance != nil {
+		t.Errorf("Expected the user's balances to agree with their ledger, got %+v", balance)
+	}
+
+	// A balance changed behind the ledger's back is flagged
+	if _, err := TestDB.Exec("UPDATE users SET cash_balance = cash_balance + 0.01 WHERE id = ?", user.ID); err != nil {
+		t.Fatalf("Failed to update balance: %v", err)
+	}
+	balance := flagged()
+	if balance == nil || balance.CashBalance-balance.LedgerCash != money.Cent {
+		t.Errorf("Expected the user to be flagged with a difference of 0.01, got %+v", balance)
+	}
+
+	if _, err := TestDB.Exec("UPDATE users SET cash_balance = cash_balance - 0.01 WHERE id = ?", user.ID); err != nil {
+		t.Fatalf("Failed to update balance: %v", err)
+	}
+
+	// So is a transaction that disagrees with the ledger entries posted for it
+	transactions, err := repository.NewTransactionRepo(TestDB).GetUserTransactions(user.ID, 1, 0)
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("Failed to get the latest transaction: %v", err)
+	}
+	if _, err := TestDB.Exec("UPDATE transactions SET fee = fee + 0.01 WHERE id = ?", transactions[0].ID); err != nil {
+		t.Fatalf("Failed to update transaction: %v", err)
+	}
+	balance = flagged()
+	if balance == nil || balance.CashBalance != balance.LedgerCash || balance.TransactionCash-balance.LedgerTransactionCash != -money.Cent {
+		t.Errorf("Expected the user to be flagged with transactions 0.01 short of the ledger, got %+v", balance)
+	}
+}
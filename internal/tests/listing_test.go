@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestSimulatorRemoveStock(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	price, err := sim.RemoveStock(2)
+	if err != nil {
+		t.Fatalf("Failed to remove stock: %v", err)
+	}
+	if price != 50*money.Dollar {
+		t.Errorf("Expected the removed stock's last price to be 50, got %s", price)
+	}
+	if _, err := sim.RemoveStock(2); err == nil {
+		t.Errorf("Expected removing a stock twice to fail")
+	}
+	if err := sim.SetStockSector(2, "Technology"); err == nil {
+		t.Errorf("Expected moving a removed stock into a sector to fail")
+	}
+
+	// A removed stock gets no more price updates; a stock added later does
+	sim.AddStock(4, "DDD", "Energy", 10*money.Dollar)
+	seen := map[int]bool{}
+	for _, update := range stepAndCollect(sim, 5) {
+		seen[update.StockID] = true
+	}
+	if seen[2] {
+		t.Errorf("Expected no updates for the removed stock")
+	}
+	if !seen[4] {
+		t.Errorf("Expected updates for the stock added while running")
+	}
+}
+
+func TestIPOAndDelisting(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+	portfolioRepo := repository.NewPortfolioRepo(TestDB)
+
+	suffix := time.Now().UnixNano()
+	early, err := userRepo.CreateUser(fmt.Sprintf("ipo_early_%d", suffix), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	late, err := userRepo.CreateUser(fmt.Sprintf("ipo_late_%d", suffix), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stock := &models.Stock{Symbol: fmt.Sprintf("I%d", suffix%100000000), Name: "Initial Offering Inc.", Sector: "Technology"}
+	ipo := &models.IPO{Float: 10, Price: 20 * money.Dollar}
+	if err := marketService.CreateIPO(stock, ipo); err != nil {
+		t.Fatalf("Failed to create IPO: %v", err)
+	}
+
+	// Requests hold their cost back; the IPO is oversubscribed 15 shares to 10
+	if _, err := marketService.SubscribeToIPO(early.ID, ipo.ID, 11); err == nil {
+		t.Errorf("Expected requesting more than the float to fail")
+	}
+	if _, err := marketService.SubscribeToIPO(early.ID, ipo.ID, 10); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if _, err := marketService.SubscribeToIPO(late.ID, ipo.ID, 5); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	escrowed, err := userRepo.GetUserByID(early.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if escrowed.CashBalance != early.CashBalance-200*money.Dollar {
+		t.Errorf("Expected 200.00 to be held back for 10 shares, cash is %s", escrowed.CashBalance)
+	}
+
+	// The stock can't trade until the IPO is allocated
+	if err := marketService.BuyStock(early.ID, stock.ID, 1); err == nil {
+		t.Errorf("Expected buying a stock before it lists to fail")
+	}
+
+	// Close the subscription window and allocate
+	if _, err := TestDB.Exec("UPDATE ipos SET closes_at = ? WHERE id = ?", time.Now().Add(-time.Second), ipo.ID); err != nil {
+		t.Fatalf("Failed to close IPO: %v", err)
+	}
+	marketService.ProcessIPOs()
+
+	// 10 and 5 shares scaled to 6.67 and 3.33; the spare share goes to the larger remainder
+	for _, tt := range []struct {
+		user      *models.User
+		allocated int
+		refunded  money.Money
+	}{
+		{early, 7, 60 * money.Dollar},
+		{late, 3, 40 * money.Dollar},
+	} {
+		holding, err := portfolioRepo.GetUserStockHolding(tt.user.ID, stock.ID)
+		if err != nil || holding == nil || holding.Quantity != float64(tt.allocated) {
+			t.Errorf("Expected user %d to be allocated %d shares, got %+v (%v)", tt.user.ID, tt.allocated, holding, err)
+		}
+		user, err := userRepo.GetUserByID(tt.user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		expected := tt.user.CashBalance - 20*money.Dollar*money.Money(tt.allocated)
+		if user.CashBalance != expected {
+			t.Errorf("Expected user %d to be refunded %s, leaving %s, got %s", tt.user.ID, tt.refunded, expected, user.CashBalance)
+		}
+	}
+
+	listed, err := repository.NewStockRepo(TestDB).GetStockByID(stock.ID)
+	if err != nil || listed.Status != models.StockListed {
+		t.Fatalf("Expected the stock to be listed after allocation, got %+v (%v)", listed, err)
+	}
+
+	// Delisting cashes holders out at the last price
+	if err := repository.NewStockRepo(TestDB).UpdateStockPrice(stock.ID, 25*money.Dollar); err != nil {
+		t.Fatalf("Failed to set price: %v", err)
+	}
+	before, err := userRepo.GetUserByID(early.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if _, err := marketService.DelistStock(stock.ID); err != nil {
+		t.Fatalf("Failed to delist stock: %v", err)
+	}
+
+	after, err := userRepo.GetUserByID(early.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	if after.CashBalance != before.CashBalance+7*25*money.Dollar {
+		t.Errorf("Expected 7 shares to be cashed out for 175.00, cash went from %s to %s", before.CashBalance, after.CashBalance)
+	}
+	if holding, err := portfolioRepo.GetUserStockHolding(early.ID, stock.ID); err != nil || holding != nil {
+		t.Errorf("Expected the holding to be closed, got %+v (%v)", holding, err)
+	}
+	if err := marketService.BuyStock(early.ID, stock.ID, 1); err == nil {
+		t.Errorf("Expected buying a delisted stock to fail")
+	}
+	if _, err := marketService.DelistStock(stock.ID); err == nil {
+		t.Errorf("Expected delisting a stock twice to fail")
+	}
+}
@@ -89,7 +89,7 @@ func clearTestData() error {
 	}
 
 	// Truncate tables
-	tables := []string{"transactions", "portfolios", "users", "stocks"}
+	tables := []string{"ledger_entries", "option_positions", "option_contracts", "etf_constituents", "etfs", "index_history", "earnings_reports", "stock_fundamentals", "ipo_subscriptions", "ipos", "dividend_entitlements", "corporate_actions", "orders", "tax_lots", "short_positions", "transactions", "fee_schedules", "market_events", "sector_models", "simulator_snapshots", "price_candles", "price_ticks", "portfolios", "users", "stocks"}
 	for _, table := range tables {
 		_, err := TestDB.Exec(fmt.Sprintf("TRUNCATE TABLE %s", table))
 		if err != nil {
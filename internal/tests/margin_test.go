@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+)
+
+func TestMarginBuyBorrowsAndSellRepays(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+
+	username := fmt.Sprintf("margin_%d", time.Now().UnixNano())
+	user, err := userRepo.CreateUser(username, "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+
+	// Buy more than the cash balance covers but within 2x leverage
+	quantity := math.Floor(1.5 * user.CashBalance.Float() / stock.CurrentPrice.Float())
+	fee := models.DefaultFeeSchedule().Fee(quantity, stock.CurrentPrice, 0)
+	cost := stock.CurrentPrice.Mul(quantity) + fee
+	if err := marketService.BuyStock(user.ID, stock.ID, quantity); err == nil {
+		t.Fatalf("Expected buying on credit to fail without a margin account")
+	}
+
+	if err := marketService.SetMarginAccount(user.ID, true); err != nil {
+		t.Fatalf("Failed to enable margin: %v", err)
+	}
+	if err := marketService.BuyStock(user.ID, stock.ID, quantity); err != nil {
+		t.Fatalf("Failed to buy on margin: %v", err)
+	}
+
+	summary, err := marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+	if summary.CashBalance != 0 || summary.LoanBalance != cost-user.CashBalance {
+		t.Errorf("Expected the shortfall to be borrowed, got cash %s and loan %s", summary.CashBalance, summary.LoanBalance)
+	}
+	if summary.TotalValue != user.CashBalance-fee {
+		t.Errorf("Expected net equity to drop by the commission to %s, got %s", user.CashBalance-fee, summary.TotalValue)
+	}
+
+	// The loan has to be repaid before the account can be closed
+	if err := marketService.SetMarginAccount(user.ID, false); err == nil {
+		t.Errorf("Expected closing a margin account with a loan to fail")
+	}
+
+	// Selling everything repays the loan first
+	if err := marketService.SellStock(user.ID, stock.ID, quantity); err != nil {
+		t.Fatalf("Failed to sell: %v", err)
+	}
+	updated, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if updated.LoanBalance != 0 || updated.CashBalance != user.CashBalance-2*fee {
+		t.Errorf("Expected the loan to be repaid, got cash %s and loan %s", updated.CashBalance, updated.LoanBalance)
+	}
+}
@@ -49,7 +49,7 @@ func TestGetAllStocks(t *testing.T) {
 			t.Error("Expected stock name, got empty string")
 		}
 		if stock.CurrentPrice <= 0 {
-			t.Errorf("Expected positive stock price, got %f", stock.CurrentPrice)
+			t.Errorf("Expected positive stock price, got %s", stock.CurrentPrice)
 		}
 	}
 }
@@ -120,7 +120,7 @@ func TestGetStockByID(t *testing.T) {
 					t.Error("Expected stock name, got empty string")
 				}
 				if stock.CurrentPrice <= 0 {
-					t.Errorf("Expected positive stock price, got %f", stock.CurrentPrice)
+					t.Errorf("Expected positive stock price, got %s", stock.CurrentPrice)
 				}
 			}
 		})
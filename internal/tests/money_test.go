@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"officestonks/pkg/money"
+)
+
+func TestMoneyParse(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		expected money.Money
+	}{
+		{"12.34", 1234},
+		{"10", 1000},
+		{".5", 50},
+		{"-0.5", -50},
+		{"1.005", 101}, // Halves round away from zero
+		{"1.0049", 100},
+		{"-1.005", -101},
+		{"+2.50", 250},
+		{"1e3", 100000},
+	} {
+		if m, err := money.Parse(tt.input); err != nil || m != tt.expected {
+			t.Errorf("Parse(%q) = %d (%v), expected %d", tt.input, m, err, tt.expected)
+		}
+	}
+
+	for _, input := range []string{"", "abc", "1.2.3", "-", "NaN"} {
+		if _, err := money.Parse(input); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", input)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	// Floats are rounded as they read, not as they are stored
+	if m := money.FromFloat(1.005); m != 101 {
+		t.Errorf("Expected 1.005 to round up to 1.01, got %s", m)
+	}
+	if m := money.FromFloat(0.1 + 0.2); m != 30 {
+		t.Errorf("Expected 0.1 + 0.2 to be 0.30, got %s", m)
+	}
+
+	// Adding up cents doesn't drift the way adding up floats does
+	var total money.Money
+	for i := 0; i < 10; i++ {
+		total += money.FromFloat(0.1)
+	}
+	if total != money.Dollar {
+		t.Errorf("Expected ten dimes to make a dollar, got %s", total)
+	}
+
+	for _, tt := range []struct {
+		price    money.Money
+		quantity float64
+		expected money.Money
+	}{
+		{money.FromFloat(33.33), 3, money.FromFloat(99.99)},
+		{money.FromFloat(2000), 1.2, 2400 * money.Dollar},
+		{money.FromFloat(19.99), 0.333333, money.FromFloat(6.66)},
+		{money.Cent, 0.5, money.Cent}, // Half a cent rounds away from zero
+		{-money.Cent, 0.5, -money.Cent},
+		{money.Cent, 0.499999, 0},
+		{money.FromFloat(123456789.01), 1000, money.FromFloat(123456789010)},
+	} {
+		if value := tt.price.Mul(tt.quantity); value != tt.expected {
+			t.Errorf("Expected %g shares at %s to be worth %s, got %s", tt.quantity, tt.price, tt.expected, value)
+		}
+	}
+
+	if fee := money.FromFloat(99.99).MulRate(0.001); fee != 10 {
+		t.Errorf("Expected 0.1%% of 99.99 to be 0.10, got %s", fee)
+	}
+	if money.Min(money.Dollar, money.Cent) != money.Cent || money.Max(money.Dollar, money.Cent) != money.Dollar || (-money.Dollar).Abs() != money.Dollar {
+		t.Errorf("Expected Min, Max and Abs to pick the right amounts")
+	}
+}
+
+func TestMoneyEncoding(t *testing.T) {
+	for m, expected := range map[money.Money]string{-1230: "-12.30", 5: "0.05", -5: "-0.05", 0: "0.00", 100000: "1000.00"} {
+		if s := m.String(); s != expected {
+			t.Errorf("Expected %d cents to format as %s, got %s", int64(m), expected, s)
+		}
+	}
+
+	var body struct {
+		Cash  money.Money `json:"cash"`
+		Price money.Money `json:"price"`
+		Limit money.Money `json:"limit"`
+	}
+	body.Limit = 7
+	if err := json.Unmarshal([]byte(`{"cash": 12.3, "price": "45.675", "limit": null}`), &body); err != nil {
+		t.Fatalf("Failed to decode amounts: %v", err)
+	}
+	if body.Cash != 1230 || body.Price != 4568 || body.Limit != 7 {
+		t.Errorf("Expected 12.30, 45.68 and the limit left alone, got %+v", body)
+	}
+	if err := json.Unmarshal([]byte(`{"cash": true}`), &body); err == nil {
+		t.Errorf("Expected a boolean amount to be rejected")
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil || string(encoded) != `{"cash":12.30,"price":45.68,"limit":0.07}` {
+		t.Errorf("Expected amounts to encode as numbers with two decimal places, got %s (%v)", encoded, err)
+	}
+
+	// DECIMAL columns come back as bytes; arithmetic on them may come back as other types
+	var m money.Money
+	for src, expected := range map[interface{}]money.Money{"12.34": 1234, float64(0.1): 10, int64(3): 300} {
+		if err := m.Scan(src); err != nil || m != expected {
+			t.Errorf("Scan(%v) = %s (%v), expected %s", src, m, err, expected)
+		}
+	}
+	if err := m.Scan([]byte("-0.01")); err != nil || m != -money.Cent {
+		t.Errorf("Expected to scan -0.01 from bytes, got %s (%v)", m, err)
+	}
+	if err := m.Scan(nil); err == nil {
+		t.Errorf("Expected NULL to need a NullMoney")
+	}
+	var n money.NullMoney
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("Expected NULL to scan as an invalid NullMoney, got %+v (%v)", n, err)
+	}
+	if v, err := money.FromFloat(9.5).Value(); err != nil || v != "9.50" {
+		t.Errorf("Expected 9.50 to be stored as a decimal string, got %v (%v)", v, err)
+	}
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestMarketEvents(t *testing.T) {
+	sim := market.NewMarketSimulator(time.Second, 0.05)
+	sim.SetSeed(1)
+	sim.AddStock(1, "PFE", "Healthcare", 40*money.Dollar)
+	sim.AddStock(2, "JNJ", "Healthcare", 160*money.Dollar)
+	sim.AddStock(3, "WMT", "Retail", 145*money.Dollar)
+
+	// A sector event shocks every stock in the sector and nothing else
+	affected, err := sim.ApplyEvent(market.Event{
+		Scope:       market.ScopeSector,
+		Sector:      "Healthcare",
+		Headline:    "Healthcare sector sells off",
+		PriceImpact: -0.1,
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply event: %v", err)
+	}
+	if affected != 2 {
+		t.Errorf("Expected 2 stocks to be affected, got %d", affected)
+	}
+
+	prices := make(map[int]float64)
+	for len(sim.GetUpdateChannel()) > 0 {
+		update := <-sim.GetUpdateChannel()
+		prices[update.StockID] = update.Price.Float()
+	}
+	if prices[1] != 36 || prices[2] != 144 {
+		t.Errorf("Expected healthcare prices of 36 and 144, got %.2f and %.2f", prices[1], prices[2])
+	}
+	if _, ok := prices[3]; ok {
+		t.Errorf("Expected the retail stock not to move")
+	}
+
+	// Events need a target that exists and a plausible impact
+	for _, invalid := range []market.Event{
+		{Scope: market.ScopeStock, StockID: 99, Headline: "Unknown stock soars", PriceImpact: 0.1},
+		{Scope: market.ScopeSector, Sector: "Mining", Headline: "Mining rallies", PriceImpact: 0.1},
+		{Scope: market.ScopeMarket, Headline: "Everything goes to zero", PriceImpact: -1},
+		{Scope: market.ScopeMarket, PriceImpact: 0.01},
+	} {
+		if _, err := sim.ApplyEvent(invalid); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+
+	// Generated news is valid and repeats for the same seed
+	other := market.NewMarketSimulator(time.Second, 0.05)
+	other.AddStock(1, "PFE", "Healthcare", 40*money.Dollar)
+	other.AddStock(2, "JNJ", "Healthcare", 160*money.Dollar)
+	other.AddStock(3, "WMT", "Retail", 145*money.Dollar)
+	sim.SetSeed(99)
+	other.SetSeed(99)
+	for i := 0; i < 20; i++ {
+		event, ok := sim.RandomEvent(1)
+		otherEvent, otherOk := other.RandomEvent(1)
+		if !ok || !otherOk {
+			t.Fatalf("Expected news with a chance of 1")
+		}
+		if event != otherEvent {
+			t.Fatalf("Expected the same news for the same seed, got %+v and %+v", event, otherEvent)
+		}
+		if err := event.Validate(); err != nil {
+			t.Errorf("Generated event %+v is invalid: %v", event, err)
+		}
+		if math.Signbit(event.PriceImpact) != math.Signbit(event.TrendImpact) && event.TrendImpact != 0 {
+			t.Errorf("Expected the trend to follow the price move, got %+v", event)
+		}
+	}
+	if _, ok := sim.RandomEvent(0); ok {
+		t.Errorf("Expected no news with a chance of 0")
+	}
+}
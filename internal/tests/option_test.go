@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/internal/services"
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestBlackScholes(t *testing.T) {
+	call := market.BlackScholes(true, 100, 100, 1, 0.05, 0.2)
+	put := market.BlackScholes(false, 100, 100, 1, 0.05, 0.2)
+
+	if math.Abs(call.Price-10.4506) > 0.0001 || math.Abs(put.Price-5.5735) > 0.0001 {
+		t.Errorf("Expected a call at 10.4506 and a put at 5.5735, got %.4f and %.4f", call.Price, put.Price)
+	}
+	if math.Abs(call.Delta-0.6368) > 0.0001 || math.Abs(put.Delta+0.3632) > 0.0001 {
+		t.Errorf("Expected deltas of 0.6368 and -0.3632, got %.4f and %.4f", call.Delta, put.Delta)
+	}
+	if call.Gamma != put.Gamma || call.Vega != put.Vega || call.Theta >= 0 {
+		t.Errorf("Expected calls and puts to share gamma and vega and to lose value over time, got %+v and %+v", call, put)
+	}
+
+	// Put-call parity: C - P = S - K e^(-rT)
+	if parity := call.Price - put.Price - (100 - 100*math.Exp(-0.05)); math.Abs(parity) > 1e-9 {
+		t.Errorf("Expected put-call parity to hold, off by %g", parity)
+	}
+
+	// At expiry an option is worth what it pays out
+	if quote := market.BlackScholes(true, 120, 100, 0, 0.05, 0.2); quote.Price != 20 || quote.Delta != 1 {
+		t.Errorf("Expected an expired call 20.00 in the money to be worth 20.00, got %+v", quote)
+	}
+	if quote := market.BlackScholes(false, 120, 100, 0, 0.05, 0.2); quote.Price != 0 {
+		t.Errorf("Expected an expired put out of the money to be worthless, got %+v", quote)
+	}
+}
+
+func TestSimulatorVolatility(t *testing.T) {
+	sim := newSeededSimulator(1, fixedClock{time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)})
+
+	before, err := sim.Volatility(1)
+	if err != nil || before < 0.1 || before > 1.5 {
+		t.Fatalf("Expected a plausible volatility from the price model before any ticks, got %.4f (%v)", before, err)
+	}
+
+	stepAndCollect(sim, 50)
+	volatility, err := sim.Volatility(1)
+	if err != nil || volatility < 0.1 || volatility > 1.5 || volatility == before {
+		t.Fatalf("Expected a plausible volatility following the price moves, got %.4f then %.4f (%v)", before, volatility, err)
+	}
+
+	// A short-dated at-the-money option is worth a few percent of the stock, not most of it
+	const spot = 150.0
+	years := market.YearsUntil(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC))
+	for _, isCall := range []bool{true, false} {
+		quote := market.BlackScholes(isCall, spot, spot, years, 0.05, volatility)
+		if quote.Price < 0.005*spot || quote.Price > 0.05*spot {
+			t.Errorf("Expected a 1-day at-the-money option (call %v) on a %.2f stock to cost a few percent of it, got %.2f at volatility %.4f",
+				isCall, spot, quote.Price, volatility)
+		}
+	}
+
+	if _, err := sim.Volatility(99); err == nil {
+		t.Errorf("Expected the volatility of an unknown stock to fail")
+	}
+}
+
+func TestOptionTradingAndExercise(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+	stockRepo := repository.NewStockRepo(TestDB)
+
+	suffix := time.Now().UnixNano() % 10000000
+	stock := &models.Stock{Symbol: fmt.Sprintf("O%d", suffix), Name: "Optionable Inc.", Sector: "Technology", CurrentPrice: 100 * money.Dollar}
+	if err := marketService.CreateListing(stock); err != nil {
+		t.Fatalf("Failed to list stock: %v", err)
+	}
+	user, err := userRepo.CreateUser(fmt.Sprintf("options_%d", suffix), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Listing puts calls and puts around the money on every expiry
+	marketService.ProcessOptions()
+	chain, err := marketService.GetOptionChain(stock.ID)
+	if err != nil {
+		t.Fatalf("Failed to get option chain: %v", err)
+	}
+	defaults := services.DefaultOptionsConfig()
+	if expected := defaults.Expiries * (2*defaults.Strikes + 1) * 2; len(chain.Contracts) != expected {
+		t.Fatalf("Expected %d contracts, got %d", expected, len(chain.Contracts))
+	}
+
+	var call *models.OptionContract
+	for _, contract := range chain.Contracts {
+		if contract.Type == models.CallOption && contract.Strike == 100*money.Dollar {
+			call = contract
+			break
+		}
+	}
+	if call == nil || call.Premium <= 0 || call.Greeks == nil || call.Greeks.Delta <= 0 {
+		t.Fatalf("Expected a priced at-the-money call, got %+v", call)
+	}
+
+	// Buy two contracts to open and sell one to close
+	if err := marketService.BuyOption(user.ID, call.ID, 2); err != nil {
+		t.Fatalf("Failed to buy option: %v", err)
+	}
+	if err := marketService.SellOption(user.ID, call.ID, 3); err == nil {
+		t.Errorf("Expected selling more contracts than held to fail")
+	}
+	if err := marketService.SellOption(user.ID, call.ID, 1); err != nil {
+		t.Fatalf("Failed to sell option: %v", err)
+	}
+
+	summary, err := marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+	if len(summary.OptionPositions) != 1 || summary.OptionPositions[0].Quantity != 1 || summary.OptionValue <= 0 {
+		t.Fatalf("Expected one call contract left, got %+v", summary.OptionPositions)
+	}
+
+	// The stock finishes 20.00 in the money, so the call is exercised and the shares bought at the strike
+	if err := stockRepo.UpdateStockPrice(stock.ID, 120*money.Dollar); err != nil {
+		t.Fatalf("Failed to set price: %v", err)
+	}
+	if _, err := TestDB.Exec("UPDATE option_contracts SET expires_at = ? WHERE id = ?", time.Now().Add(-time.Second), call.ID); err != nil {
+		t.Fatalf("Failed to expire contract: %v", err)
+	}
+	before, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	marketService.ProcessOptions()
+
+	after, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	shares := call.Shares
+	if cost := 100 * money.Dollar * money.Money(shares); before.CashBalance-after.CashBalance != cost {
+		t.Errorf("Expected %d shares to cost %s at the strike, cash went from %s to %s", shares, cost, before.CashBalance, after.CashBalance)
+	}
+	holding, err := repository.NewPortfolioRepo(TestDB).GetUserStockHolding(user.ID, stock.ID)
+	if err != nil || holding == nil || holding.Quantity != float64(shares) {
+		t.Errorf("Expected %d shares from the exercise, got %+v (%v)", shares, holding, err)
+	}
+
+	settled, err := repository.NewOptionRepo(TestDB).GetContractByID(call.ID)
+	if err != nil || settled.Status != models.OptionExpired || settled.SettlementPrice == nil || *settled.SettlementPrice != 120*money.Dollar {
+		t.Errorf("Expected the contract to be settled at 120.00, got %+v (%v)", settled, err)
+	}
+	if err := marketService.BuyOption(user.ID, call.ID, 1); err == nil {
+		t.Errorf("Expected buying an expired contract to fail")
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"testing"
+
+	"officestonks/internal/models"
+	"officestonks/internal/services"
+	"officestonks/pkg/money"
+)
+
+func TestLimitOrderCrossing(t *testing.T) {
+	limit := 100 * money.Dollar
+
+	tests := []struct {
+		name     string
+		side     models.TransactionType
+		price    money.Money
+		expected bool
+	}{
+		{"buy above limit", models.Buy, limit + money.Cent, false},
+		{"buy at limit", models.Buy, limit, true},
+		{"buy below limit", models.Buy, limit - money.Cent, true},
+		{"sell below limit", models.Sell, limit - money.Cent, false},
+		{"sell at limit", models.Sell, limit, true},
+		{"sell above limit", models.Sell, limit + money.Cent, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{OrderType: models.LimitOrder, Side: tt.side, LimitPrice: limit}
+			if crossed := order.LimitCrossed(tt.price); crossed != tt.expected {
+				t.Errorf("Expected crossed %v at %s, got %v", tt.expected, tt.price, crossed)
+			}
+		})
+	}
+}
+
+func TestTrailingStopPrice(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    models.Order
+		expected money.Money
+	}{
+		{"trail amount", models.Order{HighWaterMark: 150 * money.Dollar, TrailAmount: 5 * money.Dollar}, 145 * money.Dollar},
+		{"trail percent", models.Order{HighWaterMark: 150 * money.Dollar, TrailPercent: 10}, 135 * money.Dollar},
+		{"percent rounded to the cent", models.Order{HighWaterMark: 3333, TrailPercent: 5}, 3166},
+		{"percent wins over amount", models.Order{HighWaterMark: 100 * money.Dollar, TrailAmount: money.Dollar, TrailPercent: 20}, 80 * money.Dollar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if price := tt.order.TrailingStopPrice(); price != tt.expected {
+				t.Errorf("Expected stop price %s, got %s", tt.expected, price)
+			}
+		})
+	}
+}
+
+func TestConditionalOrderTriggers(t *testing.T) {
+	stop := 100 * money.Dollar
+
+	tests := []struct {
+		name      string
+		orderType models.OrderType
+		price     money.Money
+		expected  bool
+	}{
+		{"stop loss above stop", models.StopLossOrder, stop + money.Cent, false},
+		{"stop loss at stop", models.StopLossOrder, stop, true},
+		{"stop loss below stop", models.StopLossOrder, stop - money.Cent, true},
+		{"take profit below target", models.TakeProfitOrder, stop - money.Cent, false},
+		{"take profit at target", models.TakeProfitOrder, stop, true},
+		{"take profit above target", models.TakeProfitOrder, stop + money.Cent, true},
+		{"trailing stop above stop", models.TrailingStopOrder, stop + money.Cent, false},
+		{"trailing stop at stop", models.TrailingStopOrder, stop, true},
+		{"trailing stop below stop", models.TrailingStopOrder, stop - money.Cent, true},
+		{"limit orders never trigger", models.LimitOrder, stop - money.Cent, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{OrderType: tt.orderType, StopPrice: stop}
+			if triggered := order.Triggered(tt.price); triggered != tt.expected {
+				t.Errorf("Expected triggered %v at %s, got %v", tt.expected, tt.price, triggered)
+			}
+		})
+	}
+}
+
+func TestTrailingStopRatchet(t *testing.T) {
+	order := models.Order{OrderType: models.TrailingStopOrder, TrailPercent: 10, HighWaterMark: 100 * money.Dollar}
+	order.StopPrice = order.TrailingStopPrice()
+
+	steps := []struct {
+		price     money.Money
+		moved     bool
+		high      money.Money
+		stop      money.Money
+		triggered bool
+	}{
+		{110 * money.Dollar, true, 110 * money.Dollar, 99 * money.Dollar, false},
+		{105 * money.Dollar, false, 110 * money.Dollar, 99 * money.Dollar, false},
+		{120 * money.Dollar, true, 120 * money.Dollar, 108 * money.Dollar, false},
+		{110 * money.Dollar, false, 120 * money.Dollar, 108 * money.Dollar, false},
+		{108 * money.Dollar, false, 120 * money.Dollar, 108 * money.Dollar, true},
+	}
+
+	for _, step := range steps {
+		moved := order.RaiseTrail(step.price)
+		if moved != step.moved {
+			t.Errorf("At %s: expected moved %v, got %v", step.price, step.moved, moved)
+		}
+		if order.HighWaterMark != step.high || order.StopPrice != step.stop {
+			t.Errorf("At %s: expected high %s and stop %s, got %s and %s",
+				step.price, step.high, step.stop, order.HighWaterMark, order.StopPrice)
+		}
+		if triggered := !moved && order.Triggered(step.price); triggered != step.triggered {
+			t.Errorf("At %s: expected triggered %v, got %v", step.price, step.triggered, triggered)
+		}
+	}
+
+	// Only trailing stops move
+	fixed := models.Order{OrderType: models.StopLossOrder, StopPrice: 90 * money.Dollar, HighWaterMark: 100 * money.Dollar}
+	if fixed.RaiseTrail(200*money.Dollar) || fixed.StopPrice != 90*money.Dollar {
+		t.Errorf("Expected a stop-loss to keep its stop price, got %s", fixed.StopPrice)
+	}
+}
+
+func TestPlaceConditionalOrderValidation(t *testing.T) {
+	// Validation fails before any repository is touched, so the service needs none
+	marketService := services.NewMarketService(services.MarketDeps{})
+
+	tests := []struct {
+		name         string
+		quantity     float64
+		orderType    models.OrderType
+		stopPrice    money.Money
+		trailAmount  money.Money
+		trailPercent float64
+	}{
+		{"zero quantity", 0, models.StopLossOrder, 90 * money.Dollar, 0, 0},
+		{"negative quantity", -1, models.StopLossOrder, 90 * money.Dollar, 0, 0},
+		{"limit order type", 1, models.LimitOrder, 90 * money.Dollar, 0, 0},
+		{"market order type", 1, models.MarketOrder, 90 * money.Dollar, 0, 0},
+		{"stop loss without stop", 1, models.StopLossOrder, 0, 0, 0},
+		{"take profit with negative target", 1, models.TakeProfitOrder, -money.Dollar, 0, 0},
+		{"trailing stop without trail", 1, models.TrailingStopOrder, 0, 0, 0},
+		{"trailing stop with both trails", 1, models.TrailingStopOrder, 0, 5 * money.Dollar, 5},
+		{"trail percent of 100", 1, models.TrailingStopOrder, 0, 0, 100},
+		{"negative trail amount", 1, models.TrailingStopOrder, 0, -5 * money.Dollar, 5},
+		{"negative trail percent", 1, models.TrailingStopOrder, 0, 5 * money.Dollar, -5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := marketService.PlaceConditionalOrder(1, 1, tt.quantity, tt.orderType, tt.stopPrice, tt.trailAmount, tt.trailPercent)
+			if err == nil {
+				t.Errorf("Expected the order to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestPriceModels(t *testing.T) {
+	// With no volatility GBM grows by exactly the drift each tick
+	info := &market.StockInfo{BasePrice: 100 * money.Dollar, InitialPrice: 100 * money.Dollar}
+	gbm, _ := market.LookupPriceModel(market.ModelGBM)
+	price := gbm.NextPrice(rand.New(rand.NewSource(1)), info, market.ModelParams{Model: market.ModelGBM, Drift: 0.01})
+	if math.Abs(price-100*math.Exp(0.01)) > 1e-9 {
+		t.Errorf("Expected GBM without volatility to grow by the drift, got %.4f", price)
+	}
+
+	// Without volatility OU closes the configured share of the gap to the mean each tick
+	ou, _ := market.LookupPriceModel(market.ModelOU)
+	info = &market.StockInfo{BasePrice: 200 * money.Dollar, InitialPrice: 100 * money.Dollar}
+	price = ou.NextPrice(rand.New(rand.NewSource(1)), info, market.ModelParams{Model: market.ModelOU, MeanReversion: 0.5})
+	if math.Abs(price-100*math.Sqrt2) > 1e-9 {
+		t.Errorf("Expected OU to revert halfway to the initial price in log terms, got %.4f", price)
+	}
+
+	// With no jumps the jump-diffusion model is plain GBM
+	jump, _ := market.LookupPriceModel(market.ModelJumpDiffusion)
+	params := market.ModelParams{Model: market.ModelJumpDiffusion, Drift: 0.001, Sigma: 0.02}
+	info = &market.StockInfo{BasePrice: 50 * money.Dollar}
+	jumpPrice := jump.NextPrice(rand.New(rand.NewSource(3)), info, params)
+	gbmPrice := gbm.NextPrice(rand.New(rand.NewSource(3)), info, params)
+	if jumpPrice != gbmPrice {
+		t.Errorf("Expected jump-diffusion without jumps to match GBM, got %.4f and %.4f", jumpPrice, gbmPrice)
+	}
+
+	// Unknown models and out-of-range params are rejected
+	for _, invalid := range []market.ModelParams{
+		{Model: "random"},
+		{Model: market.ModelGBM, Sigma: -0.1},
+		{Model: market.ModelOU, MeanReversion: 2},
+		{Model: market.ModelJumpDiffusion, JumpIntensity: -1},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestSimulatorModelSelection(t *testing.T) {
+	sim := market.NewMarketSimulator(time.Second, 0.05)
+	sim.SetSeed(1)
+	sim.SetFactorConfig(market.FactorConfig{}) // Leave out shared moves so the models' prices are exact
+	sim.SetHaltConfig(market.HaltConfig{})     // and don't stop big moves at the price bands
+	sim.AddStock(1, "AAA", "Technology", 100*money.Dollar)
+	sim.AddStock(2, "BBB", "Technology", 100*money.Dollar)
+	sim.AddStock(3, "CCC", "Retail", 100*money.Dollar)
+
+	// The sector's model applies unless the stock has its own
+	if err := sim.SetSectorParams("Technology", &market.ModelParams{Model: market.ModelGBM, Drift: 0.1}); err != nil {
+		t.Fatalf("Failed to set sector params: %v", err)
+	}
+	if err := sim.SetStockParams(2, &market.ModelParams{Model: market.ModelGBM, Drift: -0.1}); err != nil {
+		t.Fatalf("Failed to set stock params: %v", err)
+	}
+	if err := sim.SetStockParams(99, &market.ModelParams{Model: market.ModelGBM}); err == nil {
+		t.Errorf("Expected params for an unknown stock to be rejected")
+	}
+
+	sim.Step()
+	prices := make(map[int]float64)
+	for len(sim.GetUpdateChannel()) > 0 {
+		update := <-sim.GetUpdateChannel()
+		prices[update.StockID] = update.Price.Float()
+	}
+
+	if expected := math.Round(100*math.Exp(0.1)*100) / 100; prices[1] != expected {
+		t.Errorf("Expected stock 1 to follow its sector's model to %.2f, got %.2f", expected, prices[1])
+	}
+	if expected := math.Round(100*math.Exp(-0.1)*100) / 100; prices[2] != expected {
+		t.Errorf("Expected stock 2 to follow its own model to %.2f, got %.2f", expected, prices[2])
+	}
+	if prices[3] == 0 {
+		t.Errorf("Expected stock 3 to keep the default model and still update")
+	}
+}
+
+func TestSectorsMoveTogether(t *testing.T) {
+	sim := market.NewMarketSimulator(time.Second, 0.05)
+	sim.SetSeed(5)
+	sim.SetFactorConfig(market.FactorConfig{SectorSigma: 0.02})
+
+	// With no stock-specific noise, stocks in the same sector move identically
+	flat := &market.ModelParams{Model: market.ModelGBM}
+	for id, sector := range map[int]string{1: "Technology", 2: "Technology", 3: "Retail"} {
+		sim.AddStock(id, "S", sector, 100*money.Dollar)
+		if err := sim.SetStockParams(id, flat); err != nil {
+			t.Fatalf("Failed to set stock params: %v", err)
+		}
+	}
+
+	// A zero sector beta cuts the stock loose from its sector
+	if err := sim.SetBetas(2, market.Betas{Market: 1, Sector: 0}); err != nil {
+		t.Fatalf("Failed to set betas: %v", err)
+	}
+	if err := sim.SetBetas(2, market.Betas{Market: 10}); err == nil {
+		t.Errorf("Expected an out-of-range beta to be rejected")
+	}
+
+	sim.AddStock(4, "T", "Technology", 100*money.Dollar)
+	sim.SetStockParams(4, flat)
+
+	sim.Step()
+	prices := make(map[int]float64)
+	for len(sim.GetUpdateChannel()) > 0 {
+		update := <-sim.GetUpdateChannel()
+		prices[update.StockID] = update.Price.Float()
+	}
+
+	if prices[1] != prices[4] {
+		t.Errorf("Expected stocks in the same sector to move together, got %.2f and %.2f", prices[1], prices[4])
+	}
+	if prices[2] != 100 {
+		t.Errorf("Expected a stock cut loose from its sector to stay at 100, got %.2f", prices[2])
+	}
+	if prices[1] == prices[3] {
+		t.Errorf("Expected different sectors to move differently, both got %.2f", prices[1])
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+)
+
+func TestShortAndCover(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+
+	username := fmt.Sprintf("short_%d", time.Now().UnixNano())
+	user, err := userRepo.CreateUser(username, "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+
+	// A short worth more than twice the user's equity breaks the initial margin
+	tooMany := math.Floor(2*user.CashBalance.Float()/stock.CurrentPrice.Float()) + 1
+	if err := marketService.ShortStock(user.ID, stock.ID, tooMany); err == nil {
+		t.Fatalf("Expected shorting %g shares to fail the margin check", tooMany)
+	}
+
+	// Open a small short; the proceeds are credited and become a liability
+	if err := marketService.ShortStock(user.ID, stock.ID, 5); err != nil {
+		t.Fatalf("Failed to short stock: %v", err)
+	}
+
+	// Both the short and the cover pay the default commission
+	fee := models.DefaultFeeSchedule().Fee(5, stock.CurrentPrice, 0)
+
+	summary, err := marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+	if len(summary.ShortPositions) != 1 || summary.ShortPositions[0].Quantity != 5 {
+		t.Fatalf("Expected one short position of 5 shares, got %+v", summary.ShortPositions)
+	}
+	if summary.CashBalance != user.CashBalance+stock.CurrentPrice.Mul(5)-fee {
+		t.Errorf("Expected short proceeds to be credited, cash is %s", summary.CashBalance)
+	}
+	if summary.TotalValue != user.CashBalance-fee {
+		t.Errorf("Expected net worth to drop by the commission to %s, got %s", user.CashBalance-fee, summary.TotalValue)
+	}
+
+	// Covering more than is short fails; covering the rest closes the position at the same price
+	if err := marketService.CoverShort(user.ID, stock.ID, 6); err == nil {
+		t.Errorf("Expected covering more shares than are short to fail")
+	}
+	if err := marketService.CoverShort(user.ID, stock.ID, 5); err != nil {
+		t.Fatalf("Failed to cover short: %v", err)
+	}
+
+	summary, err = marketService.GetUserPortfolio(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get portfolio: %v", err)
+	}
+	if len(summary.ShortPositions) != 0 || summary.CashBalance != user.CashBalance-2*fee {
+		t.Errorf("Expected the short to be closed for the cost of commission, got %+v", summary)
+	}
+}
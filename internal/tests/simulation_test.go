@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+// fixedClock always returns the same time
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.now }
+
+// newSeededSimulator creates a simulator with a few stocks from a fixed seed and clock, without halts
+func newSeededSimulator(seed int64, clock market.Clock) *market.MarketSimulator {
+	sim := market.NewMarketSimulator(time.Second, 0.05)
+	sim.SetSeed(seed)
+	sim.SetClock(clock)
+	sim.SetHaltConfig(market.HaltConfig{}) // Tests that want halts turn them back on
+	sim.AddStock(1, "AAA", "Technology", 100*money.Dollar)
+	sim.AddStock(2, "BBB", "Retail", 50*money.Dollar)
+	sim.AddStock(3, "CCC", "Healthcare", 20*money.Dollar)
+	return sim
+}
+
+// stepAndCollect advances a simulator one tick at a time and returns every update it sends
+func stepAndCollect(sim *market.MarketSimulator, steps int) []market.StockUpdate {
+	var updates []market.StockUpdate
+	for i := 0; i < steps; i++ {
+		sim.Step()
+		for len(sim.GetUpdateChannel()) > 0 {
+			updates = append(updates, <-sim.GetUpdateChannel())
+		}
+	}
+	return updates
+}
+
+func TestSimulatorIsDeterministic(t *testing.T) {
+	clock := fixedClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+
+	first := stepAndCollect(newSeededSimulator(42, clock), 50)
+	second := stepAndCollect(newSeededSimulator(42, clock), 50)
+
+	if len(first) != 150 {
+		t.Fatalf("Expected 150 updates from 50 steps of 3 stocks, got %d", len(first))
+	}
+	if len(second) != len(first) {
+		t.Fatalf("Expected the same number of updates, got %d and %d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Update %d differs between runs with the same seed: %+v vs %+v", i, first[i], second[i])
+		}
+		if !first[i].Time.Equal(clock.now) {
+			t.Errorf("Expected update %d to be stamped by the clock, got %v", i, first[i].Time)
+		}
+	}
+
+	// A different seed gives a different market
+	other := stepAndCollect(newSeededSimulator(7, clock), 50)
+	same := true
+	for i := range first {
+		if first[i].Price != other[i].Price {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Errorf("Expected a different seed to produce different prices")
+	}
+}
+
+func TestSimulatorProcessTransaction(t *testing.T) {
+	clock := fixedClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+
+	prices := make([]float64, 2)
+	for i := range prices {
+		sim := newSeededSimulator(42, clock)
+		sim.ProcessTransaction(1, 50, true)
+
+		update := <-sim.GetUpdateChannel()
+		if update.StockID != 1 || update.Volume != 50 {
+			t.Fatalf("Expected an update for stock 1 with volume 50, got %+v", update)
+		}
+		if update.Price <= 100*money.Dollar {
+			t.Errorf("Expected a buy to push the price above 100, got %s", update.Price)
+		}
+		prices[i] = update.Price.Float()
+	}
+
+	if prices[0] != prices[1] {
+		t.Errorf("Expected the same trade to move the price the same way, got %.2f and %.2f", prices[0], prices[1])
+	}
+}
+
+func TestSimulatorSnapshotRestore(t *testing.T) {
+	clock := fixedClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+
+	// Run a market for a while, snapshot it, and keep going
+	original := newSeededSimulator(42, clock)
+	stepAndCollect(original, 30)
+	original.ApplyEvent(market.Event{Scope: market.ScopeStock, StockID: 2, Headline: "BBB wins a contract", PriceImpact: 0.05, TrendImpact: 0.02})
+	<-original.GetUpdateChannel()
+
+	// Taking the snapshot reseeds the generator, so there are no draws to replay
+	snapshot := original.Snapshot()
+	if snapshot.Seed == 42 || snapshot.Draws != 0 || original.Seed() != snapshot.Seed {
+		t.Fatalf("Expected the snapshot to reseed the generator, got seed %d and %d draws", snapshot.Seed, snapshot.Draws)
+	}
+	expected := stepAndCollect(original, 30)
+
+	// The snapshot is stored as JSON, so make sure it survives the round trip
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("Failed to encode snapshot: %v", err)
+	}
+	snapshot = &market.Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+
+	// A new simulator with a different seed, given the same prices and the snapshot, carries on identically
+	restored := market.NewMarketSimulator(time.Second, 0.05)
+	restored.SetSeed(7)
+	restored.SetClock(clock)
+	restored.SetHaltConfig(market.HaltConfig{})
+	for id, info := range snapshot.Stocks {
+		restored.AddStock(id, info.Symbol, info.Sector, info.BasePrice)
+	}
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatalf("Failed to restore snapshot: %v", err)
+	}
+	if restored.Seed() != snapshot.Seed {
+		t.Errorf("Expected the restored seed to be %d, got %d", snapshot.Seed, restored.Seed())
+	}
+
+	got := stepAndCollect(restored, 30)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d updates after restoring, got %d", len(expected), len(got))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("Update %d differs after restoring: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+}
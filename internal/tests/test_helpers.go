@@ -65,10 +65,45 @@ func SetupTestRouter(db *sql.DB) *mux.Router {
 	stockRepo := repository.NewStockRepo(db)
 	portfolioRepo := repository.NewPortfolioRepo(db)
 	transactionRepo := repository.NewTransactionRepo(db)
+	orderRepo := repository.NewOrderRepo(db)
+	lotRepo := repository.NewTaxLotRepo(db)
+	shortRepo := repository.NewShortPositionRepo(db)
+	feeRepo := repository.NewFeeScheduleRepo(db)
+	modelRepo := repository.NewPriceModelRepo(db)
+	stateRepo := repository.NewSimulatorStateRepo(db)
+	actionRepo := repository.NewCorporateActionRepo(db)
+	historyRepo := repository.NewPriceHistoryRepo(db)
+	ipoRepo := repository.NewIPORepo(db)
+	fundamentalsRepo := repository.NewFundamentalsRepo(db)
+	indexRepo := repository.NewIndexRepo(db)
+	etfRepo := repository.NewETFRepo(db)
+	optionRepo := repository.NewOptionRepo(db)
+	ledgerRepo := repository.NewLedgerRepo(db)
+	txRunner := repository.NewTxRunner(db)
 
 	// Create services
 	authService := services.NewAuthService(userRepo)
-	marketService := services.NewMarketService(stockRepo, userRepo, portfolioRepo, transactionRepo)
+	marketService := services.NewMarketService(services.MarketDeps{
+		StockRepo:        stockRepo,
+		UserRepo:         userRepo,
+		PortfolioRepo:    portfolioRepo,
+		TransactionRepo:  transactionRepo,
+		OrderRepo:        orderRepo,
+		LotRepo:          lotRepo,
+		ShortRepo:        shortRepo,
+		FeeRepo:          feeRepo,
+		ModelRepo:        modelRepo,
+		StateRepo:        stateRepo,
+		ActionRepo:       actionRepo,
+		HistoryRepo:      historyRepo,
+		IPORepo:          ipoRepo,
+		FundamentalsRepo: fundamentalsRepo,
+		IndexRepo:        indexRepo,
+		ETFRepo:          etfRepo,
+		OptionRepo:       optionRepo,
+		LedgerRepo:       ledgerRepo,
+		TxRunner:         txRunner,
+	})
 
 	// Create handlers
 	authHandler := handlers.NewAuthHandler(authService)
@@ -97,6 +132,31 @@ func SetupTestRouter(db *sql.DB) *mux.Router {
 	return r
 }
 
+// SetupTestMarketService creates a market service backed by the test database
+func SetupTestMarketService(db *sql.DB) *services.MarketService {
+	return services.NewMarketService(services.MarketDeps{
+		StockRepo:        repository.NewStockRepo(db),
+		UserRepo:         repository.NewUserRepo(db),
+		PortfolioRepo:    repository.NewPortfolioRepo(db),
+		TransactionRepo:  repository.NewTransactionRepo(db),
+		OrderRepo:        repository.NewOrderRepo(db),
+		LotRepo:          repository.NewTaxLotRepo(db),
+		ShortRepo:        repository.NewShortPositionRepo(db),
+		FeeRepo:          repository.NewFeeScheduleRepo(db),
+		ModelRepo:        repository.NewPriceModelRepo(db),
+		StateRepo:        repository.NewSimulatorStateRepo(db),
+		ActionRepo:       repository.NewCorporateActionRepo(db),
+		HistoryRepo:      repository.NewPriceHistoryRepo(db),
+		IPORepo:          repository.NewIPORepo(db),
+		FundamentalsRepo: repository.NewFundamentalsRepo(db),
+		IndexRepo:        repository.NewIndexRepo(db),
+		ETFRepo:          repository.NewETFRepo(db),
+		OptionRepo:       repository.NewOptionRepo(db),
+		LedgerRepo:       repository.NewLedgerRepo(db),
+		TxRunner:         repository.NewTxRunner(db),
+	})
+}
+
 // MakeRequest makes a test request and returns the response
 func MakeRequest(method, url string, body interface{}, router *mux.Router) *httptest.ResponseRecorder {
 	// Create request body if provided
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"officestonks/internal/models"
+	"officestonks/internal/repository"
+	"officestonks/pkg/money"
+)
+
+func TestConcurrentBuysCannotOverdraw(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	userRepo := repository.NewUserRepo(TestDB)
+	portfolioRepo := repository.NewPortfolioRepo(TestDB)
+
+	// Create a user with the default 10,000 balance
+	username := fmt.Sprintf("concurrent_%d", time.Now().UnixNano())
+	user, err := userRepo.CreateUser(username, "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+
+	// Fire more buys at once than the balance can cover
+	const attempts = 20
+	const quantity = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := marketService.BuyStock(user.ID, stock.ID, quantity); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each buy also pays the default commission
+	tradeCost := stock.CurrentPrice*quantity + models.DefaultFeeSchedule().Fee(quantity, stock.CurrentPrice, 0)
+	maxAffordable := int(user.CashBalance / tradeCost)
+	if succeeded > maxAffordable {
+		t.Fatalf("Expected at most %d successful buys, got %d", maxAffordable, succeeded)
+	}
+
+	// Cash and shares must agree with the number of trades that went through
+	updated, err := userRepo.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	expectedCash := user.CashBalance - money.Money(succeeded)*tradeCost
+	if updated.CashBalance < 0 || updated.CashBalance != expectedCash {
+		t.Errorf("Expected cash balance %s, got %s", expectedCash, updated.CashBalance)
+	}
+
+	holding, err := portfolioRepo.GetUserStockHolding(user.ID, stock.ID)
+	if err != nil {
+		t.Fatalf("Failed to get holding: %v", err)
+	}
+	if holding == nil || holding.Quantity != float64(succeeded*quantity) {
+		t.Errorf("Expected %d shares, got %+v", succeeded*quantity, holding)
+	}
+}
+
+func TestLimitBuyReservesCommission(t *testing.T) {
+	// Skip if no test database connection
+	if TestDB == nil {
+		t.Skip("No test database connection")
+	}
+
+	marketService := SetupTestMarketService(TestDB)
+	user, err := repository.NewUserRepo(TestDB).CreateUser(fmt.Sprintf("limit_fee_%d", time.Now().UnixNano()), "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	stock, err := repository.NewStockRepo(TestDB).GetStockBySymbol("AAPL")
+	if err != nil {
+		t.Fatalf("Failed to get test stock: %v", err)
+	}
+	schedule, err := marketService.GetFeeSchedule()
+	if err != nil {
+		t.Fatalf("Failed to get fee schedule: %v", err)
+	}
+
+	// Rest a buy below the market, so it doesn't fill straight away
+	limitPrice := stock.CurrentPrice / 2
+	const quantity = 10
+	order, err := marketService.PlaceLimitOrder(user.ID, stock.ID, quantity, limitPrice, models.Buy)
+	if err != nil {
+		t.Fatalf("Failed to place limit order: %v", err)
+	}
+
+	fee := schedule.Fee(quantity, limitPrice, 0)
+	if order.ReservedFee != fee {
+		t.Errorf("Expected the order to reserve the commission of %s, got %s", fee, order.ReservedFee)
+	}
+	reserved, err := repository.NewOrderRepo(TestDB).GetReservedCash(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get reserved cash: %v", err)
+	}
+	if expected := limitPrice.Mul(quantity) + fee; reserved != expected {
+		t.Errorf("Expected %s reserved for the order and its commission, got %s", expected, reserved)
+	}
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"officestonks/pkg/market"
+	"officestonks/pkg/money"
+)
+
+func TestVolumeStats(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+	sim := newSeededSimulator(42, clock)
+	if err := sim.SetFlowConfig(market.FlowConfig{Interval: time.Hour, FlowWindow: time.Minute}); err != nil {
+		t.Fatalf("Failed to set flow config: %v", err)
+	}
+	if err := sim.SetFlowConfig(market.FlowConfig{Interval: time.Minute, FlowWindow: time.Hour}); err == nil {
+		t.Errorf("Expected a flow window longer than the interval to be rejected")
+	}
+
+	// Each trade counts at the price before it moved the market
+	sim.ProcessTransaction(1, 30, true)
+	price := (<-sim.GetUpdateChannel()).Price
+	clock.now = clock.now.Add(30 * time.Minute)
+	sim.ProcessTransaction(1, 10, false)
+	<-sim.GetUpdateChannel()
+
+	stats := sim.GetVolumeStats(1)
+	if stats.Volume != 40 || stats.BuyVolume != 30 || stats.SellVolume != 10 || stats.Trades != 2 {
+		t.Errorf("Expected 2 trades of 30 bought and 10 sold, got %+v", stats)
+	}
+	if expected := 100*money.Dollar*30 + price*10; stats.DollarVolume != expected {
+		t.Errorf("Expected dollar volume %s, got %s", expected, stats.DollarVolume)
+	}
+	if stats.Imbalance != 0.5 {
+		t.Errorf("Expected an imbalance of 0.5, got %.3f", stats.Imbalance)
+	}
+	if other := sim.GetAllVolumeStats()[2]; other.Volume != 0 || other.Imbalance != 0 {
+		t.Errorf("Expected no volume for an untraded stock, got %+v", other)
+	}
+
+	// Trades drop out once they are older than the interval
+	clock.now = clock.now.Add(45 * time.Minute)
+	stats = sim.GetVolumeStats(1)
+	if stats.Volume != 10 || stats.SellVolume != 10 || stats.Imbalance != -1 {
+		t.Errorf("Expected only the later sale to count, got %+v", stats)
+	}
+}
+
+func TestOrderFlowMovesPrices(t *testing.T) {
+	clock := fixedClock{now: time.Date(2024, 1, 2, 15, 30, 0, 0, time.UTC)}
+
+	// The same market with and without order flow feeding into prices
+	prices := make([]float64, 2)
+	for i, weight := range []float64{0, 0.05} {
+		sim := newSeededSimulator(42, clock)
+		sim.SetFactorConfig(market.FactorConfig{})
+		if err := sim.SetFlowConfig(market.FlowConfig{Interval: time.Hour, FlowWindow: time.Minute, FlowWeight: weight}); err != nil {
+			t.Fatalf("Failed to set flow config: %v", err)
+		}
+
+		sim.ProcessTransaction(1, 10, true)
+		<-sim.GetUpdateChannel()
+		for _, update := range stepAndCollect(sim, 1) {
+			if update.StockID == 1 {
+				prices[i] = update.Price.Float()
+			}
+		}
+	}
+
+	// Every recent trade was a buy, so the price gets the full 5% push
+	if ratio := prices[1] / prices[0]; math.Abs(ratio-1.05) > 0.001 {
+		t.Errorf("Expected buying pressure to lift the price by 5%%, got %.2f and %.2f", prices[0], prices[1])
+	}
+}
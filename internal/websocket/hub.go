@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"officestonks/pkg/market"
+	"officestonks/pkg/money"
 )
 
 // Hub maintains the set of active clients and broadcasts messages to them
@@ -62,15 +63,17 @@ func (h *Hub) Run() {
 func (h *Hub) broadcastStockUpdate(update market.StockUpdate) {
 	// Create a message for the update
 	message := struct {
-		Type    string  `json:"type"`
-		StockID int     `json:"stock_id"`
-		Symbol  string  `json:"symbol"`
-		Price   float64 `json:"price"`
+		Type    string      `json:"type"`
+		StockID int         `json:"stock_id"`
+		Symbol  string      `json:"symbol"`
+		Price   money.Money `json:"price"`
+		Volume  float64     `json:"volume"` // Shares traded since the last update
 	}{
 		Type:    "stock_update",
 		StockID: update.StockID,
 		Symbol:  update.Symbol,
 		Price:   update.Price,
+		Volume:  update.Volume,
 	}
 
 	h.mu.Lock()
@@ -96,4 +99,24 @@ func (h *Hub) BroadcastMessage(messageType string, data interface{}) {
 		client.Send(message)
 	}
 	h.mu.Unlock()
-}
\ No newline at end of file
+}
+
+// SendToUser sends a message to every connection belonging to one user
+func (h *Hub) SendToUser(userID int, messageType string, data interface{}) {
+	// Create a message
+	message := struct {
+		Type string      `json:"type"`
+		Data interface{} `json:"data"`
+	}{
+		Type: messageType,
+		Data: data,
+	}
+
+	h.mu.Lock()
+	for client := range h.clients {
+		if client.userID == userID {
+			client.Send(message)
+		}
+	}
+	h.mu.Unlock()
+}
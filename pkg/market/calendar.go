@@ -0,0 +1,193 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Holiday is a day the market is closed, or closes early
+type Holiday struct {
+	Date       string `json:"date"` // YYYY-MM-DD in the calendar's time zone
+	Name       string `json:"name"`
+	EarlyClose string `json:"early_close,omitempty"` // HH:MM the market closes at; empty means closed all day
+}
+
+// CalendarConfig describes when the market is open
+type CalendarConfig struct {
+	Timezone    string    // IANA time zone name, such as "America/New_York"
+	Open        string    // HH:MM the market opens on a trading day
+	Close       string    // HH:MM the market closes on a trading day
+	OpenWeekend bool      // Trade on Saturdays and Sundays too
+	Holidays    []Holiday // Office holidays and early closes
+}
+
+// DefaultCalendarConfig returns a weekday session from 9:30 to 16:00 New York time
+func DefaultCalendarConfig() CalendarConfig {
+	return CalendarConfig{
+		Timezone: "America/New_York",
+		Open:     "09:30",
+		Close:    "16:00",
+	}
+}
+
+// Calendar says when the market is open. A nil calendar is always open.
+type Calendar struct {
+	location    *time.Location
+	open        clockTime
+	close       clockTime
+	openWeekend bool
+	holidays    map[string]Holiday
+}
+
+// clockTime is a time of day
+type clockTime struct {
+	hour, minute int
+}
+
+// parseClockTime parses an HH:MM time of day
+func parseClockTime(value string) (clockTime, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return clockTime{}, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return clockTime{t.Hour(), t.Minute()}, nil
+}
+
+// on returns the time of day on the given date in the calendar's time zone
+func (c clockTime) on(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day, c.hour, c.minute, 0, 0, loc)
+}
+
+// before reports whether c is earlier in the day than other
+func (c clockTime) before(other clockTime) bool {
+	return c.hour < other.hour || (c.hour == other.hour && c.minute < other.minute)
+}
+
+// NewCalendar creates a market calendar from its config
+func NewCalendar(cfg CalendarConfig) (*Calendar, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", cfg.Timezone, err)
+	}
+
+	open, err := parseClockTime(cfg.Open)
+	if err != nil {
+		return nil, err
+	}
+	close, err := parseClockTime(cfg.Close)
+	if err != nil {
+		return nil, err
+	}
+	if !open.before(close) {
+		return nil, errors.New("the market must open before it closes")
+	}
+
+	holidays := make(map[string]Holiday, len(cfg.Holidays))
+	for _, holiday := range cfg.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return nil, fmt.Errorf("invalid holiday date %q, expected YYYY-MM-DD", holiday.Date)
+		}
+		if holiday.EarlyClose != "" {
+			earlyClose, err := parseClockTime(holiday.EarlyClose)
+			if err != nil {
+				return nil, err
+			}
+			if !open.before(earlyClose) {
+				return nil, fmt.Errorf("the early close on %s must be after the open", holiday.Date)
+			}
+		}
+		holidays[holiday.Date] = holiday
+	}
+
+	return &Calendar{
+		location:    location,
+		open:        open,
+		close:       close,
+		openWeekend: cfg.OpenWeekend,
+		holidays:    holidays,
+	}, nil
+}
+
+// Location returns the calendar's time zone
+func (c *Calendar) Location() *time.Location {
+	if c == nil {
+		return time.UTC
+	}
+	return c.location
+}
+
+// session returns when the market opens and closes on the day t falls on, or false if it doesn't open that day
+func (c *Calendar) session(t time.Time) (time.Time, time.Time, bool) {
+	local := t.In(c.location)
+	year, month, day := local.Date()
+
+	if !c.openWeekend && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	close := c.close
+	if holiday, ok := c.holidays[local.Format("2006-01-02")]; ok {
+		if holiday.EarlyClose == "" {
+			return time.Time{}, time.Time{}, false
+		}
+		close, _ = parseClockTime(holiday.EarlyClose)
+	}
+
+	return c.open.on(year, month, day, c.location), close.on(year, month, day, c.location), true
+}
+
+// IsOpen reports whether the market is open at t
+func (c *Calendar) IsOpen(t time.Time) bool {
+	if c == nil {
+		return true
+	}
+
+	open, close, ok := c.session(t)
+	return ok && !t.Before(open) && t.Before(close)
+}
+
+// maxClosedDays bounds the search for the next session, so a calendar that never opens doesn't loop forever
+const maxClosedDays = 366
+
+// NextOpen returns when the market next opens after t, or the zero time if it is always open or never opens
+func (c *Calendar) NextOpen(t time.Time) time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+
+	local := t.In(c.location)
+	for i := 0; i <= maxClosedDays; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 12, 0, 0, 0, c.location)
+		if open, _, ok := c.session(day); ok && open.After(t) {
+			return open
+		}
+	}
+	return time.Time{}
+}
+
+// NextClose returns when the market next closes after t, or the zero time if it is always open or never opens
+func (c *Calendar) NextClose(t time.Time) time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+
+	local := t.In(c.location)
+	for i := 0; i <= maxClosedDays; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 12, 0, 0, 0, c.location)
+		if _, close, ok := c.session(day); ok && close.After(t) {
+			return close
+		}
+	}
+	return time.Time{}
+}
+
+// HolidayOn returns the holiday on the day t falls on, if there is one
+func (c *Calendar) HolidayOn(t time.Time) (Holiday, bool) {
+	if c == nil {
+		return Holiday{}, false
+	}
+
+	holiday, ok := c.holidays[t.In(c.location).Format("2006-01-02")]
+	return holiday, ok
+}
@@ -0,0 +1,76 @@
+package market
+
+import (
+	"errors"
+	"math"
+
+	"officestonks/pkg/money"
+)
+
+// ApplyDividend drops a stock's price by the dividend paid out on its ex date.
+// It returns the new price.
+func (s *MarketSimulator) ApplyDividend(stockID int, amount money.Money) (money.Money, error) {
+	if amount <= 0 {
+		return 0, errors.New("dividend must be positive")
+	}
+
+	return s.adjustPrice(stockID, false, func(info *StockInfo) {
+		info.BasePrice = money.Max(info.BasePrice-amount, money.Cent)
+		if info.BandReference > 0 {
+			info.BandReference = money.Max(info.BandReference-amount, money.Cent)
+		}
+	})
+}
+
+// ApplySplit divides a stock's prices by ratio, the shares each share becomes (0.1 for a 1-for-10
+// reverse split), so that holders' stakes keep their value. It returns the new price.
+func (s *MarketSimulator) ApplySplit(stockID int, ratio float64) (money.Money, error) {
+	if ratio <= 0 || math.IsInf(ratio, 0) || math.IsNaN(ratio) {
+		return 0, errors.New("split ratio must be positive")
+	}
+
+	return s.adjustPrice(stockID, true, func(info *StockInfo) {
+		info.BasePrice = money.Max(info.BasePrice.MulRate(1/ratio), money.Cent)
+		info.InitialPrice = info.InitialPrice.MulRate(1 / ratio)
+		info.BandReference = info.BandReference.MulRate(1 / ratio)
+		if info.Params != nil && info.Params.MeanPrice > 0 {
+			params := *info.Params
+			params.MeanPrice = params.MeanPrice.MulRate(1 / ratio)
+			info.Params = &params
+		}
+	})
+}
+
+// adjustPrice changes a stock's price outside the simulation and sends the update.
+// With keepIndices the indices stay where they are, as they should for a split.
+func (s *MarketSimulator) adjustPrice(stockID int, keepIndices bool, adjust func(info *StockInfo)) (money.Money, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return 0, errors.New("stock is not being simulated")
+	}
+
+	adjust(&info)
+	if keepIndices {
+		s.adjustIndices(func() {
+			s.stocksInfo[stockID] = info
+		})
+	} else {
+		s.stocksInfo[stockID] = info
+	}
+
+	select {
+	case s.updateChan <- StockUpdate{
+		StockID: stockID,
+		Symbol:  info.Symbol,
+		Price:   info.BasePrice,
+		Time:    s.clock.Now(),
+	}:
+	default:
+		// Channel is full, skip this update
+	}
+
+	return info.BasePrice, nil
+}
@@ -0,0 +1,87 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// EarningsConfig controls how the market reacts to earnings surprises
+type EarningsConfig struct {
+	Sensitivity float64 // Price move per unit of surprise; 0.5 turns a 10% beat into a 5% rise
+	MaxReaction float64 // Largest price move, either way, an earnings report can cause
+	DriftShare  float64 // Extra return per tick that follows the report, as a fraction of the initial move
+}
+
+// DefaultEarningsConfig returns the earnings settings used unless overridden
+func DefaultEarningsConfig() EarningsConfig {
+	return EarningsConfig{
+		Sensitivity: 0.5,
+		MaxReaction: 0.15,
+		DriftShare:  0.1,
+	}
+}
+
+// Validate checks that an earnings config gives plausible price moves
+func (c EarningsConfig) Validate() error {
+	if c.Sensitivity < 0 || c.DriftShare < 0 {
+		return errors.New("sensitivity and drift share cannot be negative")
+	}
+	if c.MaxReaction < 0 || c.MaxReaction >= 0.9 {
+		return errors.New("max reaction must be at least 0 and below 0.9")
+	}
+	return nil
+}
+
+// Reaction works out the price move, as a fraction, that an earnings surprise causes
+func (c EarningsConfig) Reaction(surprise float64) float64 {
+	reaction := math.Max(-c.MaxReaction, math.Min(c.MaxReaction, surprise*c.Sensitivity))
+	return math.Round(reaction*10000) / 10000
+}
+
+// SetEarningsConfig sets how the market reacts to earnings surprises
+func (s *MarketSimulator) SetEarningsConfig(cfg EarningsConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.earningsConfig = cfg
+	return nil
+}
+
+// ApplyEarnings moves a stock's price in reaction to an earnings surprise, the fraction actual
+// earnings beat (or, negative, missed) expectations by. The move carries on as fading drift
+// after the report. It returns the price move made, which is 0 if the stock is halted.
+func (s *MarketSimulator) ApplyEarnings(stockID int, surprise float64) (float64, error) {
+	s.mu.RLock()
+	cfg := s.earningsConfig
+	info, exists := s.stocksInfo[stockID]
+	s.mu.RUnlock()
+	if !exists {
+		return 0, errors.New("stock is not being simulated")
+	}
+
+	reaction := cfg.Reaction(surprise)
+	if reaction == 0 {
+		return 0, nil
+	}
+
+	verb := "beats"
+	if reaction < 0 {
+		verb = "misses"
+	}
+	affected, err := s.ApplyEvent(Event{
+		Scope:       ScopeStock,
+		StockID:     stockID,
+		Headline:    fmt.Sprintf("%s %s earnings expectations", info.Symbol, verb),
+		PriceImpact: reaction,
+		TrendImpact: math.Max(-maxTrend, math.Min(maxTrend, math.Round(reaction*cfg.DriftShare*10000)/10000)),
+	})
+	if err != nil || affected == 0 {
+		return 0, err
+	}
+	return reaction, nil
+}
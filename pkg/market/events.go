@@ -0,0 +1,228 @@
+package market
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"officestonks/pkg/money"
+)
+
+// EventScope says what a market event affects
+type EventScope string
+
+const (
+	ScopeStock  EventScope = "stock"  // A single stock
+	ScopeSector EventScope = "sector" // Every stock in a sector
+	ScopeMarket EventScope = "market" // Every stock
+)
+
+// maxTrend caps how far trades and news can push a stock's trend
+const maxTrend = 0.1
+
+// momentumDecay is the share of a stock's news momentum that is left after each tick
+const momentumDecay = 0.8
+
+// Event is a piece of news that moves the prices of the stocks it targets
+type Event struct {
+	Scope       EventScope
+	StockID     int    // Target of a stock event
+	Sector      string // Target of a sector event
+	Headline    string
+	PriceImpact float64 // Immediate price change, as a fraction (-0.1 is a 10% drop)
+	TrendImpact float64 // Extra return per tick that follows the news and fades away
+}
+
+// Validate checks that an event has a target and a plausible impact
+func (e Event) Validate() error {
+	switch e.Scope {
+	case ScopeStock:
+		if e.StockID <= 0 {
+			return errors.New("a stock event needs a stock")
+		}
+	case ScopeSector:
+		if e.Sector == "" {
+			return errors.New("a sector event needs a sector")
+		}
+	case ScopeMarket:
+	default:
+		return errors.New("scope must be 'stock', 'sector' or 'market'")
+	}
+
+	if e.Headline == "" {
+		return errors.New("headline is required")
+	}
+	if e.PriceImpact <= -0.9 || e.PriceImpact > 1 {
+		return errors.New("price impact must be above -0.9 and at most 1")
+	}
+	if math.Abs(e.TrendImpact) > maxTrend {
+		return errors.New("trend impact must be between -0.1 and 0.1")
+	}
+	return nil
+}
+
+// targets reports whether the event affects a stock
+func (e Event) targets(info StockInfo) bool {
+	switch e.Scope {
+	case ScopeStock:
+		return info.ID == e.StockID
+	case ScopeSector:
+		return info.Sector == e.Sector
+	}
+	return true
+}
+
+// ApplyEvent shocks the price of every stock the event targets and sends their updates.
+// It returns how many stocks were affected; halted stocks are left alone.
+func (s *MarketSimulator) ApplyEvent(event Event) (int, error) {
+	if err := event.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.sortedIDs()
+	now := s.clock.Now()
+	matched, affected := 0, 0
+	for _, id := range ids {
+		info := s.stocksInfo[id]
+		if !event.targets(info) {
+			continue
+		}
+		matched++
+
+		// Halted stocks are frozen, so the news doesn't move them
+		if info.isHalted(now) {
+			continue
+		}
+		affected++
+
+		newPrice := money.Max(info.BasePrice.MulRate(1+event.PriceImpact), money.Cent)
+		newPrice = s.applyBands(&info, newPrice, now)
+		info.BasePrice = newPrice
+
+		info.Momentum = math.Max(-maxTrend, math.Min(maxTrend, info.Momentum+event.TrendImpact))
+
+		select {
+		case s.updateChan <- StockUpdate{
+			StockID: id,
+			Symbol:  info.Symbol,
+			Price:   newPrice,
+			Volume:  info.PendingVolume,
+			Time:    now,
+		}:
+			info.PendingVolume = 0
+		default:
+			// Channel is full, skip this update
+		}
+		s.stocksInfo[id] = info
+	}
+
+	if matched == 0 {
+		return 0, errors.New("no stocks match the event")
+	}
+	return affected, nil
+}
+
+// eventTemplate is a headline the simulator can make up, with the range of its price impact
+type eventTemplate struct {
+	headline  string  // Formatted with the stock symbol or sector name
+	minImpact float64 // Smallest price change, as a fraction
+	maxImpact float64 // Largest price change, as a fraction
+}
+
+var stockTemplates = []eventTemplate{
+	{"%s beats earnings expectations", 0.03, 0.08},
+	{"%s wins a major contract", 0.02, 0.06},
+	{"%s announces a share buyback", 0.01, 0.04},
+	{"%s product launch draws rave reviews", 0.02, 0.07},
+	{"%s misses earnings expectations", -0.08, -0.03},
+	{"%s CEO resigns unexpectedly", -0.07, -0.02},
+	{"%s faces a regulatory investigation", -0.10, -0.03},
+	{"%s announces a product recall", -0.06, -0.02},
+}
+
+var sectorTemplates = []eventTemplate{
+	{"%s sector rallies on strong demand", 0.02, 0.05},
+	{"Analysts upgrade the %s sector", 0.01, 0.03},
+	{"%s sector sells off", -0.05, -0.02},
+	{"New regulations weigh on the %s sector", -0.04, -0.01},
+}
+
+var marketTemplates = []eventTemplate{
+	{"Central bank cuts interest rates", 0.01, 0.03},
+	{"Jobs report comes in stronger than expected", 0.005, 0.02},
+	{"Recession fears grip the market", -0.03, -0.01},
+	{"Inflation surprises to the upside", -0.02, -0.005},
+}
+
+// RandomEvent makes up a piece of news about a random stock, sector or the whole market,
+// with the given chance of there being any news at all. It uses the simulator's random
+// number generator, so a seed replays the same news.
+func (s *MarketSimulator) RandomEvent(chance float64) (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.sortedIDs()
+	if len(ids) == 0 || s.rng.Float64() >= chance {
+		return Event{}, false
+	}
+
+	var event Event
+	var template eventTemplate
+	var target string
+	switch roll := s.rng.Float64(); {
+	case roll < 0.6:
+		info := s.stocksInfo[ids[s.rng.Intn(len(ids))]]
+		template = stockTemplates[s.rng.Intn(len(stockTemplates))]
+		event = Event{Scope: ScopeStock, StockID: info.ID}
+		target = info.Symbol
+	case roll < 0.9:
+		sectors := s.sortedSectors()
+		sector := sectors[s.rng.Intn(len(sectors))]
+		template = sectorTemplates[s.rng.Intn(len(sectorTemplates))]
+		event = Event{Scope: ScopeSector, Sector: sector}
+		target = sector
+	default:
+		template = marketTemplates[s.rng.Intn(len(marketTemplates))]
+		event = Event{Scope: ScopeMarket}
+	}
+
+	if target != "" {
+		event.Headline = fmt.Sprintf(template.headline, target)
+	} else {
+		event.Headline = template.headline
+	}
+	event.PriceImpact = template.minImpact + s.rng.Float64()*(template.maxImpact-template.minImpact)
+	event.PriceImpact = math.Round(event.PriceImpact*10000) / 10000
+	// News keeps pushing the price the same way for a while, by a fraction of the initial move
+	event.TrendImpact = math.Round(event.PriceImpact*0.1*10000) / 10000
+
+	return event, true
+}
+
+// sortedIDs returns the IDs of the simulated stocks in order. The caller must hold the lock.
+func (s *MarketSimulator) sortedIDs() []int {
+	ids := make([]int, 0, len(s.stocksInfo))
+	for id := range s.stocksInfo {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// sortedSectors returns the sectors of the simulated stocks in order. The caller must hold the lock.
+func (s *MarketSimulator) sortedSectors() []string {
+	var sectors []string
+	seen := make(map[string]bool)
+	for _, info := range s.stocksInfo {
+		if !seen[info.Sector] {
+			seen[info.Sector] = true
+			sectors = append(sectors, info.Sector)
+		}
+	}
+	sort.Strings(sectors)
+	return sectors
+}
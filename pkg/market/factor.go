@@ -0,0 +1,64 @@
+package market
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// FactorConfig sets how much the whole market and each sector move together every tick
+type FactorConfig struct {
+	MarketSigma float64 // Standard deviation of the market-wide log return shared by every stock
+	SectorSigma float64 // Standard deviation of the log return shared by the stocks in a sector
+}
+
+// DefaultFactorConfig returns the factor settings used unless overridden
+func DefaultFactorConfig() FactorConfig {
+	return FactorConfig{
+		MarketSigma: 0.005,
+		SectorSigma: 0.008,
+	}
+}
+
+// Betas scale how strongly a stock follows the market and its sector
+type Betas struct {
+	Market float64 `json:"market_beta"`
+	Sector float64 `json:"sector_beta"`
+}
+
+// DefaultBetas makes a stock move one for one with the market and its sector
+func DefaultBetas() Betas {
+	return Betas{Market: 1, Sector: 1}
+}
+
+// Validate checks that the betas are within a sensible range
+func (b Betas) Validate() error {
+	if math.Abs(b.Market) > 5 || math.Abs(b.Sector) > 5 {
+		return errors.New("betas must be between -5 and 5")
+	}
+	return nil
+}
+
+// factorReturns holds the shared log returns drawn for one tick
+type factorReturns struct {
+	market  float64
+	sectors map[string]float64
+}
+
+// drawFactors draws the market and sector returns for a tick. Sectors must be in
+// name order so a seed always hands them the same random numbers.
+func drawFactors(rng *rand.Rand, cfg FactorConfig, sectors []string) factorReturns {
+	factors := factorReturns{
+		market:  cfg.MarketSigma * rng.NormFloat64(),
+		sectors: make(map[string]float64, len(sectors)),
+	}
+	for _, sector := range sectors {
+		factors.sectors[sector] = cfg.SectorSigma * rng.NormFloat64()
+	}
+	return factors
+}
+
+// stockReturn blends the shared returns for a stock according to its betas
+func (f factorReturns) stockReturn(info StockInfo) float64 {
+	return info.Betas.Market*f.market + info.Betas.Sector*f.sectors[info.Sector]
+}
@@ -0,0 +1,262 @@
+package market
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// Reasons trading in a stock can be halted
+const (
+	HaltLimitUp         = "limit_up"         // The price rose through its upper band
+	HaltLimitDown       = "limit_down"       // The price fell through its lower band
+	HaltCircuitBreaker  = "circuit_breaker"  // The whole market fell too far too fast
+	HaltAdmin           = "admin"            // An admin halted the stock
+	HaltCorporateAction = "corporate_action" // A split is being applied
+	HaltDelisting       = "delisting"        // The stock is being delisted
+)
+
+// HaltConfig sets the price bands and circuit breakers that halt trading
+type HaltConfig struct {
+	BandPercent        float64       // Largest move from the reference price before a stock halts; 0 turns bands off
+	BandWindow         time.Duration // How long a reference price lasts before it is reset to the current price
+	HaltDuration       time.Duration // How long a stock halts for after breaking a band
+	MarketDropPercent  float64       // Fall in the market index within MarketWindow that halts every stock; 0 turns it off
+	MarketWindow       time.Duration // Window the market index fall is measured over
+	MarketHaltDuration time.Duration // How long the whole market halts for
+}
+
+// DefaultHaltConfig returns the halt settings used unless overridden
+func DefaultHaltConfig() HaltConfig {
+	return HaltConfig{
+		BandPercent:        0.10,
+		BandWindow:         5 * time.Minute,
+		HaltDuration:       5 * time.Minute,
+		MarketDropPercent:  0.07,
+		MarketWindow:       15 * time.Minute,
+		MarketHaltDuration: 15 * time.Minute,
+	}
+}
+
+// Halt says why trading in a stock is stopped and until when
+type Halt struct {
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitempty"` // Zero until an admin resumes the stock
+}
+
+// HaltEvent reports a stock being halted or resumed
+type HaltEvent struct {
+	StockID int         `json:"stock_id"`
+	Symbol  string      `json:"symbol"`
+	Halted  bool        `json:"halted"`
+	Reason  string      `json:"reason,omitempty"`
+	Price   money.Money `json:"price"`
+	Until   time.Time   `json:"until,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// indexPoint is the market index at one tick
+type indexPoint struct {
+	time  time.Time
+	value float64
+}
+
+// SetHaltConfig sets the price bands and circuit breakers
+func (s *MarketSimulator) SetHaltConfig(cfg HaltConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.haltConfig = cfg
+	s.indexHistory = nil
+}
+
+// GetHaltChannel returns the channel for receiving halt and resume events
+func (s *MarketSimulator) GetHaltChannel() <-chan HaltEvent {
+	return s.haltChan
+}
+
+// HaltStock stops trading in a stock for the given duration, or until ResumeStock if it is 0
+func (s *MarketSimulator) HaltStock(stockID int, reason string, duration time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return errors.New("stock is not being simulated")
+	}
+
+	s.halt(&info, reason, duration, s.clock.Now())
+	s.stocksInfo[stockID] = info
+	return nil
+}
+
+// ResumeStock restarts trading in a halted stock
+func (s *MarketSimulator) ResumeStock(stockID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return errors.New("stock is not being simulated")
+	}
+	if info.Halt == nil {
+		return errors.New("stock is not halted")
+	}
+
+	s.resume(&info, s.clock.Now())
+	s.stocksInfo[stockID] = info
+	return nil
+}
+
+// GetHalt returns why a stock is halted, or nil if it is trading
+func (s *MarketSimulator) GetHalt(stockID int) *Halt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists || !info.isHalted(s.clock.Now()) {
+		return nil
+	}
+	halt := *info.Halt
+	return &halt
+}
+
+// GetHalts returns every halted stock's halt, by stock ID
+func (s *MarketSimulator) GetHalts() map[int]Halt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	halts := make(map[int]Halt)
+	for id, info := range s.stocksInfo {
+		if info.isHalted(now) {
+			halts[id] = *info.Halt
+		}
+	}
+	return halts
+}
+
+// isHalted reports whether trading in the stock is stopped at now
+func (info StockInfo) isHalted(now time.Time) bool {
+	return info.Halt != nil && (info.Halt.Until.IsZero() || now.Before(info.Halt.Until))
+}
+
+// halt stops trading in a stock and reports it. The caller must hold the lock.
+func (s *MarketSimulator) halt(info *StockInfo, reason string, duration time.Duration, now time.Time) {
+	info.Halt = &Halt{Reason: reason, Since: now}
+	if duration > 0 {
+		info.Halt.Until = now.Add(duration)
+	}
+
+	s.sendHaltEvent(HaltEvent{
+		StockID: info.ID,
+		Symbol:  info.Symbol,
+		Halted:  true,
+		Reason:  reason,
+		Price:   info.BasePrice,
+		Until:   info.Halt.Until,
+		Time:    now,
+	})
+}
+
+// resume restarts trading in a stock, with a fresh band around its price, and reports it.
+// The caller must hold the lock.
+func (s *MarketSimulator) resume(info *StockInfo, now time.Time) {
+	info.Halt = nil
+	info.BandReference = info.BasePrice
+	info.BandSetAt = now
+
+	s.sendHaltEvent(HaltEvent{
+		StockID: info.ID,
+		Symbol:  info.Symbol,
+		Price:   info.BasePrice,
+		Time:    now,
+	})
+}
+
+// sendHaltEvent reports a halt or resume without blocking
+func (s *MarketSimulator) sendHaltEvent(event HaltEvent) {
+	select {
+	case s.haltChan <- event:
+	default:
+		// Channel is full, skip this event
+	}
+}
+
+// applyBands holds a new price within the stock's band. A price that breaks the band is
+// stopped at its edge and the stock is halted. The caller must hold the lock.
+func (s *MarketSimulator) applyBands(info *StockInfo, newPrice money.Money, now time.Time) money.Money {
+	cfg := s.haltConfig
+	if cfg.BandPercent <= 0 {
+		return newPrice
+	}
+
+	// Start a new band when there isn't one or the current one is too old
+	if info.BandReference <= 0 || now.Sub(info.BandSetAt) >= cfg.BandWindow {
+		info.BandReference = info.BasePrice
+		info.BandSetAt = now
+	}
+
+	// The band's edges are whole cents inside it
+	upper := money.Money(math.Floor(float64(info.BandReference) * (1 + cfg.BandPercent)))
+	lower := money.Money(math.Ceil(float64(info.BandReference) * (1 - cfg.BandPercent)))
+
+	switch {
+	case newPrice > upper:
+		info.BasePrice = upper
+		s.halt(info, HaltLimitUp, cfg.HaltDuration, now)
+		return upper
+	case newPrice < lower:
+		info.BasePrice = lower
+		s.halt(info, HaltLimitDown, cfg.HaltDuration, now)
+		return lower
+	}
+	return newPrice
+}
+
+// checkCircuitBreaker records the market index and halts every stock if it has fallen
+// too far within the window. The caller must hold the lock.
+func (s *MarketSimulator) checkCircuitBreaker(now time.Time) {
+	cfg := s.haltConfig
+	if cfg.MarketDropPercent <= 0 || len(s.stocksInfo) == 0 {
+		return
+	}
+
+	// An equal-weighted index of every stock's price relative to where it started
+	var index float64
+	for _, info := range s.stocksInfo {
+		if info.InitialPrice > 0 {
+			index += info.BasePrice.Float() / info.InitialPrice.Float()
+		}
+	}
+	index /= float64(len(s.stocksInfo))
+
+	// Keep only the points within the window
+	s.indexHistory = append(s.indexHistory, indexPoint{now, index})
+	start := 0
+	for start < len(s.indexHistory) && now.Sub(s.indexHistory[start].time) > cfg.MarketWindow {
+		start++
+	}
+	s.indexHistory = s.indexHistory[start:]
+
+	high := index
+	for _, point := range s.indexHistory {
+		high = math.Max(high, point.value)
+	}
+	if index > high*(1-cfg.MarketDropPercent) {
+		return
+	}
+
+	// Halt everything, and measure the next fall from where the market reopens
+	for _, id := range s.sortedIDs() {
+		info := s.stocksInfo[id]
+		if !info.isHalted(now) {
+			s.halt(&info, HaltCircuitBreaker, cfg.MarketHaltDuration, now)
+			s.stocksInfo[id] = info
+		}
+	}
+	s.indexHistory = nil
+}
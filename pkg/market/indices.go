@@ -0,0 +1,196 @@
+package market
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// CompositeIndexCode is the code of the index that covers every stock
+const CompositeIndexCode = "COMPOSITE"
+
+// indexBase is the level an index starts at
+const indexBase = 1000.0
+
+// IndexValue is a market index's level at one tick
+type IndexValue struct {
+	Code    string    `json:"code"`
+	Name    string    `json:"name"`
+	Sector  string    `json:"sector,omitempty"` // Empty for the composite
+	Value   float64   `json:"value"`
+	Members int       `json:"members"`
+	Time    time.Time `json:"time"`
+}
+
+// indexState is a price-weighted index: the sum of its members' prices over a divisor.
+// The divisor changes whenever members join, leave or split, so the index only moves
+// when the market does.
+type indexState struct {
+	name    string
+	sector  string
+	divisor float64
+}
+
+// indexSum is the total price and number of an index's members
+type indexSum struct {
+	total   money.Money
+	members int
+}
+
+// SectorIndexCode returns the code of a sector's index: the sector name in capitals,
+// with anything but letters and digits turned into underscores
+func SectorIndexCode(sector string) string {
+	var code strings.Builder
+	underscore := false
+	for _, r := range strings.ToUpper(strings.TrimSpace(sector)) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			code.WriteRune(r)
+			underscore = false
+		} else if !underscore && code.Len() > 0 {
+			code.WriteByte('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(code.String(), "_")
+}
+
+// GetIndexChannel returns the channel that receives every index's level after each tick
+func (s *MarketSimulator) GetIndexChannel() <-chan []IndexValue {
+	return s.indexChan
+}
+
+// Indices returns every index's current level, the composite first and then the sectors by code
+func (s *MarketSimulator) Indices() []IndexValue {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.indexValues(s.clock.Now())
+}
+
+// SetIndexLevels carries indices on from the levels they were last at, for example before a
+// restart. Indices missing from levels keep their current level.
+func (s *MarketSimulator) SetIndexLevels(levels map[string]float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums := s.indexSums()
+	for code, level := range levels {
+		if level <= 0 {
+			return errors.New("index levels must be positive")
+		}
+		if index, exists := s.indices[code]; exists {
+			index.divisor = sums[code].total.Float() / level
+		}
+	}
+	return nil
+}
+
+// adjustIndices makes a change to the stocks that shouldn't move the market, such as adding,
+// removing or splitting a stock, and changes the divisors so every index stays at its level.
+// New sectors get an index starting at the base level; sectors left empty lose theirs.
+// The caller must hold the lock.
+func (s *MarketSimulator) adjustIndices(change func()) {
+	before := s.indexSums()
+	change()
+	after := s.indexSums()
+
+	for code, index := range s.indices {
+		sum, exists := after[code]
+		if !exists {
+			delete(s.indices, code)
+			continue
+		}
+		if index.divisor > 0 && before[code].total > 0 {
+			level := before[code].total.Float() / index.divisor
+			index.divisor = sum.total.Float() / level
+		}
+	}
+
+	for code, sum := range after {
+		if _, exists := s.indices[code]; exists {
+			continue
+		}
+		index := &indexState{divisor: sum.total.Float() / indexBase}
+		if code == CompositeIndexCode {
+			index.name = "Office Stonks Composite"
+		} else {
+			index.sector = s.sectorOfIndex(code)
+			index.name = index.sector + " Index"
+		}
+		s.indices[code] = index
+	}
+}
+
+// indexSums adds up the prices of each index's members. The caller must hold the lock.
+func (s *MarketSimulator) indexSums() map[string]indexSum {
+	sums := make(map[string]indexSum)
+	for _, info := range s.stocksInfo {
+		for _, code := range []string{CompositeIndexCode, SectorIndexCode(info.Sector)} {
+			if code == "" {
+				continue
+			}
+			sum := sums[code]
+			sum.total += info.BasePrice
+			sum.members++
+			sums[code] = sum
+		}
+	}
+	return sums
+}
+
+// sectorOfIndex finds the sector a sector index code belongs to. The caller must hold the lock.
+func (s *MarketSimulator) sectorOfIndex(code string) string {
+	for _, id := range s.sortedIDs() {
+		if sector := s.stocksInfo[id].Sector; SectorIndexCode(sector) == code {
+			return sector
+		}
+	}
+	return code
+}
+
+// indexValues works out every index's level. The caller must hold the lock.
+func (s *MarketSimulator) indexValues(now time.Time) []IndexValue {
+	sums := s.indexSums()
+
+	values := make([]IndexValue, 0, len(s.indices))
+	for code, index := range s.indices {
+		sum := sums[code]
+		if index.divisor <= 0 || sum.members == 0 {
+			continue
+		}
+		values = append(values, IndexValue{
+			Code:    code,
+			Name:    index.name,
+			Sector:  index.sector,
+			Value:   math.Round(sum.total.Float()/index.divisor*100) / 100,
+			Members: sum.members,
+			Time:    now,
+		})
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		if (values[i].Code == CompositeIndexCode) != (values[j].Code == CompositeIndexCode) {
+			return values[i].Code == CompositeIndexCode
+		}
+		return values[i].Code < values[j].Code
+	})
+	return values
+}
+
+// publishIndices sends every index's level without blocking. The caller must hold the lock.
+func (s *MarketSimulator) publishIndices(now time.Time) {
+	values := s.indexValues(now)
+	if len(values) == 0 {
+		return
+	}
+
+	select {
+	case s.indexChan <- values:
+	default:
+		// Channel is full, skip this tick's levels
+	}
+}
@@ -0,0 +1,131 @@
+package market
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// varianceDecay is how much of a stock's variance estimate carries over each tick.
+// The rest comes from the tick's squared log return, as in RiskMetrics.
+const varianceDecay = 0.94
+
+// secondsPerYear is the length of the year options are priced over
+const secondsPerYear = 365 * 24 * 60 * 60
+
+// sessionsPerYear is how many trading sessions there are in a year. The simulator moves prices
+// about as much in a tick as a real stock moves in a session, so each tick is annualised as one.
+const sessionsPerYear = 252
+
+// Volatilities are kept within the range real stocks trade in, so a burst of news or a jump
+// can't price options at many times the stock's value
+const (
+	minVolatility = 0.1
+	maxVolatility = 1.5
+)
+
+// OptionQuote is an option's Black-Scholes price and Greeks, per share of the underlying
+type OptionQuote struct {
+	Price float64 `json:"price"`
+	Delta float64 `json:"delta"` // Change in price for a 1.00 move in the underlying
+	Gamma float64 `json:"gamma"` // Change in delta for a 1.00 move in the underlying
+	Theta float64 `json:"theta"` // Change in price over one day
+	Vega  float64 `json:"vega"`  // Change in price for a one point (1%) rise in volatility
+	Rho   float64 `json:"rho"`   // Change in price for a one point (1%) rise in the interest rate
+}
+
+// BlackScholes prices a European call or put on a stock paying no dividends. Years is the
+// time left to expiry, and rate and volatility are annual. At or after expiry, or with no
+// volatility, the option is worth what it would pay out if exercised now.
+func BlackScholes(isCall bool, spot, strike, years, rate, volatility float64) OptionQuote {
+	if years <= 0 || volatility <= 0 || spot <= 0 || strike <= 0 {
+		var quote OptionQuote
+		switch {
+		case isCall && spot > strike:
+			quote.Price, quote.Delta = spot-strike, 1
+		case !isCall && strike > spot:
+			quote.Price, quote.Delta = strike-spot, -1
+		}
+		return quote
+	}
+
+	sqrtT := math.Sqrt(years)
+	d1 := (math.Log(spot/strike) + (rate+volatility*volatility/2)*years) / (volatility * sqrtT)
+	d2 := d1 - volatility*sqrtT
+	discount := math.Exp(-rate * years)
+
+	quote := OptionQuote{
+		Gamma: normPDF(d1) / (spot * volatility * sqrtT),
+		Vega:  spot * normPDF(d1) * sqrtT / 100,
+	}
+	decay := -spot * normPDF(d1) * volatility / (2 * sqrtT)
+	if isCall {
+		quote.Price = spot*normCDF(d1) - strike*discount*normCDF(d2)
+		quote.Delta = normCDF(d1)
+		quote.Theta = (decay - rate*strike*discount*normCDF(d2)) / 365
+		quote.Rho = strike * years * discount * normCDF(d2) / 100
+	} else {
+		quote.Price = strike*discount*normCDF(-d2) - spot*normCDF(-d1)
+		quote.Delta = normCDF(d1) - 1
+		quote.Theta = (decay + rate*strike*discount*normCDF(-d2)) / 365
+		quote.Rho = -strike * years * discount * normCDF(-d2) / 100
+	}
+	quote.Price = math.Max(quote.Price, 0)
+	return quote
+}
+
+// normCDF is the standard normal cumulative distribution function
+func normCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+// normPDF is the standard normal probability density function
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+// YearsUntil returns the time from now until expiry in years, or 0 if it has passed
+func YearsUntil(now, expiry time.Time) float64 {
+	return math.Max(expiry.Sub(now).Seconds(), 0) / secondsPerYear
+}
+
+// recordReturn folds a tick's move into a stock's variance estimate
+func (info *StockInfo) recordReturn(oldPrice, newPrice money.Money) {
+	if oldPrice <= 0 || newPrice <= 0 {
+		return
+	}
+
+	r := math.Log(float64(newPrice) / float64(oldPrice))
+	if info.Variance == 0 {
+		info.Variance = r * r
+		return
+	}
+	info.Variance = varianceDecay*info.Variance + (1-varianceDecay)*r*r
+}
+
+// Volatility returns a stock's annualised volatility. It comes from the stock's recent price
+// moves or, before it has any, from its price model and the market and sector factors.
+// Annualising the ticks by wall-clock time would give volatilities in the hundreds, as the
+// simulator makes a session's worth of move every few seconds.
+func (s *MarketSimulator) Volatility(stockID int) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return 0, errors.New("stock is not being simulated")
+	}
+
+	perTick := math.Sqrt(info.Variance)
+	if info.Variance == 0 {
+		params := s.paramsFor(info)
+		marketSigma := info.Betas.Market * s.factors.MarketSigma
+		sectorSigma := info.Betas.Sector * s.factors.SectorSigma
+		perTick = math.Sqrt(params.Sigma*params.Sigma + marketSigma*marketSigma + sectorSigma*sectorSigma)
+	}
+
+	volatility := perTick * math.Sqrt(sessionsPerYear)
+	return math.Min(math.Max(volatility, minVolatility), maxVolatility), nil
+}
@@ -0,0 +1,173 @@
+package market
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"officestonks/pkg/money"
+)
+
+// Names of the built-in price models
+const (
+	ModelTrend         = "trend" // Random moves biased by trends that reverse, with occasional jumps
+	ModelGBM           = "gbm"   // Geometric Brownian motion
+	ModelOU            = "ou"    // Ornstein-Uhlenbeck mean reversion of the log price
+	ModelJumpDiffusion = "jump"  // Merton jump-diffusion: GBM plus randomly timed jumps
+)
+
+// ModelParams picks a stock's price model and tunes it. Rates are per simulator tick.
+type ModelParams struct {
+	Model         string      `json:"model"`
+	Drift         float64     `json:"drift"`                    // Expected log return per tick (gbm, jump)
+	Sigma         float64     `json:"sigma"`                    // Volatility per tick
+	MeanReversion float64     `json:"mean_reversion,omitempty"` // Fraction of the gap to the mean closed each tick (ou)
+	MeanPrice     money.Money `json:"mean_price,omitempty"`     // Price the stock reverts to; 0 means its initial price (ou)
+	JumpIntensity float64     `json:"jump_intensity,omitempty"` // Expected jumps per tick (jump)
+	JumpMean      float64     `json:"jump_mean,omitempty"`      // Mean log size of a jump (jump)
+	JumpStdDev    float64     `json:"jump_stddev,omitempty"`    // Standard deviation of the log size of a jump (jump)
+}
+
+// Validate checks that the params name a known model and make sense for it
+func (p ModelParams) Validate() error {
+	if _, ok := priceModels[p.Model]; !ok {
+		return errors.New("model must be 'trend', 'gbm', 'ou' or 'jump'")
+	}
+	if p.Sigma < 0 || p.JumpStdDev < 0 || p.MeanPrice < 0 {
+		return errors.New("sigma, jump_stddev and mean_price cannot be negative")
+	}
+	if p.MeanReversion < 0 || p.MeanReversion > 1 {
+		return errors.New("mean_reversion must be between 0 and 1")
+	}
+	if p.JumpIntensity < 0 || p.JumpIntensity > 1 {
+		return errors.New("jump_intensity must be between 0 and 1")
+	}
+	return nil
+}
+
+// PriceModel works out a stock's next price from its current one. Models may keep
+// state between ticks in the StockInfo, and must draw all randomness from rng.
+// The price comes back unrounded; the simulator rounds it to the cent.
+type PriceModel interface {
+	NextPrice(rng *rand.Rand, info *StockInfo, params ModelParams) float64
+}
+
+// priceModels holds the built-in models by name
+var priceModels = map[string]PriceModel{
+	ModelTrend:         TrendModel{},
+	ModelGBM:           GBMModel{},
+	ModelOU:            OUModel{},
+	ModelJumpDiffusion: JumpDiffusionModel{},
+}
+
+// LookupPriceModel returns the built-in model with the given name
+func LookupPriceModel(name string) (PriceModel, bool) {
+	model, ok := priceModels[name]
+	return model, ok
+}
+
+// TrendModel is the simulator's original model: uniform noise of width Sigma plus a
+// trend that lasts a few ticks and tends to reverse, with a 5% chance of a jump each tick.
+type TrendModel struct{}
+
+// NextPrice implements PriceModel
+func (TrendModel) NextPrice(rng *rand.Rand, info *StockInfo, params ModelParams) float64 {
+	// Check if we need to change the trend
+	if info.TrendCounter <= 0 {
+		// Time to reverse or modify the trend
+		// Stronger reversal for extreme trends (mean reversion)
+		reversalStrength := 1.0 + math.Abs(info.Trend)*5
+
+		// Generate new trend - more likely to reverse direction
+		if rng.Float64() < 0.7 { // 70% chance of trend reversal
+			// Reverse the trend with some randomness, amplified by reversalStrength
+			info.Trend = -info.Trend * (0.5 + rng.Float64()) * math.Min(reversalStrength, 3.0)
+		} else {
+			// Modify current trend with dampening (regression to mean)
+			// Stronger dampening for extreme trends
+			dampening := 0.3 + rng.Float64()*0.4         // 30-70% of current trend
+			dampening /= math.Min(reversalStrength, 2.0) // More dampening for extreme trends
+			info.Trend = info.Trend * dampening
+		}
+
+		// Set new duration for this trend
+		info.TrendCounter = rng.Intn(15) + 5 // 5-20 updates
+	} else {
+		info.TrendCounter--
+	}
+
+	// Base random change plus the trend bias
+	randomChange := (rng.Float64() - 0.5) * params.Sigma
+	newPrice := info.BasePrice.Float() * (1 + randomChange + info.Trend)
+
+	// Ensure price doesn't go below 0.01
+	if newPrice < 0.01 {
+		newPrice = 0.01
+	}
+
+	// Add some randomness to make prices jumpy sometimes (market surprises)
+	if rng.Float64() < 0.05 { // 5% chance of a price jump
+		if rng.Float64() < 0.5 {
+			newPrice *= 1.0 + (rng.Float64() * 0.05) // 0-5% jump up
+		} else {
+			newPrice *= 1.0 - (rng.Float64() * 0.05) // 0-5% jump down
+		}
+	}
+
+	return newPrice
+}
+
+// GBMModel moves the log price by Drift plus normal noise with standard deviation Sigma
+type GBMModel struct{}
+
+// NextPrice implements PriceModel
+func (GBMModel) NextPrice(rng *rand.Rand, info *StockInfo, params ModelParams) float64 {
+	return info.BasePrice.Float() * math.Exp(params.Drift-params.Sigma*params.Sigma/2+params.Sigma*rng.NormFloat64())
+}
+
+// OUModel pulls the log price towards the log of MeanPrice, closing MeanReversion of the gap each tick
+type OUModel struct{}
+
+// NextPrice implements PriceModel
+func (OUModel) NextPrice(rng *rand.Rand, info *StockInfo, params ModelParams) float64 {
+	mean := params.MeanPrice
+	if mean <= 0 {
+		mean = info.InitialPrice
+	}
+
+	logPrice := math.Log(info.BasePrice.Float())
+	logPrice += params.MeanReversion*(math.Log(mean.Float())-logPrice) + params.Sigma*rng.NormFloat64()
+	return math.Exp(logPrice)
+}
+
+// JumpDiffusionModel is GBM plus jumps that arrive JumpIntensity times per tick on average,
+// each moving the log price by a normal amount. The drift is adjusted so jumps don't change
+// the expected return.
+type JumpDiffusionModel struct{}
+
+// NextPrice implements PriceModel
+func (JumpDiffusionModel) NextPrice(rng *rand.Rand, info *StockInfo, params ModelParams) float64 {
+	expectedJump := math.Exp(params.JumpMean+params.JumpStdDev*params.JumpStdDev/2) - 1
+	logReturn := params.Drift - params.JumpIntensity*expectedJump - params.Sigma*params.Sigma/2 +
+		params.Sigma*rng.NormFloat64()
+
+	for jumps := poisson(rng, params.JumpIntensity); jumps > 0; jumps-- {
+		logReturn += params.JumpMean + params.JumpStdDev*rng.NormFloat64()
+	}
+
+	return info.BasePrice.Float() * math.Exp(logReturn)
+}
+
+// poisson draws from a Poisson distribution with a small mean
+func poisson(rng *rand.Rand, mean float64) int {
+	if mean <= 0 {
+		return 0
+	}
+
+	limit := math.Exp(-mean)
+	count := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		count++
+	}
+	return count
+}
@@ -1,17 +1,32 @@
 package market
 
 import (
+	"errors"
 	"math"
 	"math/rand"
 	"sync"
 	"time"
+
+	"officestonks/pkg/money"
 )
 
+// Clock tells the simulator what time it is. Tests and replays can supply their own.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
 // StockUpdate represents a price update for a stock
 type StockUpdate struct {
 	StockID int
 	Symbol  string
-	Price   float64
+	Price   money.Money // Rounded to the cent, as stocks are priced
+	Volume  float64     // Shares traded since the previous update for this stock
+	Time    time.Time   // When the price was set
 }
 
 // MarketSimulator handles the stock price simulation
@@ -22,45 +37,273 @@ type MarketSimulator struct {
 	mu             sync.RWMutex
 	updateChan     chan StockUpdate
 	stopChan       chan struct{}
+	rng            *rand.Rand // Source of every random number, so a seed replays the same market
+	source         *countingSource
+	seed           int64
+	clock          Clock
+	defaultParams  ModelParams            // Model for stocks with no stock or sector params
+	sectorParams   map[string]ModelParams // Models shared by every stock in a sector
+	factors        FactorConfig           // Market and sector moves shared between stocks
+	calendar       *Calendar              // When the market is open; nil means always
+	closedEvery    int                    // Outside sessions prices move every this many ticks; 0 pauses them
+	closedTicks    int
+	haltConfig     HaltConfig             // Price bands and circuit breakers
+	haltChan       chan HaltEvent         // Halts and resumes
+	indexHistory   []indexPoint           // Market index over the circuit breaker window
+	flowConfig     FlowConfig             // How volume is tracked and how order flow moves prices
+	flows          map[int][]flowTrade    // Each stock's trades over the last interval
+	earningsConfig EarningsConfig         // How prices react to earnings surprises
+	indices        map[string]*indexState // Composite and sector indices by code
+	indexChan      chan []IndexValue      // Every index's level after each tick
 }
 
 // StockInfo contains information about a stock for simulation
 type StockInfo struct {
-	ID           int
-	Symbol       string
-	BasePrice    float64
-	Sector       string
-	Trend        float64  // Bias for price movement: positive means upward trend, negative means downward
-	TrendCounter int      // Counter to track trend duration
+	ID            int
+	Symbol        string
+	BasePrice     money.Money
+	Sector        string
+	Trend         float64      // Bias for price movement: positive means upward trend, negative means downward
+	TrendCounter  int          // Counter to track trend duration
+	PendingVolume float64      // Shares traded since the last update that was sent
+	InitialPrice  money.Money  // Price the stock was added at, less any splits
+	Params        *ModelParams // The stock's own price model, if it has one
+	Betas         Betas        // How strongly the stock follows the market and its sector
+	Momentum      float64      // Extra return per tick from recent news, fading each tick
+	Halt          *Halt        // Why trading is stopped, if it is
+	BandReference money.Money  // Price the limit-up/limit-down band is centred on
+	BandSetAt     time.Time    // When the band's reference price was set
+	Variance      float64      // Recent variance of the log return per tick, for pricing options
 }
 
-// NewMarketSimulator creates a new market simulator
+// NewMarketSimulator creates a new market simulator with a random seed taken from the current time
 func NewMarketSimulator(updateInterval time.Duration, volatility float64) *MarketSimulator {
+	seed := time.Now().UnixNano()
+	source := newCountingSource(seed)
 	return &MarketSimulator{
 		stocksInfo:     make(map[int]StockInfo),
 		updateInterval: updateInterval,
 		volatility:     volatility,
 		updateChan:     make(chan StockUpdate, 100),
 		stopChan:       make(chan struct{}),
+		rng:            rand.New(source),
+		source:         source,
+		seed:           seed,
+		clock:          systemClock{},
+		defaultParams:  ModelParams{Model: ModelTrend, Sigma: volatility},
+		sectorParams:   make(map[string]ModelParams),
+		factors:        DefaultFactorConfig(),
+		haltConfig:     DefaultHaltConfig(),
+		haltChan:       make(chan HaltEvent, 100),
+		flowConfig:     DefaultFlowConfig(),
+		flows:          make(map[int][]flowTrade),
+		earningsConfig: DefaultEarningsConfig(),
+		indices:        make(map[string]*indexState),
+		indexChan:      make(chan []IndexValue, 100),
 	}
 }
 
+// SetSeed restarts the random number generator from seed. Call it before adding stocks
+// so that the initial trends are reproduced as well.
+func (s *MarketSimulator) SetSeed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source = newCountingSource(seed)
+	s.rng = rand.New(s.source)
+	s.seed = seed
+}
+
+// Seed returns the seed the random number generator was last started from
+func (s *MarketSimulator) Seed() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.seed
+}
+
+// SetClock replaces the clock used to timestamp updates
+func (s *MarketSimulator) SetClock(clock Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = clock
+}
+
+// Now returns the current time on the simulator's clock
+func (s *MarketSimulator) Now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.clock.Now()
+}
+
 // AddStock adds a stock to the simulator
-func (s *MarketSimulator) AddStock(id int, symbol, sector string, basePrice float64) {
+func (s *MarketSimulator) AddStock(id int, symbol, sector string, price money.Money) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
 	// Initialize with a random trend (slightly biased upward for a bull market)
-	initialTrend := (rand.Float64() * 0.1) - 0.03  // Range: -0.03 to 0.07, slightly positive bias
+	initialTrend := (s.rng.Float64() * 0.1) - 0.03  // Range: -0.03 to 0.07, slightly positive bias
+
+	trendCounter := s.rng.Intn(10) + 5 // Random initial trend duration (5-15 updates)
+
+	// A new member mustn't move the indices
+	s.adjustIndices(func() {
+		s.stocksInfo[id] = StockInfo{
+			ID:           id,
+			Symbol:       symbol,
+			BasePrice:    price,
+			InitialPrice: price,
+			Betas:        DefaultBetas(),
+			Sector:       sector,
+			Trend:        initialTrend,
+			TrendCounter: trendCounter,
+		}
+	})
 
-	s.stocksInfo[id] = StockInfo{
-		ID:           id,
-		Symbol:       symbol,
-		BasePrice:    basePrice,
-		Sector:       sector,
-		Trend:        initialTrend,
-		TrendCounter: rand.Intn(10) + 5, // Random initial trend duration (5-15 updates)
+	// The circuit breaker's index has a new member, so start its history again
+	s.indexHistory = nil
+}
+
+// RemoveStock stops simulating a stock and returns its last price
+func (s *MarketSimulator) RemoveStock(id int) (money.Money, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[id]
+	if !exists {
+		return 0, errors.New("stock is not being simulated")
 	}
+
+	s.adjustIndices(func() {
+		delete(s.stocksInfo, id)
+	})
+	delete(s.flows, id)
+	s.indexHistory = nil
+
+	return info.BasePrice, nil
+}
+
+// SetStockSector moves a stock into another sector, so it follows that sector's moves and price model
+func (s *MarketSimulator) SetStockSector(id int, sector string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[id]
+	if !exists {
+		return errors.New("stock is not being simulated")
+	}
+
+	info.Sector = sector
+	s.adjustIndices(func() {
+		s.stocksInfo[id] = info
+	})
+	return nil
+}
+
+// SetStockParams gives a stock its own price model, or with nil goes back to its sector's or the default
+func (s *MarketSimulator) SetStockParams(stockID int, params *ModelParams) error {
+	if params != nil {
+		if err := params.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return errors.New("stock is not being simulated")
+	}
+	info.Params = params
+	s.stocksInfo[stockID] = info
+
+	return nil
+}
+
+// SetSectorParams sets the price model for stocks in a sector that don't have their own,
+// or with nil goes back to the default
+func (s *MarketSimulator) SetSectorParams(sector string, params *ModelParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if params == nil {
+		delete(s.sectorParams, sector)
+		return nil
+	}
+	if err := params.Validate(); err != nil {
+		return err
+	}
+	s.sectorParams[sector] = *params
+
+	return nil
+}
+
+// SetCalendar sets when the market is open. Outside sessions prices only move every
+// closedEvery ticks, or not at all if closedEvery is 0.
+func (s *MarketSimulator) SetCalendar(calendar *Calendar, closedEvery int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calendar = calendar
+	s.closedEvery = closedEvery
+	s.closedTicks = 0
+}
+
+// SetFactorConfig sets how much the market and each sector move together
+func (s *MarketSimulator) SetFactorConfig(cfg FactorConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.factors = cfg
+}
+
+// FactorConfig returns how much the market and each sector move together
+func (s *MarketSimulator) FactorConfig() FactorConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.factors
+}
+
+// SetBetas sets how strongly a stock follows the market and its sector
+func (s *MarketSimulator) SetBetas(stockID int, betas Betas) error {
+	if err := betas.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.stocksInfo[stockID]
+	if !exists {
+		return errors.New("stock is not being simulated")
+	}
+	info.Betas = betas
+	s.stocksInfo[stockID] = info
+
+	return nil
+}
+
+// DefaultParams returns the price model used by stocks with no stock or sector params
+func (s *MarketSimulator) DefaultParams() ModelParams {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.defaultParams
+}
+
+// paramsFor picks a stock's price model: its own, then its sector's, then the default
+func (s *MarketSimulator) paramsFor(info StockInfo) ModelParams {
+	if info.Params != nil {
+		return *info.Params
+	}
+	if params, ok := s.sectorParams[info.Sector]; ok {
+		return params
+	}
+	return s.defaultParams
 }
 
 // GetUpdateChannel returns the channel for receiving stock updates
@@ -70,13 +313,16 @@ func (s *MarketSimulator) GetUpdateChannel() <-chan StockUpdate {
 
 // Start begins the market simulation
 func (s *MarketSimulator) Start() {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
-	
 	// Start the simulation loop in a goroutine
 	go s.simulationLoop()
 }
 
+// Step advances the simulation by one tick. It lets a caller drive the market
+// itself instead of calling Start, for example to replay a session or in tests.
+func (s *MarketSimulator) Step() {
+	s.updatePrices()
+}
+
 // Stop halts the market simulation
 func (s *MarketSimulator) Stop() {
 	close(s.stopChan)
@@ -90,7 +336,9 @@ func (s *MarketSimulator) simulationLoop() {
 	for {
 		select {
 		case <-ticker.C:
-			s.updatePrices()
+			if s.shouldTick() {
+				s.updatePrices()
+			}
 		case <-s.stopChan:
 			close(s.updateChan)
 			return
@@ -98,92 +346,100 @@ func (s *MarketSimulator) simulationLoop() {
 	}
 }
 
+// shouldTick reports whether a timer tick should move prices, which outside
+// trading sessions is only every closedEvery ticks
+func (s *MarketSimulator) shouldTick() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.calendar.IsOpen(s.clock.Now()) {
+		s.closedTicks = 0
+		return true
+	}
+
+	s.closedTicks++
+	return s.closedEvery > 0 && s.closedTicks%s.closedEvery == 0
+}
+
 // updatePrices calculates new prices for all stocks
 func (s *MarketSimulator) updatePrices() {
 	s.mu.Lock() // Use write lock since we're updating the stocksInfo
 	defer s.mu.Unlock()
 
-	// Update all stocks
-	for id, info := range s.stocksInfo {
-		// Check if we need to change the trend
-		if info.TrendCounter <= 0 {
-			// Time to reverse or modify the trend
-			// Stronger reversal for extreme trends (mean reversion)
-			reversalStrength := 1.0 + math.Abs(info.Trend)*5
-
-			// Generate new trend - more likely to reverse direction
-			if rand.Float64() < 0.7 { // 70% chance of trend reversal
-				// Reverse the trend with some randomness, amplified by reversalStrength
-				info.Trend = -info.Trend * (0.5 + rand.Float64()) * math.Min(reversalStrength, 3.0)
-			} else {
-				// Modify current trend with dampening (regression to mean)
-				// Stronger dampening for extreme trends
-				dampening := 0.3 + rand.Float64()*0.4 // 30-70% of current trend
-				dampening /= math.Min(reversalStrength, 2.0) // More dampening for extreme trends
-				info.Trend = info.Trend * dampening
-			}
-
-			// Set new duration for this trend
-			info.TrendCounter = rand.Intn(15) + 5 // 5-20 updates
-		} else {
-			info.TrendCounter--
-		}
-
-		// Calculate new price with random fluctuation + trend bias
-		// Base random change
-		randomChange := (rand.Float64() - 0.5) * s.volatility
+	// Update the stocks in ID order so a seed always hands them the same random numbers
+	ids := s.sortedIDs()
 
-		// Add trend bias to the random change
-		biasedChange := randomChange + info.Trend
+	// Draw the moves every stock in the market or a sector shares this tick
+	factors := drawFactors(s.rng, s.factors, s.sortedSectors())
 
-		// Calculate final price change
-		newPrice := info.BasePrice * (1 + biasedChange)
+	now := s.clock.Now()
+	for _, id := range ids {
+		info := s.stocksInfo[id]
 
-		// Ensure price doesn't go below 0.01
-		if newPrice < 0.01 {
-			newPrice = 0.01
+		// Halted stocks are frozen until the halt runs out
+		if info.Halt != nil {
+			if info.isHalted(now) {
+				continue
+			}
+			s.resume(&info, now)
 		}
 
-		// Add some randomness to make prices jumpy sometimes (market surprises)
-		if rand.Float64() < 0.05 { // 5% chance of a price jump
-			jumpMultiplier := 1.0
-			if rand.Float64() < 0.5 {
-				// Positive jump
-				jumpMultiplier = 1.0 + (rand.Float64() * 0.05) // 0-5% jump up
-			} else {
-				// Negative jump
-				jumpMultiplier = 1.0 - (rand.Float64() * 0.05) // 0-5% jump down
-			}
-			newPrice *= jumpMultiplier
+		// Let the stock's price model work out where it goes next
+		params := s.paramsFor(info)
+		model, ok := priceModels[params.Model]
+		if !ok {
+			model = TrendModel{}
 		}
+		newPrice := model.NextPrice(s.rng, &info, params)
+
+		// The model's move is the stock's own; add the market's and its sector's on top
+		newPrice *= math.Exp(factors.stockReturn(info))
+
+		// Recent news keeps pushing the price, less so each tick
+		newPrice *= 1 + info.Momentum
+		info.Momentum *= momentumDecay
 
-		// Round to 2 decimal places
-		newPrice = math.Round(newPrice*100) / 100
+		// So does buying or selling pressure
+		newPrice *= 1 + s.flowReturn(id, now)
+
+		// Round to the cent, keeping the price at 0.01 or more, and stop at the edge of the stock's band
+		price := money.Max(money.FromFloat(newPrice), money.Cent)
+		price = s.applyBands(&info, price, now)
 
 		// Update the base price for future calculations
-		info.BasePrice = newPrice
-		s.stocksInfo[id] = info
+		info.recordReturn(info.BasePrice, price)
+		info.BasePrice = price
 
 		// Send the update
 		select {
 		case s.updateChan <- StockUpdate{
 			StockID: id,
 			Symbol:  info.Symbol,
-			Price:   newPrice,
+			Price:   price,
+			Volume:  info.PendingVolume,
+			Time:    now,
 		}:
+			info.PendingVolume = 0
 		default:
 			// Channel is full, skip this update
 		}
+		s.stocksInfo[id] = info
 	}
+
+	// Halt the whole market if it has fallen too far too fast
+	s.checkCircuitBreaker(now)
+
+	// Tell listeners where the indices closed the tick
+	s.publishIndices(now)
 }
 
 // ProcessTransaction simulates market impact of a transaction
-func (s *MarketSimulator) ProcessTransaction(stockID int, quantity int, isBuy bool) {
+func (s *MarketSimulator) ProcessTransaction(stockID int, quantity float64, isBuy bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	stock, exists := s.stocksInfo[stockID]
-	if !exists {
+	if !exists || stock.isHalted(s.clock.Now()) {
 		return
 	}
 
@@ -192,11 +448,11 @@ func (s *MarketSimulator) ProcessTransaction(stockID int, quantity int, isBuy bo
 	// Impact depends on quantity, current price, and is amplified by current trend
 
 	// Base impact factor - higher than before for more dramatic changes
-	impactFactor := 0.0005 * float64(quantity) // 0.05% per share
+	impactFactor := 0.0005 * quantity // 0.05% per share
 
 	// For larger transactions, apply diminishing returns (sqrt scaling)
 	if quantity > 100 {
-		impactFactor = 0.0005 * (100 + math.Sqrt(float64(quantity-100)))
+		impactFactor = 0.0005 * (100 + math.Sqrt(quantity-100))
 	}
 
 	// Reverse the direction for sells
@@ -211,13 +467,11 @@ func (s *MarketSimulator) ProcessTransaction(stockID int, quantity int, isBuy bo
 	}
 
 	// Calculate new price
-	newPrice := stock.BasePrice * (1 + impactFactor)
-	if newPrice < 0.01 {
-		newPrice = 0.01
-	}
+	tradePrice := stock.BasePrice
+	newPrice := money.Max(stock.BasePrice.MulRate(1+impactFactor), money.Cent)
 
-	// Round to 2 decimal places
-	newPrice = math.Round(newPrice*100) / 100
+	// Stop at the edge of the stock's band
+	newPrice = s.applyBands(&stock, newPrice, s.clock.Now())
 
 	// Update the base price
 	stock.BasePrice = newPrice
@@ -228,14 +482,15 @@ func (s *MarketSimulator) ProcessTransaction(stockID int, quantity int, isBuy bo
 	stock.Trend += trendAdjustment
 
 	// Cap the trend to prevent extreme values
-	const maxTrend = 0.1
 	if stock.Trend > maxTrend {
 		stock.Trend = maxTrend
 	} else if stock.Trend < -maxTrend {
 		stock.Trend = -maxTrend
 	}
 
-	s.stocksInfo[stockID] = stock
+	// Count the shares towards the volume of the next update and the interval's order flow
+	stock.PendingVolume += quantity
+	s.recordTrade(stockID, quantity, tradePrice, isBuy, s.clock.Now())
 
 	// Send the update
 	select {
@@ -243,8 +498,13 @@ func (s *MarketSimulator) ProcessTransaction(stockID int, quantity int, isBuy bo
 		StockID: stockID,
 		Symbol:  stock.Symbol,
 		Price:   newPrice,
+		Volume:  stock.PendingVolume,
+		Time:    s.clock.Now(),
 	}:
+		stock.PendingVolume = 0
 	default:
 		// Channel is full, skip this update
 	}
+
+	s.stocksInfo[stockID] = stock
 }
\ No newline at end of file
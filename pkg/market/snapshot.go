@@ -0,0 +1,132 @@
+package market
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// countingSource is a seeded random source that counts how many numbers it has produced,
+// so its state can be saved as the seed and the count and restored by replaying the count.
+// Snapshots reseed it, so the count only covers the draws since the last snapshot.
+type countingSource struct {
+	src   rand.Source64
+	draws uint64
+}
+
+// newCountingSource creates a counting source from a seed
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (c *countingSource) Int63() int64 {
+	c.draws++
+	return c.src.Int63()
+}
+
+func (c *countingSource) Uint64() uint64 {
+	c.draws++
+	return c.src.Uint64()
+}
+
+func (c *countingSource) Seed(seed int64) {
+	c.src.Seed(seed)
+	c.draws = 0
+}
+
+// skip advances the source by n draws
+func (c *countingSource) skip(n uint64) {
+	for ; n > 0; n-- {
+		c.Uint64()
+	}
+}
+
+// Snapshot is everything the simulator needs to carry on where it left off
+type Snapshot struct {
+	Seed         int64                  `json:"seed"`
+	Draws        uint64                 `json:"draws"` // Random numbers drawn since the seed was set; 0 for snapshots reseeded when taken
+	Stocks       map[int]StockInfo      `json:"stocks"`
+	SectorParams map[string]ModelParams `json:"sector_params"`
+	TakenAt      time.Time              `json:"taken_at"`
+}
+
+// Snapshot captures the simulator's state: every stock's trend, news momentum, halt
+// and price band, its price model and the state of the random number generator.
+// The generator is reseeded from its own next number, so restoring never has to replay
+// more than the draws since the last snapshot, however long the simulator has run.
+func (s *MarketSimulator) Snapshot() *Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seed = s.rng.Int63()
+	s.source = newCountingSource(s.seed)
+	s.rng = rand.New(s.source)
+
+	snapshot := &Snapshot{
+		Seed:         s.seed,
+		Draws:        s.source.draws,
+		Stocks:       make(map[int]StockInfo, len(s.stocksInfo)),
+		SectorParams: make(map[string]ModelParams, len(s.sectorParams)),
+		TakenAt:      s.clock.Now(),
+	}
+	for id, info := range s.stocksInfo {
+		if info.Params != nil {
+			params := *info.Params
+			info.Params = &params
+		}
+		if info.Halt != nil {
+			halt := *info.Halt
+			info.Halt = &halt
+		}
+		snapshot.Stocks[id] = info
+	}
+	for sector, params := range s.sectorParams {
+		snapshot.SectorParams[sector] = params
+	}
+
+	return snapshot
+}
+
+// Restore carries on from a snapshot. Stocks must already have been added; their
+// prices, symbols and sectors are kept, and stocks missing from the snapshot keep
+// their fresh state. The random number generator continues exactly where it was.
+func (s *MarketSimulator) Restore(snapshot *Snapshot) error {
+	if snapshot == nil {
+		return errors.New("no snapshot to restore")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, saved := range snapshot.Stocks {
+		info, exists := s.stocksInfo[id]
+		if !exists {
+			continue
+		}
+
+		info.Trend = saved.Trend
+		info.TrendCounter = saved.TrendCounter
+		info.PendingVolume = saved.PendingVolume
+		info.InitialPrice = saved.InitialPrice
+		info.Params = saved.Params
+		info.Betas = saved.Betas
+		info.Momentum = saved.Momentum
+		info.Halt = saved.Halt
+		info.BandReference = saved.BandReference
+		info.BandSetAt = saved.BandSetAt
+		info.Variance = saved.Variance
+		s.stocksInfo[id] = info
+	}
+
+	s.sectorParams = make(map[string]ModelParams, len(snapshot.SectorParams))
+	for sector, params := range snapshot.SectorParams {
+		s.sectorParams[sector] = params
+	}
+
+	s.source = newCountingSource(snapshot.Seed)
+	s.source.skip(snapshot.Draws)
+	s.rng = rand.New(s.source)
+	s.seed = snapshot.Seed
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package market
+
+import (
+	"errors"
+	"time"
+
+	"officestonks/pkg/money"
+)
+
+// FlowConfig controls how trading volume is tracked and how order flow moves prices
+type FlowConfig struct {
+	Interval   time.Duration // Period the volume stats cover
+	FlowWindow time.Duration // Period of recent trades whose imbalance pushes the trend
+	FlowWeight float64       // Extra return per tick when every recent trade was a buy (or, negated, a sell); 0 ignores order flow
+}
+
+// DefaultFlowConfig returns the volume settings used unless overridden
+func DefaultFlowConfig() FlowConfig {
+	return FlowConfig{
+		Interval:   time.Hour,
+		FlowWindow: time.Minute,
+		FlowWeight: 0.001,
+	}
+}
+
+// Validate checks that a flow config's periods can hold trades
+func (c FlowConfig) Validate() error {
+	if c.Interval <= 0 || c.FlowWindow <= 0 {
+		return errors.New("interval and flow window must be positive")
+	}
+	if c.FlowWindow > c.Interval {
+		return errors.New("flow window cannot be longer than the interval")
+	}
+	return nil
+}
+
+// VolumeStats sums up a stock's trading over the last interval
+type VolumeStats struct {
+	Volume       float64     `json:"volume"`        // Shares traded
+	DollarVolume money.Money `json:"dollar_volume"` // Value of the shares traded
+	BuyVolume    float64     `json:"buy_volume"`
+	SellVolume   float64     `json:"sell_volume"`
+	Imbalance    float64     `json:"imbalance"` // (buys - sells) / volume, from -1 (all sells) to 1 (all buys)
+	Trades       int         `json:"trades"`
+}
+
+// flowTrade is one trade in a stock's recent order flow
+type flowTrade struct {
+	time     time.Time
+	quantity float64
+	price    money.Money
+	isBuy    bool
+}
+
+// SetFlowConfig sets how volume is tracked and how order flow moves prices
+func (s *MarketSimulator) SetFlowConfig(cfg FlowConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.flowConfig = cfg
+	return nil
+}
+
+// GetVolumeStats returns a stock's volume over the last interval
+func (s *MarketSimulator) GetVolumeStats(stockID int) VolumeStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.volumeStats(stockID, s.flowConfig.Interval, s.clock.Now())
+}
+
+// GetAllVolumeStats returns every stock's volume over the last interval, by stock ID
+func (s *MarketSimulator) GetAllVolumeStats() map[int]VolumeStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	stats := make(map[int]VolumeStats, len(s.stocksInfo))
+	for id := range s.stocksInfo {
+		stats[id] = s.volumeStats(id, s.flowConfig.Interval, now)
+	}
+	return stats
+}
+
+// recordTrade adds a trade to a stock's order flow, dropping trades older than the interval.
+// The caller must hold the lock.
+func (s *MarketSimulator) recordTrade(stockID int, quantity float64, price money.Money, isBuy bool, now time.Time) {
+	trades := append(s.flows[stockID], flowTrade{now, quantity, price, isBuy})
+
+	start := 0
+	for start < len(trades) && now.Sub(trades[start].time) > s.flowConfig.Interval {
+		start++
+	}
+	s.flows[stockID] = trades[start:]
+}
+
+// volumeStats sums a stock's trades within the period before now. The caller must hold the lock.
+func (s *MarketSimulator) volumeStats(stockID int, period time.Duration, now time.Time) VolumeStats {
+	var stats VolumeStats
+	for _, trade := range s.flows[stockID] {
+		if now.Sub(trade.time) > period {
+			continue
+		}
+
+		stats.Volume += trade.quantity
+		stats.DollarVolume += trade.price.Mul(trade.quantity)
+		stats.Trades++
+		if trade.isBuy {
+			stats.BuyVolume += trade.quantity
+		} else {
+			stats.SellVolume += trade.quantity
+		}
+	}
+
+	if stats.Volume > 0 {
+		stats.Imbalance = (stats.BuyVolume - stats.SellVolume) / stats.Volume
+	}
+	return stats
+}
+
+// flowReturn is the extra return recent order flow adds to a stock this tick. The caller must hold the lock.
+func (s *MarketSimulator) flowReturn(stockID int, now time.Time) float64 {
+	if s.flowConfig.FlowWeight == 0 {
+		return 0
+	}
+	return s.flowConfig.FlowWeight * s.volumeStats(stockID, s.flowConfig.FlowWindow, now).Imbalance
+}
@@ -0,0 +1,252 @@
+// Package money holds amounts of dollars as a whole number of cents, so cash
+// balances and trade values add up exactly instead of drifting with float rounding.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of dollars counted in cents. Arithmetic between amounts is
+// exact; anything that multiplies by a fraction rounds to the nearest cent, with
+// halves rounded away from zero as MySQL does for DECIMAL columns.
+type Money int64
+
+// Common amounts
+const (
+	Cent   Money = 1
+	Dollar Money = 100
+)
+
+// shareScale is how many parts a share quantity is counted in, matching the
+// six decimal places quantities are stored with
+const shareScale = 1_000_000
+
+// FromFloat converts a dollar amount to Money, rounding to the nearest cent.
+// The float is rounded as its shortest decimal form, so 1.005 becomes 1.01.
+func FromFloat(f float64) Money {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	m, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Money(roundHalfAway(f * 100))
+	}
+	return m
+}
+
+// Parse reads a decimal dollar amount such as "12.34" or "-0.5", rounding to the nearest cent
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	str := s
+	negative := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		negative, str = true, str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	whole, frac, _ := strings.Cut(str, ".")
+	if whole == "" && frac == "" || !digits(whole) || !digits(frac) {
+		// Exponents and the like go through float parsing
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		return Money(roundHalfAway(f * 100)), nil
+	}
+
+	var cents int64
+	for _, c := range whole {
+		cents = cents*10 + int64(c-'0')
+		if cents > math.MaxInt64/1000 {
+			return 0, fmt.Errorf("amount %q is out of range", s)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		cents *= 10
+		if i < len(frac) {
+			cents += int64(frac[i] - '0')
+		}
+	}
+	if len(frac) > 2 && frac[2] >= '5' {
+		cents++
+	}
+
+	if negative {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+// digits reports whether s is made up only of decimal digits
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// roundHalfAway rounds f to a whole number, halves away from zero
+func roundHalfAway(f float64) int64 {
+	return int64(math.Round(f))
+}
+
+// Float returns the amount in dollars, for maths that is inexact anyway such as
+// ratios, volatility and option pricing
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Cents returns the amount as a whole number of cents
+func (m Money) Cents() int64 {
+	return int64(m)
+}
+
+// Mul returns the value of quantity shares at m each, rounded to the nearest cent.
+// Quantities are taken to the millionth of a share, and the product is exact before rounding.
+func (m Money) Mul(quantity float64) Money {
+	units := big.NewInt(roundHalfAway(quantity * shareScale))
+	product := units.Mul(units, big.NewInt(int64(m)))
+
+	scale := big.NewInt(shareScale)
+	quo, rem := new(big.Int).QuoRem(product, scale, new(big.Int))
+	if rem.Sign() != 0 && new(big.Int).Abs(rem).Cmp(new(big.Int).Rsh(scale, 1)) >= 0 {
+		quo.Add(quo, big.NewInt(int64(rem.Sign())))
+	}
+	return Money(quo.Int64())
+}
+
+// MulRate returns m scaled by a rate such as a commission percentage or an
+// interest rate, rounded to the nearest cent
+func (m Money) MulRate(rate float64) Money {
+	return FromFloat(m.Float() * rate)
+}
+
+// Abs returns the amount without its sign
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// Min returns the smaller of two amounts
+func Min(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of two amounts
+func Max(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// String formats the amount in dollars with two decimal places, such as "-12.30"
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+	}
+	// Work in uint64 so the most negative amount doesn't overflow
+	abs := uint64(cents)
+	if cents < 0 {
+		abs = uint64(-(cents + 1)) + 1
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimal places
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or a quoted decimal string, rounding to the nearest cent
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the amount as a decimal string, which MySQL converts to DECIMAL without loss
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a DECIMAL column, or the result of arithmetic on one
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		parsed, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case string:
+		parsed, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case float64:
+		*m = FromFloat(v)
+	case int64:
+		*m = Money(v) * Dollar
+	case nil:
+		return errors.New("cannot scan NULL into Money")
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+// NullMoney is an amount that may be NULL in the database
+type NullMoney struct {
+	Money Money
+	Valid bool // Valid is true if Money is not NULL
+}
+
+// Scan reads a nullable DECIMAL column
+func (n *NullMoney) Scan(src interface{}) error {
+	if src == nil {
+		n.Money, n.Valid = 0, false
+		return nil
+	}
+	n.Valid = true
+	return n.Money.Scan(src)
+}
+
+// Value stores the amount, or NULL if it isn't valid
+func (n NullMoney) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Money.Value()
+}
@@ -7,6 +7,9 @@ CREATE TABLE users (
   password_hash VARCHAR(255) NOT NULL,
   cash_balance DECIMAL(15,2) DEFAULT 10000.00,
   is_admin BOOLEAN DEFAULT FALSE,
+  margin_enabled BOOLEAN DEFAULT FALSE,
+  loan_balance DECIMAL(15,2) DEFAULT 0.00,
+  cost_basis_method VARCHAR(10) DEFAULT 'fifo',
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
@@ -18,33 +21,324 @@ CREATE TABLE stocks (
   name VARCHAR(100) NOT NULL,
   sector VARCHAR(50),
   current_price DECIMAL(10,2) NOT NULL,
+  model_params TEXT NULL,
+  market_beta DECIMAL(6,3) NOT NULL DEFAULT 1.000,
+  sector_beta DECIMAL(6,3) NOT NULL DEFAULT 1.000,
+  status VARCHAR(20) NOT NULL DEFAULT 'listed',
+  instrument_type VARCHAR(10) NOT NULL DEFAULT 'stock',
   last_updated TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Sector Models Table (price model shared by the stocks in a sector that don't have their own)
+CREATE TABLE sector_models (
+  sector VARCHAR(50) PRIMARY KEY,
+  model_params TEXT NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
 -- User Portfolios Table
 CREATE TABLE portfolios (
   id INT PRIMARY KEY AUTO_INCREMENT,
   user_id INT NOT NULL,
   stock_id INT NOT NULL,
-  quantity INT NOT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
   FOREIGN KEY (user_id) REFERENCES users(id),
   FOREIGN KEY (stock_id) REFERENCES stocks(id),
   UNIQUE KEY unique_user_stock (user_id, stock_id)
 );
 
+-- Short Positions Table (borrowed shares that have been sold and must be bought back)
+CREATE TABLE short_positions (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  stock_id INT NOT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
+  entry_price DECIMAL(10,2) NOT NULL,
+  opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  UNIQUE KEY unique_user_short (user_id, stock_id)
+);
+
+-- Tax Lots Table (shares bought in each trade, used up by sales according to the user's cost basis method)
+CREATE TABLE tax_lots (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  stock_id INT NOT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
+  original_quantity DECIMAL(18,6) NOT NULL,
+  cost_per_share DECIMAL(12,2) NOT NULL,
+  transaction_id INT NULL,
+  acquired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_tax_lots_user_stock (user_id, stock_id)
+);
+
 -- Transactions Table
 CREATE TABLE transactions (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  stock_id INT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
+  price DECIMAL(10,2) NOT NULL,
+  transaction_type VARCHAR(20) NOT NULL,
+  order_id INT NULL,
+  fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  realized_pnl DECIMAL(12,2) NULL,
+  option_id INT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id)
+);
+
+-- Orders Table (resting limit and conditional orders)
+CREATE TABLE orders (
   id INT PRIMARY KEY AUTO_INCREMENT,
   user_id INT NOT NULL,
   stock_id INT NOT NULL,
-  quantity INT NOT NULL,
+  side ENUM('buy', 'sell') NOT NULL,
+  order_type VARCHAR(20) NOT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
+  limit_price DECIMAL(10,2) NOT NULL,
+  reserved_fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  status VARCHAR(20) NOT NULL DEFAULT 'open',
+  filled_price DECIMAL(10,2) NULL,
+  stop_price DECIMAL(10,2) NULL,
+  trail_amount DECIMAL(10,2) NULL,
+  trail_percent DECIMAL(5,2) NULL,
+  high_water_mark DECIMAL(10,2) NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_orders_stock_status (stock_id, status),
+  INDEX idx_orders_user_status (user_id, status)
+);
+
+-- Fee Schedules Table (the newest row is the active commission schedule)
+CREATE TABLE fee_schedules (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  fee_type VARCHAR(20) NOT NULL,
+  flat_fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  per_share DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  percent DECIMAL(6,4) NOT NULL DEFAULT 0.0000,
+  tiers TEXT NULL,
+  min_fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  max_fee DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Price Ticks Table (every simulated price, kept for history)
+CREATE TABLE price_ticks (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT NOT NULL,
   price DECIMAL(10,2) NOT NULL,
-  transaction_type ENUM('buy', 'sell') NOT NULL,
+  volume DECIMAL(18,6) NOT NULL DEFAULT 0,
+  created_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_price_ticks_stock_time (stock_id, created_at)
+);
+
+-- Price Candles Table (open/high/low/close and volume for each stock per interval)
+CREATE TABLE price_candles (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT NOT NULL,
+  candle_interval VARCHAR(5) NOT NULL,
+  bucket_start TIMESTAMP NOT NULL,
+  open DECIMAL(10,2) NOT NULL,
+  high DECIMAL(10,2) NOT NULL,
+  low DECIMAL(10,2) NOT NULL,
+  close DECIMAL(10,2) NOT NULL,
+  volume DECIMAL(24,6) NOT NULL DEFAULT 0,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  UNIQUE KEY unique_stock_interval_bucket (stock_id, candle_interval, bucket_start)
+);
+
+-- Market Events Table (news that moved the prices of a stock, a sector or the whole market)
+CREATE TABLE market_events (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  scope VARCHAR(10) NOT NULL,
+  stock_id INT NULL,
+  sector VARCHAR(50) NULL,
+  headline VARCHAR(255) NOT NULL,
+  price_impact DECIMAL(6,4) NOT NULL,
+  trend_impact DECIMAL(6,4) NOT NULL DEFAULT 0.0000,
+  source VARCHAR(20) NOT NULL,
+  created_by INT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_market_events_created (created_at)
+);
+
+-- Simulator Snapshots Table (the market simulator's state, so it carries on across restarts)
+CREATE TABLE simulator_snapshots (
+  id INT PRIMARY KEY,
+  state MEDIUMTEXT NOT NULL,
+  saved_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Corporate Actions Table (dividends and splits declared on stocks)
+CREATE TABLE corporate_actions (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT NOT NULL,
+  action_type VARCHAR(20) NOT NULL,
+  amount DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+  split_to INT NOT NULL DEFAULT 0,
+  split_from INT NOT NULL DEFAULT 0,
+  ex_date TIMESTAMP NOT NULL,
+  pay_date TIMESTAMP NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'declared',
+  source VARCHAR(20) NOT NULL,
+  created_by INT NULL,
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_corporate_actions_status (status, ex_date)
+);
+
+-- Dividend Entitlements Table (what each holder is owed, or short seller owes, fixed on the ex date)
+CREATE TABLE dividend_entitlements (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  action_id INT NOT NULL,
+  user_id INT NOT NULL,
+  quantity DECIMAL(18,6) NOT NULL,
+  amount DECIMAL(12,2) NOT NULL,
+  paid_at TIMESTAMP NULL,
+  FOREIGN KEY (action_id) REFERENCES corporate_actions(id),
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  INDEX idx_dividend_entitlements_action (action_id)
+);
+
+-- IPOs Table (new listings taking subscriptions before they trade)
+CREATE TABLE ipos (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT UNIQUE NOT NULL,
+  float_shares INT NOT NULL,
+  ipo_price DECIMAL(10,2) NOT NULL,
+  opens_at TIMESTAMP NOT NULL,
+  closes_at TIMESTAMP NOT NULL,
+  status VARCHAR(20) NOT NULL DEFAULT 'open',
+  created_by INT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_ipos_status (status, closes_at)
+);
+
+-- IPO Subscriptions Table (shares each user has requested in an IPO, and what they were allocated)
+CREATE TABLE ipo_subscriptions (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  ipo_id INT NOT NULL,
+  user_id INT NOT NULL,
+  quantity INT NOT NULL,
+  allocated INT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (ipo_id) REFERENCES ipos(id),
   FOREIGN KEY (user_id) REFERENCES users(id),
+  UNIQUE KEY unique_ipo_user (ipo_id, user_id)
+);
+
+-- Stock Fundamentals Table (simulated company figures behind each stock, updated by earnings reports)
+CREATE TABLE stock_fundamentals (
+  stock_id INT PRIMARY KEY,
+  shares_outstanding BIGINT NOT NULL,
+  eps DECIMAL(12,4) NOT NULL,
+  revenue DECIMAL(20,2) NOT NULL,
+  fiscal_year INT NOT NULL,
+  fiscal_quarter INT NOT NULL,
+  next_earnings_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_stock_fundamentals_next (next_earnings_at)
+);
+
+-- Earnings Reports Table (each quarter's results against expectations)
+CREATE TABLE earnings_reports (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT NOT NULL,
+  fiscal_year INT NOT NULL,
+  fiscal_quarter INT NOT NULL,
+  eps DECIMAL(12,4) NOT NULL,
+  expected_eps DECIMAL(12,4) NOT NULL,
+  revenue DECIMAL(20,2) NOT NULL,
+  expected_revenue DECIMAL(20,2) NOT NULL,
+  surprise DECIMAL(8,4) NOT NULL,
+  price_impact DECIMAL(8,4) NOT NULL DEFAULT 0.0000,
+  reported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  UNIQUE KEY unique_stock_quarter (stock_id, fiscal_year, fiscal_quarter)
+);
+
+-- Index History Table (composite and sector index levels, one row per index per simulator tick)
+CREATE TABLE index_history (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  code VARCHAR(50) NOT NULL,
+  value DECIMAL(14,2) NOT NULL,
+  recorded_at TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+  INDEX idx_index_history_code_time (code, recorded_at)
+);
+
+-- ETFs Table (instruments whose price is the value of a basket of other stocks)
+CREATE TABLE etfs (
+  stock_id INT PRIMARY KEY,
+  cash DECIMAL(16,2) NOT NULL DEFAULT 0.00,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
   FOREIGN KEY (stock_id) REFERENCES stocks(id)
 );
 
+-- ETF Constituents Table (shares of each stock behind one share of an ETF)
+CREATE TABLE etf_constituents (
+  etf_id INT NOT NULL,
+  stock_id INT NOT NULL,
+  units DECIMAL(18,8) NOT NULL,
+  PRIMARY KEY (etf_id, stock_id),
+  FOREIGN KEY (etf_id) REFERENCES etfs(stock_id),
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  INDEX idx_etf_constituents_stock (stock_id)
+);
+
+-- Option Contracts Table (listed calls and puts on stocks)
+CREATE TABLE option_contracts (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  stock_id INT NOT NULL,
+  option_type VARCHAR(4) NOT NULL,
+  strike DECIMAL(10,2) NOT NULL,
+  shares INT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  status VARCHAR(10) NOT NULL DEFAULT 'active',
+  settlement_price DECIMAL(10,2) NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (stock_id) REFERENCES stocks(id),
+  UNIQUE KEY uniq_option_contract (stock_id, option_type, strike, expires_at),
+  INDEX idx_option_contracts_status_expiry (status, expires_at)
+);
+
+-- Option Positions Table (contracts users hold)
+CREATE TABLE option_positions (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  contract_id INT NOT NULL,
+  quantity INT NOT NULL,
+  average_cost DECIMAL(12,2) NOT NULL,
+  opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id),
+  FOREIGN KEY (contract_id) REFERENCES option_contracts(id),
+  UNIQUE KEY uniq_option_position (user_id, contract_id)
+);
+
+-- Ledger Entries Table (double-entry postings for every cash movement; balances are derived from them)
+CREATE TABLE ledger_entries (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  debit_account VARCHAR(30) NOT NULL,
+  credit_account VARCHAR(30) NOT NULL,
+  amount DECIMAL(15,2) NOT NULL,
+  transaction_id INT NULL,
+  memo VARCHAR(255) NULL,
+  created_by INT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  INDEX idx_ledger_user (user_id)
+);
+
 -- Chat Messages Table
 CREATE TABLE chat_messages (
   id INT PRIMARY KEY AUTO_INCREMENT,